@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/backup"
+	"github.com/AuraReaper/strangedb/internal/config"
+)
+
+// snapshots every node of a running cluster into a backup directory,
+// either in full or, with --parent, only what changed since that backup
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	nodes := fs.String("nodes", "", "comma separated HTTP addresses of every node, e.g. localhost:9000,localhost:9010")
+	dir := fs.String("out", "", "directory to write the backup to")
+	parent := fs.String("parent", "", "previous backup to take an incremental backup on top of")
+	overlap := fs.Duration("overlap", backup.DefaultOverlap, "how far before --parent the incremental backup starts, for writes that arrived late")
+	token := fs.String("token", os.Getenv("STRANGEDB_TOKEN"), "API token of an admin role, for clusters with auth")
+	fs.Parse(args)
+
+	if *nodes == "" || *dir == "" {
+		return errors.New("--nodes and --out are required")
+	}
+
+	start := time.Now()
+
+	manifest, err := backup.Run(context.Background(), backup.Options{
+		Nodes:   splitList(*nodes),
+		Dir:     *dir,
+		Parent:  *parent,
+		Overlap: *overlap,
+		Token:   *token,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range manifest.Snapshots {
+		fmt.Printf("%-12s %8d records %6d tombstones %6d chunks %10d bytes\n",
+			s.NodeID, s.Stats.Records, s.Stats.Tombstones, s.Stats.Chunks, s.Bytes)
+	}
+	fmt.Printf("%s backup at %s written to %s in %s\n",
+		manifest.Type, manifest.At, *dir, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// loads a backup, and the chain it builds on, into the data directories
+// of a new, stopped cluster
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dir := fs.String("backup", "", "backup directory, full or the last incremental of a chain")
+	nodes := fs.String("nodes", "", "comma separated ring addresses of the target nodes, e.g. localhost:9001,localhost:9011; omit to restore into a single directory")
+	dataDirs := fs.String("data-dirs", "", "comma separated data directories, one per target node")
+	replicationN := fs.Int("n", 3, "replication factor of the target cluster")
+	vnodes := fs.Int("v-nodes", 0, "virtual nodes of the target cluster (default: as backed up)")
+	partitioner := fs.String("partitioner", "", "partitioner of the target cluster (default: as backed up)")
+	weights := fs.String("weights", "", "weights of target nodes other than 1, e.g. localhost:9001=2 (default: as backed up)")
+	keyFile := fs.String("encryption-key-file", os.Getenv("ENCRYPTION_KEY_FILE"), "AES key to encrypt the data directories with, ENCRYPTION_KEY without one")
+	fs.Parse(args)
+
+	if *dir == "" || *dataDirs == "" {
+		return errors.New("--backup and --data-dirs are required")
+	}
+
+	key, err := loadEncryptionKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	stats, err := backup.Restore(*dir, backup.RestoreOptions{
+		Nodes:         splitList(*nodes),
+		DataDirs:      splitList(*dataDirs),
+		ReplicationN:  *replicationN,
+		VNodes:        *vnodes,
+		Partitioner:   *partitioner,
+		Weights:       parseWeights(*weights),
+		EncryptionKey: key,
+	})
+	if err != nil {
+		return err
+	}
+
+	targets := make([]string, 0, len(stats.Written))
+	for node := range stats.Written {
+		targets = append(targets, node)
+	}
+	sort.Strings(targets)
+
+	for _, node := range targets {
+		fmt.Printf("%-20s %8d entries\n", node, stats.Written[node])
+	}
+	fmt.Printf("restored %d entries from %d snapshots of %d backups in %s\n",
+		stats.Entries, stats.Snapshots, stats.Backups, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// nil for an empty flag, so the default applies
+func parseWeights(s string) map[string]float64 {
+	if s == "" {
+		return nil
+	}
+	return config.ParseWeights(s)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+// the key of the data directories an offline command opens, from the
+// file or, like the node, from ENCRYPTION_KEY
+func loadEncryptionKey(path string) ([]byte, error) {
+	return storage.LoadEncryptionKey(path, os.Getenv("ENCRYPTION_KEY"))
+}
+
+// re-encrypts a stopped node's data keys with a new master key. without
+// --old-key-file a plaintext directory is encrypted
+func runRotateKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	dataDir := fs.String("data-dir", "", "data directory of a stopped node")
+	oldKeyFile := fs.String("old-key-file", "", "file with the current key, omit for a plaintext directory")
+	newKeyFile := fs.String("new-key-file", "", "file with the new key")
+	fs.Parse(args)
+
+	if *dataDir == "" || *newKeyFile == "" {
+		return errors.New("--data-dir and --new-key-file are required")
+	}
+
+	oldKey, err := storage.LoadEncryptionKey(*oldKeyFile, "")
+	if err != nil {
+		return err
+	}
+	newKey, err := storage.LoadEncryptionKey(*newKeyFile, "")
+	if err != nil {
+		return err
+	}
+
+	if err := storage.RotateEncryptionKey(*dataDir, oldKey, newKey); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is now encrypted with %s\n", *dataDir, *newKeyFile)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/bulk"
+	"github.com/AuraReaper/strangedb/internal/config"
+	"github.com/AuraReaper/strangedb/internal/loader"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+// builds per-node stream files from a JSONL or CSV file for a new,
+// stopped cluster and, given --data-dirs, ingests them right away
+func runLoad(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	in := fs.String("in", "", "file to load")
+	format := fs.String("format", bulk.FormatJSONL, "input format, jsonl or csv")
+	nodes := fs.String("nodes", "", "comma separated ring addresses of the target nodes, e.g. localhost:9001,localhost:9011")
+	replicationN := fs.Int("n", 3, "replication factor of the target cluster")
+	vnodes := fs.Int("v-nodes", 150, "virtual nodes of the target cluster")
+	partitioner := fs.String("partitioner", "md5", "partitioner of the target cluster (md5/xxhash/murmur3/ordered)")
+	weights := fs.String("weights", "", "weights of target nodes other than 1, e.g. localhost:9001=2")
+	dir := fs.String("out", "", "directory for the stream files")
+	dataDirs := fs.String("data-dirs", "", "comma separated data directories, one per node, to ingest into after building")
+	preserve := fs.Bool("preserve-timestamps", false, "write records with the timestamps in the input")
+	compression := fs.String("compression", "none", "default value compression of the target cluster (none/snappy/zstd)")
+	namespaces := fs.String("compression-namespaces", "", "per-namespace compression, e.g. docs=zstd,cache=none")
+	memory := fs.Int("memory-mb", loader.DefaultMemory>>20, "input sorted in memory before spilling to disk")
+	verify := fs.Bool("verify", true, "record merkle roots and check them after ingesting")
+	keyFile := fs.String("encryption-key-file", os.Getenv("ENCRYPTION_KEY_FILE"), "AES key to encrypt the data directories with, ENCRYPTION_KEY without one")
+	fs.Parse(args)
+
+	if *in == "" || *nodes == "" || *dir == "" {
+		return errors.New("--in, --nodes and --out are required")
+	}
+
+	policy, err := storage.NewCompressionPolicy(*compression, config.ParseKeyValues(*namespaces))
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	manifest, err := loader.Build(loader.Options{
+		Input:              *in,
+		Format:             *format,
+		Nodes:              splitList(*nodes),
+		ReplicationN:       *replicationN,
+		VNodes:             *vnodes,
+		Partitioner:        *partitioner,
+		Weights:            parseWeights(*weights),
+		Dir:                *dir,
+		PreserveTimestamps: *preserve,
+		Compression:        policy,
+		Memory:             *memory << 20,
+		Verify:             *verify,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range manifest.Streams {
+		fmt.Printf("%-20s %10d records %12d bytes  %s\n", s.Node, s.Records, s.Bytes, s.File)
+	}
+	fmt.Printf("built stream files in %s in %s\n", *dir, time.Since(start).Round(time.Millisecond))
+
+	if *dataDirs == "" {
+		return nil
+	}
+	return ingestLoad(*dir, manifest.Nodes, splitList(*dataDirs), *keyFile)
+}
+
+// ingests stream files built by load, e.g. on each node's own host
+func runIngest(args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
+	dir := fs.String("load", "", "directory written by strangedb load")
+	nodes := fs.String("nodes", "", "comma separated nodes to ingest (default: all in the load)")
+	dataDirs := fs.String("data-dirs", "", "comma separated empty data directories, one per node")
+	keyFile := fs.String("encryption-key-file", os.Getenv("ENCRYPTION_KEY_FILE"), "AES key to encrypt the data directories with, ENCRYPTION_KEY without one")
+	fs.Parse(args)
+
+	if *dir == "" || *dataDirs == "" {
+		return errors.New("--load and --data-dirs are required")
+	}
+
+	return ingestLoad(*dir, splitList(*nodes), splitList(*dataDirs), *keyFile)
+}
+
+func ingestLoad(dir string, nodes, dataDirs []string, keyFile string) error {
+	key, err := loadEncryptionKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	results, err := loader.Ingest(dir, nodes, dataDirs, key)
+	for _, r := range results {
+		if r.Node == "" {
+			continue
+		}
+
+		status := "count checked"
+		if r.Verified {
+			status = "merkle root verified"
+		}
+		fmt.Printf("%-20s %10d records  %s\n", r.Node, r.Records, status)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("ingested in %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -8,7 +8,29 @@ import (
 	"github.com/AuraReaper/strangedb/internal/node"
 )
 
+// offline and operator tools, run as `strangedb <command> [flags]`
+var commands = map[string]func(args []string) error{
+	"migrate":    runMigrate,
+	"backup":     runBackup,
+	"restore":    runRestore,
+	"export":     runExport,
+	"import":     runImport,
+	"load":       runLoad,
+	"ingest":     runIngest,
+	"rotate-key": runRotateKey,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	cfg := config.Load()
 
 	fmt.Printf("Starting StrangeDB node %s on port %d\n", cfg.NodeID, cfg.HTTPPort)
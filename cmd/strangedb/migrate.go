@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+// converts legacy JSON records to the binary format, either through a
+// running node (--url) or directly on a stopped node's data directory
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	url := fs.String("url", "", "HTTP address of a running node, e.g. http://localhost:9000")
+	dataDir := fs.String("data-dir", "", "data directory of a stopped node")
+	token := fs.String("token", os.Getenv("STRANGEDB_TOKEN"), "API token of an admin role, for nodes with auth")
+	keyFile := fs.String("encryption-key-file", os.Getenv("ENCRYPTION_KEY_FILE"), "AES key of an encrypted data directory, ENCRYPTION_KEY without one")
+	fs.Parse(args)
+
+	if (*url == "") == (*dataDir == "") {
+		return errors.New("exactly one of --url or --data-dir is required")
+	}
+
+	start := time.Now()
+
+	var stats storage.MigrationStats
+	var err error
+	if *url != "" {
+		stats, err = migrateOnline(*url, *token)
+	} else {
+		stats, err = migrateOffline(*dataDir, *keyFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("scanned %d records, migrated %d in %s\n",
+		stats.Scanned, stats.Migrated, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func migrateOnline(url, token string) (storage.MigrationStats, error) {
+	var stats storage.MigrationStats
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(url, "/")+"/admin/storage/migrate", nil)
+	if err != nil {
+		return stats, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return stats, fmt.Errorf("migration failed: %s", strings.TrimSpace(string(body)))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
+
+func migrateOffline(dataDir, keyFile string) (storage.MigrationStats, error) {
+	key, err := loadEncryptionKey(keyFile)
+	if err != nil {
+		return storage.MigrationStats{}, err
+	}
+
+	store := storage.NewBadgerStorage(dataDir)
+	store.SetEncryption(key, 0)
+	if err := store.Open(); err != nil {
+		return storage.MigrationStats{}, fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer store.Close()
+
+	return store.MigrateRecords()
+}
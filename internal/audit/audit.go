@@ -0,0 +1,502 @@
+// Package audit keeps a tamper-evident record of writes and admin
+// actions. entries live under their own badger prefix, numbered in the
+// order they were recorded, and each carries the hash of the one before
+// it, so editing or removing an entry breaks the chain after it.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/rs/zerolog"
+)
+
+// kept apart from the data, chunk and meta prefixes of the storage, so
+// scans and backups never see entries
+const entryPrefix = "a:"
+
+const OutcomeOK = "ok"
+
+// entries written in one transaction at most
+const maxBatch = 1000
+
+var ErrNotOpen = errors.New("audit log is not open")
+
+type Entry struct {
+	Seq uint64 `json:"seq"`
+	// from the authenticated caller, empty when auth is off
+	Principal string `json:"principal,omitempty"`
+	Operation string `json:"operation"`
+	Key       string `json:"key,omitempty"`
+	// of the write, or of when the action was recorded
+	Timestamp hlc.Timestamp `json:"timestamp"`
+	// the coordinating node
+	Node string `json:"node"`
+	// ok, or why the operation failed
+	Outcome  string `json:"outcome"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// the hash of the entry, covering every field but Hash
+func (e *Entry) computeHash() string {
+	unhashed := *e
+	unhashed.Hash = ""
+
+	data, _ := json.Marshal(&unhashed)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type principalKey struct{}
+
+// tags operations made with ctx with the caller that asked for them
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func principalFrom(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// entries are chained and written by one goroutine, which takes every
+// entry recorded while it wrote the last batch and writes them together,
+// so concurrent writers share a transaction instead of queueing for one
+type Log struct {
+	clock     *hlc.Clock
+	node      string
+	retention time.Duration
+	log       zerolog.Logger
+
+	mu      sync.Mutex
+	db      *badger.DB
+	pending []*pendingEntry
+	closed  bool
+	// the writer has entries to take
+	wake chan struct{}
+
+	// the head of the chain, owned by the writer once open
+	seq  uint64
+	last string
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// an entry waiting for its sequence number, hash and write
+type pendingEntry struct {
+	entry *Entry
+	done  chan error
+}
+
+// entries older than retention are pruned, 0 keeps them forever
+func NewLog(clock *hlc.Clock, node string, retention time.Duration, log zerolog.Logger) *Log {
+	return &Log{
+		clock:     clock,
+		node:      node,
+		retention: retention,
+		log:       log,
+		wake:      make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// starts appending to the chain stored in db
+func (l *Log) Open(db *badger.DB) error {
+	var last *Entry
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.Prefix = []byte(entryPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// the largest sequence number sorts last
+		it.Seek(entryKey(math.MaxUint64))
+		if !it.Valid() {
+			return nil
+		}
+
+		var err error
+		last, err = decodeEntry(it.Item())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrNotOpen
+	}
+	l.db = db
+	if last != nil {
+		l.seq = last.Seq
+		l.last = last.Hash
+	}
+
+	l.wg.Add(1)
+	go l.writeLoop(db)
+	return nil
+}
+
+func (l *Log) Start() {
+	if l.retention > 0 {
+		go l.pruneLoop()
+	}
+}
+
+// writes the entries already recorded; later ones fail with ErrNotOpen
+func (l *Log) Stop() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	close(l.stopCh)
+	l.wg.Wait()
+}
+
+func entryKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(entryPrefix), seq)
+}
+
+func decodeEntry(item *badger.Item) (*Entry, error) {
+	var entry Entry
+	err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &entry)
+	})
+	return &entry, err
+}
+
+// appends an entry for an operation made with ctx; a zero ts is
+// replaced by the current time. failures to record are logged, never
+// returned, so auditing cannot fail the operation itself
+func (l *Log) Record(ctx context.Context, operation, key string, ts hlc.Timestamp, opErr error) {
+	if err := l.record(principalFrom(ctx), operation, key, ts, opErr); err != nil {
+		l.log.Error().Err(err).Str("operation", operation).Str("key", key).Msg("failed to record audit entry")
+	}
+}
+
+// like Record, for callers that know the principal
+func (l *Log) RecordAs(principal, operation, key string, opErr error) {
+	if err := l.record(principal, operation, key, hlc.Timestamp{}, opErr); err != nil {
+		l.log.Error().Err(err).Str("operation", operation).Str("key", key).Msg("failed to record audit entry")
+	}
+}
+
+func (l *Log) record(principal, operation, key string, ts hlc.Timestamp, opErr error) error {
+	if ts.WallTime == 0 {
+		ts = l.clock.Now()
+	}
+
+	outcome := OutcomeOK
+	if opErr != nil {
+		outcome = opErr.Error()
+	}
+
+	p := &pendingEntry{
+		entry: &Entry{
+			Principal: principal,
+			Operation: operation,
+			Key:       key,
+			Timestamp: ts,
+			Node:      l.node,
+			Outcome:   outcome,
+		},
+		done: make(chan error, 1),
+	}
+
+	l.mu.Lock()
+	if l.db == nil || l.closed {
+		l.mu.Unlock()
+		return ErrNotOpen
+	}
+	l.pending = append(l.pending, p)
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	return <-p.done
+}
+
+// writes pending entries until Stop, then the ones left
+func (l *Log) writeLoop(db *badger.DB) {
+	defer l.wg.Done()
+
+	for {
+		select {
+		case <-l.wake:
+		case <-l.stopCh:
+		}
+
+		l.mu.Lock()
+		batch := l.pending
+		l.pending = nil
+		closed := l.closed
+		l.mu.Unlock()
+
+		for len(batch) > 0 {
+			n := min(len(batch), maxBatch)
+			l.write(db, batch[:n])
+			batch = batch[n:]
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// chains a batch of entries onto the head and writes them in one
+// transaction; on failure none of them is kept and the head stays put
+func (l *Log) write(db *badger.DB, batch []*pendingEntry) {
+	seq, last := l.seq, l.last
+	err := db.Update(func(txn *badger.Txn) error {
+		for _, p := range batch {
+			seq++
+			p.entry.Seq = seq
+			p.entry.PrevHash = last
+			p.entry.Hash = p.entry.computeHash()
+			last = p.entry.Hash
+
+			data, err := json.Marshal(p.entry)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(entryKey(seq), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		l.seq, l.last = seq, last
+	}
+
+	for _, p := range batch {
+		p.done <- err
+	}
+}
+
+// selects entries; empty fields match everything
+type Query struct {
+	// only entries after this sequence number
+	After     uint64
+	Limit     int
+	Principal string
+	Operation string
+	// keys starting with it
+	Prefix string
+}
+
+func (q *Query) matches(e *Entry) bool {
+	return (q.Principal == "" || e.Principal == q.Principal) &&
+		(q.Operation == "" || strings.EqualFold(e.Operation, q.Operation)) &&
+		strings.HasPrefix(e.Key, q.Prefix)
+}
+
+// returns up to q.Limit matching entries in order, and the sequence
+// number to pass as After for the next page, 0 at the end
+func (l *Log) List(q Query) ([]*Entry, uint64, error) {
+	db, err := l.database()
+	if err != nil {
+		return nil, 0, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+
+	var entries []*Entry
+	var next uint64
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(entryPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(entryKey(q.After + 1)); it.Valid(); it.Next() {
+			entry, err := decodeEntry(it.Item())
+			if err != nil {
+				return err
+			}
+			if !q.matches(entry) {
+				continue
+			}
+
+			if len(entries) == q.Limit {
+				next = entries[len(entries)-1].Seq
+				return nil
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+
+	return entries, next, err
+}
+
+type Verification struct {
+	OK      bool   `json:"ok"`
+	Entries int    `json:"entries"`
+	First   uint64 `json:"first,omitempty"`
+	Last    uint64 `json:"last,omitempty"`
+	// keep it elsewhere to also notice entries cut off the end later
+	LastHash string `json:"last_hash,omitempty"`
+	// the first entry that does not match its hash or its predecessor
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (v *Verification) fail(seq uint64, problem string) {
+	v.OK = false
+	v.BrokenAt = seq
+	v.Error = problem
+}
+
+// walks the chain from the oldest entry kept, checking every hash and
+// that sequence numbers have no gaps. entries before the oldest kept
+// one were pruned, so its own PrevHash is taken on trust
+func (l *Log) Verify() (*Verification, error) {
+	db, err := l.database()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Verification{OK: true}
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(entryPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		var prev *Entry
+		for it.Rewind(); it.Valid(); it.Next() {
+			k := it.Item().Key()
+			if len(k) != len(entryPrefix)+8 {
+				result.fail(0, fmt.Sprintf("unexpected key %q", k))
+				return nil
+			}
+			seq := binary.BigEndian.Uint64(k[len(entryPrefix):])
+
+			entry, err := decodeEntry(it.Item())
+			var problem string
+			switch {
+			case err != nil:
+				problem = "entry does not decode: " + err.Error()
+			case entry.Seq != seq:
+				problem = "sequence number does not match its key"
+			case entry.Hash != entry.computeHash():
+				problem = "hash does not match the entry"
+			case prev != nil && seq != prev.Seq+1:
+				problem = fmt.Sprintf("entries %d to %d are missing", prev.Seq+1, seq-1)
+			case prev != nil && entry.PrevHash != prev.Hash:
+				problem = "previous hash does not match the entry before"
+			}
+			if problem != "" {
+				result.fail(seq, problem)
+				return nil
+			}
+
+			if prev == nil {
+				result.First = entry.Seq
+			}
+			result.Last = entry.Seq
+			result.LastHash = entry.Hash
+			result.Entries++
+			prev = entry
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+func (l *Log) database() (*badger.DB, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return nil, ErrNotOpen
+	}
+	return l.db, nil
+}
+
+func (l *Log) pruneLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.prune(time.Now().Add(-l.retention)); err != nil {
+				l.log.Error().Err(err).Msg("failed to prune audit log")
+			}
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// deletes the oldest entries up to the first one recorded after before,
+// so what remains is still one unbroken chain. the newest entry is
+// always kept, it carries the chain on across restarts
+func (l *Log) prune(before time.Time) error {
+	db, err := l.database()
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(entryPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			entry, err := decodeEntry(it.Item())
+			if err != nil {
+				return err
+			}
+			if entry.Timestamp.WallTime >= before.UnixNano() {
+				return nil
+			}
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+
+		// every entry is old
+		keys = keys[:max(len(keys)-1, 0)]
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	batch := db.NewWriteBatch()
+	defer batch.Cancel()
+	for _, k := range keys {
+		if err := batch.Delete(k); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/rs/zerolog"
+)
+
+func openTestLog(t *testing.T) (*Log, *badger.DB) {
+	t.Helper()
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("Failed to open badger: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	l := NewLog(hlc.NewClock("node1"), "node1", 0, zerolog.Nop())
+	if err := l.Open(db); err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	t.Cleanup(l.Stop)
+	return l, db
+}
+
+func TestRecordAndList(t *testing.T) {
+	l, db := openTestLog(t)
+
+	ctx := WithPrincipal(context.Background(), "ci")
+	l.Record(ctx, "SET", "orders:1", hlc.Timestamp{}, nil)
+	l.Record(ctx, "DELETE", "orders:1", hlc.Timestamp{}, errors.New("quorum not reached"))
+	l.RecordAs("ops", "POST /admin/storage/migrate", "", nil)
+
+	entries, next, err := l.List(Query{})
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(entries) != 3 || next != 0 {
+		t.Fatalf("Expected 3 entries and no next page, got %d and %d", len(entries), next)
+	}
+	if entries[1].Principal != "ci" || entries[1].Outcome != "quorum not reached" || entries[1].Node != "node1" {
+		t.Errorf("Unexpected entry %+v", entries[1])
+	}
+	if entries[1].PrevHash != entries[0].Hash {
+		t.Error("Expected entries to be chained")
+	}
+
+	entries, next, _ = l.List(Query{Principal: "ci", Limit: 1})
+	if len(entries) != 1 || next != 1 {
+		t.Errorf("Expected one entry and next 1, got %d and %d", len(entries), next)
+	}
+
+	// a reopened log carries on the chain
+	l.Stop()
+	reopened := NewLog(hlc.NewClock("node1"), "node1", 0, zerolog.Nop())
+	if err := reopened.Open(db); err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Stop()
+	reopened.RecordAs("ops", "GET /admin/audit", "", nil)
+
+	v, err := reopened.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK || v.Entries != 4 || v.Last != 4 {
+		t.Errorf("Expected an intact chain of 4 entries, got %+v", v)
+	}
+}
+
+func TestConcurrentRecordsChain(t *testing.T) {
+	l, _ := openTestLog(t)
+
+	var wg sync.WaitGroup
+	for i := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.RecordAs("ci", "SET", fmt.Sprintf("k%d", i), nil)
+		}()
+	}
+	wg.Wait()
+
+	v, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK || v.Entries != 200 || v.Last != 200 {
+		t.Errorf("Expected an intact chain of 200 entries, got %+v", v)
+	}
+
+	l.Stop()
+	if err := l.record("ci", "SET", "late", hlc.Timestamp{}, nil); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected ErrNotOpen after Stop, got %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	l, db := openTestLog(t)
+	for _, key := range []string{"a", "b", "c"} {
+		l.RecordAs("ci", "SET", key, nil)
+	}
+
+	// rewrite the key of the second entry
+	err := db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(entryKey(2))
+		if err != nil {
+			return err
+		}
+		entry, err := decodeEntry(item)
+		if err != nil {
+			return err
+		}
+		entry.Key = "x"
+		data, _ := json.Marshal(entry)
+		return txn.Set(entryKey(2), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.OK || v.BrokenAt != 2 {
+		t.Errorf("Expected the chain to break at 2, got %+v", v)
+	}
+
+	// removing an entry leaves a gap
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(entryKey(2))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := l.Verify(); v.OK || v.BrokenAt != 3 {
+		t.Errorf("Expected the chain to break at 3, got %+v", v)
+	}
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testConfig() *fileConfig {
+	return &fileConfig{
+		Roles: map[string][]grantConfig{
+			"reader": {{Prefix: "", Access: "read"}},
+			"orders": {{Namespace: "orders", Access: "write"}},
+			"ops":    {{Prefix: "", Access: "admin"}},
+		},
+		Tokens: []tokenConfig{
+			{Name: "ci", SHA256: HashToken("ci-token"), Roles: []string{"orders", "reader"}},
+		},
+	}
+}
+
+func TestStaticTokenGrants(t *testing.T) {
+	a, err := newAuthenticator(testConfig())
+	if err != nil {
+		t.Fatalf("Failed to build authenticator: %v", err)
+	}
+
+	p, err := a.Authenticate("ci-token")
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if p.Name != "ci" {
+		t.Errorf("Expected principal ci, got %q", p.Name)
+	}
+
+	cases := []struct {
+		access Access
+		key    string
+		want   bool
+	}{
+		{AccessRead, "users:1", true},
+		{AccessWrite, "orders:1", true},
+		{AccessWrite, "orders:", true},
+		{AccessWrite, "ordersx", false},
+		{AccessWrite, "users:1", false},
+		{AccessAdmin, "orders:1", false},
+		// a scan of everything is wider than the orders namespace
+		{AccessWrite, "", false},
+	}
+	for _, c := range cases {
+		if got := p.Can(c.access, c.key); got != c.want {
+			t.Errorf("Can(%s, %q) = %v, want %v", c.access, c.key, got, c.want)
+		}
+	}
+
+	if _, err := a.Authenticate("wrong"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+	if _, err := a.Authenticate(""); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials, got %v", err)
+	}
+}
+
+func TestTokenWithUnknownRole(t *testing.T) {
+	cfg := testConfig()
+	cfg.Tokens[0].Roles = []string{"missing"}
+
+	if _, err := newAuthenticator(cfg); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("Expected ErrUnknownRole, got %v", err)
+	}
+}
+
+func encodeSegment(v any) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+
+	signed := encodeSegment(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encodeSegment(claims)
+
+	var signature []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerification(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+	}}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	data, _ := json.Marshal(jwks)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.JWT = &JWTConfig{JWKSFile: path, Issuer: "idp", Audience: "strangedb"}
+	a, err := newAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build authenticator: %v", err)
+	}
+
+	now := time.Now().Unix()
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{"sub": "alice", "iss": "idp", "aud": []string{"strangedb"}, "exp": now + 60, "roles": []string{"orders"}}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      crypto.Signer
+	}{
+		{"ES256", "ec", ecKey},
+		{"RS256", "rsa", rsaKey},
+		{"EdDSA", "ed", edKey},
+	} {
+		p, err := a.Authenticate(signJWT(t, tc.alg, tc.kid, tc.key, claims(nil)))
+		if err != nil {
+			t.Errorf("%s: failed to authenticate: %v", tc.alg, err)
+			continue
+		}
+		if p.Name != "alice" || !p.Can(AccessWrite, "orders:1") || p.Can(AccessRead, "users:1") {
+			t.Errorf("%s: unexpected principal %+v", tc.alg, p)
+		}
+	}
+
+	noExp := claims(nil)
+	delete(noExp, "exp")
+
+	rejected := map[string]string{
+		"no exp":        signJWT(t, "ES256", "ec", ecKey, noExp),
+		"expired":       signJWT(t, "ES256", "ec", ecKey, claims(map[string]any{"exp": now - 3600})),
+		"wrong issuer":  signJWT(t, "ES256", "ec", ecKey, claims(map[string]any{"iss": "other"})),
+		"wrong aud":     signJWT(t, "ES256", "ec", ecKey, claims(map[string]any{"aud": "other"})),
+		"unknown key":   signJWT(t, "ES256", "ec", otherKey, claims(nil)),
+		"alg mismatch":  signJWT(t, "ES256", "rsa", ecKey, claims(nil)),
+		"not yet valid": signJWT(t, "ES256", "ec", ecKey, claims(map[string]any{"nbf": now + 3600})),
+		"alg none": encodeSegment(map[string]string{"alg": "none", "kid": "ec"}) + "." +
+			encodeSegment(claims(nil)) + ".",
+	}
+	for name, token := range rejected {
+		if _, err := a.Authenticate(token); err == nil {
+			t.Errorf("%s: expected the token to be rejected", name)
+		}
+	}
+}
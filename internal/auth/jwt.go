@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenExpired = errors.New("token expired")
+	ErrUnknownKey   = errors.New("token signed by an unknown key")
+)
+
+// clock skew tolerated on exp and nbf
+const jwtLeeway = time.Minute
+
+// verifies JWTs against the keys of a local JWKS file. only asymmetric
+// algorithms are accepted, so the file holds nothing secret
+type jwtVerifier struct {
+	keys       []jwk
+	issuer     string
+	audience   string
+	rolesClaim string
+	now        func() time.Time
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// rsa
+	N string `json:"n"`
+	E string `json:"e"`
+	// ec and okp
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	key crypto.PublicKey
+}
+
+type verifiedClaims struct {
+	subject string
+	roles   []string
+}
+
+func newJWTVerifier(cfg *JWTConfig) (*jwtVerifier, error) {
+	if cfg.JWKSFile == "" {
+		return nil, errors.New("jwt: jwks_file is required")
+	}
+
+	data, err := os.ReadFile(cfg.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwt: %s: %w", cfg.JWKSFile, err)
+	}
+
+	v := &jwtVerifier{
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		rolesClaim: cfg.RolesClaim,
+		now:        time.Now,
+	}
+	if v.rolesClaim == "" {
+		v.rolesClaim = "roles"
+	}
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.key, err = k.publicKey(); err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", k.Kid, err)
+		}
+		v.keys = append(v.keys, k)
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("jwt: no signing keys in %s", cfg.JWKSFile)
+	}
+
+	return v, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, errors.New("point not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (v *jwtVerifier) verify(token string) (*verifiedClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range v.keys {
+		if (header.Kid != "" && k.Kid != header.Kid) || (k.Alg != "" && k.Alg != header.Alg) {
+			continue
+		}
+		if verifySignature(header.Alg, k.key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrUnknownKey
+	}
+
+	var claims map[string]json.RawMessage
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return v.checkClaims(claims)
+}
+
+func (v *jwtVerifier) checkClaims(claims map[string]json.RawMessage) (*verifiedClaims, error) {
+	now := v.now()
+
+	// a token without exp would be good forever
+	var exp, nbf float64
+	raw, ok := claims["exp"]
+	if !ok {
+		return nil, fmt.Errorf("%w: no exp", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(raw, &exp); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, ErrTokenExpired
+	}
+	if raw, ok := claims["nbf"]; ok {
+		if err := json.Unmarshal(raw, &nbf); err != nil {
+			return nil, ErrInvalidToken
+		}
+		if now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+			return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+		}
+	}
+
+	if v.issuer != "" {
+		var iss string
+		json.Unmarshal(claims["iss"], &iss)
+		if iss != v.issuer {
+			return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, iss)
+		}
+	}
+
+	if v.audience != "" {
+		audiences := stringList(claims["aud"])
+		found := false
+		for _, aud := range audiences {
+			found = found || aud == v.audience
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: audience", ErrInvalidToken)
+		}
+	}
+
+	var subject string
+	json.Unmarshal(claims["sub"], &subject)
+
+	return &verifiedClaims{
+		subject: subject,
+		roles:   stringList(claims[v.rolesClaim]),
+	}, nil
+}
+
+// a claim holding either a list of strings or one string, which for
+// roles may list several separated by spaces
+func stringList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.Fields(s)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(k, signed, signature)
+	default:
+		// none and the hmac algorithms
+		return false
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			return rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+		}
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(k, hash, digest, signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return false
+		}
+		// r and s, each the size of the curve
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
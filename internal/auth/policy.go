@@ -0,0 +1,232 @@
+// Package auth authenticates API callers by static token or JWT and
+// decides which keys their roles let them read, write or administer.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrNoCredentials = errors.New("missing credentials")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrUnknownRole   = errors.New("unknown role")
+)
+
+// what a grant allows; each level includes the ones below it
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessRead
+	AccessWrite
+	// the admin endpoints, on top of reading and writing
+	AccessAdmin
+)
+
+func ParseAccess(s string) (Access, error) {
+	switch strings.ToLower(s) {
+	case "read":
+		return AccessRead, nil
+	case "write":
+		return AccessWrite, nil
+	case "admin":
+		return AccessAdmin, nil
+	default:
+		return AccessNone, fmt.Errorf("invalid access %q, use read, write or admin", s)
+	}
+}
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	case AccessAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// access to the keys under a prefix
+type Grant struct {
+	Prefix string
+	Access Access
+}
+
+// an authenticated caller and what its roles grant
+type Principal struct {
+	Name   string
+	Roles  []string
+	grants []Grant
+}
+
+// whether the principal has access to key, or to every key starting
+// with it when it is a scan prefix
+func (p *Principal) Can(access Access, key string) bool {
+	for _, grant := range p.grants {
+		if grant.Access >= access && strings.HasPrefix(key, grant.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// the auth file, JSON:
+//
+//	{
+//	  "roles": {
+//	    "reader": [{"prefix": "", "access": "read"}],
+//	    "orders": [{"namespace": "orders", "access": "write"}]
+//	  },
+//	  "tokens": [{"name": "ci", "sha256": "<hex sha256 of the token>", "roles": ["orders"]}],
+//	  "jwt": {"jwks_file": "jwks.json", "issuer": "...", "audience": "...", "roles_claim": "roles"}
+//	}
+type fileConfig struct {
+	Roles  map[string][]grantConfig `json:"roles"`
+	Tokens []tokenConfig            `json:"tokens"`
+	JWT    *JWTConfig               `json:"jwt"`
+}
+
+type grantConfig struct {
+	// keys of the namespace, the part before the first ':'
+	Namespace string `json:"namespace"`
+	Prefix    string `json:"prefix"`
+	Access    string `json:"access"`
+}
+
+type tokenConfig struct {
+	Name string `json:"name"`
+	// tokens are never stored, only their hash
+	SHA256 string   `json:"sha256"`
+	Roles  []string `json:"roles"`
+}
+
+type JWTConfig struct {
+	JWKSFile string `json:"jwks_file"`
+	// checked against the iss and aud claims when set
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// claim listing the caller's roles, "roles" by default
+	RolesClaim string `json:"roles_claim"`
+}
+
+type Authenticator struct {
+	roles  map[string][]Grant
+	tokens map[string]*Principal // by hex sha256
+	jwt    *jwtVerifier
+}
+
+func Load(path string) (*Authenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg fileConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return newAuthenticator(&cfg)
+}
+
+func newAuthenticator(cfg *fileConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		roles:  make(map[string][]Grant),
+		tokens: make(map[string]*Principal),
+	}
+
+	for role, grants := range cfg.Roles {
+		for _, g := range grants {
+			access, err := ParseAccess(g.Access)
+			if err != nil {
+				return nil, fmt.Errorf("role %q: %w", role, err)
+			}
+
+			prefix := g.Prefix
+			if g.Namespace != "" {
+				if g.Prefix != "" {
+					return nil, fmt.Errorf("role %q: namespace and prefix are mutually exclusive", role)
+				}
+				prefix = g.Namespace + ":"
+			}
+			a.roles[role] = append(a.roles[role], Grant{Prefix: prefix, Access: access})
+		}
+	}
+
+	for _, t := range cfg.Tokens {
+		hash := strings.ToLower(t.SHA256)
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("token %q: sha256 must be %d hex characters", t.Name, sha256.Size*2)
+		}
+
+		principal, err := a.principal(t.Name, t.Roles)
+		if err != nil {
+			return nil, fmt.Errorf("token %q: %w", t.Name, err)
+		}
+		a.tokens[hash] = principal
+	}
+
+	if cfg.JWT != nil {
+		verifier, err := newJWTVerifier(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+
+	return a, nil
+}
+
+// a principal with the grants of roles. roles of static tokens must
+// exist; roles named by a JWT this node does not know grant nothing
+func (a *Authenticator) principal(name string, roles []string) (*Principal, error) {
+	p := &Principal{Name: name, Roles: roles}
+	var err error
+	for _, role := range roles {
+		grants, ok := a.roles[role]
+		if !ok {
+			err = fmt.Errorf("%w %q", ErrUnknownRole, role)
+			continue
+		}
+		p.grants = append(p.grants, grants...)
+	}
+	return p, err
+}
+
+// the principal a bearer token identifies. tokens with three dot
+// separated parts are JWTs, anything else is a static token
+func (a *Authenticator) Authenticate(token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	if strings.Count(token, ".") == 2 && a.jwt != nil {
+		claims, err := a.jwt.verify(token)
+		if err != nil {
+			return nil, err
+		}
+
+		p, _ := a.principal(claims.subject, claims.roles)
+		return p, nil
+	}
+
+	if p, ok := a.tokens[HashToken(token)]; ok {
+		return p, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+// hex sha256 of a token, as the auth file lists it
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
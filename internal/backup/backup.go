@@ -0,0 +1,371 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+const (
+	ManifestFile    = "manifest.json"
+	manifestVersion = 1
+
+	TypeFull        = "full"
+	TypeIncremental = "incremental"
+
+	// how far before its parent an incremental backup starts
+	DefaultOverlap = time.Hour
+)
+
+var (
+	ErrNoNodes     = errors.New("no nodes to back up")
+	ErrBrokenChain = errors.New("broken backup chain")
+)
+
+// describes one cluster-wide backup; written last, so a directory
+// without it holds an incomplete backup
+type Manifest struct {
+	Version   int       `json:"version"`
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	// an incremental backup holds the records written after Since, which
+	// lies an overlap before the At of its parent
+	Since     hlc.Timestamp `json:"since"`
+	At        hlc.Timestamp `json:"at"`
+	Parent    *ParentRef    `json:"parent,omitempty"`
+	Ring      RingLayout    `json:"ring"`
+	Snapshots []Snapshot    `json:"snapshots"`
+}
+
+type ParentRef struct {
+	ID string `json:"id"`
+	// relative to the backup's own directory, so a chain can be moved
+	// as a whole
+	Dir string `json:"dir"`
+}
+
+// the ring the backup was taken from, kept for reference; restores
+// route keys through the layout of the target cluster
+type RingLayout struct {
+	Nodes       []string           `json:"nodes"`
+	VNodes      int                `json:"vnodes_per_node"`
+	Partitioner string             `json:"partitioner,omitempty"`
+	Weights     map[string]float64 `json:"weights,omitempty"`
+}
+
+type Snapshot struct {
+	NodeID string              `json:"node_id"`
+	URL    string              `json:"url"`
+	File   string              `json:"file"`
+	Bytes  int64               `json:"bytes"`
+	SHA256 string              `json:"sha256"`
+	Stats  storage.BackupStats `json:"stats"`
+}
+
+type Options struct {
+	// HTTP addresses of every node in the cluster
+	Nodes []string
+	Dir   string
+	// directory of the previous backup; when set only records written
+	// after it are exported
+	Parent string
+	// an incremental backup also takes records written up to Overlap
+	// before its parent, 0 for DefaultOverlap. a write can reach a replica
+	// after the parent was taken while carrying an older timestamp, from
+	// hinted handoff, read repair or a slow coordinator; restores merge
+	// by timestamp, so records in both backups do no harm
+	Overlap time.Duration
+	// API token of a role with admin access, for clusters with auth
+	Token string
+}
+
+// snapshots every node at roughly the same HLC. the backup point is
+// taken from the local clock and handed to each node, which moves its
+// own clock past it before streaming, so writes accepted after the
+// snapshot started always carry a later timestamp
+func Run(ctx context.Context, opts Options) (*Manifest, error) {
+	if len(opts.Nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+	if opts.Overlap <= 0 {
+		opts.Overlap = DefaultOverlap
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	layout, err := fetchRing(ctx, opts.Nodes[0], opts.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ring layout: %w", err)
+	}
+
+	at := hlc.NewClock("backup").Now()
+	manifest := &Manifest{
+		Version:   manifestVersion,
+		ID:        at.String(),
+		Type:      TypeFull,
+		CreatedAt: time.Now().UTC(),
+		At:        at,
+		Ring:      *layout,
+		Snapshots: make([]Snapshot, len(opts.Nodes)),
+	}
+
+	if opts.Parent != "" {
+		parent, err := ReadManifest(opts.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("parent backup: %w", err)
+		}
+
+		rel, err := relativeDir(opts.Dir, opts.Parent)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Type = TypeIncremental
+		manifest.Since = hlc.Timestamp{WallTime: max(parent.At.WallTime-opts.Overlap.Nanoseconds(), 0)}
+		manifest.Parent = &ParentRef{ID: parent.ID, Dir: rel}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(opts.Nodes))
+
+	for i, node := range opts.Nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+
+			snapshot, err := fetchSnapshot(ctx, node, opts.Token, manifest, opts.Dir)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", node, err)
+				return
+			}
+			manifest.Snapshots[i] = *snapshot
+		}(i, node)
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if err := writeManifest(opts.Dir, manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func fetchRing(ctx context.Context, node, token string) (*RingLayout, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL(node)+"/cluster/ring", nil)
+	if err != nil {
+		return nil, err
+	}
+	setToken(req, token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var layout RingLayout
+	err = json.NewDecoder(resp.Body).Decode(&layout)
+	return &layout, err
+}
+
+// downloads one node's snapshot, then reads it back to verify it and
+// count what it holds
+func fetchSnapshot(ctx context.Context, node, token string, manifest *Manifest, dir string) (*Snapshot, error) {
+	query := url.Values{"at": {manifest.At.String()}}
+	if manifest.Type == TypeIncremental {
+		query.Set("since", manifest.Since.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		baseURL(node)+"/admin/snapshot?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	setToken(req, token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	nodeID := resp.Header.Get("X-Node-ID")
+	if nodeID == "" {
+		return nil, errors.New("node did not identify itself")
+	}
+
+	snapshot := &Snapshot{
+		NodeID: nodeID,
+		URL:    node,
+		File:   nodeID + ".backup",
+	}
+
+	f, err := os.Create(filepath.Join(dir, snapshot.File))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	snapshot.Bytes, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot interrupted: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	snapshot.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	err = storage.ReadBackup(f, func(entry *storage.BackupEntry) error {
+		snapshot.Stats.Add(entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot unreadable: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+func writeManifest(dir string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// written to a temp file and renamed so a crash never leaves a
+	// manifest pointing at a partial backup
+	tmp := filepath.Join(dir, ManifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, ManifestFile))
+}
+
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+// follows parent links from dir back to a full backup and returns the
+// chain oldest first, along with the directory of every backup in it
+func Chain(dir string) ([]*Manifest, []string, error) {
+	var manifests []*Manifest
+	var dirs []string
+	seen := make(map[string]bool)
+
+	for {
+		manifest, err := ReadManifest(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		if seen[manifest.ID] {
+			return nil, nil, fmt.Errorf("%w: %s appears twice", ErrBrokenChain, manifest.ID)
+		}
+		seen[manifest.ID] = true
+
+		manifests = append([]*Manifest{manifest}, manifests...)
+		dirs = append([]string{dir}, dirs...)
+
+		if manifest.Type == TypeFull {
+			return manifests, dirs, nil
+		}
+		if manifest.Parent == nil {
+			return nil, nil, fmt.Errorf("%w: incremental %s has no parent", ErrBrokenChain, manifest.ID)
+		}
+
+		parentDir := manifest.Parent.Dir
+		if !filepath.IsAbs(parentDir) {
+			parentDir = filepath.Join(dir, parentDir)
+		}
+
+		parent, err := ReadManifest(parentDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", parentDir, err)
+		}
+		// an overlap is fine, a gap loses writes
+		if parent.ID != manifest.Parent.ID || hlc.IsAfter(manifest.Since, parent.At) {
+			return nil, nil, fmt.Errorf("%w: %s does not follow %s", ErrBrokenChain, manifest.ID, parent.ID)
+		}
+
+		dir = parentDir
+	}
+}
+
+func relativeDir(from, to string) (string, error) {
+	absFrom, err := filepath.Abs(from)
+	if err != nil {
+		return "", err
+	}
+	absTo, err := filepath.Abs(to)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Rel(absFrom, absTo)
+}
+
+func baseURL(node string) string {
+	if !strings.Contains(node, "://") {
+		node = "http://" + node
+	}
+
+	return strings.TrimSuffix(node, "/")
+}
+
+func setToken(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
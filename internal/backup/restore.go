@@ -0,0 +1,233 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+const (
+	restoreBatchEntries = 1000
+	restoreBatchBytes   = 16 << 20
+)
+
+var ErrChecksumMismatch = errors.New("snapshot checksum mismatch")
+
+// ring address used when restoring into a single data directory
+const localNode = "local"
+
+type RestoreOptions struct {
+	// ring addresses of the target cluster, as its nodes register
+	// themselves, paired one to one with DataDirs. may be left empty
+	// to restore everything into a single data directory
+	Nodes        []string
+	DataDirs     []string
+	ReplicationN int
+	// default to the vnodes and partitioner of the backed up ring
+	VNodes      int
+	Partitioner string
+	// weights of target nodes other than 1; by default the backed up
+	// weights of nodes with the same address
+	Weights map[string]float64
+	// encrypts the data directories when set
+	EncryptionKey []byte
+}
+
+type RestoreStats struct {
+	Backups   int            `json:"backups"`
+	Snapshots int            `json:"snapshots"`
+	Entries   int            `json:"entries"`
+	Written   map[string]int `json:"written"` // per target node
+}
+
+// loads a backup into empty data directories for a new cluster. for an
+// incremental backup the whole chain is replayed, starting with the full
+// backup it builds on. every entry is routed through a ring built from
+// the target layout, so the node count may differ from the backed up
+// cluster; replicas of the same key from different snapshots merge by
+// timestamp
+func Restore(dir string, opts RestoreOptions) (*RestoreStats, error) {
+	chain, dirs, err := Chain(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Nodes) == 0 && len(opts.DataDirs) == 1 {
+		opts.Nodes = []string{localNode}
+		opts.ReplicationN = 1
+	}
+	if len(opts.Nodes) == 0 || len(opts.Nodes) != len(opts.DataDirs) {
+		return nil, errors.New("every target node needs exactly one data directory")
+	}
+
+	vnodes := opts.VNodes
+	if vnodes <= 0 {
+		vnodes = chain[len(chain)-1].Ring.VNodes
+	}
+
+	name := opts.Partitioner
+	if name == "" {
+		name = chain[len(chain)-1].Ring.Partitioner
+	}
+	partitioner, err := ring.ParsePartitioner(name)
+	if err != nil {
+		return nil, err
+	}
+
+	hashring := ring.New(vnodes)
+	hashring.SetPartitioner(partitioner)
+
+	weights := opts.Weights
+	if weights == nil {
+		weights = chain[len(chain)-1].Ring.Weights
+	}
+	for _, node := range opts.Nodes {
+		hashring.SetWeight(node, weights[node])
+		hashring.AddNode(node)
+	}
+
+	stores := make(map[string]*storage.BadgerStorage, len(opts.Nodes))
+	defer func() {
+		for _, store := range stores {
+			store.Close()
+		}
+	}()
+
+	for i, node := range opts.Nodes {
+		if err := checkEmpty(opts.DataDirs[i]); err != nil {
+			return nil, err
+		}
+
+		store := storage.NewBadgerStorage(opts.DataDirs[i])
+		store.SetEncryption(opts.EncryptionKey, 0)
+		if err := store.Open(); err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", opts.DataDirs[i], err)
+		}
+		stores[node] = store
+
+		if err := store.SetMeta(storage.MetaPartitioner, partitioner.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &router{
+		ring:         hashring,
+		replicationN: opts.ReplicationN,
+		stores:       stores,
+		pending:      make(map[string][]*storage.BackupEntry),
+		pendingBytes: make(map[string]int),
+		stats:        &RestoreStats{Written: make(map[string]int)},
+	}
+
+	for i, manifest := range chain {
+		for _, snapshot := range manifest.Snapshots {
+			if err := r.load(dirs[i], snapshot); err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(dirs[i], snapshot.File), err)
+			}
+			r.stats.Snapshots++
+		}
+		r.stats.Backups++
+	}
+
+	for node, store := range stores {
+		if err := r.flush(node); err != nil {
+			return nil, err
+		}
+
+		// stale replicas and earlier backups in the chain bring chunks
+		// of uploads that a newer manifest replaced
+		if _, err := store.DropOrphanChunks(); err != nil {
+			return nil, fmt.Errorf("cleanup of %s: %w", node, err)
+		}
+	}
+
+	return r.stats, nil
+}
+
+// batches entries per target node
+type router struct {
+	ring         *ring.ConsistentHashRing
+	replicationN int
+	stores       map[string]*storage.BadgerStorage
+	pending      map[string][]*storage.BackupEntry
+	pendingBytes map[string]int
+	stats        *RestoreStats
+}
+
+func (r *router) load(dir string, snapshot Snapshot) error {
+	f, err := os.Open(filepath.Join(dir, snapshot.File))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	err = storage.ReadBackup(io.TeeReader(f, hash), func(entry *storage.BackupEntry) error {
+		r.stats.Entries++
+		return r.route(entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	// entries are already written by now, but the target directories
+	// are fresh and can be discarded
+	if hex.EncodeToString(hash.Sum(nil)) != snapshot.SHA256 {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
+
+func (r *router) route(entry *storage.BackupEntry) error {
+	for _, node := range r.ring.GetReplicas(entry.Key, r.replicationN) {
+		r.pending[node] = append(r.pending[node], entry)
+		r.pendingBytes[node] += entry.Size()
+
+		if len(r.pending[node]) >= restoreBatchEntries || r.pendingBytes[node] >= restoreBatchBytes {
+			if err := r.flush(node); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *router) flush(node string) error {
+	entries := r.pending[node]
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := r.stores[node].Restore(entries); err != nil {
+		return fmt.Errorf("restore into %s: %w", node, err)
+	}
+
+	r.stats.Written[node] += len(entries)
+	r.pending[node] = entries[:0]
+	r.pendingBytes[node] = 0
+	return nil
+}
+
+func checkEmpty(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("data directory %s is not empty", dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package bulk
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	DefaultPageSize  = 1000
+	DefaultBatchSize = 500
+
+	// keeps batch requests under the HTTP API's 4MB JSON limit
+	maxBatchBytes = 3 << 20
+	// values past this go through the chunked upload path one by one
+	maxBatchValue = 1 << 20
+
+	progressInterval = 5 * time.Second
+)
+
+type Stats struct {
+	Records int64
+	Bytes   int64
+	Elapsed time.Duration
+	// records read from a checkpoint rather than in this run
+	Resumed int64
+}
+
+func (s Stats) String() string {
+	rate, throughput := 0.0, 0.0
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		rate = float64(s.Records-s.Resumed) / secs
+		throughput = float64(s.Bytes) / secs / (1 << 20)
+	}
+
+	return fmt.Sprintf("%d records, %.0f records/s, %.2f MB/s", s.Records, rate, throughput)
+}
+
+type ExportOptions struct {
+	URL    string
+	Path   string
+	Format string
+	Prefix string
+	// include each record's HLC timestamp in the output
+	Timestamps bool
+	PageSize   int
+	// called periodically while the export runs
+	Progress func(Stats)
+	// API token, for clusters with auth
+	Token string
+}
+
+// writes every key of the cluster to a file, page by page. a checkpoint
+// next to the file records the last key written and the file size at
+// that point, so a rerun with the same options truncates any partial
+// page and continues
+func Export(ctx context.Context, opts ExportOptions) (Stats, error) {
+	var stats Stats
+	start := time.Now()
+
+	if err := ValidateFormat(opts.Format); err != nil {
+		return stats, err
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultPageSize
+	}
+
+	c := newClient(opts.URL, opts.Token)
+
+	cpPath := opts.Path + ".checkpoint"
+	cp, err := loadCheckpoint(cpPath, Run{
+		URL:        c.base,
+		Format:     opts.Format,
+		Prefix:     opts.Prefix,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		return stats, err
+	}
+	stats.Records, stats.Resumed = cp.Records, cp.Records
+
+	f, err := os.OpenFile(opts.Path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(cp.Offset); err != nil {
+		return stats, err
+	}
+	if _, err := f.Seek(cp.Offset, io.SeekStart); err != nil {
+		return stats, err
+	}
+
+	w, err := NewWriter(f, opts.Format, cp.Offset == 0)
+	if err != nil {
+		return stats, err
+	}
+
+	lastProgress := time.Now()
+
+	for {
+		page, err := c.scan(ctx, opts.Prefix, cp.Cursor, opts.PageSize)
+		if err != nil {
+			return stats, err
+		}
+
+		for _, k := range page.Keys {
+			record := &Record{
+				Key:         k.Key,
+				Value:       k.Value,
+				Encoding:    k.Encoding,
+				ContentType: k.ContentType,
+			}
+			if opts.Timestamps {
+				ts := k.Timestamp
+				record.Timestamp = &ts
+			}
+
+			if k.Chunked {
+				value, err := c.getRaw(ctx, k.Key)
+				if err != nil {
+					return stats, fmt.Errorf("%s: %w", k.Key, err)
+				}
+				record.Value = base64.StdEncoding.EncodeToString(value)
+				record.Encoding = "base64"
+			}
+
+			if err := w.Write(record); err != nil {
+				return stats, err
+			}
+			stats.Records++
+			stats.Bytes += int64(len(record.Key) + len(record.Value))
+		}
+
+		if err := w.Flush(); err != nil {
+			return stats, err
+		}
+		if err := f.Sync(); err != nil {
+			return stats, err
+		}
+
+		if page.Next == "" {
+			stats.Elapsed = time.Since(start)
+			return stats, removeCheckpoint(cpPath)
+		}
+
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return stats, err
+		}
+		cp.Cursor, cp.Offset, cp.Records = page.Next, offset, stats.Records
+		if err := cp.save(cpPath); err != nil {
+			return stats, err
+		}
+
+		if opts.Progress != nil && time.Since(lastProgress) >= progressInterval {
+			stats.Elapsed = time.Since(start)
+			opts.Progress(stats)
+			lastProgress = time.Now()
+		}
+	}
+}
+
+type ImportOptions struct {
+	URL    string
+	Path   string
+	Format string
+	// write records with the timestamps in the input instead of new ones
+	PreserveTimestamps bool
+	BatchSize          int
+	Progress           func(Stats)
+	// API token, for clusters with auth
+	Token string
+}
+
+// loads a file into the cluster in batches, which the receiving node
+// splits by replica set. a checkpoint next to the input records how far
+// it was acknowledged, so a rerun on the same file with the same options
+// skips what is already written
+func Import(ctx context.Context, opts ImportOptions) (Stats, error) {
+	var stats Stats
+	start := time.Now()
+
+	if err := ValidateFormat(opts.Format); err != nil {
+		return stats, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	f, err := os.Open(opts.Path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	c := newClient(opts.URL, opts.Token)
+
+	run, err := inputRun(f, Run{
+		URL:        c.base,
+		Format:     opts.Format,
+		Timestamps: opts.PreserveTimestamps,
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	cpPath := opts.Path + ".checkpoint"
+	cp, err := loadCheckpoint(cpPath, run)
+	if err != nil {
+		return stats, err
+	}
+	stats.Records, stats.Resumed = cp.Records, cp.Records
+
+	r, err := NewReader(f, opts.Format, cp.Offset)
+	if err != nil {
+		return stats, err
+	}
+	lastProgress := time.Now()
+
+	var batch []*Record
+	batchBytes := 0
+	// input offset just past the last record handled
+	done := cp.Offset
+
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := c.batch(ctx, batch); err != nil {
+				return err
+			}
+		}
+
+		stats.Records += int64(len(batch))
+		stats.Bytes += int64(batchBytes)
+		batch, batchBytes = batch[:0], 0
+
+		cp.Offset, cp.Records = done, stats.Records
+		if err := cp.save(cpPath); err != nil {
+			return err
+		}
+
+		if opts.Progress != nil && time.Since(lastProgress) >= progressInterval {
+			stats.Elapsed = time.Since(start)
+			opts.Progress(stats)
+			lastProgress = time.Now()
+		}
+		return nil
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		if !opts.PreserveTimestamps {
+			record.Timestamp = nil
+		} else if record.Timestamp != nil && record.Timestamp.WallTime == 0 {
+			record.Timestamp = nil
+		}
+
+		value, err := record.Bytes()
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", record.Key, err)
+		}
+
+		if len(value) > maxBatchValue {
+			// a crash before the pending batch is acknowledged writes
+			// this again on resume, which is harmless
+			if err := c.putRaw(ctx, record.Key, value, record.ContentType, record.Timestamp); err != nil {
+				return stats, fmt.Errorf("%s: %w", record.Key, err)
+			}
+			stats.Records++
+			stats.Bytes += int64(len(value))
+			done = r.Offset()
+			continue
+		}
+
+		size := len(record.Key) + len(record.Value)
+		if len(batch) >= opts.BatchSize || (len(batch) > 0 && batchBytes+size > maxBatchBytes) {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+
+		batch = append(batch, record)
+		batchBytes += size
+		done = r.Offset()
+	}
+
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	stats.Elapsed = time.Since(start)
+	return stats, removeCheckpoint(cpPath)
+}
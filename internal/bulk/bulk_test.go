@@ -0,0 +1,376 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+)
+
+type stored struct {
+	value       []byte
+	contentType string
+	timestamp   hlc.Timestamp
+	// written through PUT, which the scan leaves out like a chunked value
+	chunked bool
+}
+
+// the parts of a node's HTTP API that export and import use, over a map
+type fakeNode struct {
+	mu     sync.Mutex
+	keys   map[string]stored
+	clock  *hlc.Clock
+	writes map[string]int
+	// by path, how many requests succeed before one fails
+	failing map[string]int
+}
+
+func startNode(t *testing.T) (*fakeNode, string) {
+	n := &fakeNode{
+		keys:    make(map[string]stored),
+		clock:   hlc.NewClock("fake"),
+		writes:  make(map[string]int),
+		failing: make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/scan", n.scan)
+	mux.HandleFunc("POST /api/v1/batch", n.batch)
+	mux.HandleFunc("PUT /api/v1/kv/{key}", n.put)
+	mux.HandleFunc("GET /api/v1/kv/{key}", n.get)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		left, fail := n.failing[r.URL.Path]
+		if fail && left > 0 {
+			n.failing[r.URL.Path]--
+			fail = false
+		} else if fail {
+			delete(n.failing, r.URL.Path)
+		}
+		n.mu.Unlock()
+
+		if fail {
+			http.Error(w, "connection reset", http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return n, server.URL
+}
+
+func (n *fakeNode) set(key string, s stored) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if s.timestamp.WallTime == 0 {
+		s.timestamp = n.clock.Now()
+	}
+	n.keys[key] = s
+	n.writes[key]++
+}
+
+// fails the request to path that follows the next ok ones
+func (n *fakeNode) failAfter(path string, ok int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failing[path] = ok
+}
+
+func (n *fakeNode) scan(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	after := r.URL.Query().Get("after")
+
+	var keys []string
+	for key := range n.keys {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	page := scanPage{}
+	for _, key := range keys {
+		if len(page.Keys) == limit {
+			page.Next = page.Keys[len(page.Keys)-1].Key
+			break
+		}
+
+		s := n.keys[key]
+		k := scanKey{Key: key, ContentType: s.contentType, Chunked: s.chunked, Timestamp: s.timestamp}
+		switch {
+		case s.chunked:
+		case utf8.Valid(s.value):
+			k.Value, k.Encoding = string(s.value), "utf8"
+		default:
+			k.Value, k.Encoding = base64.StdEncoding.EncodeToString(s.value), "base64"
+		}
+		page.Keys = append(page.Keys, k)
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+func (n *fakeNode) batch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Records []*Record `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, record := range req.Records {
+		value, err := record.Bytes()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s := stored{value: value, contentType: record.ContentType}
+		if record.Timestamp != nil {
+			s.timestamp = *record.Timestamp
+		}
+		n.set(record.Key, s)
+	}
+
+	json.NewEncoder(w).Encode(batchResponse{Written: len(req.Records)})
+}
+
+func (n *fakeNode) put(w http.ResponseWriter, r *http.Request) {
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s := stored{value: value, contentType: r.Header.Get("Content-Type"), chunked: true}
+	if v := r.URL.Query().Get("timestamp"); v != "" {
+		if s.timestamp, err = hlc.Parse(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	n.set(r.PathValue("key"), s)
+}
+
+func (n *fakeNode) get(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	s, ok := n.keys[r.PathValue("key")]
+	n.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(s.value)
+}
+
+// a source node with text, binary and chunked values
+func exportSource(t *testing.T) (*fakeNode, string) {
+	n, url := startNode(t)
+
+	for i := range 7 {
+		n.set("k"+strconv.Itoa(i), stored{value: []byte("value " + strconv.Itoa(i)), contentType: "text/plain"})
+	}
+	n.set("binary", stored{value: []byte{0xff, 0x00, 0xfe}, contentType: "application/octet-stream"})
+	n.set("large", stored{value: bytes.Repeat([]byte{0xab}, maxBatchValue+1), contentType: "image/png", chunked: true})
+
+	return n, url
+}
+
+func checkCopied(t *testing.T, src, dst *fakeNode, timestamps bool) {
+	t.Helper()
+
+	if len(dst.keys) != len(src.keys) {
+		t.Fatalf("imported %d keys, want %d", len(dst.keys), len(src.keys))
+	}
+	for key, want := range src.keys {
+		got := dst.keys[key]
+		if !bytes.Equal(got.value, want.value) {
+			t.Errorf("%s = %q, want %q", key, got.value, want.value)
+		}
+		if got.contentType != want.contentType {
+			t.Errorf("%s content type %q, want %q", key, got.contentType, want.contentType)
+		}
+		if same := hlc.Compare(got.timestamp, want.timestamp) == 0; same != timestamps {
+			t.Errorf("%s timestamp %v, source %v, preserved %v", key, got.timestamp, want.timestamp, timestamps)
+		}
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSONL, FormatCSV} {
+		for _, timestamps := range []bool{true, false} {
+			t.Run(format+"/timestamps="+strconv.FormatBool(timestamps), func(t *testing.T) {
+				src, srcURL := exportSource(t)
+				dst, dstURL := startNode(t)
+				path := filepath.Join(t.TempDir(), "dump."+format)
+				ctx := context.Background()
+
+				stats, err := Export(ctx, ExportOptions{URL: srcURL, Path: path, Format: format, Timestamps: true, PageSize: 3})
+				if err != nil {
+					t.Fatalf("Export failed: %v", err)
+				}
+				if stats.Records != 9 {
+					t.Fatalf("exported %d records, want 9", stats.Records)
+				}
+
+				stats, err = Import(ctx, ImportOptions{URL: dstURL, Path: path, Format: format, PreserveTimestamps: timestamps, BatchSize: 2})
+				if err != nil {
+					t.Fatalf("Import failed: %v", err)
+				}
+				if stats.Records != 9 {
+					t.Fatalf("imported %d records, want 9", stats.Records)
+				}
+
+				checkCopied(t, src, dst, timestamps)
+				if !dst.keys["large"].chunked {
+					t.Error("large value was not sent through the chunked upload path")
+				}
+				if _, err := os.Stat(path + ".checkpoint"); !os.IsNotExist(err) {
+					t.Errorf("checkpoint left behind after a finished run: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestExportResumes(t *testing.T) {
+	src, srcURL := exportSource(t)
+	path := filepath.Join(t.TempDir(), "dump.jsonl")
+	ctx := context.Background()
+	opts := ExportOptions{URL: srcURL, Path: path, Format: FormatJSONL, Timestamps: true, PageSize: 3}
+
+	src.failAfter("/api/v1/scan", 1)
+	if _, err := Export(ctx, opts); err == nil {
+		t.Fatal("Export succeeded with the second page failing")
+	}
+	if _, err := os.Stat(path + ".checkpoint"); err != nil {
+		t.Fatalf("no checkpoint after the interrupted run: %v", err)
+	}
+
+	stats, err := Export(ctx, opts)
+	if err != nil {
+		t.Fatalf("resumed Export failed: %v", err)
+	}
+	if stats.Records != 9 || stats.Resumed != 3 {
+		t.Fatalf("resumed export has %d records, %d resumed, want 9 and 3", stats.Records, stats.Resumed)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := NewReader(f, FormatJSONL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]int)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[record.Key]++
+	}
+	for key := range src.keys {
+		if seen[key] != 1 {
+			t.Errorf("%s exported %d times, want once", key, seen[key])
+		}
+	}
+}
+
+// writes the export of a source node and returns its path
+func exportFile(t *testing.T, dir string) string {
+	t.Helper()
+
+	_, url := exportSource(t)
+	path := filepath.Join(dir, "dump.jsonl")
+	if _, err := Export(context.Background(), ExportOptions{URL: url, Path: path, Format: FormatJSONL, Timestamps: true}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportResumes(t *testing.T) {
+	path := exportFile(t, t.TempDir())
+	dst, url := startNode(t)
+	ctx := context.Background()
+	opts := ImportOptions{URL: url, Path: path, Format: FormatJSONL, PreserveTimestamps: true, BatchSize: 2}
+
+	dst.failAfter("/api/v1/batch", 2)
+	if _, err := Import(ctx, opts); err == nil {
+		t.Fatal("Import succeeded with the third batch failing")
+	}
+
+	stats, err := Import(ctx, opts)
+	if err != nil {
+		t.Fatalf("resumed Import failed: %v", err)
+	}
+	if stats.Records != 9 || stats.Resumed != 4 {
+		t.Fatalf("resumed import has %d records, %d resumed, want 9 and 4", stats.Records, stats.Resumed)
+	}
+
+	for key, n := range dst.writes {
+		if n != 1 {
+			t.Errorf("%s written %d times, want once", key, n)
+		}
+	}
+	if len(dst.writes) != 9 {
+		t.Errorf("%d keys written, want 9", len(dst.writes))
+	}
+}
+
+func TestImportRefusesOtherRun(t *testing.T) {
+	dir := t.TempDir()
+	path := exportFile(t, dir)
+	dst, url := startNode(t)
+	ctx := context.Background()
+	opts := ImportOptions{URL: url, Path: path, Format: FormatJSONL, PreserveTimestamps: true, BatchSize: 2}
+
+	dst.failAfter("/api/v1/batch", 1)
+	if _, err := Import(ctx, opts); err == nil {
+		t.Fatal("Import succeeded with the node failing")
+	}
+
+	other := opts
+	other.PreserveTimestamps = false
+	if _, err := Import(ctx, other); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("Import with other options = %v, want %v", err, ErrCheckpointMismatch)
+	}
+
+	// same size, different records
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Replace(data, []byte(`"k0"`), []byte(`"x0"`), 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(ctx, opts); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("Import of another file = %v, want %v", err, ErrCheckpointMismatch)
+	}
+}
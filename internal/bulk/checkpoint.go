@@ -0,0 +1,120 @@
+package bulk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var ErrCheckpointMismatch = errors.New("checkpoint belongs to a different run")
+
+// bytes of the import input hashed to tell files apart
+const inputHeadSize = 64 << 10
+
+// progress of an export or import, saved after every acknowledged page
+// or batch so an interrupted run continues where it stopped
+type Checkpoint struct {
+	// the last exported key
+	Cursor string `json:"cursor,omitempty"`
+	// bytes of the export written, or of the import input consumed
+	Offset  int64     `json:"offset"`
+	Records int64     `json:"records"`
+	Updated time.Time `json:"updated"`
+	Run     Run       `json:"run"`
+}
+
+// what a run was started with. the offset and cursor only mean something
+// for the same run, so resuming with anything else is refused
+type Run struct {
+	URL    string `json:"url"`
+	Format string `json:"format"`
+	Prefix string `json:"prefix,omitempty"`
+	// Timestamps of an export, PreserveTimestamps of an import
+	Timestamps bool `json:"timestamps,omitempty"`
+	// size of the import input and the sha256 of its first bytes
+	InputSize int64  `json:"input_size,omitempty"`
+	InputHead string `json:"input_head,omitempty"`
+}
+
+// identifies the import input f by its size and head
+func inputRun(f *os.File, run Run) (Run, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return run, err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, inputHeadSize)); err != nil {
+		return run, err
+	}
+
+	run.InputSize = info.Size()
+	run.InputHead = hex.EncodeToString(h.Sum(nil))
+	return run, nil
+}
+
+// returns a fresh checkpoint for run when there is nothing to resume
+func loadCheckpoint(path string, run Run) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Checkpoint{Run: run}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	if err := cp.Run.check(run); err != nil {
+		return nil, fmt.Errorf("%w: %v, remove %s to start over", ErrCheckpointMismatch, err, path)
+	}
+
+	return &cp, nil
+}
+
+func (r Run) check(o Run) error {
+	switch {
+	case r.URL != o.URL:
+		return fmt.Errorf("started against %q", r.URL)
+	case r.Format != o.Format:
+		return fmt.Errorf("started with format %q", r.Format)
+	case r.Prefix != o.Prefix:
+		return fmt.Errorf("started with prefix %q", r.Prefix)
+	case r.Timestamps != o.Timestamps:
+		return fmt.Errorf("started with timestamps %v", r.Timestamps)
+	case r.InputSize != o.InputSize || r.InputHead != o.InputHead:
+		return errors.New("the input file changed")
+	}
+	return nil
+}
+
+// called once a run finished; a run of one page never saved one
+func removeCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (cp *Checkpoint) save(path string) error {
+	cp.Updated = time.Now().UTC()
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,155 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+)
+
+// talks to the HTTP API of one node, which coordinates for the cluster
+type client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func newClient(addr, token string) *client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &client{
+		base:  strings.TrimSuffix(addr, "/"),
+		token: token,
+		http:  http.DefaultClient,
+	}
+}
+
+type scanKey struct {
+	Key         string        `json:"key"`
+	Value       string        `json:"value"`
+	Encoding    string        `json:"encoding"`
+	ContentType string        `json:"content_type"`
+	Chunked     bool          `json:"chunked"`
+	Timestamp   hlc.Timestamp `json:"timestamp"`
+}
+
+type scanPage struct {
+	Keys []scanKey `json:"keys"`
+	Next string    `json:"next"`
+}
+
+func (c *client) scan(ctx context.Context, prefix, after string, limit int) (*scanPage, error) {
+	query := url.Values{
+		"prefix": {prefix},
+		"after":  {after},
+		"limit":  {fmt.Sprint(limit)},
+	}
+
+	var page scanPage
+	err := c.do(ctx, http.MethodGet, "/api/v1/scan?"+query.Encode(), "", nil, &page)
+	return &page, err
+}
+
+type batchResponse struct {
+	Written int      `json:"written"`
+	Failed  []string `json:"failed"`
+}
+
+func (c *client) batch(ctx context.Context, records []*Record) error {
+	body, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+
+	var resp batchResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/batch", "application/json", body, &resp); err != nil {
+		return err
+	}
+	if len(resp.Failed) > 0 {
+		return fmt.Errorf("%d keys not written, first %q", len(resp.Failed), resp.Failed[0])
+	}
+
+	return nil
+}
+
+// fetches a chunked value, which the scan leaves out
+func (c *client) getRaw(ctx context.Context, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.base+"/api/v1/kv/"+url.PathEscape(key)+"?raw=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setToken(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// stores a value too large for a batch through the chunked upload path,
+// keeping ts when it is set
+func (c *client) putRaw(ctx context.Context, key string, value []byte, contentType string, ts *hlc.Timestamp) error {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	path := "/api/v1/kv/" + url.PathEscape(key)
+	if ts != nil {
+		path += "?" + url.Values{"timestamp": {ts.String()}}.Encode()
+	}
+
+	return c.do(ctx, http.MethodPut, path, contentType, value, nil)
+}
+
+func (c *client) do(ctx context.Context, method, path, contentType string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.setToken(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (c *client) setToken(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
@@ -0,0 +1,241 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+var csvHeader = []string{"key", "value", "encoding", "content_type", "timestamp"}
+
+// one key as it appears in an export file; the same shape the HTTP API
+// uses for values
+type Record struct {
+	Key         string         `json:"key"`
+	Value       string         `json:"value"`
+	Encoding    string         `json:"encoding,omitempty"`
+	ContentType string         `json:"content_type,omitempty"`
+	Timestamp   *hlc.Timestamp `json:"timestamp,omitempty"`
+}
+
+// the value as raw bytes, undoing its encoding
+func (r *Record) Bytes() ([]byte, error) {
+	if r.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(r.Value)
+	}
+
+	return []byte(r.Value), nil
+}
+
+func ValidateFormat(format string) error {
+	if format != FormatJSONL && format != FormatCSV {
+		return fmt.Errorf("unknown format %q, use jsonl or csv", format)
+	}
+
+	return nil
+}
+
+type Writer interface {
+	Write(record *Record) error
+	Flush() error
+}
+
+// header controls whether a CSV writer starts with a header row; it is
+// left out when appending to a resumed export
+func NewWriter(w io.Writer, format string, header bool) (Writer, error) {
+	switch format {
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if header {
+			if err := cw.Write(csvHeader); err != nil {
+				return nil, err
+			}
+		}
+		return &csvWriter{w: cw}, nil
+	default:
+		return nil, ValidateFormat(format)
+	}
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(record *Record) error {
+	return j.enc.Encode(record)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.w.Flush()
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(record *Record) error {
+	var ts string
+	if record.Timestamp != nil {
+		ts = record.Timestamp.String()
+	}
+
+	return c.w.Write([]string{record.Key, record.Value, record.Encoding, record.ContentType, ts})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type Reader interface {
+	// returns io.EOF once the input is exhausted
+	Read() (*Record, error)
+	// byte offset just past the last record read, for resuming
+	Offset() int64
+}
+
+// reads records starting at the given byte offset of r. CSV input needs
+// a header row naming its columns; only key and value are required, so
+// exports from other databases load as long as they name those two
+func NewReader(r io.ReadSeeker, format string, offset int64) (Reader, error) {
+	switch format {
+	case FormatJSONL:
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return &jsonlReader{r: bufio.NewReaderSize(r, 1<<20), offset: offset}, nil
+	case FormatCSV:
+		return newCSVReader(r, offset)
+	default:
+		return nil, ValidateFormat(format)
+	}
+}
+
+type jsonlReader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+func (j *jsonlReader) Read() (*Record, error) {
+	for {
+		line, err := j.r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		start := j.offset
+		j.offset += int64(len(line))
+
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\n') {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("invalid record at byte %d: %w", start, err)
+		}
+		return &record, nil
+	}
+}
+
+func (j *jsonlReader) Offset() int64 {
+	return j.offset
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	base    int64
+	columns map[string]int
+}
+
+func newCSVReader(r io.ReadSeeker, offset int64) (*csvReader, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, required := range []string{"key", "value"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header has no %q column", required)
+		}
+	}
+
+	base := cr.InputOffset()
+	if offset > base {
+		// resuming past the header: start a fresh reader at the offset
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		cr = csv.NewReader(r)
+		base = offset
+	} else {
+		base = 0
+	}
+	cr.FieldsPerRecord = len(header)
+	cr.ReuseRecord = true
+
+	return &csvReader{r: cr, base: base, columns: columns}, nil
+}
+
+func (c *csvReader) Read() (*Record, error) {
+	row, err := c.r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{
+		Key:         c.field(row, "key"),
+		Value:       c.field(row, "value"),
+		Encoding:    c.field(row, "encoding"),
+		ContentType: c.field(row, "content_type"),
+	}
+
+	if ts := c.field(row, "timestamp"); ts != "" {
+		parsed, err := hlc.Parse(ts)
+		if err != nil {
+			line, _ := c.r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		record.Timestamp = &parsed
+	}
+
+	return record, nil
+}
+
+func (c *csvReader) field(row []string, name string) string {
+	if i, ok := c.columns[name]; ok && i < len(row) {
+		return row[i]
+	}
+
+	return ""
+}
+
+func (c *csvReader) Offset() int64 {
+	return c.base + c.r.InputOffset()
+}
@@ -11,20 +11,100 @@ import (
 type Config struct {
 	// node
 	NodeID string
+	DC     string  // datacenter label, for replica placement
+	Rack   string  // rack label within the datacenter
+	Weight float64 // capacity relative to the other nodes, scales its virtual nodes
 
 	// server
 	HTTPPort int
 	GRPCPort int
+	RESPPort int // redis protocol port, 0 disables it
 
 	// storage
-	DataDir string
+	DataDir               string
+	Compression           string            // default value codec: none, snappy, zstd
+	CompressionNamespaces map[string]string // namespace -> codec overrides
+	GRPCCompression       string            // inter-node wire compressor: gzip, snappy, zstd
 
 	// cluster settings
 	Seeds        []string
 	ReplicationN int
 	ReadQuorum   int
 	WriteQuorum  int
-	VNodes       int // virtual nodes
+	VNodes       int    // virtual nodes
+	Partitioner  string // md5, xxhash, murmur3 or ordered; fixed for the life of a cluster
+	// replicas per datacenter; when set it replaces ReplicationN
+	DCReplication map[string]int
+
+	// cross-cluster replication
+	ClusterID        string   // id of this cluster, the origin of its writes
+	ReplicateTo      []string // gRPC addresses of nodes in the remote cluster
+	ReplicationBatch int      // writes per batch shipped to the remote cluster
+	ReplicationQueue int      // writes buffered before tailing pauses
+	// how far ahead of the local clock preserved timestamps of imports
+	// and replicated writes may be, 0 for no limit
+	MaxClockSkew time.Duration
+	// how far before its watermark tailing resumes, for writes that
+	// reached this node out of timestamp order
+	ReplicationReplay time.Duration
+
+	// shared by the nodes of a cluster; when set, the inter-node gRPC
+	// service only serves callers presenting it
+	ClusterSecret string
+
+	// tls; with a certificate the gRPC port serves TLS and nodes only
+	// accept peers presenting a certificate signed by TLSCA
+	TLSCert string
+	TLSKey  string
+	TLSCA   string
+	// certificate for HTTPS on the API port, plain HTTP without one
+	HTTPTLSCert string
+	HTTPTLSKey  string
+	// how often certificate files are checked for changes
+	TLSReloadInterval time.Duration
+	// comma separated origins allowed to call the API from a browser
+	CORSOrigins string
+	// tokens, JWT keys and roles for the HTTP API, open without one
+	AuthFile string
+	// how long audit log entries are kept, 0 keeps them forever
+	AuditRetention time.Duration
+	// AES key the data directory is encrypted with, read from the file
+	// or, without one, from ENCRYPTION_KEY. never a flag, so it does not
+	// show up in process listings
+	EncryptionKeyFile string
+	EncryptionKey     string
+	// how often badger generates a new data key
+	EncryptionKeyRotation time.Duration
+	// rate limits and namespace quotas, reloaded when the file changes
+	LimitsFile string
+
+	// admission control; requests past MaxInFlight wait in a queue of
+	// MaxQueued for at most QueueTimeout, the rest are shed
+	MaxInFlight     int
+	MaxQueued       int
+	QueueTimeout    time.Duration
+	MaxPeerInFlight int // requests outstanding at each peer
+
+	// how long replica RPCs may take, by kind; a shorter client deadline
+	// wins
+	RPCReadTimeout      time.Duration
+	RPCWriteTimeout     time.Duration
+	RPCBulkTimeout      time.Duration // scans and batches
+	RPCReplicateTimeout time.Duration // batches shipped to the remote cluster
+	// how long a redis command may take, as redis clients send no deadline
+	RESPTimeout time.Duration
+	// largest value a gRPC client API Get returns, in bytes
+	KVMaxValue int64
+	// tries of an idempotent replica RPC, and the backoff between them
+	RPCAttempts int
+	RPCBackoff  time.Duration
+	// failures in a row that open a peer's circuit, and how long it stays
+	// open before a call probes the peer
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	// idle peer connections are pinged every PeerKeepalive
+	PeerKeepalive        time.Duration
+	PeerKeepaliveTimeout time.Duration
 
 	// timing settings
 	GossipInterval      time.Duration
@@ -37,19 +117,48 @@ type Config struct {
 
 func DefaultConfig() *Config {
 	return &Config{
-		NodeID:              generateNodeID(),
-		HTTPPort:            9000,
-		GRPCPort:            9001,
-		DataDir:             "./data",
-		Seeds:               []string{},
-		ReplicationN:        3,
-		ReadQuorum:          2,
-		WriteQuorum:         2,
-		VNodes:              150,
-		GossipInterval:      time.Second,
-		AntiEntropyInterval: 10 * time.Minute,
-		TombstoneTTL:        24 * time.Hour,
-		LogLevel:            "info",
+		NodeID:                generateNodeID(),
+		DC:                    "dc1",
+		Rack:                  "rack1",
+		Weight:                1,
+		HTTPPort:              9000,
+		GRPCPort:              9001,
+		DataDir:               "./data",
+		Compression:           "none",
+		Seeds:                 []string{},
+		ReplicationN:          3,
+		ReadQuorum:            2,
+		WriteQuorum:           2,
+		VNodes:                150,
+		Partitioner:           "md5",
+		ClusterID:             "cluster1",
+		ReplicationBatch:      500,
+		ReplicationQueue:      10000,
+		ReplicationReplay:     time.Minute,
+		MaxClockSkew:          500 * time.Millisecond,
+		GossipInterval:        time.Second,
+		AntiEntropyInterval:   10 * time.Minute,
+		TombstoneTTL:          24 * time.Hour,
+		TLSReloadInterval:     time.Minute,
+		CORSOrigins:           "*",
+		EncryptionKeyRotation: 10 * 24 * time.Hour,
+		MaxInFlight:           1024,
+		MaxQueued:             2048,
+		QueueTimeout:          time.Second,
+		MaxPeerInFlight:       512,
+		RPCReadTimeout:        5 * time.Second,
+		RPCWriteTimeout:       5 * time.Second,
+		RPCBulkTimeout:        10 * time.Second,
+		RPCReplicateTimeout:   30 * time.Second,
+		RESPTimeout:           10 * time.Second,
+		KVMaxValue:            16 * 1024 * 1024,
+		RPCAttempts:           3,
+		RPCBackoff:            50 * time.Millisecond,
+		BreakerFailures:       5,
+		BreakerCooldown:       5 * time.Second,
+		PeerKeepalive:         30 * time.Second,
+		PeerKeepaliveTimeout:  10 * time.Second,
+		LogLevel:              "info",
 	}
 }
 
@@ -69,6 +178,20 @@ func (c *Config) loadFromEnv() {
 		c.NodeID = v
 	}
 
+	if v := os.Getenv("DC"); v != "" {
+		c.DC = v
+	}
+
+	if v := os.Getenv("RACK"); v != "" {
+		c.Rack = v
+	}
+
+	if v := os.Getenv("WEIGHT"); v != "" {
+		if w, err := strconv.ParseFloat(v, 64); err == nil {
+			c.Weight = w
+		}
+	}
+
 	if v := os.Getenv("HTTP_PORT"); v != "" {
 		if port, err := strconv.Atoi(v); err == nil {
 			c.HTTPPort = port
@@ -81,10 +204,28 @@ func (c *Config) loadFromEnv() {
 		}
 	}
 
+	if v := os.Getenv("RESP_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			c.RESPPort = port
+		}
+	}
+
 	if v := os.Getenv("DATA_DIR"); v != "" {
 		c.DataDir = v
 	}
 
+	if v := os.Getenv("COMPRESSION"); v != "" {
+		c.Compression = v
+	}
+
+	if v := os.Getenv("COMPRESSION_NAMESPACES"); v != "" {
+		c.CompressionNamespaces = ParseKeyValues(v)
+	}
+
+	if v := os.Getenv("GRPC_COMPRESSION"); v != "" {
+		c.GRPCCompression = v
+	}
+
 	if v := os.Getenv("REPLICATION_N"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			c.ReplicationN = n
@@ -102,12 +243,210 @@ func (c *Config) loadFromEnv() {
 			c.WriteQuorum = w
 		}
 	}
+	if v := os.Getenv("DC_REPLICATION"); v != "" {
+		c.DCReplication = parseReplication(v)
+	}
+
 	if v := os.Getenv("VIRTUAL_NODES"); v != "" {
 		if vn, err := strconv.Atoi(v); err == nil {
 			c.VNodes = vn
 		}
 	}
 
+	if v := os.Getenv("PARTITIONER"); v != "" {
+		c.Partitioner = v
+	}
+
+	if v := os.Getenv("CLUSTER_ID"); v != "" {
+		c.ClusterID = v
+	}
+
+	if v := os.Getenv("REPLICATE_TO"); v != "" {
+		c.ReplicateTo = strings.Split(v, ",")
+	}
+
+	if v := os.Getenv("REPLICATION_BATCH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.ReplicationBatch = n
+		}
+	}
+
+	if v := os.Getenv("REPLICATION_QUEUE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.ReplicationQueue = n
+		}
+	}
+
+	if v := os.Getenv("REPLICATION_REPLAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.ReplicationReplay = d
+		}
+	}
+
+	if v := os.Getenv("MAX_CLOCK_SKEW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.MaxClockSkew = d
+		}
+	}
+
+	if v := os.Getenv("CLUSTER_SECRET"); v != "" {
+		c.ClusterSecret = v
+	}
+
+	if v := os.Getenv("TLS_CERT"); v != "" {
+		c.TLSCert = v
+	}
+
+	if v := os.Getenv("TLS_KEY"); v != "" {
+		c.TLSKey = v
+	}
+
+	if v := os.Getenv("TLS_CA"); v != "" {
+		c.TLSCA = v
+	}
+
+	if v := os.Getenv("HTTP_TLS_CERT"); v != "" {
+		c.HTTPTLSCert = v
+	}
+
+	if v := os.Getenv("HTTP_TLS_KEY"); v != "" {
+		c.HTTPTLSKey = v
+	}
+
+	if v := os.Getenv("TLS_RELOAD_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.TLSReloadInterval = d
+		}
+	}
+
+	if v := os.Getenv("CORS_ORIGINS"); v != "" {
+		c.CORSOrigins = v
+	}
+
+	if v := os.Getenv("AUTH_FILE"); v != "" {
+		c.AuthFile = v
+	}
+
+	if v := os.Getenv("AUDIT_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.AuditRetention = d
+		}
+	}
+
+	if v := os.Getenv("ENCRYPTION_KEY_FILE"); v != "" {
+		c.EncryptionKeyFile = v
+	}
+
+	if v := os.Getenv("ENCRYPTION_KEY"); v != "" {
+		c.EncryptionKey = v
+	}
+
+	if v := os.Getenv("ENCRYPTION_KEY_ROTATION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.EncryptionKeyRotation = d
+		}
+	}
+
+	if v := os.Getenv("LIMITS_FILE"); v != "" {
+		c.LimitsFile = v
+	}
+
+	if v := os.Getenv("MAX_IN_FLIGHT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.MaxInFlight = n
+		}
+	}
+
+	if v := os.Getenv("MAX_QUEUED"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.MaxQueued = n
+		}
+	}
+
+	if v := os.Getenv("QUEUE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.QueueTimeout = d
+		}
+	}
+
+	if v := os.Getenv("MAX_PEER_IN_FLIGHT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.MaxPeerInFlight = n
+		}
+	}
+
+	if v := os.Getenv("RPC_READ_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.RPCReadTimeout = d
+		}
+	}
+
+	if v := os.Getenv("RPC_WRITE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.RPCWriteTimeout = d
+		}
+	}
+
+	if v := os.Getenv("RPC_BULK_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.RPCBulkTimeout = d
+		}
+	}
+
+	if v := os.Getenv("RPC_REPLICATE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.RPCReplicateTimeout = d
+		}
+	}
+
+	if v := os.Getenv("RESP_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.RESPTimeout = d
+		}
+	}
+
+	if v := os.Getenv("KV_MAX_VALUE"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			c.KVMaxValue = n
+		}
+	}
+
+	if v := os.Getenv("RPC_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.RPCAttempts = n
+		}
+	}
+
+	if v := os.Getenv("RPC_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.RPCBackoff = d
+		}
+	}
+
+	if v := os.Getenv("BREAKER_FAILURES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.BreakerFailures = n
+		}
+	}
+
+	if v := os.Getenv("BREAKER_COOLDOWN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.BreakerCooldown = d
+		}
+	}
+
+	if v := os.Getenv("PEER_KEEPALIVE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.PeerKeepalive = d
+		}
+	}
+
+	if v := os.Getenv("PEER_KEEPALIVE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.PeerKeepaliveTimeout = d
+		}
+	}
+
 	if v := os.Getenv("LOG_LEVEL"); v != "" {
 		c.LogLevel = v
 	}
@@ -115,23 +454,140 @@ func (c *Config) loadFromEnv() {
 
 func (c *Config) loadFromFlags() {
 	flag.StringVar(&c.NodeID, "node-id", c.NodeID, "Unique node identifier")
+	flag.StringVar(&c.DC, "dc", c.DC, "datacenter of this node")
+	flag.StringVar(&c.Rack, "rack", c.Rack, "rack of this node")
+	flag.Float64Var(&c.Weight, "weight", c.Weight, "capacity of this node relative to the others, e.g. 2 for twice the disk")
 	flag.IntVar(&c.HTTPPort, "http-port", c.HTTPPort, "HTTP API port")
 	flag.IntVar(&c.GRPCPort, "grpc-port", c.GRPCPort, "gRPC inter-node port")
+	flag.IntVar(&c.RESPPort, "resp-port", c.RESPPort, "redis protocol port, 0 to disable")
 	flag.StringVar(&c.DataDir, "data-dir", c.DataDir, "Data directory")
+	flag.StringVar(&c.Compression, "compression", c.Compression, "default value compression (none/snappy/zstd)")
+	flag.StringVar(&c.GRPCCompression, "grpc-compression", c.GRPCCompression, "inter-node gRPC compression (gzip/snappy/zstd)")
 	flag.IntVar(&c.ReplicationN, "n", c.ReplicationN, "replication factors, N")
 	flag.IntVar(&c.ReadQuorum, "r", c.ReadQuorum, "read quorum")
 	flag.IntVar(&c.WriteQuorum, "w", c.WriteQuorum, "write quorum")
 	flag.IntVar(&c.VNodes, "v-nodes", c.VNodes, "virtual nodes")
+	flag.StringVar(&c.Partitioner, "partitioner", c.Partitioner, "key partitioner (md5/xxhash/murmur3/ordered), the same on every node")
+	flag.StringVar(&c.ClusterID, "cluster-id", c.ClusterID, "id of this cluster, for cross-cluster replication")
+	flag.IntVar(&c.ReplicationBatch, "replication-batch", c.ReplicationBatch, "writes per batch shipped to the remote cluster")
+	flag.IntVar(&c.ReplicationQueue, "replication-queue", c.ReplicationQueue, "writes buffered for the remote cluster before tailing pauses")
+	flag.DurationVar(&c.MaxClockSkew, "max-clock-skew", c.MaxClockSkew, "how far ahead of the local clock imported or replicated timestamps may be, 0 for no limit")
+	flag.DurationVar(&c.ReplicationReplay, "replication-replay", c.ReplicationReplay, "how far before its watermark tailing resumes")
+	flag.StringVar(&c.ClusterSecret, "cluster-secret", c.ClusterSecret, "secret shared by the nodes, required by the inter-node gRPC service when set")
+	flag.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "node certificate for inter-node gRPC, signed by the cluster CA")
+	flag.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "key of the node certificate")
+	flag.StringVar(&c.TLSCA, "tls-ca", c.TLSCA, "cluster CA bundle peers are verified against")
+	flag.StringVar(&c.HTTPTLSCert, "http-tls-cert", c.HTTPTLSCert, "certificate for HTTPS on the API port")
+	flag.StringVar(&c.HTTPTLSKey, "http-tls-key", c.HTTPTLSKey, "key of the HTTPS certificate")
+	flag.DurationVar(&c.TLSReloadInterval, "tls-reload-interval", c.TLSReloadInterval, "how often certificate files are checked for changes")
+	flag.StringVar(&c.CORSOrigins, "cors-origins", c.CORSOrigins, "comma separated origins allowed to call the API from a browser, * for any")
+	flag.StringVar(&c.AuthFile, "auth-file", c.AuthFile, "JSON file of API tokens, JWT settings and roles; the HTTP API is open without one")
+	flag.DurationVar(&c.AuditRetention, "audit-retention", c.AuditRetention, "how long audit log entries are kept, 0 to keep them forever")
+	flag.StringVar(&c.EncryptionKeyFile, "encryption-key-file", c.EncryptionKeyFile, "file with the hex or base64 AES key the data directory is encrypted with")
+	flag.DurationVar(&c.EncryptionKeyRotation, "encryption-key-rotation", c.EncryptionKeyRotation, "how often a new data key is generated")
+	flag.StringVar(&c.LimitsFile, "limits-file", c.LimitsFile, "JSON file of per-client and per-namespace rate limits and namespace quotas, reloaded on change")
+	flag.IntVar(&c.MaxInFlight, "max-in-flight", c.MaxInFlight, "requests this node coordinates at once, 0 for no limit")
+	flag.IntVar(&c.MaxQueued, "max-queued", c.MaxQueued, "requests waiting for a slot before new ones are shed with 503")
+	flag.DurationVar(&c.QueueTimeout, "queue-timeout", c.QueueTimeout, "longest a request waits for a slot")
+	flag.IntVar(&c.MaxPeerInFlight, "max-peer-in-flight", c.MaxPeerInFlight, "requests outstanding at each peer, 0 for no limit")
+	flag.DurationVar(&c.RPCReadTimeout, "rpc-read-timeout", c.RPCReadTimeout, "how long a replica read may take")
+	flag.DurationVar(&c.RPCWriteTimeout, "rpc-write-timeout", c.RPCWriteTimeout, "how long a replica write or delete may take")
+	flag.DurationVar(&c.RPCBulkTimeout, "rpc-bulk-timeout", c.RPCBulkTimeout, "how long a replica scan or batch may take")
+	flag.DurationVar(&c.RPCReplicateTimeout, "rpc-replicate-timeout", c.RPCReplicateTimeout, "how long shipping a batch to the remote cluster may take")
+	flag.DurationVar(&c.RESPTimeout, "resp-timeout", c.RESPTimeout, "how long a redis command may take, 0 for no limit")
+	flag.Int64Var(&c.KVMaxValue, "kv-max-value", c.KVMaxValue, "largest value in bytes a gRPC client Get returns; larger ones are read over HTTP")
+	flag.IntVar(&c.RPCAttempts, "rpc-attempts", c.RPCAttempts, "tries of an idempotent replica RPC that fails to reach its peer")
+	flag.DurationVar(&c.RPCBackoff, "rpc-backoff", c.RPCBackoff, "wait before retrying a replica RPC, doubling after each retry")
+	flag.IntVar(&c.BreakerFailures, "breaker-failures", c.BreakerFailures, "failures in a row that open a peer's circuit")
+	flag.DurationVar(&c.BreakerCooldown, "breaker-cooldown", c.BreakerCooldown, "how long an open circuit fails calls before probing the peer")
+	flag.DurationVar(&c.PeerKeepalive, "peer-keepalive", c.PeerKeepalive, "idle time before a peer connection is pinged, at least 10s")
+	flag.DurationVar(&c.PeerKeepaliveTimeout, "peer-keepalive-timeout", c.PeerKeepaliveTimeout, "how long a ping may go unanswered before the connection is dropped")
 	flag.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level (debug/info/warn/error)")
 
 	var seeds string
 	flag.StringVar(&seeds, "seeds", "", "comma seperated seed node URLs")
 
+	var compressionNamespaces string
+	flag.StringVar(&compressionNamespaces, "compression-namespaces", "", "per-namespace compression, e.g. docs=zstd,cache=none")
+
+	var dcReplication string
+	flag.StringVar(&dcReplication, "dc-replication", "", "replicas per datacenter, e.g. east=3,west=2 (replaces -n)")
+
+	var replicateTo string
+	flag.StringVar(&replicateTo, "replicate-to", "", "comma separated gRPC addresses of a remote cluster to ship writes to")
+
 	flag.Parse()
 
 	if seeds != "" {
 		c.Seeds = strings.Split(seeds, ",")
 	}
+
+	if compressionNamespaces != "" {
+		c.CompressionNamespaces = ParseKeyValues(compressionNamespaces)
+	}
+
+	if dcReplication != "" {
+		c.DCReplication = parseReplication(dcReplication)
+	}
+
+	if replicateTo != "" {
+		c.ReplicateTo = strings.Split(replicateTo, ",")
+	}
+}
+
+// total replicas of a key, summed over datacenters when those are set
+func (c *Config) Replicas() int {
+	if len(c.DCReplication) == 0 {
+		return c.ReplicationN
+	}
+
+	total := 0
+	for _, n := range c.DCReplication {
+		total += n
+	}
+	return total
+}
+
+// parses "east=3,west=2", skipping pairs without a positive count
+func parseReplication(s string) map[string]int {
+	result := make(map[string]int)
+
+	for dc, v := range ParseKeyValues(s) {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			result[dc] = n
+		}
+	}
+
+	return result
+}
+
+// parses "localhost:9001=2,localhost:9011=0.5", skipping pairs without a
+// positive weight
+func ParseWeights(s string) map[string]float64 {
+	result := make(map[string]float64)
+
+	for node, v := range ParseKeyValues(s) {
+		if w, err := strconv.ParseFloat(v, 64); err == nil && w > 0 {
+			result[node] = w
+		}
+	}
+
+	return result
+}
+
+// parses "a=x,b=y" into a map, skipping malformed pairs
+func ParseKeyValues(s string) map[string]string {
+	result := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" {
+			continue
+		}
+		result[k] = v
+	}
+
+	return result
 }
 
 func generateNodeID() string {
@@ -31,3 +31,32 @@ func TestEnvOverride(t *testing.T) {
 		t.Errorf("Expected HTTPPort 8080 from env, got %d", cfg.HTTPPort)
 	}
 }
+
+func TestParseKeyValues(t *testing.T) {
+	result := ParseKeyValues("docs=zstd, cache=none,bogus,=x")
+
+	if len(result) != 2 || result["docs"] != "zstd" || result["cache"] != "none" {
+		t.Errorf("Unexpected parse result: %v", result)
+	}
+}
+
+func TestDCReplication(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DCReplication = parseReplication("east=3, west=2,bad=x,none=0")
+
+	if len(cfg.DCReplication) != 2 || cfg.DCReplication["east"] != 3 || cfg.DCReplication["west"] != 2 {
+		t.Errorf("Unexpected parse result: %v", cfg.DCReplication)
+	}
+
+	if cfg.Replicas() != 5 {
+		t.Errorf("Expected 5 replicas, got %d", cfg.Replicas())
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	weights := ParseWeights("localhost:9001=2, localhost:9011=0.5,localhost:9021=-1,bad=x")
+
+	if len(weights) != 2 || weights["localhost:9001"] != 2 || weights["localhost:9011"] != 0.5 {
+		t.Errorf("Unexpected parse result: %v", weights)
+	}
+}
@@ -0,0 +1,164 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/AuraReaper/strangedb/internal/telemetry"
+)
+
+var (
+	ErrOverloaded = errors.New("node overloaded")
+	ErrPeerBusy   = errors.New("peer busy")
+)
+
+type AdmissionOptions struct {
+	// requests coordinated at once, 0 for no limit
+	MaxInFlight int
+	// requests waiting for a slot; more are shed
+	MaxQueued int
+	// longest a request waits for a slot, also bounded by its context
+	QueueTimeout time.Duration
+	// requests this node has outstanding at each peer, 0 for no limit
+	MaxPeerInFlight int
+}
+
+// bounds the requests a node coordinates at once. a request past the
+// limit waits in a queue until a slot frees up, its context ends or the
+// queue timeout passes; when the queue is full it is shed right away
+type admission struct {
+	slots        chan struct{}
+	queued       atomic.Int64
+	maxQueued    int64
+	queueTimeout time.Duration
+
+	maxPeer int
+	mu      sync.Mutex
+	peers   map[string]chan struct{}
+}
+
+func newAdmission(opts AdmissionOptions) *admission {
+	a := &admission{
+		maxQueued:    int64(opts.MaxQueued),
+		queueTimeout: opts.QueueTimeout,
+		maxPeer:      opts.MaxPeerInFlight,
+		peers:        make(map[string]chan struct{}),
+	}
+	if opts.MaxInFlight > 0 {
+		a.slots = make(chan struct{}, opts.MaxInFlight)
+	}
+	return a
+}
+
+func (c *Coordinator) SetAdmission(opts AdmissionOptions) {
+	c.admission = newAdmission(opts)
+}
+
+// waits for a slot; release must be called once the request is done
+func (c *Coordinator) admit(ctx context.Context) (release func(), err error) {
+	a := c.admission
+	// a request out of time is not worth starting
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	if a == nil || a.slots == nil {
+		return func() {}, nil
+	}
+
+	release = func() {
+		<-a.slots
+		telemetry.AdmissionInFlight.Dec()
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		telemetry.AdmissionInFlight.Inc()
+		return release, nil
+	default:
+	}
+
+	if a.queued.Add(1) > a.maxQueued {
+		a.queued.Add(-1)
+		telemetry.AdmissionRejections.WithLabelValues("queue_full").Inc()
+		return nil, ErrOverloaded
+	}
+	telemetry.AdmissionQueueDepth.Inc()
+	defer func() {
+		a.queued.Add(-1)
+		telemetry.AdmissionQueueDepth.Dec()
+	}()
+
+	var timeout <-chan time.Time
+	if a.queueTimeout > 0 {
+		timer := time.NewTimer(a.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		telemetry.AdmissionInFlight.Inc()
+		return release, nil
+	case <-timeout:
+		telemetry.AdmissionRejections.WithLabelValues("queue_timeout").Inc()
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		err := contextError(ctx)
+		reason := "canceled"
+		if err == ErrTimeout {
+			reason = "deadline"
+		}
+		telemetry.AdmissionRejections.WithLabelValues(reason).Inc()
+		return nil, err
+	}
+}
+
+// runs call unless addr already has MaxPeerInFlight requests from this
+// node. a busy peer fails at once instead of queueing, so a slow node
+// does not pile up goroutines here; it counts as a failed replica, and a
+// write it was not sent is kept as a hint (see hintBusy)
+func (c *Coordinator) callPeer(addr string, call func() error) error {
+	a := c.admission
+	if a == nil || a.maxPeer <= 0 {
+		return call()
+	}
+
+	a.mu.Lock()
+	slots, ok := a.peers[addr]
+	if !ok {
+		slots = make(chan struct{}, a.maxPeer)
+		a.peers[addr] = slots
+	}
+	a.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		telemetry.AdmissionRejections.WithLabelValues("peer_busy").Inc()
+		return ErrPeerBusy
+	}
+
+	telemetry.PeerInFlight.WithLabelValues(addr).Inc()
+	defer func() {
+		<-slots
+		telemetry.PeerInFlight.WithLabelValues(addr).Dec()
+	}()
+
+	return call()
+}
+
+// keeps the records of a write a busy peer was not sent, for hinted
+// handoff to deliver once it has room. a peer that failed the call itself
+// may have applied it, and is left to anti-entropy
+func (c *Coordinator) hintBusy(addr string, err error, records ...*storage.Record) {
+	if c.hintStore == nil || !errors.Is(err, ErrPeerBusy) {
+		return
+	}
+	for _, record := range records {
+		c.hintStore.AddHint(addr, record)
+	}
+}
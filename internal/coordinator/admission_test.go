@@ -0,0 +1,155 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+)
+
+func TestAdmitShedsWhenQueueFull(t *testing.T) {
+	c := setupTestCoordinator(t)
+	c.SetAdmission(AdmissionOptions{MaxInFlight: 1})
+	ctx := context.Background()
+
+	release, err := c.admit(ctx)
+	if err != nil {
+		t.Fatalf("admit failed: %v", err)
+	}
+
+	if _, err := c.Set(ctx, "k", []byte("v"), ""); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Set error = %v with no queue, want %v", err, ErrOverloaded)
+	}
+
+	release()
+	if _, err := c.Set(ctx, "k", []byte("v"), ""); err != nil {
+		t.Fatalf("Set failed once the slot was free: %v", err)
+	}
+}
+
+func TestAdmitQueues(t *testing.T) {
+	c := setupTestCoordinator(t)
+	c.SetAdmission(AdmissionOptions{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	release, err := c.admit(ctx)
+	if err != nil {
+		t.Fatalf("admit failed: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := c.admit(ctx); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("admit error = %v after the queue timeout, want %v", err, ErrOverloaded)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("shed after %v, want a wait of the queue timeout", waited)
+	}
+
+	// a queued request gets the slot once it is released
+	time.AfterFunc(10*time.Millisecond, release)
+	next, err := c.admit(ctx)
+	if err != nil {
+		t.Fatalf("queued admit failed: %v", err)
+	}
+	next()
+
+	// its own deadline ends the wait first
+	hold, _ := c.admit(ctx)
+	defer hold()
+	deadline, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.admit(deadline); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("admit error = %v past the deadline, want %v", err, ErrTimeout)
+	}
+}
+
+// a peer whose writes hang until released, and which keeps the records
+// of merged batches
+type slowPeer struct {
+	pb.UnimplementedNodeServiceServer
+
+	started chan struct{}
+	release chan struct{}
+
+	mu     sync.Mutex
+	merged []*pb.Record
+}
+
+func (p *slowPeer) Set(context.Context, *pb.SetRequest) (*pb.SetResponse, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return &pb.SetResponse{Success: true}, nil
+}
+
+func (p *slowPeer) BatchSet(_ context.Context, req *pb.BatchSetRequest) (*pb.BatchSetResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if req.Merge {
+		p.merged = append(p.merged, req.Records...)
+	}
+	return &pb.BatchSetResponse{Written: uint32(len(req.Records))}, nil
+}
+
+func TestBusyPeerGetsHint(t *testing.T) {
+	peer := &slowPeer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	addr := startPeer(t, peer)
+
+	c := setupClusterCoordinator(t, addr)
+	c.SetAdmission(AdmissionOptions{MaxPeerInFlight: 1})
+	hints := NewHintStore(10, time.Hour)
+	c.SetHintStore(hints)
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Set(ctx, "first", []byte("v"), "")
+		done <- err
+	}()
+	<-peer.started
+
+	// the peer's one slot is taken, so it is not sent these
+	if _, err := c.Set(ctx, "second", []byte("v"), ""); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := c.Delete(ctx, "third"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	close(peer.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	kept := hints.GetHints(addr)
+	if len(kept) != 2 || kept[0].Record.Key != "second" || kept[1].Record.Key != "third" || !kept[1].Record.Tombstone {
+		t.Fatalf("hints for the busy peer = %+v, want second and the tombstone of third", kept)
+	}
+
+	NewHintedHandoff(hints, c.grpcClient, time.Hour).replayOnce()
+
+	if len(peer.merged) != 2 {
+		t.Fatalf("peer was merged %d records, want the 2 hints", len(peer.merged))
+	}
+	if left := hints.GetHints(addr); len(left) != 0 {
+		t.Errorf("%d hints left after they were delivered", len(left))
+	}
+}
+
+func TestFailedPeerGetsNoHint(t *testing.T) {
+	// nothing listens here, so the call itself fails
+	c := setupClusterCoordinator(t, "127.0.0.1:1")
+	c.grpcClient.SetPeerAlive("127.0.0.1:1", false)
+	hints := NewHintStore(10, time.Hour)
+	c.SetHintStore(hints)
+
+	if _, err := c.Set(context.Background(), "k", []byte("v"), ""); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if kept := hints.GetHints("127.0.0.1:1"); len(kept) != 0 {
+		t.Errorf("kept %d hints for a peer that failed the call", len(kept))
+	}
+}
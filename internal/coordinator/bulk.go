@@ -0,0 +1,389 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+)
+
+type ScanPage struct {
+	Records []*storage.Record
+	// pass back as after for the next page; empty once the scan is done
+	Next string
+}
+
+// pages through every key in the cluster in key order. each node is
+// asked for its next limit keys and the newest version of every key
+// wins; keys past the end of a node's page are held back, since that
+// node may still have a newer version of them. deleted keys are left
+// out of the page but still move the cursor. with an order preserving
+// partitioner only the nodes owning the prefix are asked
+func (c *Coordinator) Scan(ctx context.Context, prefix, after string, limit int) (*ScanPage, error) {
+	release, err := c.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	nodes := c.ring.PrefixReplicas(prefix, c.replicationN)
+	if len(nodes) == 0 {
+		return nil, ErrNoNodesAvailable
+	}
+
+	type scanResult struct {
+		records []*storage.Record
+		err     error
+		node    string
+	}
+
+	resultCh := make(chan scanResult, len(nodes))
+	var wg sync.WaitGroup
+
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			var records []*storage.Record
+			var err error
+
+			if addr == c.nodeURL {
+				// local
+				records, err = c.storage.Scan(prefix, after, limit)
+			} else {
+				// remote
+				var resp *pb.ScanResponse
+				e := c.callPeer(addr, func() (err error) {
+					resp, err = c.grpcClient.Scan(ctx, addr, &pb.ScanRequest{
+						Prefix: prefix,
+						After:  after,
+						Limit:  uint32(limit),
+					})
+					return err
+				})
+				if e != nil {
+					err = e
+				} else {
+					for _, r := range resp.Records {
+						records = append(records, grpcTransport.RecordFromProto(r))
+					}
+				}
+			}
+
+			resultCh <- scanResult{records: records, err: err, node: addr}
+		}(node)
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	latest := make(map[string]*storage.Record)
+	var failedNodes []string
+	var errs []error
+	var cutoff string
+	complete := true
+
+	for res := range resultCh {
+		if res.err != nil {
+			failedNodes = append(failedNodes, res.node)
+			errs = append(errs, res.err)
+			continue
+		}
+
+		for _, r := range res.records {
+			if current, ok := latest[r.Key]; !ok || hlc.IsAfter(r.Timestamp, current.Timestamp) {
+				latest[r.Key] = r
+			}
+		}
+
+		if len(res.records) == limit {
+			last := res.records[len(res.records)-1].Key
+			if complete || last < cutoff {
+				cutoff = last
+			}
+			complete = false
+		}
+	}
+
+	// every key lives on replicationN nodes, so losing fewer than that
+	// still sees each key at least once
+	if len(failedNodes) >= min(c.replicationN, len(nodes)) {
+		c.log.Error().Strs("failed_nodes", failedNodes).Msg("scan failed: too many nodes unavailable")
+		return nil, quorumError(ctx, errs)
+	}
+
+	keys := make([]string, 0, len(latest))
+	for key := range latest {
+		if complete || key <= cutoff {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	page := &ScanPage{}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		complete = false
+	}
+	if !complete {
+		page.Next = keys[len(keys)-1]
+	}
+
+	for _, key := range keys {
+		if r := latest[key]; !r.Tombstone {
+			page.Records = append(page.Records, r)
+		}
+	}
+
+	return page, nil
+}
+
+// how far ahead of this node's clock a preserved timestamp may be
+const DefaultMaxClockSkew = 500 * time.Millisecond
+
+var ErrClockSkew = errors.New("timestamp too far in the future")
+
+// bounds the preserved timestamps of batches and replicated writes. the
+// clock moves up to the newest of them, so one far in the future would
+// make every later write lose to it. 0 turns the check off
+func (c *Coordinator) SetMaxClockSkew(d time.Duration) {
+	c.maxClockSkew = d
+}
+
+type BatchResult struct {
+	Written int
+	// keys whose replica set acknowledged none of the writes
+	Failed []string
+}
+
+// writes many records, grouped by replica set so each replica receives a
+// single request per group. records without a timestamp get one from the
+// local clock; preserved timestamps advance the clock past them, and a
+// replica keeps its stored version of a key when it is newer than the
+// preserved one, so an import never rolls back a live write. a group of
+// keys counts as written once the consistency level of ctx is met on
+// its replicas, or at the default level once any replica took it
+func (c *Coordinator) Batch(ctx context.Context, records []*storage.Record) (*BatchResult, error) {
+	release, err := c.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// a batch is refused as a whole when it would take a namespace over
+	// its quota
+	sizes := make(map[string]int64)
+	for _, record := range records {
+		sizes[storage.Namespace(record.Key)] += int64(len(record.Value))
+	}
+	for _, record := range records {
+		if err := c.checkQuota(ctx, "BATCH", record.Key, sizes[storage.Namespace(record.Key)]); err != nil {
+			return nil, err
+		}
+	}
+
+	preserved := slices.ContainsFunc(records, func(r *storage.Record) bool {
+		return r.Timestamp.WallTime != 0
+	})
+	result, err := c.batch(ctx, records, "BATCH", preserved)
+
+	if c.auditor != nil {
+		failed := make(map[string]bool)
+		if result != nil {
+			for _, key := range result.Failed {
+				failed[key] = true
+			}
+		}
+
+		for _, record := range records {
+			recordErr := err
+			if failed[record.Key] {
+				recordErr = ErrQuorumNotReached
+			}
+			c.audit(ctx, "BATCH", record.Key, record.Timestamp, recordErr)
+		}
+	}
+
+	return result, err
+}
+
+// with merge set, replicas keep their stored version of a key when it is
+// newer than the batch's
+func (c *Coordinator) batch(ctx context.Context, records []*storage.Record, operation string, merge bool) (*BatchResult, error) {
+	type group struct {
+		replicas []string
+		records  []*storage.Record
+	}
+
+	for _, record := range records {
+		if err := c.checkSkew(record.Key, record.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := make(map[string]*group)
+	for _, record := range records {
+		if record.Timestamp.WallTime == 0 {
+			record.Timestamp = c.clock.Now()
+		} else {
+			c.clock.Update(record.Timestamp)
+		}
+
+		replicas := c.ring.GetReplicas(record.Key, c.replicationN)
+		if len(replicas) == 0 {
+			return nil, ErrNoNodesAvailable
+		}
+
+		id := strings.Join(replicas, ",")
+		if groups[id] == nil {
+			groups[id] = &group{replicas: replicas}
+		}
+		groups[id].records = append(groups[id].records, record)
+	}
+
+	level := consistencyFrom(ctx)
+	result := &BatchResult{}
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *group) {
+			defer wg.Done()
+
+			tracker := c.newAckTracker(level, g.replicas, c.writeQuorum)
+			acks, groupErrs := c.writeGroup(ctx, tracker, g.replicas, g.records, merge)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			errs = append(errs, groupErrs...)
+
+			if !written(level, tracker, acks) {
+				for _, r := range g.records {
+					result.Failed = append(result.Failed, r.Key)
+				}
+				return
+			}
+			result.Written += len(g.records)
+		}(g)
+	}
+
+	wg.Wait()
+
+	log := c.log.With().
+		Str("operation", operation).
+		Stringer("consistency", level).
+		Int("records", len(records)).
+		Int("replica_sets", len(groups)).
+		Int("failed", len(result.Failed)).
+		Logger()
+
+	if result.Written == 0 && len(records) > 0 {
+		log.Error().Msg("quorum not reached, batch failed")
+		return result, quorumError(ctx, errs)
+	}
+
+	log.Info().Msg("batch operation finished")
+	return result, nil
+}
+
+// refuses a preserved timestamp too far ahead of the local clock, which
+// would otherwise drag the clock along with it
+func (c *Coordinator) checkSkew(key string, ts hlc.Timestamp) error {
+	if c.maxClockSkew > 0 && ts.WallTime > time.Now().Add(c.maxClockSkew).UnixNano() {
+		return fmt.Errorf("%w: %s at %v", ErrClockSkew, key, time.Unix(0, ts.WallTime).UTC())
+	}
+	return nil
+}
+
+// whether a group write counts as written: at the default level any
+// ack does, like single writes; other levels need the tracker met
+func written(level Consistency, tracker *ackTracker, acks int) bool {
+	if level == ConsistencyDefault {
+		return acks > 0
+	}
+	return tracker.met()
+}
+
+// sends one replica set its records and returns how many replicas
+// acknowledged them and why the others did not. acks are counted in
+// tracker, which may span replicas not asked here; fewer than the write
+// quorum is logged
+func (c *Coordinator) writeGroup(ctx context.Context, tracker *ackTracker, replicas []string, records []*storage.Record, merge bool) (int, []error) {
+	var protoRecords []*pb.Record
+	acks := 0
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, replica := range replicas {
+		if replica != c.nodeURL && protoRecords == nil {
+			protoRecords = make([]*pb.Record, len(records))
+			for i, r := range records {
+				protoRecords[i] = grpcTransport.RecordToProto(r)
+			}
+		}
+
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			var err error
+			switch {
+			case addr == c.nodeURL && merge:
+				_, err = c.storage.MergeBatch(records)
+			case addr == c.nodeURL:
+				err = c.storage.SetBatch(records)
+			case merge:
+				err = c.callPeer(addr, func() error {
+					_, err := c.grpcClient.MergeBatch(ctx, addr, protoRecords)
+					return err
+				})
+			default:
+				err = c.callPeer(addr, func() error {
+					_, err := c.grpcClient.BatchSet(ctx, addr, protoRecords)
+					return err
+				})
+			}
+			c.hintBusy(addr, err, records...)
+
+			if err != nil {
+				c.log.Warn().Err(err).Str("node", addr).Msg("batch write to replica failed")
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			acks++
+			tracker.ack(addr)
+			mu.Unlock()
+		}(replica)
+	}
+
+	wg.Wait()
+
+	if acks < c.writeQuorum {
+		c.log.Warn().
+			Strs("replicas", replicas).
+			Int("acks_received", acks).
+			Int("quorum_required", c.writeQuorum).
+			Msg("quorum not reached for batch, returning partial results")
+	}
+
+	return acks, errs
+}
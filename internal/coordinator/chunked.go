@@ -0,0 +1,400 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+)
+
+var ErrChunkUnavailable = errors.New("chunk unavailable on all replicas")
+
+// size of each chunk of a large value; well under the gRPC message limit
+const ChunkSize = 1 << 20
+
+// one replica receiving the chunks of an upload
+type chunkSink struct {
+	addr   string
+	stream pb.NodeService_PutChunksClient // nil for the local node
+	err    error
+}
+
+// stores a value of any size read from r. the value is split into
+// chunks that are streamed to every replica; the manifest that makes
+// the object visible is written only once all chunks reached the write
+// quorum, so readers see either the previous value or the whole new one
+func (c *Coordinator) SetLarge(ctx context.Context, key string, r io.Reader, contentType string) (*storage.Record, error) {
+	return c.setLarge(ctx, key, r, contentType, hlc.Timestamp{})
+}
+
+// stores a large value under a preserved timestamp, the chunked
+// counterpart of a Batch record carrying one: the clock advances past
+// it, and a replica keeps its stored version when that is newer
+func (c *Coordinator) ImportLarge(ctx context.Context, key string, r io.Reader, contentType string, ts hlc.Timestamp) (*storage.Record, error) {
+	if ts.WallTime == 0 {
+		return c.SetLarge(ctx, key, r, contentType)
+	}
+	return c.setLarge(ctx, key, r, contentType, ts)
+}
+
+// a zero ts takes one from the local clock
+func (c *Coordinator) setLarge(ctx context.Context, key string, r io.Reader, contentType string, ts hlc.Timestamp) (*storage.Record, error) {
+	operation := "SET_LARGE"
+	if ts.WallTime != 0 {
+		operation = "IMPORT_LARGE"
+	}
+
+	release, err := c.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	replicas := c.ring.GetReplicas(key, c.replicationN)
+	if len(replicas) == 0 {
+		return nil, ErrNoNodesAvailable
+	}
+	if err := c.checkQuota(ctx, operation, key, 0); err != nil {
+		return nil, err
+	}
+	if ts.WallTime != 0 {
+		if err := c.checkSkew(key, ts); err != nil {
+			return nil, err
+		}
+		c.clock.Update(ts)
+	}
+
+	uploadID := newUploadID()
+
+	log := c.log.With().
+		Str("key", key).
+		Str("operation", operation).
+		Str("upload_id", uploadID).
+		Strs("replicas", replicas).
+		Int("quorum_required", c.writeQuorum).
+		Logger()
+
+	log.Info().Msg("performing chunked set operation")
+
+	// chunks are only counted by the periodic recount, so the upload so
+	// far is added here
+	quota := func(size int64) error {
+		return c.checkQuota(ctx, operation, key, size)
+	}
+
+	manifest, failed, err := c.uploadChunks(ctx, log, key, uploadID, replicas, r, quota)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := json.Marshal(manifest)
+	if err != nil {
+		c.dropUpload(key, uploadID, replicas)
+		return nil, err
+	}
+
+	record := &storage.Record{
+		Key:         key,
+		Value:       value,
+		Timestamp:   ts,
+		ContentType: contentType,
+		Manifest:    true,
+	}
+
+	if ts.WallTime == 0 {
+		record.Timestamp = c.clock.Now()
+
+		// some replicas may have stored the manifest when this fails, so
+		// the chunks stay; where no manifest names them they are
+		// collected as orphans
+		return c.writeExcept(ctx, record, operation, failed)
+	}
+
+	var ok []string
+	for _, addr := range replicas {
+		if _, missed := failed[addr]; !missed {
+			ok = append(ok, addr)
+		}
+	}
+
+	level := consistencyFrom(ctx)
+	tracker := c.newAckTracker(level, replicas, c.writeQuorum)
+	acks, errs := c.writeGroup(ctx, tracker, ok, []*storage.Record{record}, true)
+	if !written(level, tracker, acks) {
+		err = quorumError(ctx, errs)
+	}
+	c.audit(ctx, operation, key, ts, err)
+	if err != nil {
+		log.Error().Int("acks_received", acks).Stringer("consistency", level).Msg("manifest write failed")
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// streams the value read from r to every replica as chunks of an upload.
+// it fails, dropping the upload, unless the write quorum received every
+// chunk; replicas that missed some are returned in failed with their
+// chunks dropped, so they are not sent a manifest pointing at data they
+// do not have and keep the previous value until repaired
+func (c *Coordinator) uploadChunks(ctx context.Context, log zerolog.Logger, key, uploadID string, replicas []string, r io.Reader, quota func(size int64) error) (*storage.Manifest, map[string]error, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sinks := make([]*chunkSink, len(replicas))
+	for i, addr := range replicas {
+		sinks[i] = &chunkSink{addr: addr}
+		if addr != c.nodeURL {
+			sinks[i].stream, sinks[i].err = c.grpcClient.PutChunks(streamCtx, addr)
+		}
+	}
+
+	abort := func() {
+		// cancelling the streams makes remote replicas drop their chunks
+		cancel()
+		c.dropUpload(key, uploadID, replicas)
+	}
+
+	manifest := &storage.Manifest{
+		UploadID:  uploadID,
+		ChunkSize: ChunkSize,
+	}
+
+	buf := make([]byte, ChunkSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			data := buf[:n]
+			sum := sha256.Sum256(data)
+			manifest.Chunks = append(manifest.Chunks, hex.EncodeToString(sum[:]))
+			manifest.Size += int64(n)
+
+			if quota != nil {
+				if err := quota(manifest.Size); err != nil {
+					log.Warn().Err(err).Msg("upload aborted")
+					abort()
+					return nil, nil, err
+				}
+			}
+
+			if alive := c.sendChunk(sinks, key, uploadID, index, data); alive < c.writeQuorum {
+				log.Error().Int("replicas_alive", alive).Msg("quorum lost while streaming chunks")
+				abort()
+				return nil, nil, quorumError(ctx, sinkErrors(sinks))
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("reading value failed")
+			abort()
+			return nil, nil, err
+		}
+	}
+
+	var failedNodes []string
+	failed := make(map[string]error)
+	acked := 0
+	for _, sink := range sinks {
+		if sink.err == nil && sink.stream != nil {
+			_, sink.err = sink.stream.CloseAndRecv()
+		}
+		if sink.err == nil {
+			acked++
+		} else {
+			failedNodes = append(failedNodes, sink.addr)
+			failed[sink.addr] = sink.err
+		}
+	}
+
+	log.Info().
+		Int("chunks", len(manifest.Chunks)).
+		Int64("size", manifest.Size).
+		Int("acks_received", acked).
+		Strs("failed_nodes", failedNodes).
+		Msg("chunks uploaded")
+
+	if acked < c.writeQuorum {
+		log.Error().Msg("quorum not reached for chunks, upload aborted")
+		abort()
+		return nil, nil, quorumError(ctx, sinkErrors(sinks))
+	}
+
+	c.dropUpload(key, uploadID, failedNodes)
+	return manifest, failed, nil
+}
+
+func sinkErrors(sinks []*chunkSink) []error {
+	var errs []error
+	for _, sink := range sinks {
+		if sink.err != nil {
+			errs = append(errs, sink.err)
+		}
+	}
+	return errs
+}
+
+// writes one chunk to every healthy sink in parallel and returns how
+// many are still healthy afterwards
+func (c *Coordinator) sendChunk(sinks []*chunkSink, key, uploadID string, index int, data []byte) int {
+	var wg sync.WaitGroup
+
+	for _, sink := range sinks {
+		if sink.err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(sink *chunkSink) {
+			defer wg.Done()
+
+			if sink.stream == nil {
+				// local
+				sink.err = c.storage.SetChunk(key, uploadID, index, data)
+				return
+			}
+
+			// remote
+			sink.err = sink.stream.Send(&pb.Chunk{
+				Key:      key,
+				UploadId: uploadID,
+				Index:    uint32(index),
+				Data:     data,
+			})
+		}(sink)
+	}
+
+	wg.Wait()
+
+	alive := 0
+	for _, sink := range sinks {
+		if sink.err == nil {
+			alive++
+		}
+	}
+
+	return alive
+}
+
+// best effort removal of an upload's chunks from every replica
+func (c *Coordinator) dropUpload(key, uploadID string, replicas []string) {
+	for _, addr := range replicas {
+		if addr == c.nodeURL {
+			c.storage.DeleteChunks(key, uploadID)
+			continue
+		}
+
+		go c.grpcClient.DeleteChunks(context.Background(), addr, key, uploadID)
+	}
+}
+
+// returns a reader over the object a manifest record describes. chunks
+// are fetched lazily, from the local node first, and verified against
+// the manifest so a corrupt or missing copy falls through to the next
+// replica
+func (c *Coordinator) OpenLarge(ctx context.Context, record *storage.Record) (io.Reader, *storage.Manifest, error) {
+	manifest, err := storage.ParseManifest(record)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replicas := c.ring.GetReplicas(record.Key, c.replicationN)
+	if i := slices.Index(replicas, c.nodeURL); i > 0 {
+		replicas[0], replicas[i] = replicas[i], replicas[0]
+	}
+
+	return &chunkReader{
+		ctx:         ctx,
+		coordinator: c,
+		key:         record.Key,
+		manifest:    manifest,
+		replicas:    replicas,
+	}, manifest, nil
+}
+
+type chunkReader struct {
+	ctx         context.Context
+	coordinator *Coordinator
+	key         string
+	manifest    *storage.Manifest
+	replicas    []string
+	next        int
+	buf         bytes.Reader
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.next >= len(r.manifest.Chunks) {
+			return 0, io.EOF
+		}
+
+		data, err := r.coordinator.fetchChunk(r.ctx, r.replicas, r.key, r.manifest, r.next)
+		if err != nil {
+			return 0, err
+		}
+
+		r.buf.Reset(data)
+		r.next++
+	}
+
+	return r.buf.Read(p)
+}
+
+func (c *Coordinator) fetchChunk(ctx context.Context, replicas []string, key string, manifest *storage.Manifest, index int) ([]byte, error) {
+	for _, addr := range replicas {
+		var data []byte
+
+		if addr == c.nodeURL {
+			// local read
+			d, err := c.storage.GetChunk(key, manifest.UploadID, index)
+			if err != nil {
+				continue
+			}
+			data = d
+		} else {
+			// remote read
+			resp, err := c.grpcClient.GetChunk(ctx, addr, &pb.GetChunkRequest{
+				Key:      key,
+				UploadId: manifest.UploadID,
+				Index:    uint32(index),
+			})
+			if err != nil || !resp.Found {
+				continue
+			}
+			data = resp.Data
+		}
+
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != manifest.Chunks[index] {
+			c.log.Warn().
+				Str("key", key).
+				Str("node", addr).
+				Int("chunk", index).
+				Msg("chunk checksum mismatch")
+			continue
+		}
+
+		return data, nil
+	}
+
+	return nil, ErrChunkUnavailable
+}
+
+func newUploadID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
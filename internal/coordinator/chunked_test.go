@@ -0,0 +1,192 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// a replica running the node service over its own storage
+func startReplica(t *testing.T) (*storage.BadgerStorage, string) {
+	store := setupTestStorage(t)
+	return store, startPeer(t, grpcTransport.NewServer(0, store, hlc.NewClock("replica")))
+}
+
+// a replica that stores the first chunk of each upload and then drops
+// the connection, without cleaning up
+type brokenUploads struct {
+	*grpcTransport.Server
+	store     *storage.BadgerStorage
+	upload    atomic.Value // upload id of the last upload
+	manifests atomic.Int32
+}
+
+func (r *brokenUploads) PutChunks(stream pb.NodeService_PutChunksServer) error {
+	chunk, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	r.store.SetChunk(chunk.Key, chunk.UploadId, int(chunk.Index), chunk.Data)
+	r.upload.Store(chunk.UploadId)
+	return status.Error(codes.Unavailable, "connection reset")
+}
+
+func (r *brokenUploads) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	r.manifests.Add(1)
+	return r.Server.Set(ctx, req)
+}
+
+func startBrokenReplica(t *testing.T) (*brokenUploads, string) {
+	store := setupTestStorage(t)
+	r := &brokenUploads{Server: grpcTransport.NewServer(0, store, hlc.NewClock("replica")), store: store}
+	return r, startPeer(t, r)
+}
+
+func largeValue() []byte {
+	return bytes.Repeat([]byte("0123456789"), ChunkSize/4)
+}
+
+func TestSetLargeAcrossReplicas(t *testing.T) {
+	replica, addr := startReplica(t)
+	c := setupClusterCoordinator(t, addr)
+	ctx := context.Background()
+
+	value := largeValue()
+	if _, err := c.SetLarge(ctx, "blob", bytes.NewReader(value), "application/octet-stream"); err != nil {
+		t.Fatalf("SetLarge failed: %v", err)
+	}
+
+	record, err := replica.Get("blob")
+	if err != nil || !record.Manifest {
+		t.Fatalf("replica has %v, %v, want the manifest", record, err)
+	}
+	manifest, err := storage.ParseManifest(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Chunks) != 3 {
+		t.Fatalf("value in %d chunks, want 3", len(manifest.Chunks))
+	}
+
+	if data := readLarge(t, c, "blob"); !bytes.Equal(data, value) {
+		t.Fatalf("read %d bytes, want %d", len(data), len(value))
+	}
+
+	// with the local copy gone the chunks come from the replica
+	c.storage.DeleteChunks("blob", manifest.UploadID)
+	if data := readLarge(t, c, "blob"); !bytes.Equal(data, value) {
+		t.Fatalf("read %d bytes from the replica, want %d", len(data), len(value))
+	}
+}
+
+func TestSetLargeSkipsReplicaMissingChunks(t *testing.T) {
+	replica, addr := startBrokenReplica(t)
+	c := setupClusterCoordinator(t, addr)
+	ctx := context.Background()
+
+	value := largeValue()
+	if _, err := c.SetLarge(ctx, "blob", bytes.NewReader(value), ""); err != nil {
+		t.Fatalf("SetLarge failed: %v", err)
+	}
+	if data := readLarge(t, c, "blob"); !bytes.Equal(data, value) {
+		t.Fatalf("read %d bytes, want %d", len(data), len(value))
+	}
+
+	if n := replica.manifests.Load(); n != 0 {
+		t.Errorf("replica missing chunks was sent %d manifests", n)
+	}
+	if _, err := replica.store.Get("blob"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("replica Get = %v, want no value", err)
+	}
+
+	// the chunk it did get is dropped
+	upload := replica.upload.Load().(string)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := replica.store.GetChunk("blob", upload, 0); errors.Is(err, storage.ErrKeyNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("chunk of the failed upload left on the replica")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSetLargeAbortsWithoutQuorum(t *testing.T) {
+	_, addr := startBrokenReplica(t)
+	c := setupClusterCoordinator(t, addr)
+	c.writeQuorum = 2
+	ctx := context.Background()
+
+	if _, err := c.SetLarge(ctx, "blob", bytes.NewReader(largeValue()), ""); !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("SetLarge error = %v, want %v", err, ErrQuorumNotReached)
+	}
+	if _, err := c.storage.Get("blob"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Get = %v after the aborted upload, want no value", err)
+	}
+	if dropped, err := c.storage.(*storage.BadgerStorage).DropOrphanChunks(); err != nil || dropped != 0 {
+		t.Errorf("%d uploads left behind (%v), want the chunks dropped", dropped, err)
+	}
+}
+
+func TestReplicateLargeKeepsTimestamp(t *testing.T) {
+	west := setupTestCoordinator(t)
+	west.SetClusterID("west")
+	ctx := context.Background()
+
+	value := largeValue()
+	shipped, err := west.SetLarge(ctx, "blob", bytes.NewReader(value), "application/octet-stream")
+	if err != nil {
+		t.Fatalf("SetLarge failed: %v", err)
+	}
+	r, _, err := west.OpenLarge(ctx, shipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replica, addr := startReplica(t)
+	east := setupClusterCoordinator(t, addr)
+	east.SetClusterID("east")
+	if err := east.ReplicateLarge(ctx, "west", shipped, r); err != nil {
+		t.Fatalf("ReplicateLarge failed: %v", err)
+	}
+
+	record, err := replica.Get("blob")
+	if err != nil || !record.Manifest {
+		t.Fatalf("replica has %v, %v, want the manifest", record, err)
+	}
+	if hlc.Compare(record.Timestamp, shipped.Timestamp) != 0 || record.Origin != "west" {
+		t.Errorf("replica has timestamp %v from %q, want %v from west", record.Timestamp, record.Origin, shipped.Timestamp)
+	}
+	if record.ContentType != "application/octet-stream" {
+		t.Errorf("content type %q, want application/octet-stream", record.ContentType)
+	}
+	if data := readLarge(t, east, "blob"); !bytes.Equal(data, value) {
+		t.Fatalf("read %d bytes, want %d", len(data), len(value))
+	}
+
+	// a value cut short does not match its manifest and is not stored
+	err = east.ReplicateLarge(ctx, "west", &storage.Record{
+		Key:       "cut",
+		Value:     shipped.Value,
+		Timestamp: shipped.Timestamp,
+		Manifest:  true,
+	}, bytes.NewReader(value[:ChunkSize]))
+	if !errors.Is(err, ErrValueMismatch) {
+		t.Fatalf("ReplicateLarge error = %v, want %v", err, ErrValueMismatch)
+	}
+	if _, err := east.storage.Get("cut"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Get = %v after the mismatch, want no value", err)
+	}
+}
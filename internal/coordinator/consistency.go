@@ -0,0 +1,155 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// how many replicas must answer before an operation succeeds
+type Consistency int
+
+const (
+	// the configured read or write quorum; succeeds with fewer acks as
+	// long as one replica answered
+	ConsistencyDefault Consistency = iota
+	ConsistencyOne
+	ConsistencyQuorum
+	// a quorum of the replicas in the coordinator's datacenter
+	ConsistencyLocalQuorum
+	// a quorum of the replicas in every datacenter
+	ConsistencyEachQuorum
+	ConsistencyAll
+)
+
+var ErrInvalidConsistency = errors.New("invalid consistency level, use one, quorum, local_quorum, each_quorum or all")
+
+func ParseConsistency(s string) (Consistency, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return ConsistencyDefault, nil
+	case "one":
+		return ConsistencyOne, nil
+	case "quorum":
+		return ConsistencyQuorum, nil
+	case "local_quorum":
+		return ConsistencyLocalQuorum, nil
+	case "each_quorum":
+		return ConsistencyEachQuorum, nil
+	case "all":
+		return ConsistencyAll, nil
+	default:
+		return ConsistencyDefault, ErrInvalidConsistency
+	}
+}
+
+func (l Consistency) String() string {
+	switch l {
+	case ConsistencyOne:
+		return "one"
+	case ConsistencyQuorum:
+		return "quorum"
+	case ConsistencyLocalQuorum:
+		return "local_quorum"
+	case ConsistencyEachQuorum:
+		return "each_quorum"
+	case ConsistencyAll:
+		return "all"
+	default:
+		return "default"
+	}
+}
+
+type consistencyKey struct{}
+
+// runs the operations made with ctx at the given level
+func WithConsistency(ctx context.Context, level Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, level)
+}
+
+func consistencyFrom(ctx context.Context) Consistency {
+	level, _ := ctx.Value(consistencyKey{}).(Consistency)
+	return level
+}
+
+// counts acks against what a consistency level requires, per datacenter
+// for the DC aware levels and over all replicas otherwise
+type ackTracker struct {
+	need map[string]int
+	dcOf func(node string) string
+}
+
+func (c *Coordinator) newAckTracker(level Consistency, replicas []string, quorum int) *ackTracker {
+	t := &ackTracker{
+		need: make(map[string]int),
+		dcOf: func(string) string { return "" },
+	}
+
+	switch level {
+	case ConsistencyOne:
+		t.need[""] = 1
+	case ConsistencyQuorum:
+		t.need[""] = len(replicas)/2 + 1
+	case ConsistencyAll:
+		t.need[""] = len(replicas)
+	case ConsistencyLocalQuorum, ConsistencyEachQuorum:
+		t.dcOf = func(node string) string { return c.ring.Topology(node).DC }
+
+		perDC := make(map[string]int)
+		for _, r := range replicas {
+			perDC[t.dcOf(r)]++
+		}
+
+		if level == ConsistencyLocalQuorum {
+			// no local replicas means the level cannot be met
+			t.need[c.localDC()] = perDC[c.localDC()]/2 + 1
+		} else {
+			for dc, n := range perDC {
+				t.need[dc] = n/2 + 1
+			}
+		}
+	default:
+		t.need[""] = quorum
+	}
+
+	return t
+}
+
+func (t *ackTracker) ack(node string) {
+	dc := t.dcOf(node)
+	if t.need[dc] > 0 {
+		t.need[dc]--
+	}
+}
+
+func (t *ackTracker) met() bool {
+	for _, n := range t.need {
+		if n > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Coordinator) localDC() string {
+	return c.ring.Topology(c.nodeURL).DC
+}
+
+// replicas worth asking for a read at level; LOCAL_QUORUM reads stay in
+// the local datacenter
+func (c *Coordinator) readTargets(level Consistency, replicas []string) []string {
+	if level != ConsistencyLocalQuorum {
+		return replicas
+	}
+
+	local := c.localDC()
+	var targets []string
+	for _, r := range replicas {
+		if c.ring.Topology(r).DC == local {
+			targets = append(targets, r)
+		}
+	}
+
+	return targets
+}
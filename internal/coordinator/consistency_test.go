@@ -0,0 +1,125 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+func TestAckTrackerAcrossDatacenters(t *testing.T) {
+	c := setupTestCoordinator(t)
+
+	// the coordinator is in dc1 with two more replicas there, dc2 has two
+	// and dc3 one
+	topology := map[string]string{
+		testNode: "dc1", "a2": "dc1", "a3": "dc1",
+		"b1": "dc2", "b2": "dc2",
+		"c1": "dc3",
+	}
+	for node, dc := range topology {
+		c.ring.SetTopology(node, ring.Topology{DC: dc})
+	}
+	replicas := []string{testNode, "a2", "a3", "b1", "b2", "c1"}
+
+	tests := []struct {
+		name     string
+		level    Consistency
+		replicas []string
+		acks     []string
+		met      bool
+	}{
+		{"one", ConsistencyOne, replicas, []string{"c1"}, true},
+		{"quorum of six", ConsistencyQuorum, replicas, []string{"b1", "b2", "c1"}, false},
+		{"quorum met", ConsistencyQuorum, replicas, []string{"a2", "b1", "b2", "c1"}, true},
+		{"all missing one", ConsistencyAll, replicas, []string{testNode, "a2", "a3", "b1", "b2"}, false},
+		{"default counts the quorum given", ConsistencyDefault, replicas, []string{"b1", "c1"}, true},
+
+		{"local quorum", ConsistencyLocalQuorum, replicas, []string{testNode, "a3"}, true},
+		{"local quorum short locally", ConsistencyLocalQuorum, replicas, []string{testNode, "b1", "b2", "c1"}, false},
+		{"local quorum without local acks", ConsistencyLocalQuorum, replicas, []string{"b1", "b2", "c1"}, false},
+		{"local quorum without local replicas", ConsistencyLocalQuorum, []string{"b1", "b2", "c1"}, []string{"b1", "b2", "c1"}, false},
+
+		{"each quorum", ConsistencyEachQuorum, replicas, []string{testNode, "a2", "b1", "b2", "c1"}, true},
+		{"each quorum missing a datacenter", ConsistencyEachQuorum, replicas, []string{testNode, "a2", "a3", "b1", "b2"}, false},
+		{"each quorum short in one", ConsistencyEachQuorum, replicas, []string{testNode, "a2", "b1", "c1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := c.newAckTracker(tt.level, tt.replicas, 2)
+			if tracker.met() {
+				t.Fatal("met before any ack")
+			}
+
+			for _, node := range tt.acks {
+				tracker.ack(node)
+			}
+			if got := tracker.met(); got != tt.met {
+				t.Errorf("met = %v after acks from %v, want %v", got, tt.acks, tt.met)
+			}
+		})
+	}
+}
+
+// the address of a node that refuses connections
+func deadPeer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestBatchMeetsConsistencyLevel(t *testing.T) {
+	tests := []struct {
+		level   Consistency
+		written bool
+	}{
+		{ConsistencyDefault, true},
+		{ConsistencyOne, true},
+		{ConsistencyLocalQuorum, true},
+		{ConsistencyQuorum, true},
+		{ConsistencyEachQuorum, false},
+		{ConsistencyAll, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			replica, live := startReplica(t)
+			dead := deadPeer(t)
+			c := setupClusterCoordinator(t, live, dead)
+			c.ring.SetTopology(testNode, ring.Topology{DC: "dc1"})
+			c.ring.SetTopology(live, ring.Topology{DC: "dc2"})
+			c.ring.SetTopology(dead, ring.Topology{DC: "dc2"})
+
+			ctx := WithConsistency(context.Background(), tt.level)
+			result, err := c.Batch(ctx, []*storage.Record{{Key: "k", Value: []byte("v")}})
+
+			if !tt.written {
+				if !errors.Is(err, ErrQuorumNotReached) {
+					t.Fatalf("Batch error = %v, want %v", err, ErrQuorumNotReached)
+				}
+				if result == nil || len(result.Failed) != 1 {
+					t.Errorf("Batch result = %+v, want k failed", result)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Batch failed: %v", err)
+			}
+			if result.Written != 1 || len(result.Failed) != 0 {
+				t.Errorf("Batch result = %+v, want k written", result)
+			}
+			if _, err := replica.Get("k"); err != nil {
+				t.Errorf("live replica missing k: %v", err)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/AuraReaper/strangedb/internal/hlc"
 	"github.com/AuraReaper/strangedb/internal/ring"
@@ -20,6 +21,7 @@ var (
 
 type Coordinator struct {
 	nodeURL      string
+	clusterID    string
 	ring         *ring.ConsistentHashRing
 	storage      storage.Storage
 	clock        *hlc.Clock
@@ -30,6 +32,14 @@ type Coordinator struct {
 	log          zerolog.Logger
 	readRepair   *ReadRepair
 	hintStore    *HintStore
+	auditor      Auditor
+	admission    *admission
+	maxClockSkew time.Duration
+}
+
+// records the outcome of client writes; implemented by the audit log
+type Auditor interface {
+	Record(ctx context.Context, operation, key string, ts hlc.Timestamp, err error)
 }
 
 func New(nodeURL string, ring *ring.ConsistentHashRing, storage storage.Storage, clock *hlc.Clock,
@@ -44,6 +54,7 @@ func New(nodeURL string, ring *ring.ConsistentHashRing, storage storage.Storage,
 		readQuorum:   readQuorum,
 		writeQuorum:  writeQuorum,
 		log:          log,
+		maxClockSkew: DefaultMaxClockSkew,
 	}
 }
 
@@ -51,16 +62,44 @@ func (c *Coordinator) SetReadRepair(rr *ReadRepair) {
 	c.readRepair = rr
 }
 
+func (c *Coordinator) SetAuditor(a Auditor) {
+	c.auditor = a
+}
+
+func (c *Coordinator) audit(ctx context.Context, operation, key string, ts hlc.Timestamp, err error) {
+	if c.auditor != nil {
+		c.auditor.Record(ctx, operation, key, ts, err)
+	}
+}
+
 func (c *Coordinator) SetHintStore(hs *HintStore) {
 	c.hintStore = hs
 }
 
+// replicas of every key
+func (c *Coordinator) ReplicationN() int {
+	return c.replicationN
+}
+
 func (c *Coordinator) Storage() storage.Storage {
 	return c.storage
 }
 
 func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, error) {
+	release, err := c.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return c.get(ctx, key)
+}
+
+func (c *Coordinator) get(ctx context.Context, key string) (*storage.Record, error) {
+	level := consistencyFrom(ctx)
 	replicas := c.ring.GetReplicas(key, c.replicationN)
+	tracker := c.newAckTracker(level, replicas, c.readQuorum)
+	replicas = c.readTargets(level, replicas)
 	if len(replicas) == 0 {
 		return nil, ErrNoNodesAvailable
 	}
@@ -70,6 +109,7 @@ func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, err
 		Str("operation", "GET").
 		Strs("replicas", replicas).
 		Int("quorum_required", c.readQuorum).
+		Stringer("consistency", level).
 		Logger()
 
 	log.Info().Msg("performing get operation")
@@ -98,20 +138,15 @@ func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, err
 				r, err = c.storage.Get(key)
 			} else {
 				// remote read
-				resp, e := c.grpcClient.Get(ctx, addr, key)
+				var resp *pb.GetResponse
+				e := c.callPeer(addr, func() (err error) {
+					resp, err = c.grpcClient.Get(ctx, addr, key)
+					return err
+				})
 				if e != nil {
 					err = e
 				} else if resp.Found {
-					r = &storage.Record{
-						Key:   resp.Record.Key,
-						Value: resp.Record.Value,
-						Timestamp: hlc.Timestamp{
-							WallTime: resp.Record.Timestamp.WallTime,
-							Logical:  resp.Record.Timestamp.Logical,
-							NodeID:   resp.Record.Timestamp.NodeId,
-						},
-						Tombstone: resp.Record.Tombstone,
-					}
+					r = grpcTransport.RecordFromProto(resp.Record)
 				} else {
 					err = storage.ErrKeyNotFound
 				}
@@ -133,7 +168,9 @@ func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, err
 	responsesByAddr := make(map[string]*storage.Record)
 	var records []*storage.Record
 	var failedNodes []string
+	var errs []error
 	successCount := 0
+	answered := 0
 
 	for res := range resultCh {
 		if res.err == nil && res.record != nil {
@@ -143,6 +180,18 @@ func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, err
 		} else {
 			responsesByAddr[res.node] = nil
 		}
+
+		// a replica without the key still answered
+		if res.err == nil || res.err == storage.ErrKeyNotFound || res.err == storage.ErrKeyDeleted {
+			tracker.ack(res.node)
+			answered++
+		} else {
+			failedNodes = append(failedNodes, res.node)
+			errs = append(errs, res.err)
+		}
+		if level != ConsistencyDefault && tracker.met() {
+			break
+		}
 	}
 
 	log = log.With().
@@ -150,9 +199,16 @@ func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, err
 		Strs("failed_nodes", failedNodes).
 		Logger()
 
-	if successCount == 0 {
+	if level != ConsistencyDefault && !tracker.met() {
+		log.Error().Msg("get failed: consistency level not met")
+		return nil, quorumError(ctx, errs)
+	}
+
+	// replicas that answered without the key count, so a missing key is
+	// not reported as an outage
+	if level == ConsistencyDefault && answered == 0 {
 		log.Error().Msg("get failed: no replicas responded")
-		return nil, ErrQuorumNotReached
+		return nil, quorumError(ctx, errs)
 	}
 
 	latest := c.findLatest(records)
@@ -163,7 +219,7 @@ func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, err
 	}
 
 	// Quorum check
-	if successCount >= c.readQuorum {
+	if successCount >= c.readQuorum || level != ConsistencyDefault {
 		if latest == nil {
 			log.Info().Msg("key not found")
 			return nil, storage.ErrKeyNotFound
@@ -179,29 +235,79 @@ func (c *Coordinator) Get(ctx context.Context, key string) (*storage.Record, err
 	return latest, nil
 }
 
-func (c *Coordinator) Set(ctx context.Context, key string, value []byte) (*storage.Record, error) {
-	replicas := c.ring.GetReplicas(key, c.replicationN)
+// implemented by storages that keep namespace quotas
+type quotaChecker interface {
+	CheckQuota(key string, size int64) error
+}
+
+// quotas are checked against what the namespace takes on this node;
+// replicas apply writes that reached the coordinator regardless, so
+// repairs and hints are never refused. refusals are audited
+func (c *Coordinator) checkQuota(ctx context.Context, operation, key string, size int64) error {
+	checker, ok := c.storage.(quotaChecker)
+	if !ok {
+		return nil
+	}
+
+	err := checker.CheckQuota(key, size)
+	if err != nil {
+		c.audit(ctx, operation, key, hlc.Timestamp{}, err)
+	}
+	return err
+}
+
+func (c *Coordinator) Set(ctx context.Context, key string, value []byte, contentType string) (*storage.Record, error) {
+	release, err := c.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := c.checkQuota(ctx, "SET", key, int64(len(value))); err != nil {
+		return nil, err
+	}
+
+	record := &storage.Record{
+		Key:         key,
+		Value:       value,
+		Timestamp:   c.clock.Now(),
+		Tombstone:   false,
+		ContentType: contentType,
+	}
+
+	return c.write(ctx, record, "SET")
+}
+
+// replicates a fully built record and waits for the write quorum
+func (c *Coordinator) write(ctx context.Context, record *storage.Record, operation string) (*storage.Record, error) {
+	return c.writeExcept(ctx, record, operation, nil)
+}
+
+// like write, but the replicas in failed are not sent the record and
+// count as having failed with their error
+func (c *Coordinator) writeExcept(ctx context.Context, record *storage.Record, operation string, failed map[string]error) (_ *storage.Record, err error) {
+	defer func() {
+		c.audit(ctx, operation, record.Key, record.Timestamp, err)
+	}()
+
+	replicas := c.ring.GetReplicas(record.Key, c.replicationN)
 	if len(replicas) == 0 {
 		return nil, ErrNoNodesAvailable
 	}
 
+	level := consistencyFrom(ctx)
+	tracker := c.newAckTracker(level, replicas, c.writeQuorum)
+
 	log := c.log.With().
-		Str("key", key).
-		Str("operation", "SET").
+		Str("key", record.Key).
+		Str("operation", operation).
 		Strs("replicas", replicas).
 		Int("quorum_required", c.writeQuorum).
+		Stringer("consistency", level).
 		Logger()
 
 	log.Info().Msg("performing set operation")
 
-	ts := c.clock.Now()
-	record := &storage.Record{
-		Key:       key,
-		Value:     value,
-		Timestamp: ts,
-		Tombstone: false,
-	}
-
 	type setResult struct {
 		err  error
 		node string
@@ -209,6 +315,7 @@ func (c *Coordinator) Set(ctx context.Context, key string, value []byte) (*stora
 
 	resultCh := make(chan setResult, len(replicas))
 	var wg sync.WaitGroup
+	rctx, detach, cancel := replicaContext(ctx)
 
 	for _, replica := range replicas {
 		wg.Add(1)
@@ -216,21 +323,18 @@ func (c *Coordinator) Set(ctx context.Context, key string, value []byte) (*stora
 			defer wg.Done()
 
 			var err error
-			if addr == c.nodeURL {
+			if e, ok := failed[addr]; ok {
+				err = e
+			} else if addr == c.nodeURL {
 				// local
 				err = c.storage.Set(record)
 			} else {
 				// remote
-				_, err = c.grpcClient.Set(ctx, addr, &pb.Record{
-					Key:   record.Key,
-					Value: record.Value,
-					Timestamp: &pb.Timestamp{
-						WallTime: record.Timestamp.WallTime,
-						Logical:  record.Timestamp.Logical,
-						NodeId:   record.Timestamp.NodeID,
-					},
-					Tombstone: false,
+				err = c.callPeer(addr, func() error {
+					_, err := c.grpcClient.Set(rctx, addr, grpcTransport.RecordToProto(record))
+					return err
 				})
+				c.hintBusy(addr, err, record)
 			}
 
 			resultCh <- setResult{err: err, node: addr}
@@ -239,16 +343,26 @@ func (c *Coordinator) Set(ctx context.Context, key string, value []byte) (*stora
 
 	go func() {
 		wg.Wait()
+		cancel()
 		close(resultCh)
 	}()
 
 	var failedNodes []string
+	var errs []error
 	var successCount int
 	for res := range resultCh {
 		if res.err == nil {
 			successCount++
+			tracker.ack(res.node)
 		} else {
 			failedNodes = append(failedNodes, res.node)
+			errs = append(errs, res.err)
+		}
+
+		// the remaining replicas still get the write
+		if level != ConsistencyDefault && tracker.met() {
+			detach()
+			break
 		}
 	}
 
@@ -257,37 +371,50 @@ func (c *Coordinator) Set(ctx context.Context, key string, value []byte) (*stora
 		Strs("failed_nodes", failedNodes).
 		Logger()
 
-	if successCount >= c.writeQuorum {
+	if tracker.met() {
 		log.Info().Msg("set operation successful")
 		return record, nil
 	}
 
-	if successCount > 0 {
+	if level == ConsistencyDefault && successCount > 0 {
 		log.Warn().Msg("quorum not reached, but returning partial results")
 		return record, nil
 	}
 
 	log.Error().Msg("quorum not reached, set operation failed")
-	return nil, ErrQuorumNotReached
+	return nil, quorumError(ctx, errs)
 }
 
-func (c *Coordinator) Delete(ctx context.Context, key string) error {
+func (c *Coordinator) Delete(ctx context.Context, key string) (err error) {
+	release, err := c.admit(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ts := c.clock.Now()
+	defer func() {
+		c.audit(ctx, "DELETE", key, ts, err)
+	}()
+
 	replicas := c.ring.GetReplicas(key, c.replicationN)
 	if len(replicas) == 0 {
 		return ErrNoNodesAvailable
 	}
 
+	level := consistencyFrom(ctx)
+	tracker := c.newAckTracker(level, replicas, c.writeQuorum)
+
 	log := c.log.With().
 		Str("key", key).
 		Str("operation", "DELETE").
 		Strs("replicas", replicas).
 		Int("quorum_required", c.writeQuorum).
+		Stringer("consistency", level).
 		Logger()
 
 	log.Info().Msg("performing delete operation")
 
-	ts := c.clock.Now()
-
 	type deleteResult struct {
 		err  error
 		node string
@@ -295,6 +422,7 @@ func (c *Coordinator) Delete(ctx context.Context, key string) error {
 
 	resultCh := make(chan deleteResult, len(replicas))
 	var wg sync.WaitGroup
+	rctx, detach, cancel := replicaContext(ctx)
 
 	for _, replica := range replicas {
 		wg.Add(1)
@@ -307,11 +435,11 @@ func (c *Coordinator) Delete(ctx context.Context, key string) error {
 				err = c.storage.Delete(key, ts)
 			} else {
 				// remote
-				_, err = c.grpcClient.Delete(ctx, addr, key, &pb.Timestamp{
-					WallTime: ts.WallTime,
-					Logical:  ts.Logical,
-					NodeId:   ts.NodeID,
+				err = c.callPeer(addr, func() error {
+					_, err := c.grpcClient.Delete(rctx, addr, key, grpcTransport.TimestampToProto(ts))
+					return err
 				})
+				c.hintBusy(addr, err, &storage.Record{Key: key, Timestamp: ts, Tombstone: true})
 			}
 
 			resultCh <- deleteResult{err: err, node: addr}
@@ -320,16 +448,26 @@ func (c *Coordinator) Delete(ctx context.Context, key string) error {
 
 	go func() {
 		wg.Wait()
+		cancel()
 		close(resultCh)
 	}()
 
 	var failedNodes []string
+	var errs []error
 	var successCount int
 	for res := range resultCh {
 		if res.err == nil {
 			successCount++
+			tracker.ack(res.node)
 		} else {
 			failedNodes = append(failedNodes, res.node)
+			errs = append(errs, res.err)
+		}
+
+		// the remaining replicas still get the write
+		if level != ConsistencyDefault && tracker.met() {
+			detach()
+			break
 		}
 	}
 
@@ -338,18 +476,18 @@ func (c *Coordinator) Delete(ctx context.Context, key string) error {
 		Strs("failed_nodes", failedNodes).
 		Logger()
 
-	if successCount >= c.writeQuorum {
+	if tracker.met() {
 		log.Info().Msg("delete operation successful")
 		return nil
 	}
 
-	if successCount > 0 {
+	if level == ConsistencyDefault && successCount > 0 {
 		log.Warn().Msg("quorum not reached, but returning partial results")
 		return nil
 	}
 
 	log.Error().Msg("quorum not reached, delete operation failed")
-	return ErrQuorumNotReached
+	return quorumError(ctx, errs)
 }
 
 func (c *Coordinator) findLatest(records []*storage.Record) *storage.Record {
@@ -0,0 +1,176 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+)
+
+const testNode = "localhost:0"
+
+func setupTestStorage(t *testing.T) *storage.BadgerStorage {
+	store := storage.NewBadgerStorage(t.TempDir())
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// a coordinator of a one node cluster, so every replica is local
+func setupTestCoordinator(t *testing.T) *Coordinator {
+	store := setupTestStorage(t)
+
+	hashring := ring.New(10)
+	hashring.AddNode(testNode)
+
+	return New(testNode, hashring, store, hlc.NewClock(testNode),
+		grpcTransport.NewClient(grpcTransport.ClientOptions{}), 1, 1, 1, zerolog.Nop())
+}
+
+// a coordinator whose keys are on this node and every peer, with
+// quorums of one
+func setupClusterCoordinator(t *testing.T, peers ...string) *Coordinator {
+	c := setupTestCoordinator(t)
+	for _, peer := range peers {
+		c.ring.AddNode(peer)
+	}
+	c.replicationN = 1 + len(peers)
+
+	t.Cleanup(c.grpcClient.Close)
+	return c
+}
+
+// serves impl as the node service of a peer
+func startPeer(t *testing.T, impl pb.NodeServiceServer) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	pb.RegisterNodeServiceServer(server, impl)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func readLarge(t *testing.T, c *Coordinator, key string) []byte {
+	t.Helper()
+
+	record, err := c.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !record.Manifest {
+		t.Fatalf("expected %q to be stored in chunks", key)
+	}
+
+	r, _, err := c.OpenLarge(context.Background(), record)
+	if err != nil {
+		t.Fatalf("OpenLarge failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading chunks failed: %v", err)
+	}
+	return data
+}
+
+func TestExpireKeepsChunkedValue(t *testing.T) {
+	c := setupTestCoordinator(t)
+	ctx := context.Background()
+
+	value := bytes.Repeat([]byte("0123456789"), ChunkSize/4)
+	if _, err := c.SetLarge(ctx, "blob", bytes.NewReader(value), "application/octet-stream"); err != nil {
+		t.Fatalf("SetLarge failed: %v", err)
+	}
+
+	ok, err := c.Expire(ctx, "blob", time.Now().Add(time.Hour))
+	if err != nil || !ok {
+		t.Fatalf("Expire = %v, %v", ok, err)
+	}
+	if data := readLarge(t, c, "blob"); !bytes.Equal(data, value) {
+		t.Fatalf("value changed after EXPIRE: %d bytes, want %d", len(data), len(value))
+	}
+
+	// PERSIST
+	if ok, err := c.Expire(ctx, "blob", time.Time{}); err != nil || !ok {
+		t.Fatalf("Expire = %v, %v", ok, err)
+	}
+	if data := readLarge(t, c, "blob"); !bytes.Equal(data, value) {
+		t.Fatalf("value changed after PERSIST: %d bytes, want %d", len(data), len(value))
+	}
+}
+
+func TestBatchKeepsNewerLiveValue(t *testing.T) {
+	c := setupTestCoordinator(t)
+	ctx := context.Background()
+
+	exported := c.clock.Now()
+	if _, err := c.Set(ctx, "user:1", []byte("live"), ""); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// an import of an export taken before the live write
+	_, err := c.Batch(ctx, []*storage.Record{
+		{Key: "user:1", Value: []byte("exported"), Timestamp: exported},
+		{Key: "user:2", Value: []byte("exported"), Timestamp: exported},
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	if record, err := c.Get(ctx, "user:1"); err != nil || string(record.Value) != "live" {
+		t.Fatalf("Get(user:1) = %v, %v, want the live value", record, err)
+	}
+	if record, err := c.Get(ctx, "user:2"); err != nil || string(record.Value) != "exported" {
+		t.Fatalf("Get(user:2) = %v, %v, want the imported value", record, err)
+	}
+}
+
+func TestBatchRejectsTimestampsAhead(t *testing.T) {
+	c := setupTestCoordinator(t)
+	ctx := context.Background()
+
+	ahead := hlc.Timestamp{WallTime: time.Now().Add(time.Hour).UnixNano(), NodeID: "elsewhere"}
+	_, err := c.Batch(ctx, []*storage.Record{{Key: "k", Value: []byte("v"), Timestamp: ahead}})
+	if !errors.Is(err, ErrClockSkew) {
+		t.Fatalf("Batch error = %v, want %v", err, ErrClockSkew)
+	}
+
+	if _, err := c.Get(ctx, "k"); err == nil {
+		t.Error("a record of the refused batch was written")
+	}
+	if now := c.clock.Now(); now.WallTime >= ahead.WallTime {
+		t.Error("the clock moved to the refused timestamp")
+	}
+}
+
+func TestGetMissingKeyWithFailedReplica(t *testing.T) {
+	// the peer fails every read; this node answers without the key
+	c := setupClusterCoordinator(t, startPeer(t, pb.UnimplementedNodeServiceServer{}))
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Get(missing) error = %v, want %v", err, storage.ErrKeyNotFound)
+	}
+
+	all := WithConsistency(ctx, ConsistencyAll)
+	if _, err := c.Get(all, "missing"); !errors.Is(err, ErrQuorumNotReached) {
+		t.Errorf("Get(missing) at all error = %v, want %v", err, ErrQuorumNotReached)
+	}
+}
@@ -0,0 +1,54 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrTimeout = errors.New("request timed out")
+
+// the error a request that missed its quorum fails with. running out of
+// time, either the request's own deadline or the RPC timeout of every
+// replica that failed, is a timeout rather than an outage
+func quorumError(ctx context.Context, errs []error) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+
+	if len(errs) == 0 {
+		return ErrQuorumNotReached
+	}
+	for _, err := range errs {
+		if !timedOut(err) {
+			return ErrQuorumNotReached
+		}
+	}
+	return ErrTimeout
+}
+
+// ErrTimeout once the deadline of ctx passed, context.Canceled once the
+// caller went away, nil while it is still live
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
+
+// the context the replica calls of a write run on. it is cancelled with
+// ctx until detach is called; after that the calls still running go on
+// with their own RPC timeout, so replicas a write stopped waiting for
+// once its consistency level was met still get it when the request ends
+func replicaContext(ctx context.Context) (rctx context.Context, detach, cancel func()) {
+	rctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	return rctx, func() { stop() }, cancel
+}
+
+func timedOut(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTimeout) ||
+		status.Code(err) == codes.DeadlineExceeded
+}
@@ -0,0 +1,68 @@
+package coordinator
+
+import (
+	"context"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+// like Set, but the key reads as deleted from expiresAt on; a zero time
+// never expires
+func (c *Coordinator) SetExpiring(ctx context.Context, key string, value []byte, contentType string,
+	expiresAt time.Time) (*storage.Record, error) {
+	release, err := c.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := c.checkQuota(ctx, "SET", key, int64(len(value))); err != nil {
+		return nil, err
+	}
+
+	record := &storage.Record{
+		Key:         key,
+		Value:       value,
+		Timestamp:   c.clock.Now(),
+		ContentType: contentType,
+		ExpiresAt:   expiryNanos(expiresAt),
+	}
+
+	return c.write(ctx, record, "SET")
+}
+
+// gives an existing key a new expiry, or none for a zero time, by
+// writing its current version again. reports whether the key existed
+func (c *Coordinator) Expire(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	release, err := c.admit(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	current, err := c.get(ctx, key)
+	if err == storage.ErrKeyNotFound || err == storage.ErrKeyDeleted {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	record := *current
+	record.Timestamp = c.clock.Now()
+	record.Origin = ""
+	record.ExpiresAt = expiryNanos(expiresAt)
+
+	if _, err := c.write(ctx, &record, "EXPIRE"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func expiryNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
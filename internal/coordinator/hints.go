@@ -83,6 +83,26 @@ func (hs *HintStore) RemoveHint(targetNode string, record *storage.Record) {
 	hs.hints[targetNode] = filtered
 }
 
+// drops the hints that were delivered, keeping any added since
+func (hs *HintStore) removeHints(targetNode string, delivered []*Hint) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	done := make(map[*Hint]bool, len(delivered))
+	for _, h := range delivered {
+		done[h] = true
+	}
+
+	hints := hs.hints[targetNode]
+	filtered := make([]*Hint, 0, len(hints))
+	for _, h := range hints {
+		if !done[h] {
+			filtered = append(filtered, h)
+		}
+	}
+	hs.hints[targetNode] = filtered
+}
+
 func (hs *HintStore) ClearHints(targetNode string) {
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
@@ -91,7 +111,7 @@ func (hs *HintStore) ClearHints(targetNode string) {
 }
 
 func (hs *HintStore) cleanupLoop() {
-	ticker := time.NewTimer(time.Minute)
+	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
 	for range ticker.C {
@@ -157,48 +177,27 @@ func (hh *HintedHandoff) replayOnce() {
 	nodes := hh.store.Nodes()
 
 	for _, node := range nodes {
-		hints := hh.store.GetHints(node)
-
-		for _, hint := range hints {
-			hh.replayHint(node, hint)
+		if hints := hh.store.GetHints(node); len(hints) > 0 {
+			hh.replay(node, hints)
 		}
 	}
 }
 
-func (hh *HintedHandoff) replayHint(node string, hint *Hint) {
-	var err error
-
-	if hint.Record.Tombstone {
-		_, err = hh.grpcClient.Delete(
-			context.Background(), node, hint.Record.Key,
-			&pb.Timestamp{
-				WallTime: hint.Record.Timestamp.WallTime,
-				Logical:  hint.Record.Timestamp.Logical,
-				NodeId:   hint.Record.Timestamp.NodeID,
-			},
-		)
-	} else {
-		_, err = hh.grpcClient.Set(
-			context.Background(),
-			node,
-			&pb.Record{
-				Key:   hint.Record.Key,
-				Value: hint.Record.Value,
-				Timestamp: &pb.Timestamp{
-					WallTime: hint.Record.Timestamp.WallTime,
-					Logical:  hint.Record.Timestamp.Logical,
-					NodeId:   hint.Record.Timestamp.NodeID,
-				},
-				Tombstone: hint.Record.Tombstone,
-			},
-		)
+// delivers a node's hints as a merge, so a hint that arrives after a
+// newer write to its key does not roll the key back
+func (hh *HintedHandoff) replay(node string, hints []*Hint) {
+	records := make([]*pb.Record, len(hints))
+	for i, hint := range hints {
+		records[i] = grpcTransport.RecordToProto(hint.Record)
 	}
 
-	if err == nil {
-		hh.store.RemoveHint(node, hint.Record)
-	} else {
-		hint.Attempts++
+	if _, err := hh.grpcClient.MergeBatch(context.Background(), node, records); err != nil {
+		for _, hint := range hints {
+			hint.Attempts++
+		}
+		return
 	}
+	hh.store.removeHints(node, hints)
 }
 
 func (hh *HintedHandoff) replayLoop() {
@@ -6,7 +6,7 @@ import (
 
 	"github.com/AuraReaper/strangedb/internal/hlc"
 	"github.com/AuraReaper/strangedb/internal/storage"
-	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
 )
 
 type ReadRepair struct {
@@ -52,16 +52,7 @@ func (rr *ReadRepair) readReplica(ctx context.Context, address string, record *s
 	}
 
 	// remote repair
-	_, err := rr.coordinator.grpcClient.Set(ctx, address, &pb.Record{
-		Key:   record.Key,
-		Value: record.Value,
-		Timestamp: &pb.Timestamp{
-			WallTime: record.Timestamp.WallTime,
-			Logical:  record.Timestamp.Logical,
-			NodeId:   record.Timestamp.NodeID,
-		},
-		Tombstone: record.Tombstone,
-	})
+	_, err := rr.coordinator.grpcClient.Set(ctx, address, grpcTransport.RecordToProto(record))
 
 	return err
 }
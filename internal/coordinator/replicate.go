@@ -0,0 +1,124 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+var (
+	ErrReplicationLoop = errors.New("writes replicated from this cluster back into itself")
+	ErrValueMismatch   = errors.New("replicated value does not match its manifest")
+)
+
+// id of the cluster this node belongs to, the origin of its writes
+func (c *Coordinator) SetClusterID(id string) {
+	c.clusterID = id
+}
+
+// applies writes shipped from another cluster. their timestamps are kept
+// and a replica only takes a record newer than what it stores, so both
+// clusters settle on the same version of a key in whatever order writes
+// arrive. records are marked with their origin, which keeps them from
+// being shipped back
+func (c *Coordinator) Replicate(ctx context.Context, origin string, records []*storage.Record) (int, []string, error) {
+	if origin == c.clusterID {
+		return 0, nil, ErrReplicationLoop
+	}
+
+	for _, record := range records {
+		record.Origin = origin
+	}
+
+	result, err := c.batch(ctx, records, "REPLICATE", true)
+	if result == nil {
+		return 0, nil, err
+	}
+
+	return result.Written, result.Failed, err
+}
+
+// applies a chunked value shipped from another cluster. the value read
+// from r is uploaded as a new set of chunks and checked against the
+// shipped manifest; only then is the manifest written, with the shipped
+// timestamp and merged like Replicate, so a replica never points at
+// chunks it does not have
+func (c *Coordinator) ReplicateLarge(ctx context.Context, origin string, record *storage.Record, r io.Reader) error {
+	if origin == c.clusterID {
+		return ErrReplicationLoop
+	}
+
+	shipped, err := storage.ParseManifest(record)
+	if err != nil {
+		return err
+	}
+	if err := c.checkSkew(record.Key, record.Timestamp); err != nil {
+		return err
+	}
+	c.clock.Update(record.Timestamp)
+
+	replicas := c.ring.GetReplicas(record.Key, c.replicationN)
+	if len(replicas) == 0 {
+		return ErrNoNodesAvailable
+	}
+
+	uploadID := newUploadID()
+
+	log := c.log.With().
+		Str("key", record.Key).
+		Str("operation", "REPLICATE_LARGE").
+		Str("origin", origin).
+		Str("upload_id", uploadID).
+		Strs("replicas", replicas).
+		Logger()
+
+	manifest, failed, err := c.uploadChunks(ctx, log, record.Key, uploadID, replicas, r, nil)
+	if err != nil {
+		return err
+	}
+
+	// chunk hashes only line up when both clusters split at the same size
+	if manifest.Size != shipped.Size ||
+		(manifest.ChunkSize == shipped.ChunkSize && !slices.Equal(manifest.Chunks, shipped.Chunks)) {
+		log.Error().Int64("size", manifest.Size).Int64("shipped_size", shipped.Size).Msg("replicated value does not match its manifest")
+		c.dropUpload(record.Key, uploadID, replicas)
+		return fmt.Errorf("%w: %s", ErrValueMismatch, record.Key)
+	}
+
+	value, err := json.Marshal(manifest)
+	if err != nil {
+		c.dropUpload(record.Key, uploadID, replicas)
+		return err
+	}
+
+	var ok []string
+	for _, addr := range replicas {
+		if _, missed := failed[addr]; !missed {
+			ok = append(ok, addr)
+		}
+	}
+
+	level := consistencyFrom(ctx)
+	tracker := c.newAckTracker(level, replicas, c.writeQuorum)
+	acks, errs := c.writeGroup(ctx, tracker, ok, []*storage.Record{{
+		Key:         record.Key,
+		Value:       value,
+		Timestamp:   record.Timestamp,
+		ContentType: record.ContentType,
+		Manifest:    true,
+		Origin:      origin,
+		ExpiresAt:   record.ExpiresAt,
+	}}, true)
+	if !written(level, tracker, acks) {
+		// chunks no manifest names are collected as orphans
+		log.Error().Int("acks_received", acks).Msg("manifest write failed")
+		return quorumError(ctx, errs)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package coordinator
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+)
+
+const (
+	watchRetryMin = 100 * time.Millisecond
+	watchRetryMax = 5 * time.Second
+
+	// how far behind the newest delivered write a key is still deduped;
+	// a replica reporting a write later than that delivers it again
+	watchDedupWindow = time.Minute
+)
+
+// a Key watch follows a single key, a Prefix watch every key under it
+type WatchOptions struct {
+	Key    string
+	Prefix string
+	Since  hlc.Timestamp
+}
+
+func (o WatchOptions) matches(key string) bool {
+	if o.Key != "" {
+		return key == o.Key
+	}
+
+	return strings.HasPrefix(key, o.Prefix)
+}
+
+// the writes a watch delivers
+type Watch struct {
+	events   chan *storage.Record
+	replayed chan struct{}
+}
+
+// closed when the watch context ends
+func (w *Watch) Events() <-chan *storage.Record {
+	return w.events
+}
+
+// closed once every replica sent the writes after Since, or failed
+// before it could. they come in key order rather than timestamp order,
+// so until then a write not yet received can be older than the ones
+// that were; records received before it closed were all read from
+// Events
+func (w *Watch) Replayed() <-chan struct{} {
+	return w.replayed
+}
+
+// streams set and delete events from the owning replicas, each write
+// delivered once no matter how many replicas report it
+func (c *Coordinator) Watch(ctx context.Context, opts WatchOptions) (*Watch, error) {
+	var replicas []string
+	if opts.Key != "" {
+		replicas = c.ring.GetReplicas(opts.Key, c.replicationN)
+	} else {
+		// a prefix spans the whole ring
+		replicas = c.ring.GetNodes()
+	}
+
+	if len(replicas) == 0 {
+		return nil, ErrNoNodesAvailable
+	}
+
+	c.log.Info().
+		Str("key", opts.Key).
+		Str("prefix", opts.Prefix).
+		Str("operation", "WATCH").
+		Strs("replicas", replicas).
+		Msg("starting watch")
+
+	merged := make(chan *storage.Record)
+	var wg sync.WaitGroup
+
+	for _, replica := range replicas {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			c.watchReplica(ctx, addr, opts, merged)
+		}(replica)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	w := &Watch{
+		events:   make(chan *storage.Record),
+		replayed: make(chan struct{}),
+	}
+	go func() {
+		defer close(w.events)
+
+		// latest timestamp delivered per key, within the dedup window
+		seen := make(map[string]hlc.Timestamp)
+		var newest hlc.Timestamp
+		var pruned int64
+		replaying := len(replicas)
+
+		for record := range merged {
+			// a replica is done with its backlog
+			if record == nil {
+				if replaying--; replaying == 0 {
+					close(w.replayed)
+				}
+				continue
+			}
+
+			floor, ok := seen[record.Key]
+			if !ok {
+				floor = opts.Since
+			}
+
+			if !hlc.IsAfter(record.Timestamp, floor) {
+				continue
+			}
+			seen[record.Key] = record.Timestamp
+			if hlc.IsAfter(record.Timestamp, newest) {
+				newest = record.Timestamp
+			}
+
+			// once a window, so the map holds about two windows of keys
+			if cutoff := newest.WallTime - watchDedupWindow.Nanoseconds(); cutoff > pruned {
+				if pruned != 0 {
+					pruneSeen(seen, cutoff)
+				}
+				pruned = newest.WallTime
+			}
+
+			select {
+			case w.events <- record:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// forgets keys last delivered before cutoff, so a long watch over many
+// keys does not keep every one of them
+func pruneSeen(seen map[string]hlc.Timestamp, cutoff int64) {
+	for key, ts := range seen {
+		if ts.WallTime < cutoff {
+			delete(seen, key)
+		}
+	}
+}
+
+// follows one replica until ctx ends, resuming whenever the stream
+// breaks. a nil record goes out once the replica sent its backlog, or
+// failed before it could, so one replica that is down does not hold up
+// the others
+func (c *Coordinator) watchReplica(ctx context.Context, addr string, opts WatchOptions, out chan<- *storage.Record) {
+	since := opts.Since
+	backoff := watchRetryMin
+	reported := false
+
+	send := func(record *storage.Record) bool {
+		select {
+		case out <- record:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	report := func() bool {
+		if reported {
+			return true
+		}
+		reported = true
+		return send(nil)
+	}
+
+	for ctx.Err() == nil {
+		// the backlog comes in key order, so the newest timestamp
+		// delivered is only a safe place to resume once all of it came
+		newest := since
+		replayed := false
+
+		err := c.streamReplica(ctx, addr, opts, since, func(record *storage.Record) bool {
+			if record == nil {
+				replayed = true
+				since = newest
+				return report()
+			}
+
+			if hlc.IsAfter(record.Timestamp, newest) {
+				newest = record.Timestamp
+			}
+			if replayed {
+				since = newest
+			}
+			backoff = watchRetryMin
+
+			return send(record)
+		})
+
+		if ctx.Err() != nil || !report() {
+			return
+		}
+
+		c.log.Warn().
+			Err(err).
+			Str("node", addr).
+			Str("operation", "WATCH").
+			Dur("retry_in", backoff).
+			Msg("watch stream interrupted")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff = min(backoff*2, watchRetryMax)
+	}
+}
+
+// delivers the writes of one replica, and nil once its backlog was sent
+func (c *Coordinator) streamReplica(ctx context.Context, addr string, opts WatchOptions, since hlc.Timestamp,
+	deliver func(*storage.Record) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if addr == c.nodeURL {
+		// local watch
+		prefix := opts.Prefix
+		if opts.Key != "" {
+			prefix = opts.Key
+		}
+
+		watcher, err := c.storage.Watch(ctx, prefix, since)
+		if err != nil {
+			return err
+		}
+
+		events, replayed := watcher.Events(), watcher.Replayed()
+		for events != nil {
+			select {
+			case <-replayed:
+				replayed = nil
+				if !deliver(nil) {
+					return nil
+				}
+			case record, ok := <-events:
+				if !ok {
+					events = nil
+				} else if opts.matches(record.Key) && !deliver(record) {
+					return nil
+				}
+			}
+		}
+
+		if err := watcher.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	// remote watch
+	stream, err := c.grpcClient.Watch(ctx, addr, &pb.WatchRequest{
+		Key:          opts.Key,
+		Prefix:       opts.Prefix,
+		Since:        grpcTransport.TimestampToProto(since),
+		MarkReplayed: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if event.Replayed {
+			if !deliver(nil) {
+				return nil
+			}
+			continue
+		}
+
+		record := grpcTransport.RecordFromProto(event.Record)
+		if opts.matches(record.Key) && !deliver(record) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// a replica whose backlog is newest first in key order, and whose first
+// stream breaks after one record
+type droppingReplica struct {
+	pb.UnimplementedNodeServiceServer
+	streams atomic.Int32
+}
+
+func (r *droppingReplica) Watch(req *pb.WatchRequest, stream pb.NodeService_WatchServer) error {
+	first := r.streams.Add(1) == 1
+	since := grpcTransport.TimestampFromProto(req.Since)
+
+	backlog := []*pb.Record{
+		{Key: "k:a", Value: []byte("a"), Timestamp: &pb.Timestamp{WallTime: 300}},
+		{Key: "k:b", Value: []byte("b"), Timestamp: &pb.Timestamp{WallTime: 100}},
+	}
+	for i, record := range backlog {
+		if first && i == 1 {
+			return status.Error(codes.Unavailable, "connection reset")
+		}
+		if hlc.IsAfter(grpcTransport.TimestampFromProto(record.Timestamp), since) {
+			if err := stream.Send(&pb.WatchEvent{Record: record}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if req.MarkReplayed {
+		if err := stream.Send(&pb.WatchEvent{Replayed: true}); err != nil {
+			return err
+		}
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func TestWatchResumesMidBacklog(t *testing.T) {
+	replica := &droppingReplica{}
+	c := setupClusterCoordinator(t, startPeer(t, replica))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	watch, err := c.Watch(ctx, WatchOptions{Prefix: "k:"})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	got := make(map[string]int)
+	for len(got) < 2 {
+		select {
+		case record, ok := <-watch.Events():
+			if !ok {
+				t.Fatalf("watch ended with %v, want k:a and k:b", got)
+			}
+			got[record.Key]++
+		case <-ctx.Done():
+			t.Fatalf("watch delivered %v, the write older than the break was lost", got)
+		}
+	}
+	if got["k:a"] != 1 {
+		t.Errorf("k:a delivered %d times, want once", got["k:a"])
+	}
+
+	select {
+	case <-watch.Replayed():
+	case <-ctx.Done():
+		t.Fatal("backlog never reported replayed")
+	}
+	if n := replica.streams.Load(); n != 2 {
+		t.Errorf("replica streamed %d times, want 2", n)
+	}
+}
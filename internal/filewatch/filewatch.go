@@ -0,0 +1,115 @@
+// Package filewatch loads files again when they change, for settings
+// that are rotated or edited while a node runs.
+package filewatch
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// calls load whenever one of its files has a newer modification time
+// than when they were last loaded. a failed load keeps what was loaded
+// before and is tried again on the next check
+type Watcher struct {
+	files    []string
+	interval time.Duration
+	load     func() error
+	log      zerolog.Logger
+
+	mu      sync.Mutex
+	modTime time.Time
+
+	stopCh chan struct{}
+}
+
+// loads the files once, failing with the error of load. empty names
+// are skipped
+func New(files []string, interval time.Duration, load func() error, log zerolog.Logger) (*Watcher, error) {
+	w := &Watcher{
+		interval: interval,
+		load:     load,
+		log:      log,
+		stopCh:   make(chan struct{}),
+	}
+	for _, file := range files {
+		if file != "" {
+			w.files = append(w.files, file)
+		}
+	}
+
+	if _, err := w.reload(true); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Watcher) Start() {
+	go w.watchLoop()
+}
+
+func (w *Watcher) Stop() {
+	close(w.stopCh)
+}
+
+// loads the files again if they changed since the last load, and
+// reports whether they did
+func (w *Watcher) Check() (bool, error) {
+	return w.reload(false)
+}
+
+func (w *Watcher) watchLoop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// a half written file fails to load; the next tick tries again
+			reloaded, err := w.Check()
+			if err != nil {
+				w.log.Warn().Err(err).Strs("files", w.files).Msg("failed to reload")
+			} else if reloaded {
+				w.log.Info().Strs("files", w.files).Msg("reloaded")
+			}
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+func (w *Watcher) reload(force bool) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// taken before loading, so a change made meanwhile is seen next time
+	modTime, err := w.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	if !force && !modTime.After(w.modTime) {
+		return false, nil
+	}
+
+	if err := w.load(); err != nil {
+		return false, err
+	}
+	w.modTime = modTime
+	return true, nil
+}
+
+func (w *Watcher) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range w.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -1,11 +1,19 @@
 package gossip
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/rand/v2"
 	"sync"
 	"time"
 )
 
+var ErrPartitionerMismatch = errors.New("cluster uses a different partitioner")
+
+// sends our digest to a peer and returns the peer's
+type Transport func(ctx context.Context, addr string, digest []MemberState) ([]MemberState, error)
+
 type Gossiper struct {
 	mu         sync.RWMutex
 	membership *Membership
@@ -14,6 +22,7 @@ type Gossiper struct {
 	interval   time.Duration
 	timeout    time.Duration
 	stopCh     chan struct{}
+	transport  Transport
 
 	onMembershipChange func([]string)
 }
@@ -43,6 +52,64 @@ func (g *Gossiper) SetMembershipChangeCallback(fn func([]string)) {
 	g.onMembershipChange = fn
 }
 
+// labels this node announces to its peers
+func (g *Gossiper) SetTopology(dc, rack string) {
+	g.membership.SetTopology(g.nodeURL, dc, rack)
+}
+
+// capacity this node announces, relative to the other nodes
+func (g *Gossiper) SetWeight(weight float64) {
+	g.membership.SetWeight(g.nodeURL, weight)
+}
+
+// partitioner this node announces; peers with another one are rejected
+func (g *Gossiper) SetPartitioner(name string) {
+	g.membership.SetPartitioner(name)
+}
+
+func (g *Gossiper) SetTransport(t Transport) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.transport = t
+}
+
+// gossips with every seed once before the node starts serving and fails
+// when one of them runs another partitioner. unreachable seeds are
+// skipped, so the first nodes of a cluster can start in any order
+func (g *Gossiper) Join(ctx context.Context) error {
+	g.mu.RLock()
+	transport := g.transport
+	g.mu.RUnlock()
+
+	if transport == nil {
+		return nil
+	}
+
+	own := g.membership.Partitioner()
+	for _, seed := range g.peers {
+		if seed == g.nodeURL {
+			continue
+		}
+
+		seedCtx, cancel := context.WithTimeout(ctx, g.timeout)
+		digest, err := transport(seedCtx, seed, g.membership.GetDigest())
+		cancel()
+		if err != nil {
+			continue
+		}
+
+		for _, state := range digest {
+			if state.NodeURL == seed && state.Partitioner != "" && own != "" && state.Partitioner != own {
+				return fmt.Errorf("%w: %s runs %s", ErrPartitionerMismatch, seed, state.Partitioner)
+			}
+		}
+
+		g.merge(digest)
+	}
+
+	return nil
+}
+
 func (g *Gossiper) Start() {
 	go g.gossipLoop()
 	go g.failureDetectionLoop()
@@ -56,6 +123,10 @@ func (g *Gossiper) GetMembers() []string {
 	return g.membership.GetMembers()
 }
 
+func (g *Gossiper) GetAllMembers() map[string]Member {
+	return g.membership.GetAllMembers()
+}
+
 func (g *Gossiper) gossipLoop() {
 	ticker := time.NewTicker(g.interval)
 	defer ticker.Stop()
@@ -94,7 +165,48 @@ func (g *Gossiper) gossipRound() {
 }
 
 func (g *Gossiper) gossipWith(targetURL string) {
-	g.membership.UpdateMember(targetURL, time.Now().Unix())
+	g.mu.RLock()
+	transport := g.transport
+	g.mu.RUnlock()
+
+	if transport == nil {
+		g.membership.UpdateMember(targetURL, time.Now().Unix())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+
+	// an unreachable peer is left to the failure detector
+	digest, err := transport(ctx, targetURL, g.membership.GetDigest())
+	if err != nil {
+		return
+	}
+
+	g.merge(digest)
+}
+
+func (g *Gossiper) merge(digest []MemberState) {
+	changed := false
+	for _, state := range digest {
+		if g.membership.Apply(state) {
+			changed = true
+		}
+	}
+
+	if changed {
+		g.notify()
+	}
+}
+
+func (g *Gossiper) notify() {
+	g.mu.RLock()
+	callback := g.onMembershipChange
+	g.mu.RUnlock()
+
+	if callback != nil {
+		callback(g.membership.GetMembers())
+	}
 }
 
 func (g *Gossiper) failureDetectionLoop() {
@@ -141,20 +253,11 @@ func (g *Gossiper) checkFailures() {
 	}
 
 	if membershipChanged {
-		g.mu.RLock()
-		callback := g.onMembershipChange
-		defer g.mu.RUnlock()
-
-		if callback != nil {
-			callback(g.membership.GetMembers())
-		}
+		g.notify()
 	}
 }
 
-func (g *Gossiper) HandleGossip(digest map[string]int64) map[string]int64 {
-	for url, heartbeat := range digest {
-		g.membership.UpdateMember(url, heartbeat)
-	}
-
+func (g *Gossiper) HandleGossip(digest []MemberState) []MemberState {
+	g.merge(digest)
 	return g.membership.GetDigest()
 }
@@ -13,17 +13,46 @@ const (
 	Dead
 )
 
+func (s NodeState) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
+
 type Member struct {
 	NodeURL     string
 	State       NodeState
 	Heartbeat   int64
 	LastUpdated time.Time
+	DC          string
+	Rack        string
+	Partitioner string
+	// relative capacity, 0 from nodes that do not announce one
+	Weight float64
+}
+
+// what nodes exchange about each member in a gossip round
+type MemberState struct {
+	NodeURL     string
+	Heartbeat   int64
+	DC          string
+	Rack        string
+	Partitioner string
+	Weight      float64
 }
 
 type Membership struct {
-	mu      sync.RWMutex
-	members map[string]*Member
-	nodeURL string
+	mu          sync.RWMutex
+	members     map[string]*Member
+	nodeURL     string
+	partitioner string
 }
 
 func NewMembership(nodeURL string) *Membership {
@@ -32,10 +61,12 @@ func NewMembership(nodeURL string) *Membership {
 		nodeURL: nodeURL,
 	}
 
+	// heartbeats start at the start time, so a restarted node is not
+	// behind the count its peers remember
 	m.members[nodeURL] = &Member{
 		NodeURL:     nodeURL,
 		State:       Alive,
-		Heartbeat:   0,
+		Heartbeat:   time.Now().UnixMilli(),
 		LastUpdated: time.Now(),
 	}
 
@@ -57,13 +88,14 @@ func (m *Membership) GetMembers() []string {
 	return members
 }
 
-func (m *Membership) GetAllMembers() map[string]*Member {
+// copies of every member, whatever its state
+func (m *Membership) GetAllMembers() map[string]Member {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	result := make(map[string]*Member)
+	result := make(map[string]Member)
 	for k, v := range m.members {
-		result[k] = v
+		result[k] = *v
 	}
 
 	return result
@@ -89,6 +121,96 @@ func (m *Membership) UpdateMember(nodeURL string, heartbeat int64) {
 	}
 }
 
+func (m *Membership) SetTopology(nodeURL, dc, rack string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if member, ok := m.members[nodeURL]; ok {
+		member.DC = dc
+		member.Rack = rack
+	}
+}
+
+func (m *Membership) SetWeight(nodeURL string, weight float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if member, ok := m.members[nodeURL]; ok {
+		member.Weight = weight
+	}
+}
+
+// the partitioner this node runs with; members announcing another one
+// are kept out of the cluster
+func (m *Membership) SetPartitioner(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.partitioner = name
+	m.members[m.nodeURL].Partitioner = name
+}
+
+func (m *Membership) Partitioner() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.partitioner
+}
+
+// called with the lock held
+func (m *Membership) compatible(state MemberState) bool {
+	return state.Partitioner == "" || m.partitioner == "" || state.Partitioner == m.partitioner
+}
+
+// merges what a peer knows about a member, reporting whether the member
+// is new or its labels or weight changed
+func (m *Membership) Apply(state MemberState) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.members[state.NodeURL]
+
+	// it would place keys differently; a seed we started with is
+	// dropped instead
+	if !m.compatible(state) {
+		if ok && state.NodeURL != m.nodeURL && member.State != Dead {
+			member.State = Dead
+			member.LastUpdated = time.Now()
+			return true
+		}
+		return false
+	}
+
+	if !ok {
+		m.members[state.NodeURL] = &Member{
+			NodeURL:     state.NodeURL,
+			State:       Alive,
+			Heartbeat:   state.Heartbeat,
+			LastUpdated: time.Now(),
+			DC:          state.DC,
+			Rack:        state.Rack,
+			Partitioner: state.Partitioner,
+			Weight:      state.Weight,
+		}
+		return true
+	}
+
+	// our own entry is only ever changed by us
+	if state.NodeURL == m.nodeURL || state.Heartbeat <= member.Heartbeat {
+		return false
+	}
+
+	member.Heartbeat = state.Heartbeat
+	member.State = Alive
+	member.LastUpdated = time.Now()
+
+	changed := member.DC != state.DC || member.Rack != state.Rack || member.Weight != state.Weight
+	member.DC, member.Rack = state.DC, state.Rack
+	member.Partitioner = state.Partitioner
+	member.Weight = state.Weight
+	return changed
+}
+
 func (m *Membership) MarkSuspect(nodeURL string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -122,13 +244,20 @@ func (m *Membership) IncrementHeartbeat() int64 {
 	return 0
 }
 
-func (m *Membership) GetDigest() map[string]int64 {
+func (m *Membership) GetDigest() []MemberState {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	digest := make(map[string]int64)
+	digest := make([]MemberState, 0, len(m.members))
 	for url, member := range m.members {
-		digest[url] = member.Heartbeat
+		digest = append(digest, MemberState{
+			NodeURL:     url,
+			Heartbeat:   member.Heartbeat,
+			DC:          member.DC,
+			Rack:        member.Rack,
+			Partitioner: member.Partitioner,
+			Weight:      member.Weight,
+		})
 	}
 
 	return digest
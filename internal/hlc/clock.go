@@ -1,6 +1,9 @@
 package hlc
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -126,3 +129,36 @@ func IsAfter(a, b Timestamp) bool {
 func IsBefore(a, b Timestamp) bool {
 	return Compare(a, b) < 0
 }
+
+// formats a timestamp as "wall.logical.node", used as a resume cursor
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%d.%d.%s", t.WallTime, t.Logical, t.NodeID)
+}
+
+// parses a timestamp produced by Timestamp.String
+func Parse(s string) (Timestamp, error) {
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) < 2 {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	wall, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q: %w", s, err)
+	}
+
+	logical, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q: %w", s, err)
+	}
+
+	ts := Timestamp{
+		WallTime: wall,
+		Logical:  uint32(logical),
+	}
+	if len(parts) == 3 {
+		ts.NodeID = parts[2]
+	}
+
+	return ts, nil
+}
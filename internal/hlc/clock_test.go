@@ -67,3 +67,20 @@ func TestMontonicity(t *testing.T) {
 		last = ts
 	}
 }
+
+func TestParse(t *testing.T) {
+	ts := Timestamp{WallTime: 1700000000000000000, Logical: 7, NodeID: "host.local-42"}
+
+	parsed, err := Parse(ts.String())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if Compare(parsed, ts) != 0 {
+		t.Errorf("Parse(%q) = %v, want %v", ts.String(), parsed, ts)
+	}
+
+	if _, err := Parse("not-a-timestamp"); err == nil {
+		t.Error("expected error for malformed timestamp")
+	}
+}
@@ -0,0 +1,133 @@
+package loader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/AuraReaper/strangedb/internal/antientropy"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("stream file checksum mismatch")
+	ErrVerifyFailed     = errors.New("loaded data does not match the stream file")
+)
+
+type IngestResult struct {
+	Node    string `json:"node"`
+	Records int    `json:"records"`
+	// set when the merkle root of the loaded store was compared with
+	// the one recorded at build time
+	Verified bool `json:"verified"`
+}
+
+// loads the stream files of the given nodes into their empty data
+// directories, one node per goroutine. afterwards each store is checked
+// against the manifest: the record count always, the merkle root of all
+// record hashes when the load was built with verification. a non-nil
+// encryptionKey encrypts the data directories
+func Ingest(dir string, nodes, dataDirs []string, encryptionKey []byte) ([]IngestResult, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) == 0 {
+		nodes = manifest.Nodes
+	}
+	if len(nodes) != len(dataDirs) {
+		return nil, errors.New("every node needs exactly one data directory")
+	}
+
+	streams := make(map[string]Stream, len(manifest.Streams))
+	for _, s := range manifest.Streams {
+		streams[s.Node] = s
+	}
+
+	results := make([]IngestResult, len(nodes))
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+
+	for i, node := range nodes {
+		stream, ok := streams[node]
+		if !ok {
+			return nil, fmt.Errorf("no stream file for %s in %s", node, dir)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := ingest(filepath.Join(dir, stream.File), dataDirs[i], stream, manifest.Partitioner, encryptionKey)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", stream.Node, err)
+				return
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
+func ingest(path, dataDir string, stream Stream, partitioner string, encryptionKey []byte) (IngestResult, error) {
+	result := IngestResult{Node: stream.Node}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	store := storage.NewBadgerStorage(dataDir)
+	store.SetEncryption(encryptionKey, 0)
+	if err := store.Open(); err != nil {
+		return result, fmt.Errorf("failed to open %s: %w", dataDir, err)
+	}
+	defer store.Close()
+
+	hash := sha256.New()
+	result.Records, err = store.Ingest(io.TeeReader(f, hash))
+	if err != nil {
+		return result, err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != stream.SHA256 {
+		return result, ErrChecksumMismatch
+	}
+	if result.Records != stream.Records {
+		return result, fmt.Errorf("%w: %d records ingested, %d expected", ErrVerifyFailed, result.Records, stream.Records)
+	}
+
+	// the node refuses to start with another partitioner than the one
+	// the keys were placed with
+	if partitioner != "" {
+		if err := store.SetMeta(storage.MetaPartitioner, partitioner); err != nil {
+			return result, err
+		}
+	}
+
+	if stream.MerkleRoot == "" {
+		return result, nil
+	}
+
+	hashes, err := store.RecordHashes()
+	if err != nil {
+		return result, err
+	}
+	if len(hashes) != stream.Records {
+		return result, fmt.Errorf("%w: %d records stored, %d expected", ErrVerifyFailed, len(hashes), stream.Records)
+	}
+	if root := antientropy.Build(hashes, merkleDepth).GetRootHash(); root != stream.MerkleRoot {
+		return result, fmt.Errorf("%w: merkle root %s, expected %s", ErrVerifyFailed, root, stream.MerkleRoot)
+	}
+
+	result.Verified = true
+	return result, nil
+}
@@ -0,0 +1,454 @@
+package loader
+
+import (
+	"bufio"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/antientropy"
+	"github.com/AuraReaper/strangedb/internal/bulk"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+const (
+	ManifestVersion = 1
+	ManifestFile    = "load.json"
+
+	// input held in memory before it is sorted and spilled to disk
+	DefaultMemory = 256 << 20
+
+	// entries per KVList in stream and run files
+	listEntries = 1000
+	merkleDepth = 16
+)
+
+var ErrNoNodes = errors.New("no target nodes")
+
+// describes the stream files of a load, one per target node
+type Manifest struct {
+	Version      int                `json:"version"`
+	CreatedAt    time.Time          `json:"created_at"`
+	Nodes        []string           `json:"nodes"`
+	VNodes       int                `json:"vnodes"`
+	Partitioner  string             `json:"partitioner,omitempty"`
+	Weights      map[string]float64 `json:"weights,omitempty"`
+	ReplicationN int                `json:"replication_n"`
+	Streams      []Stream           `json:"streams"`
+}
+
+type Stream struct {
+	Node    string `json:"node"`
+	File    string `json:"file"`
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+	SHA256  string `json:"sha256"`
+	// root of a merkle tree over the stream's record hashes, empty when
+	// the load was built without verification
+	MerkleRoot string `json:"merkle_root,omitempty"`
+}
+
+type Options struct {
+	Input  string
+	Format string
+	// ring addresses of the target cluster, as its nodes register
+	// themselves
+	Nodes        []string
+	ReplicationN int
+	VNodes       int
+	// partitioner of the target cluster, md5 when empty
+	Partitioner string
+	// weights of the target nodes that do not have weight 1
+	Weights map[string]float64
+	// directory for the stream files and the manifest
+	Dir string
+	// keep the timestamps in the input instead of assigning new ones
+	PreserveTimestamps bool
+	Compression        *storage.CompressionPolicy
+	Memory             int
+	// compute merkle roots for Ingest to check against. this keeps a
+	// hash of every key of one node in memory at a time
+	Verify bool
+}
+
+// partitions the input by ring ownership and writes one stream file per
+// target node, sorted by key with one version of every key, ready for
+// Ingest. input larger than Memory is sorted in runs that are merged
+// afterwards, so the input size is bound by disk rather than memory
+func Build(opts Options) (*Manifest, error) {
+	if len(opts.Nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+	if err := bulk.ValidateFormat(opts.Format); err != nil {
+		return nil, err
+	}
+	if opts.Memory <= 0 {
+		opts.Memory = DefaultMemory
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	runDir, err := os.MkdirTemp(opts.Dir, "runs-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(runDir)
+
+	tokens, err := ring.ParsePartitioner(opts.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+
+	hashring := ring.New(opts.VNodes)
+	hashring.SetPartitioner(tokens)
+	for _, node := range opts.Nodes {
+		hashring.SetWeight(node, opts.Weights[node])
+		hashring.AddNode(node)
+	}
+
+	p := &partitioner{
+		ring:         hashring,
+		replicationN: opts.ReplicationN,
+		runDir:       runDir,
+		memory:       opts.Memory,
+		pending:      make(map[string][]*storage.BackupEntry),
+		runs:         make(map[string][]string),
+	}
+	if err := p.read(opts); err != nil {
+		return nil, err
+	}
+	if err := p.spill(); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Version:      ManifestVersion,
+		CreatedAt:    time.Now().UTC(),
+		Nodes:        opts.Nodes,
+		VNodes:       hashring.VNodes(),
+		Partitioner:  tokens.Name(),
+		Weights:      opts.Weights,
+		ReplicationN: opts.ReplicationN,
+	}
+
+	for i, node := range opts.Nodes {
+		stream := Stream{Node: node, File: fmt.Sprintf("node-%d.kv", i)}
+		if err := merge(p.runs[node], filepath.Join(opts.Dir, stream.File), &stream, opts.Verify); err != nil {
+			return nil, fmt.Errorf("%s: %w", node, err)
+		}
+		manifest.Streams = append(manifest.Streams, stream)
+	}
+
+	return manifest, writeManifest(opts.Dir, manifest)
+}
+
+// routes input records to their replicas and spills sorted runs
+type partitioner struct {
+	ring         *ring.ConsistentHashRing
+	replicationN int
+	runDir       string
+	memory       int
+
+	pending      map[string][]*storage.BackupEntry
+	pendingBytes int
+	runs         map[string][]string
+	spilled      int
+}
+
+func (p *partitioner) read(opts Options) error {
+	f, err := os.Open(opts.Input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := bulk.NewReader(f, opts.Format, 0)
+	if err != nil {
+		return err
+	}
+
+	clock := hlc.NewClock("loader")
+
+	for {
+		in, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if in.Key == "" {
+			return fmt.Errorf("record without key before byte %d", r.Offset())
+		}
+
+		value, err := in.Bytes()
+		if err != nil {
+			return fmt.Errorf("%s: %w", in.Key, err)
+		}
+
+		record := &storage.Record{
+			Key:         in.Key,
+			Value:       value,
+			ContentType: in.ContentType,
+		}
+		if opts.PreserveTimestamps && in.Timestamp != nil && in.Timestamp.WallTime != 0 {
+			record.Timestamp = *in.Timestamp
+		} else {
+			record.Timestamp = clock.Now()
+		}
+
+		entry := storage.NewBackupEntry(record, opts.Compression)
+		for _, node := range p.ring.GetReplicas(record.Key, p.replicationN) {
+			p.pending[node] = append(p.pending[node], entry)
+		}
+
+		p.pendingBytes += entry.Size()
+		if p.pendingBytes >= p.memory {
+			if err := p.spill(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writes every node's pending entries to a new run file, sorted by key
+// and with only the newest version of each key
+func (p *partitioner) spill() error {
+	for node, entries := range p.pending {
+		if len(entries) == 0 {
+			continue
+		}
+
+		// stable, so equal timestamps resolve to the later input
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+		unique := entries[:0]
+		for _, e := range entries {
+			if n := len(unique); n > 0 && unique[n-1].Key == e.Key {
+				if !hlc.IsBefore(e.Timestamp, unique[n-1].Timestamp) {
+					unique[n-1] = e
+				}
+				continue
+			}
+			unique = append(unique, e)
+		}
+
+		path := filepath.Join(p.runDir, fmt.Sprintf("run-%d.kv", p.spilled))
+		if err := writeRun(path, unique); err != nil {
+			return err
+		}
+		p.runs[node] = append(p.runs[node], path)
+		p.pending[node] = entries[:0]
+		p.spilled++
+	}
+
+	p.pendingBytes = 0
+	return nil
+}
+
+func writeRun(path string, entries []*storage.BackupEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+
+	for len(entries) > 0 {
+		n := min(len(entries), listEntries)
+		if err := storage.WriteBackup(w, entries[:n]); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+
+	return w.Flush()
+}
+
+// merges the sorted runs of one node into its stream file. runs are
+// spilled in input order, so on equal timestamps the later run wins
+func merge(runs []string, path string, stream *Stream, verify bool) error {
+	h := &runHeap{}
+	for i, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r := &runReader{r: storage.NewBackupReader(f), order: i}
+		if err := r.advance(); err != nil {
+			return err
+		}
+		if r.head != nil {
+			heap.Push(h, r)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(f, hash)}
+	w := bufio.NewWriterSize(counter, 1<<20)
+
+	var keyHashes map[string]string
+	if verify {
+		keyHashes = make(map[string]string)
+	}
+
+	batch := make([]*storage.BackupEntry, 0, listEntries)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := storage.WriteBackup(w, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for h.Len() > 0 {
+		winner := (*h)[0].head
+		key := winner.Key
+
+		for h.Len() > 0 && (*h)[0].head.Key == key {
+			r := (*h)[0]
+			if !hlc.IsBefore(r.head.Timestamp, winner.Timestamp) {
+				winner = r.head
+			}
+
+			if err := r.advance(); err != nil {
+				return err
+			}
+			if r.head == nil {
+				heap.Pop(h)
+			} else {
+				heap.Fix(h, 0)
+			}
+		}
+
+		batch = append(batch, winner)
+		stream.Records++
+		if keyHashes != nil {
+			keyHashes[key] = winner.Hash()
+		}
+
+		if len(batch) >= listEntries {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	stream.Bytes = counter.n
+	stream.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if keyHashes != nil {
+		stream.MerkleRoot = antientropy.Build(keyHashes, merkleDepth).GetRootHash()
+	}
+	return nil
+}
+
+type runReader struct {
+	r     *storage.BackupReader
+	head  *storage.BackupEntry
+	order int
+}
+
+func (r *runReader) advance() error {
+	entry, err := r.r.Next()
+	if err == io.EOF {
+		r.head = nil
+		return nil
+	}
+	r.head = entry
+	return err
+}
+
+// orders runs by their next key, then by spill order so that the merge
+// sees versions of a key in input order
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].head.Key != h[j].head.Key {
+		return h[i].head.Key < h[j].head.Key
+	}
+	return h[i].order < h[j].order
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func writeManifest(dir string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, ManifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, ManifestFile))
+}
+
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported load manifest version %d", manifest.Version)
+	}
+
+	return &manifest, nil
+}
@@ -0,0 +1,195 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/bulk"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+var testNodes = []string{"localhost:9001", "localhost:9011", "localhost:9021"}
+
+// writes records as a JSONL input file
+func writeInput(t *testing.T, records []*bulk.Record) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "input.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := bulk.NewWriter(f, bulk.FormatJSONL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadInto(t *testing.T, opts Options) []*storage.BadgerStorage {
+	t.Helper()
+
+	if _, err := Build(opts); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	dataDirs := make([]string, len(opts.Nodes))
+	for i := range dataDirs {
+		dataDirs[i] = t.TempDir()
+	}
+	results, err := Ingest(opts.Dir, nil, dataDirs, nil)
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	for _, r := range results {
+		if opts.Verify && !r.Verified {
+			t.Errorf("%s was not verified", r.Node)
+		}
+	}
+
+	stores := make([]*storage.BadgerStorage, len(dataDirs))
+	for i, dir := range dataDirs {
+		stores[i] = storage.NewBadgerStorage(dir)
+		if err := stores[i].Open(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { stores[i].Close() })
+	}
+	return stores
+}
+
+func TestLoadPlacesRecordsOnTheirReplicas(t *testing.T) {
+	base := time.Now().Add(-time.Hour).UnixNano()
+	ts := func(n int64) *hlc.Timestamp { return &hlc.Timestamp{WallTime: base + n, NodeID: "src"} }
+
+	var input []*bulk.Record
+	want := make(map[string]*bulk.Record)
+	for i := range 200 {
+		r := &bulk.Record{Key: fmt.Sprintf("user:%03d", i), Value: fmt.Sprintf("v%d", i), Timestamp: ts(int64(i))}
+		input = append(input, r)
+		want[r.Key] = r
+	}
+	binary := &bulk.Record{Key: "blob", Value: "/wD+", Encoding: "base64", ContentType: "application/octet-stream", Timestamp: ts(500)}
+	input = append(input, binary)
+	want[binary.Key] = binary
+
+	// the newer version wins over one later in the input, which ends up
+	// in a later run
+	newer := &bulk.Record{Key: "dup", Value: "new", Timestamp: ts(1000)}
+	input = append([]*bulk.Record{newer}, input...)
+	input = append(input, &bulk.Record{Key: "dup", Value: "old", Timestamp: ts(10)})
+	want[newer.Key] = newer
+
+	opts := Options{
+		Input:              writeInput(t, input),
+		Format:             bulk.FormatJSONL,
+		Nodes:              testNodes,
+		ReplicationN:       2,
+		VNodes:             10,
+		Dir:                t.TempDir(),
+		PreserveTimestamps: true,
+		// spills a run every few records
+		Memory: 512,
+		Verify: true,
+	}
+	stores := loadInto(t, opts)
+
+	hashring := ring.New(10)
+	for _, node := range testNodes {
+		hashring.AddNode(node)
+	}
+
+	for key, in := range want {
+		value, err := in.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		replicas := hashring.GetReplicas(key, 2)
+		for i, node := range testNodes {
+			record, err := stores[i].Get(key)
+			if !slices.Contains(replicas, node) {
+				if !errors.Is(err, storage.ErrKeyNotFound) {
+					t.Errorf("%s on %s, which is not one of its replicas %v", key, node, replicas)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("%s missing on its replica %s: %v", key, node, err)
+				continue
+			}
+			if !bytes.Equal(record.Value, value) || record.ContentType != in.ContentType {
+				t.Errorf("%s on %s = %q (%s), want %q (%s)", key, node, record.Value, record.ContentType, value, in.ContentType)
+			}
+			if hlc.Compare(record.Timestamp, *in.Timestamp) != 0 {
+				t.Errorf("%s on %s written at %v, want the input's %v", key, node, record.Timestamp, *in.Timestamp)
+			}
+		}
+	}
+}
+
+func TestLoadAssignsTimestampsUnlessPreserved(t *testing.T) {
+	old := &hlc.Timestamp{WallTime: time.Now().Add(-time.Hour).UnixNano(), NodeID: "src"}
+	opts := Options{
+		Input:        writeInput(t, []*bulk.Record{{Key: "k", Value: "v", Timestamp: old}}),
+		Format:       bulk.FormatJSONL,
+		Nodes:        testNodes[:1],
+		ReplicationN: 1,
+		VNodes:       10,
+		Dir:          t.TempDir(),
+	}
+	start := time.Now().UnixNano()
+	stores := loadInto(t, opts)
+
+	record, err := stores[0].Get("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Timestamp.WallTime < start {
+		t.Errorf("loaded at %v, want a timestamp from the load instead of %v", record.Timestamp, *old)
+	}
+}
+
+func TestIngestRejectsChangedStream(t *testing.T) {
+	opts := Options{
+		Input:        writeInput(t, []*bulk.Record{{Key: "k", Value: "v"}}),
+		Format:       bulk.FormatJSONL,
+		Nodes:        testNodes[:1],
+		ReplicationN: 1,
+		VNodes:       10,
+		Dir:          t.TempDir(),
+	}
+	manifest, err := Build(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest.Streams[0].SHA256 = "0000"
+	if err := writeManifest(opts.Dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Ingest(opts.Dir, nil, []string{t.TempDir()}, nil)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Ingest error = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
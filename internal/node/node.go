@@ -2,27 +2,40 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/AuraReaper/strangedb/internal/audit"
+	"github.com/AuraReaper/strangedb/internal/auth"
 	"github.com/AuraReaper/strangedb/internal/config"
 	"github.com/AuraReaper/strangedb/internal/coordinator"
 	"github.com/AuraReaper/strangedb/internal/gossip"
 	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ratelimit"
+	"github.com/AuraReaper/strangedb/internal/replication"
 	"github.com/AuraReaper/strangedb/internal/ring"
 	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/AuraReaper/strangedb/internal/tlsutil"
 	"github.com/AuraReaper/strangedb/internal/transport/grpc"
 	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	"github.com/AuraReaper/strangedb/internal/transport/grpc/kv"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
 	httpTransport "github.com/AuraReaper/strangedb/internal/transport/http"
+	"github.com/AuraReaper/strangedb/internal/transport/resp"
 	"github.com/rs/zerolog/log"
 )
 
+// how often the limits file is checked for changes
+const limitsReloadInterval = 10 * time.Second
+
 type Node struct {
 	cfg                *config.Config
-	storage            storage.Storage
+	storage            *storage.BadgerStorage
 	clock              *hlc.Clock
 	ring               *ring.ConsistentHashRing
 	gossiper           *gossip.Gossiper
@@ -30,18 +43,57 @@ type Node struct {
 	grpcServer         *grpc.Server
 	grpcClient         *grpc.Client
 	httpServer         *httpTransport.Server
+	respServer         *resp.Server
 	readReapair        *coordinator.ReadRepair
 	hintStore          *coordinator.HintStore
 	hintedHandoff      *coordinator.HintedHandoff
 	tombstoneCollector *storage.TombstoneCollector
+	replicationAgent   *replication.Agent
+	peerTLS            *tlsutil.Reloader
+	httpTLS            *tlsutil.Reloader
+	auditLog           *audit.Log
+	limits             *ratelimit.Reloader
 }
 
 func New(cfg *config.Config) (*Node, error) {
+	compression, err := storage.NewCompressionPolicy(cfg.Compression, cfg.CompressionNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := grpcTransport.ValidateCompressor(cfg.GRPCCompression); err != nil {
+		return nil, err
+	}
+
+	if cfg.Weight <= 0 {
+		return nil, fmt.Errorf("weight must be positive, got %g", cfg.Weight)
+	}
+
+	partitioner, err := ring.ParsePartitioner(cfg.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionKey, err := storage.LoadEncryptionKey(cfg.EncryptionKeyFile, cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
 	store := storage.NewBadgerStorage(cfg.DataDir)
+	store.SetCompression(compression)
+	store.SetEncryption(encryptionKey, cfg.EncryptionKeyRotation)
+	store.SetLogger(log.With().Str("component", "storage").Logger())
+	if encryptionKey == nil {
+		log.Warn().Msg("no encryption key set, the data directory is stored in plaintext")
+	}
 	clock := hlc.NewClock(cfg.NodeID)
 
 	hashring := ring.New(cfg.VNodes)
+	hashring.SetPartitioner(partitioner)
+	hashring.SetDCReplication(cfg.DCReplication)
 	nodeURL := fmt.Sprintf("localhost:%d", cfg.GRPCPort)
+	hashring.SetTopology(nodeURL, ring.Topology{DC: cfg.DC, Rack: cfg.Rack})
+	hashring.SetWeight(nodeURL, cfg.Weight)
 	hashring.AddNode(nodeURL)
 
 	for _, seed := range cfg.Seeds {
@@ -50,10 +102,57 @@ func New(cfg *config.Config) (*Node, error) {
 		}
 	}
 
-	grpcClient := grpcTransport.NewClient()
+	peerTLS, httpTLS, err := loadTLS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	clientOpts := grpcTransport.ClientOptions{
+		Compressor: cfg.GRPCCompression,
+		PeerSecret: cfg.ClusterSecret,
+		Timeouts: grpcTransport.Timeouts{
+			Read:      cfg.RPCReadTimeout,
+			Write:     cfg.RPCWriteTimeout,
+			Bulk:      cfg.RPCBulkTimeout,
+			Replicate: cfg.RPCReplicateTimeout,
+		},
+		Retry: grpcTransport.RetryOptions{
+			Attempts: cfg.RPCAttempts,
+			Backoff:  cfg.RPCBackoff,
+		},
+		Breaker: grpcTransport.BreakerOptions{
+			Failures: cfg.BreakerFailures,
+			Cooldown: cfg.BreakerCooldown,
+		},
+		Keepalive: grpcTransport.KeepaliveOptions{
+			Time:    cfg.PeerKeepalive,
+			Timeout: cfg.PeerKeepaliveTimeout,
+		},
+	}
+	if peerTLS != nil {
+		clientOpts.TLS = peerTLS.ClientConfig()
+	}
+	grpcClient := grpcTransport.NewClient(clientOpts)
 	gossiper := gossip.New(nodeURL, cfg.Seeds, cfg.GossipInterval)
+	gossiper.SetTopology(cfg.DC, cfg.Rack)
+	gossiper.SetPartitioner(partitioner.Name())
+	gossiper.SetWeight(cfg.Weight)
+	gossiper.SetTransport(grpcClient.Gossip)
 
 	gossiper.SetMembershipChangeCallback(func(members []string) {
+		// labels and weights first, so a new node is placed by its rack
+		// and gets its share of virtual nodes right away
+		for addr, member := range gossiper.GetAllMembers() {
+			if addr != nodeURL {
+				grpcClient.SetPeerAlive(addr, member.State != gossip.Dead)
+			}
+			if member.DC != "" || member.Rack != "" {
+				hashring.SetTopology(addr, ring.Topology{DC: member.DC, Rack: member.Rack})
+			}
+			if member.Weight > 0 {
+				hashring.SetWeight(addr, member.Weight)
+			}
+		}
 		for _, member := range members {
 			hashring.AddNode(member)
 		}
@@ -66,7 +165,7 @@ func New(cfg *config.Config) (*Node, error) {
 		store,
 		clock,
 		grpcClient,
-		cfg.ReplicationN,
+		cfg.Replicas(),
 		cfg.ReadQuorum,
 		cfg.WriteQuorum,
 		coordLogger,
@@ -75,12 +174,95 @@ func New(cfg *config.Config) (*Node, error) {
 	readReapir := coordinator.NewReadRepair(coord)
 	hintStore := coordinator.NewHintStore(1000, cfg.TombstoneTTL)
 	grpcServer := grpcTransport.NewServer(cfg.GRPCPort, store, clock)
-	handler := httpTransport.NewHandler(coord, clock, cfg.NodeID, gossiper, hashring)
-	httpServer := httpTransport.NewServer(handler, cfg.HTTPPort)
+	grpcServer.SetGossiper(gossiper)
+	grpcServer.SetPeerSecret(cfg.ClusterSecret)
+	if peerTLS != nil {
+		grpcServer.SetTLS(peerTLS.ServerConfig(true), true)
+	}
+	if cfg.ClusterSecret == "" && peerTLS == nil {
+		log.Warn().Msg("no cluster secret or certificate set, any client can use the inter-node gRPC service")
+	}
+	auditLog := audit.NewLog(clock, cfg.NodeID, cfg.AuditRetention,
+		log.With().Str("component", "audit").Logger())
+	coord.SetAuditor(auditLog)
+	coord.SetMaxClockSkew(cfg.MaxClockSkew)
+	coord.SetAdmission(coordinator.AdmissionOptions{
+		MaxInFlight:     cfg.MaxInFlight,
+		MaxQueued:       cfg.MaxQueued,
+		QueueTimeout:    cfg.QueueTimeout,
+		MaxPeerInFlight: cfg.MaxPeerInFlight,
+	})
+	handler := httpTransport.NewHandler(coord, clock, cfg.NodeID, gossiper, hashring,
+		log.With().Str("component", "http").Logger())
+	handler.SetAuditLog(auditLog)
+	handler.SetPeerClient(grpcClient)
+	authLog := log.With().Str("component", "audit").Logger()
+	httpOpts := httpTransport.ServerOptions{CORSOrigins: cfg.CORSOrigins, AuthLog: authLog}
+	if cfg.AuthFile != "" {
+		httpOpts.Auth, err = auth.Load(cfg.AuthFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+	} else {
+		log.Warn().Msg("no auth file set, anyone reaching the client APIs can read and write every key")
+	}
+	if httpTLS != nil {
+		httpOpts.TLS = httpTLS.ServerConfig(false)
+	}
+	httpServer := httpTransport.NewServer(handler, cfg.HTTPPort, httpOpts)
 	hintedHandoff := coordinator.NewHintedHandoff(hintStore, grpcClient, time.Minute)
 	tombstoneCollector := storage.NewTombstoneCollector(store.DB(), cfg.TombstoneTTL, time.Hour)
 
 	coord.SetReadRepair(readReapir)
+	coord.SetHintStore(hintStore)
+	coord.SetClusterID(cfg.ClusterID)
+	grpcServer.SetReplicator(coord)
+	kvService := kv.NewService(coord, hashring, gossiper)
+	kvService.SetMaxValueSize(cfg.KVMaxValue)
+	if httpOpts.Auth != nil {
+		kvService.SetAuth(httpOpts.Auth, authLog)
+		kvService.SetAuditLog(auditLog)
+	}
+	grpcServer.RegisterService(&pb.KVService_ServiceDesc, kvService)
+
+	var limits *ratelimit.Reloader
+	if cfg.LimitsFile != "" {
+		limiter := ratelimit.NewLimiter(nil)
+		limits, err = ratelimit.NewReloader(cfg.LimitsFile, limitsReloadInterval, func(limitsCfg *ratelimit.Config) {
+			limiter.SetConfig(limitsCfg)
+			store.SetQuotas(limitsCfg.Quotas())
+		}, log.With().Str("component", "limits").Logger())
+		if err != nil {
+			return nil, fmt.Errorf("limits: %w", err)
+		}
+		handler.SetLimiter(limiter)
+		kvService.SetLimiter(limiter)
+	}
+
+	var respServer *resp.Server
+	if cfg.RESPPort > 0 {
+		respServer = resp.NewServer(coord, cfg.RESPPort, log.With().Str("component", "resp").Logger())
+		respServer.SetCommandTimeout(cfg.RESPTimeout)
+		if httpOpts.Auth != nil {
+			respServer.SetAuth(httpOpts.Auth, authLog)
+			respServer.SetAuditLog(auditLog)
+		}
+	}
+
+	var agent *replication.Agent
+	if len(cfg.ReplicateTo) > 0 {
+		agent, err = replication.NewAgent(replication.Options{
+			ClusterID:    cfg.ClusterID,
+			Remotes:      cfg.ReplicateTo,
+			BatchSize:    cfg.ReplicationBatch,
+			QueueSize:    cfg.ReplicationQueue,
+			ReplayWindow: cfg.ReplicationReplay,
+			StatePath:    filepath.Join(cfg.DataDir, "replication.json"),
+		}, nodeURL, hashring, store, grpcClient, log.With().Str("component", "replication").Logger())
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &Node{
 		cfg:                cfg,
@@ -92,17 +274,68 @@ func New(cfg *config.Config) (*Node, error) {
 		grpcServer:         grpcServer,
 		grpcClient:         grpcClient,
 		httpServer:         httpServer,
+		respServer:         respServer,
 		readReapair:        readReapir,
 		hintedHandoff:      hintedHandoff,
 		tombstoneCollector: tombstoneCollector,
+		replicationAgent:   agent,
+		peerTLS:            peerTLS,
+		httpTLS:            httpTLS,
+		auditLog:           auditLog,
+		limits:             limits,
 	}, nil
 }
 
+// the certificates of the gRPC and HTTP listeners, nil for those
+// without one
+func loadTLS(cfg *config.Config) (*tlsutil.Reloader, *tlsutil.Reloader, error) {
+	var peerTLS, httpTLS *tlsutil.Reloader
+	var err error
+	tlsLog := log.With().Str("component", "tls").Logger()
+
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" || cfg.TLSCA == "" {
+			return nil, nil, errors.New("inter-node TLS needs a certificate, a key and the cluster CA")
+		}
+		peerTLS, err = tlsutil.NewReloader(cfg.TLSCert, cfg.TLSKey, cfg.TLSCA, cfg.TLSReloadInterval, tlsLog)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cfg.HTTPTLSCert != "" || cfg.HTTPTLSKey != "" {
+		if cfg.HTTPTLSCert == "" || cfg.HTTPTLSKey == "" {
+			return nil, nil, errors.New("HTTPS needs a certificate and a key")
+		}
+		httpTLS, err = tlsutil.NewReloader(cfg.HTTPTLSCert, cfg.HTTPTLSKey, "", cfg.TLSReloadInterval, tlsLog)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return peerTLS, httpTLS, nil
+}
+
 func (n *Node) Start(ctx context.Context) error {
 	if err := n.storage.Open(); err != nil {
 		return fmt.Errorf("failed to open storage: %w", err)
 	}
 
+	if err := n.checkPartitioner(); err != nil {
+		n.storage.Close()
+		return err
+	}
+
+	if err := n.auditLog.Open(n.storage.DB()); err != nil {
+		n.storage.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	if err := n.gossiper.Join(ctx); err != nil {
+		n.storage.Close()
+		return err
+	}
+
 	go func() {
 		fmt.Printf("Starting gRPC server on port %d\n", n.cfg.GRPCPort)
 		if err := n.grpcServer.Start(); err != nil {
@@ -110,11 +343,35 @@ func (n *Node) Start(ctx context.Context) error {
 		}
 	}()
 
+	if n.respServer != nil {
+		go func() {
+			fmt.Printf("Starting redis protocol server on port %d\n", n.cfg.RESPPort)
+			if err := n.respServer.Start(); err != nil {
+				fmt.Printf("redis protocol server error: %v\n", err)
+			}
+		}()
+	}
+
 	n.gossiper.Start()
 	fmt.Println("Gossiper started")
 
 	n.hintedHandoff.Start()
 	n.tombstoneCollector.Start()
+	n.auditLog.Start()
+	if n.limits != nil {
+		n.limits.Start()
+	}
+	for _, reloader := range []*tlsutil.Reloader{n.peerTLS, n.httpTLS} {
+		if reloader != nil {
+			reloader.Start()
+		}
+	}
+
+	if n.replicationAgent != nil {
+		if err := n.replicationAgent.Start(); err != nil {
+			return err
+		}
+	}
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -129,16 +386,51 @@ func (n *Node) Start(ctx context.Context) error {
 	}
 }
 
+// keys were placed by the partitioner the data directory was first
+// written with, so a node never starts with another one
+func (n *Node) checkPartitioner() error {
+	name := n.ring.Partitioner().Name()
+
+	stored, err := n.storage.Meta(storage.MetaPartitioner)
+	if err != nil {
+		return err
+	}
+	if stored == "" {
+		return n.storage.SetMeta(storage.MetaPartitioner, name)
+	}
+	if stored != name {
+		return fmt.Errorf("data directory %s was written with the %s partitioner, not %s", n.cfg.DataDir, stored, name)
+	}
+
+	return nil
+}
+
 func (n *Node) Shutdown() error {
+	if n.replicationAgent != nil {
+		n.replicationAgent.Stop()
+	}
 	n.gossiper.Stop()
+	if n.respServer != nil {
+		n.respServer.Stop()
+	}
 	n.grpcServer.Stop()
 	n.grpcClient.Close()
 	n.hintedHandoff.Stop()
 	n.tombstoneCollector.Stop()
+	if n.limits != nil {
+		n.limits.Stop()
+	}
+	for _, reloader := range []*tlsutil.Reloader{n.peerTLS, n.httpTLS} {
+		if reloader != nil {
+			reloader.Stop()
+		}
+	}
 
 	if err := n.httpServer.Shutdown(); err != nil {
 		return err
 	}
+	// after every api, so their last writes are recorded
+	n.auditLog.Stop()
 
 	return n.storage.Close()
 }
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/filewatch"
+	"github.com/rs/zerolog"
+)
+
+type Rate struct {
+	// requests, or keys of a batch, per second
+	PerSecond float64 `json:"rate"`
+	// requests allowed at once after a quiet period, rate by default
+	Burst int `json:"burst,omitempty"`
+}
+
+type NamespaceLimits struct {
+	Rate
+	// bytes the namespace may take on each node, 0 for no quota
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+}
+
+// the limits file, JSON:
+//
+//	{
+//	  "default": {"rate": 200, "burst": 400},
+//	  "clients": {"batch-job": {"rate": 50}},
+//	  "namespaces": {"orders": {"rate": 1000, "quota_bytes": 10737418240}}
+//	}
+//
+// clients are principals when auth is on, otherwise IP addresses. a
+// client without an entry gets the default, or no limit without one
+type Config struct {
+	Default    *Rate                      `json:"default,omitempty"`
+	Clients    map[string]Rate            `json:"clients,omitempty"`
+	Namespaces map[string]NamespaceLimits `json:"namespaces,omitempty"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.Default != nil {
+		if err := c.Default.validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+
+	for client, rate := range c.Clients {
+		if err := rate.validate(); err != nil {
+			return fmt.Errorf("client %q: %w", client, err)
+		}
+		c.Clients[client] = rate
+	}
+
+	for ns, limits := range c.Namespaces {
+		// a namespace may only have a quota
+		if limits.PerSecond != 0 || limits.Burst != 0 {
+			if err := limits.Rate.validate(); err != nil {
+				return fmt.Errorf("namespace %q: %w", ns, err)
+			}
+		}
+		if limits.QuotaBytes < 0 {
+			return fmt.Errorf("namespace %q: quota_bytes must not be negative", ns)
+		}
+		c.Namespaces[ns] = limits
+	}
+
+	return nil
+}
+
+func (r *Rate) validate() error {
+	if r.PerSecond <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	if r.Burst == 0 {
+		r.Burst = int(math.Max(1, math.Ceil(r.PerSecond)))
+	}
+	return nil
+}
+
+// the storage quota of every namespace that has one
+func (c *Config) Quotas() map[string]int64 {
+	quotas := make(map[string]int64)
+	for ns, limits := range c.Namespaces {
+		if limits.QuotaBytes > 0 {
+			quotas[ns] = limits.QuotaBytes
+		}
+	}
+	return quotas
+}
+
+// loads the limits file again whenever it changes and hands the new
+// config to apply, so limits change without a restart
+type Reloader struct {
+	path    string
+	apply   func(*Config)
+	watcher *filewatch.Watcher
+}
+
+// loads and applies the file once. a file that fails to load later
+// keeps the limits in force
+func NewReloader(path string, interval time.Duration, apply func(*Config), log zerolog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		path:  path,
+		apply: apply,
+	}
+
+	watcher, err := filewatch.New([]string{path}, interval, r.load, log)
+	if err != nil {
+		return nil, err
+	}
+	r.watcher = watcher
+	return r, nil
+}
+
+func (r *Reloader) Start() {
+	r.watcher.Start()
+}
+
+func (r *Reloader) Stop() {
+	r.watcher.Stop()
+}
+
+func (r *Reloader) load() error {
+	cfg, err := LoadConfig(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.apply(cfg)
+	return nil
+}
@@ -0,0 +1,207 @@
+// Package ratelimit throttles API callers with token buckets, one per
+// client and one per namespace, so a single busy client or namespace
+// cannot take every coordinator goroutine.
+package ratelimit
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idle buckets are dropped once there are more than this many clients,
+// so callers that come and go do not grow the map forever
+const maxIdleClients = 10000
+
+type bucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(r Rate, now time.Time) *bucket {
+	return &bucket{
+		rate:   r.PerSecond,
+		burst:  float64(r.Burst),
+		tokens: float64(r.Burst),
+		last:   now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// takes a new rate, keeping the tokens left up to the new burst
+func (b *bucket) setRate(r Rate, now time.Time) {
+	b.refill(now)
+	b.rate = r.PerSecond
+	b.burst = float64(r.Burst)
+	b.tokens = math.Min(b.tokens, b.burst)
+}
+
+// how long until n tokens are available, 0 when they are
+func (b *bucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+type Limiter struct {
+	mu         sync.Mutex
+	cfg        *Config
+	clients    map[string]*bucket
+	namespaces map[string]*bucket
+}
+
+// a nil config limits nothing
+func NewLimiter(cfg *Config) *Limiter {
+	l := &Limiter{}
+	l.SetConfig(cfg)
+	return l
+}
+
+// replaces the limits. buckets keep the tokens they have left, so a
+// reload does not hand every caller a fresh burst; buckets of callers
+// and namespaces no longer limited are dropped
+func (l *Limiter) SetConfig(cfg *Config) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cfg = cfg
+	if l.clients == nil {
+		l.clients = make(map[string]*bucket)
+		l.namespaces = make(map[string]*bucket)
+	}
+
+	for client, b := range l.clients {
+		if rate, ok := l.clientRate(client); ok {
+			b.setRate(rate, now)
+		} else {
+			delete(l.clients, client)
+		}
+	}
+	for ns, b := range l.namespaces {
+		if rate, ok := l.namespaceRate(ns); ok {
+			b.setRate(rate, now)
+		} else {
+			delete(l.namespaces, ns)
+		}
+	}
+}
+
+func (l *Limiter) Config() *Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.cfg
+}
+
+// takes cost tokens from the bucket of client and of every namespace,
+// or none when one of them runs short. in that case it returns how long
+// to wait before trying again. a cost above a bucket's burst waits for a
+// full bucket rather than forever
+func (l *Limiter) Allow(client string, namespaces []string, cost int) (time.Duration, bool) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buckets []*bucket
+	if b := l.clientBucket(client, now); b != nil {
+		buckets = append(buckets, b)
+	}
+	for _, ns := range namespaces {
+		if b := l.namespaceBucket(ns, now); b != nil {
+			buckets = append(buckets, b)
+		}
+	}
+
+	var retryAfter time.Duration
+	for _, b := range buckets {
+		b.refill(now)
+		retryAfter = max(retryAfter, b.wait(math.Min(float64(cost), b.burst)))
+	}
+	if retryAfter > 0 {
+		return retryAfter, false
+	}
+
+	for _, b := range buckets {
+		b.tokens -= math.Min(float64(cost), b.burst)
+	}
+	return 0, true
+}
+
+func (l *Limiter) clientBucket(client string, now time.Time) *bucket {
+	if b, ok := l.clients[client]; ok {
+		return b
+	}
+
+	rate, ok := l.clientRate(client)
+	if !ok {
+		return nil
+	}
+
+	if len(l.clients) >= maxIdleClients {
+		l.dropFull(now)
+	}
+
+	b := newBucket(rate, now)
+	// names may point into a request buffer that is reused
+	l.clients[strings.Clone(client)] = b
+	return b
+}
+
+func (l *Limiter) namespaceBucket(ns string, now time.Time) *bucket {
+	if b, ok := l.namespaces[ns]; ok {
+		return b
+	}
+
+	rate, ok := l.namespaceRate(ns)
+	if !ok {
+		return nil
+	}
+
+	b := newBucket(rate, now)
+	l.namespaces[strings.Clone(ns)] = b
+	return b
+}
+
+// the rate of a client, false when it has no limit
+func (l *Limiter) clientRate(client string) (Rate, bool) {
+	if rate, ok := l.cfg.Clients[client]; ok {
+		return rate, true
+	}
+	if l.cfg.Default == nil {
+		return Rate{}, false
+	}
+	return *l.cfg.Default, true
+}
+
+// the rate of a namespace, false when it has only a quota or nothing
+func (l *Limiter) namespaceRate(ns string) (Rate, bool) {
+	limits, ok := l.cfg.Namespaces[ns]
+	if !ok || limits.PerSecond == 0 {
+		return Rate{}, false
+	}
+	return limits.Rate, true
+}
+
+// a full bucket is the same as a new one
+func (l *Limiter) dropFull(now time.Time) {
+	for client, b := range l.clients {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.clients, client)
+		}
+	}
+}
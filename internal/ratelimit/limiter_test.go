@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBuckets(t *testing.T) {
+	l := NewLimiter(&Config{
+		Default:    &Rate{PerSecond: 1, Burst: 2},
+		Clients:    map[string]Rate{"batch": {PerSecond: 100, Burst: 100}},
+		Namespaces: map[string]NamespaceLimits{"orders": {Rate: Rate{PerSecond: 1, Burst: 3}}},
+	})
+
+	// the default burst, then a wait of about a second
+	for i := range 2 {
+		if _, ok := l.Allow("10.0.0.1", nil, 1); !ok {
+			t.Fatalf("Expected request %d to be allowed", i)
+		}
+	}
+	retryAfter, ok := l.Allow("10.0.0.1", nil, 1)
+	if ok || retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("Expected a wait of up to a second, got %v, %v", retryAfter, ok)
+	}
+
+	// other clients have their own bucket
+	if _, ok := l.Allow("10.0.0.2", nil, 1); !ok {
+		t.Error("Expected another client to be allowed")
+	}
+
+	// the namespace bucket is shared by every client
+	if _, ok := l.Allow("batch", []string{"orders"}, 3); !ok {
+		t.Error("Expected the batch to be allowed")
+	}
+	if _, ok := l.Allow("10.0.0.3", []string{"orders"}, 1); ok {
+		t.Error("Expected the namespace to be exhausted")
+	}
+
+	// a refused request takes no tokens from the other buckets
+	if _, ok := l.Allow("10.0.0.3", []string{"users"}, 2); !ok {
+		t.Error("Expected the client bucket to be untouched")
+	}
+
+	l.SetConfig(nil)
+	if _, ok := l.Allow("10.0.0.1", []string{"orders"}, 1000); !ok {
+		t.Error("Expected no limits without a config")
+	}
+}
+
+func TestReloadKeepsTokens(t *testing.T) {
+	cfg := &Config{Default: &Rate{PerSecond: 0.001, Burst: 2}}
+	l := NewLimiter(cfg)
+	for range 2 {
+		l.Allow("10.0.0.1", nil, 1)
+	}
+
+	// the same limits again, as a reload of an unchanged file gives
+	l.SetConfig(&Config{Default: &Rate{PerSecond: 0.001, Burst: 2}})
+	if _, ok := l.Allow("10.0.0.1", nil, 1); ok {
+		t.Error("Expected the reload to leave the bucket empty")
+	}
+
+	// a larger burst does not refill the bucket either, a smaller one
+	// caps what is left
+	l.SetConfig(&Config{Default: &Rate{PerSecond: 0.001, Burst: 10}})
+	if _, ok := l.Allow("10.0.0.1", nil, 1); ok {
+		t.Error("Expected a larger burst to leave the bucket empty")
+	}
+	if _, ok := l.Allow("10.0.0.2", nil, 1); !ok {
+		t.Error("Expected a new client to get the new burst")
+	}
+	l.SetConfig(&Config{Default: &Rate{PerSecond: 0.001, Burst: 1}})
+	if _, ok := l.Allow("10.0.0.2", nil, 1); !ok {
+		t.Error("Expected the client to keep a token")
+	}
+	if _, ok := l.Allow("10.0.0.2", nil, 1); ok {
+		t.Error("Expected the smaller burst to cap the tokens left")
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := &Config{
+		Default:    &Rate{PerSecond: 2.5},
+		Namespaces: map[string]NamespaceLimits{"docs": {QuotaBytes: 1 << 20}},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Default.Burst != 3 {
+		t.Errorf("Expected burst 3, got %d", cfg.Default.Burst)
+	}
+	if q := cfg.Quotas(); q["docs"] != 1<<20 || len(q) != 1 {
+		t.Errorf("Unexpected quotas %v", q)
+	}
+
+	bad := &Config{Clients: map[string]Rate{"x": {PerSecond: 0}}}
+	if err := bad.validate(); err == nil {
+		t.Error("Expected a zero rate to be rejected")
+	}
+}
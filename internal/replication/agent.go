@@ -0,0 +1,452 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/AuraReaper/strangedb/internal/telemetry"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrNoClusterID = errors.New("replication needs a cluster id")
+	ErrNoRemotes   = errors.New("replication needs at least one remote address")
+)
+
+const (
+	flushInterval = 100 * time.Millisecond
+	saveInterval  = time.Second
+	retryMin      = 100 * time.Millisecond
+	retryMax      = 10 * time.Second
+)
+
+type Options struct {
+	// id of the local cluster, the origin marker of shipped writes
+	ClusterID string
+	// gRPC addresses of nodes in the remote cluster, tried in turn
+	Remotes   []string
+	BatchSize int
+	// writes buffered between tailing and shipping; once full, tailing
+	// stops and resumes from the watermark when shipping catches up
+	QueueSize int
+	// how far before the saved watermark tailing resumes, covering writes
+	// that reached this node out of timestamp order
+	ReplayWindow time.Duration
+	// file the watermark is kept in
+	StatePath string
+}
+
+// ships the writes this node owns to a remote cluster. every node runs
+// one; a key is shipped by the first of its replicas, the others skip
+// it. writes that came from another cluster are never shipped, which
+// keeps bidirectional setups from looping
+type Agent struct {
+	opts    Options
+	nodeURL string
+	ring    *ring.ConsistentHashRing
+	storage storage.Storage
+	client  *grpcTransport.Client
+	log     zerolog.Logger
+
+	queue chan *storage.Record
+	// wall time of the oldest write in the batch being shipped, 0 when
+	// there is none
+	oldest atomic.Int64
+
+	inflight inflight
+
+	// only touched by the shipping goroutine once started
+	state  *State
+	saved  time.Time
+	remote int
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewAgent(opts Options, nodeURL string, ring *ring.ConsistentHashRing, store storage.Storage,
+	client *grpcTransport.Client, log zerolog.Logger) (*Agent, error) {
+	if opts.ClusterID == "" {
+		return nil, ErrNoClusterID
+	}
+	if len(opts.Remotes) == 0 {
+		return nil, ErrNoRemotes
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+
+	return &Agent{
+		opts:    opts,
+		nodeURL: nodeURL,
+		ring:    ring,
+		storage: store,
+		client:  client,
+		log:     log,
+		queue:   make(chan *storage.Record, opts.QueueSize),
+	}, nil
+}
+
+// starts tailing from the saved watermark; with no watermark every
+// stored write is shipped first
+func (a *Agent) Start() error {
+	state, err := loadState(a.opts.StatePath)
+	if err != nil {
+		return fmt.Errorf("failed to load replication state: %w", err)
+	}
+	a.state = state
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+
+	a.log.Info().
+		Str("cluster", a.opts.ClusterID).
+		Strs("remotes", a.opts.Remotes).
+		Time("watermark", time.Unix(0, state.Watermark.WallTime)).
+		Msg("starting replication agent")
+
+	a.wg.Add(2)
+	go a.tail(ctx)
+	go a.ship(ctx)
+
+	return nil
+}
+
+func (a *Agent) Stop() {
+	if a.cancel == nil {
+		return
+	}
+
+	a.cancel()
+	a.wg.Wait()
+
+	if err := a.state.save(a.opts.StatePath); err != nil {
+		a.log.Error().Err(err).Msg("failed to save replication state")
+	}
+}
+
+// follows local writes until ctx ends, restarting the watch from the
+// watermark whenever it breaks
+func (a *Agent) tail(ctx context.Context) {
+	defer a.wg.Done()
+
+	backoff := retryMin
+	for ctx.Err() == nil {
+		err := a.follow(ctx, a.resumePoint())
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, storage.ErrWatchOverflow) {
+			telemetry.XDCBackpressure.Inc()
+			a.log.Warn().Msg("replication fell behind local writes, resuming from watermark")
+			backoff = retryMin
+		} else {
+			a.log.Warn().Err(err).Dur("retry_in", backoff).Msg("replication watch interrupted")
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff = min(backoff*2, retryMax)
+	}
+}
+
+func (a *Agent) follow(ctx context.Context, since hlc.Timestamp) error {
+	watcher, err := a.storage.Watch(ctx, "", since)
+	if err != nil {
+		return err
+	}
+
+	// the watermark holds until the backlog is through
+	a.inflight.setReplaying(true)
+	replayed := watcher.Replayed()
+	events := watcher.Events()
+	for events != nil {
+		var record *storage.Record
+		select {
+		case <-replayed:
+			// every backlog record was received and queued above
+			a.inflight.setReplaying(false)
+			replayed = nil
+			continue
+		case r, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			record = r
+		}
+
+		if !a.owns(record) {
+			continue
+		}
+
+		// blocks once the queue is full; the watcher then overflows and
+		// is restarted, so a slow remote never holds up local writes
+		a.inflight.push(record.Timestamp)
+		select {
+		case a.queue <- record:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	if err := watcher.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func (a *Agent) owns(record *storage.Record) bool {
+	if record.Origin != "" {
+		telemetry.XDCRecordsSkipped.WithLabelValues("replicated").Inc()
+		return false
+	}
+
+	replicas := a.ring.GetReplicas(record.Key, 1)
+	return len(replicas) > 0 && replicas[0] == a.nodeURL
+}
+
+// the watermark less the replay window, zero before anything was shipped
+func (a *Agent) resumePoint() hlc.Timestamp {
+	a.state.mu.Lock()
+	defer a.state.mu.Unlock()
+
+	if a.state.Watermark.WallTime == 0 {
+		return hlc.Timestamp{}
+	}
+
+	return hlc.Timestamp{WallTime: a.state.Watermark.WallTime - a.opts.ReplayWindow.Nanoseconds()}
+}
+
+// gathers queued writes into batches of up to BatchSize, flushing
+// partial ones every flushInterval
+func (a *Agent) ship(ctx context.Context) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*storage.Record
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case record := <-a.queue:
+			if oldest := a.oldest.Load(); oldest == 0 || record.Timestamp.WallTime < oldest {
+				a.oldest.Store(record.Timestamp.WallTime)
+			}
+			if record.Manifest {
+				// a chunked value travels on its own stream, after the
+				// writes queued before it
+				if len(batch) > 0 && !a.send(ctx, batch) {
+					return
+				}
+				batch = nil
+				if !a.sendLarge(ctx, record) {
+					return
+				}
+				continue
+			}
+			batch = append(batch, record)
+			if len(batch) < a.opts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			a.report()
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if !a.send(ctx, batch) {
+			return
+		}
+		batch = nil
+	}
+}
+
+// retries the batch until the remote cluster takes all of it or ctx
+// ends, moving to the next remote address after every failure
+func (a *Agent) send(ctx context.Context, batch []*storage.Record) bool {
+	records := make([]*pb.Record, len(batch))
+	for i, r := range batch {
+		records[i] = grpcTransport.RecordToProto(r)
+	}
+
+	backoff := retryMin
+	for {
+		addr := a.opts.Remotes[a.remote]
+
+		resp, err := a.client.Replicate(ctx, addr, a.opts.ClusterID, records)
+		if err == nil && len(resp.Failed) == 0 {
+			a.acked(batch)
+			return true
+		}
+		if err == nil {
+			err = fmt.Errorf("%d of %d records not written", len(resp.Failed), len(batch))
+		}
+
+		telemetry.XDCShipErrors.Inc()
+		a.log.Warn().
+			Err(err).
+			Str("remote", addr).
+			Int("records", len(batch)).
+			Dur("retry_in", backoff).
+			Msg("failed to ship batch to remote cluster")
+
+		a.remote = (a.remote + 1) % len(a.opts.Remotes)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+
+		a.report()
+		backoff = min(backoff*2, retryMax)
+	}
+}
+
+// retries a chunked value until the remote cluster takes it or ctx ends,
+// streaming its chunks from local storage. chunks can be gone once a
+// newer write replaced the value; that write is shipped on its own, so
+// the old one is skipped
+func (a *Agent) sendLarge(ctx context.Context, record *storage.Record) bool {
+	manifest, err := storage.ParseManifest(record)
+	if err != nil {
+		a.log.Error().Err(err).Str("key", record.Key).Msg("unreadable manifest not shipped")
+		telemetry.XDCRecordsSkipped.WithLabelValues("bad_manifest").Inc()
+		a.acked([]*storage.Record{record})
+		return true
+	}
+
+	backoff := retryMin
+	for {
+		addr := a.opts.Remotes[a.remote]
+
+		r := &chunkReader{storage: a.storage, key: record.Key, manifest: manifest}
+		_, err := a.client.ReplicateLarge(ctx, addr, a.opts.ClusterID, grpcTransport.RecordToProto(record), r)
+		if err == nil {
+			a.acked([]*storage.Record{record})
+			return true
+		}
+
+		if r.err != nil && a.superseded(record) {
+			telemetry.XDCRecordsSkipped.WithLabelValues("superseded").Inc()
+			a.acked([]*storage.Record{record})
+			return true
+		}
+
+		telemetry.XDCShipErrors.Inc()
+		log := a.log.Warn()
+		if r.err != nil {
+			// the chunks should be here while this version is current
+			log = a.log.Error()
+			err = r.err
+		} else {
+			a.remote = (a.remote + 1) % len(a.opts.Remotes)
+		}
+		log.Err(err).
+			Str("remote", addr).
+			Str("key", record.Key).
+			Int64("size", manifest.Size).
+			Dur("retry_in", backoff).
+			Msg("failed to ship chunked value to remote cluster")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+
+		a.report()
+		backoff = min(backoff*2, retryMax)
+	}
+}
+
+// whether the record's key was since overwritten or deleted locally
+func (a *Agent) superseded(record *storage.Record) bool {
+	current, err := a.storage.Get(record.Key)
+	if errors.Is(err, storage.ErrKeyDeleted) || errors.Is(err, storage.ErrKeyNotFound) {
+		return true
+	}
+	return err == nil && hlc.IsAfter(current.Timestamp, record.Timestamp)
+}
+
+// reads the value a manifest describes from local storage
+type chunkReader struct {
+	storage  storage.Storage
+	key      string
+	manifest *storage.Manifest
+	next     int
+	buf      []byte
+	// why a chunk could not be read, kept apart from the remote's errors
+	err error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next >= len(r.manifest.Chunks) {
+			return 0, io.EOF
+		}
+
+		data, err := r.storage.GetChunk(r.key, r.manifest.UploadID, r.next)
+		if err != nil {
+			r.err = fmt.Errorf("chunk %d: %w", r.next, err)
+			return 0, r.err
+		}
+		r.buf = data
+		r.next++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (a *Agent) acked(batch []*storage.Record) {
+	telemetry.XDCRecordsShipped.Add(float64(len(batch)))
+	a.oldest.Store(0)
+
+	a.inflight.ack(batch)
+	if watermark, ok := a.inflight.watermark(); ok {
+		a.state.advance(watermark)
+	}
+	if time.Since(a.saved) < saveInterval {
+		return
+	}
+
+	if err := a.state.save(a.opts.StatePath); err != nil {
+		a.log.Error().Err(err).Msg("failed to save replication state")
+		return
+	}
+	a.saved = time.Now()
+}
+
+func (a *Agent) report() {
+	telemetry.XDCQueueDepth.Set(float64(len(a.queue)))
+
+	lag := 0.0
+	if oldest := a.oldest.Load(); oldest != 0 {
+		lag = time.Since(time.Unix(0, oldest)).Seconds()
+	}
+	telemetry.XDCLagSeconds.Set(lag)
+}
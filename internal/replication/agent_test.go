@@ -0,0 +1,336 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+)
+
+const testNode = "localhost:0"
+
+// a remote cluster that keeps what it is sent, and refuses batches
+// holding a rejected key
+type remote struct {
+	pb.UnimplementedNodeServiceServer
+
+	mu       sync.Mutex
+	received map[string]bool
+	rejected map[string]bool
+	large    map[string][]byte
+}
+
+func (r *remote) Replicate(_ context.Context, req *pb.ReplicateRequest) (*pb.ReplicateResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var failed []string
+	for _, record := range req.Records {
+		if r.rejected[record.Key] {
+			failed = append(failed, record.Key)
+		}
+	}
+	if len(failed) > 0 {
+		return &pb.ReplicateResponse{Failed: failed}, nil
+	}
+
+	for _, record := range req.Records {
+		r.received[record.Key] = true
+	}
+	return &pb.ReplicateResponse{Written: uint32(len(req.Records))}, nil
+}
+
+func (r *remote) ReplicateLarge(stream pb.NodeService_ReplicateLargeServer) error {
+	var key string
+	var value []byte
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Record != nil {
+			key = msg.Record.Key
+		}
+		value = append(value, msg.Data...)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received[key] = true
+	r.large[key] = value
+	return stream.SendAndClose(&pb.ReplicateResponse{Written: 1})
+}
+
+func (r *remote) largeValue(key string) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.large[key]
+}
+
+func (r *remote) setRejected(key string, rejected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rejected[key] = rejected
+}
+
+func (r *remote) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+func startRemote(t *testing.T) (*remote, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &remote{received: make(map[string]bool), rejected: make(map[string]bool), large: make(map[string][]byte)}
+	server := grpc.NewServer()
+	pb.RegisterNodeServiceServer(server, r)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return r, listener.Addr().String()
+}
+
+func setupTestAgent(t *testing.T, store storage.Storage, addr string, batchSize int, statePath string) *Agent {
+	hashring := ring.New(10)
+	hashring.AddNode(testNode)
+
+	client := grpcTransport.NewClient(grpcTransport.ClientOptions{})
+	t.Cleanup(func() { client.Close() })
+
+	agent, err := NewAgent(Options{
+		ClusterID: "east",
+		Remotes:   []string{addr},
+		BatchSize: batchSize,
+		StatePath: statePath,
+	}, testNode, hashring, store, client, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent
+}
+
+func setupTestStorage(t *testing.T) *storage.BadgerStorage {
+	store := storage.NewBadgerStorage(t.TempDir())
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgentShipsBacklogAndLiveWrites(t *testing.T) {
+	store := setupTestStorage(t)
+	r, addr := startRemote(t)
+	clock := hlc.NewClock("test-node")
+
+	for i := 0; i < 2500; i++ {
+		store.Set(&storage.Record{Key: fmt.Sprintf("k%05d", i), Value: []byte("v"), Timestamp: clock.Now()})
+	}
+	// written in another cluster, never shipped back
+	store.Set(&storage.Record{Key: "remote", Value: []byte("v"), Timestamp: clock.Now(), Origin: "west"})
+
+	agent := setupTestAgent(t, store, addr, 100, filepath.Join(t.TempDir(), "replication.json"))
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Stop()
+
+	waitFor(t, "the backlog to be shipped", func() bool { return r.count() == 2500 })
+
+	live := clock.Now()
+	store.Set(&storage.Record{Key: "live", Value: []byte("v"), Timestamp: live})
+	waitFor(t, "the live write to be shipped", func() bool { return r.count() == 2501 })
+
+	agent.Stop()
+	state, err := loadState(agent.opts.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hlc.Compare(state.Watermark, live) != 0 {
+		t.Errorf("watermark = %v, want the live write %v", state.Watermark, live)
+	}
+	if r.received["remote"] {
+		t.Error("a replicated write was shipped back")
+	}
+}
+
+// the backlog comes in key order, so a key shipped early can be newer
+// than one still waiting; the watermark must not pass the waiting one
+func TestAgentWatermarkStaysBelowUnshippedWrite(t *testing.T) {
+	store := setupTestStorage(t)
+	r, addr := startRemote(t)
+
+	base := time.Now().Add(-time.Hour).UnixNano()
+	newer := hlc.Timestamp{WallTime: base + 100, NodeID: "n"}
+	older := hlc.Timestamp{WallTime: base + 50, NodeID: "n"}
+	store.Set(&storage.Record{Key: "a", Value: []byte("new"), Timestamp: newer})
+	store.Set(&storage.Record{Key: "b", Value: []byte("old"), Timestamp: older})
+	r.setRejected("b", true)
+
+	statePath := filepath.Join(t.TempDir(), "replication.json")
+	agent := setupTestAgent(t, store, addr, 1, statePath)
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "a to be shipped", func() bool { return r.count() == 1 })
+	// let the agent retry b a few times
+	time.Sleep(300 * time.Millisecond)
+	agent.Stop()
+
+	state, err := loadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hlc.IsBefore(state.Watermark, older) {
+		t.Fatalf("watermark %v passed the unshipped write at %v", state.Watermark, older)
+	}
+
+	// a restarted agent still ships b
+	r.setRejected("b", false)
+	agent = setupTestAgent(t, store, addr, 1, statePath)
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Stop()
+
+	waitFor(t, "b to be shipped after a restart", func() bool { return r.count() == 2 })
+}
+
+// stores value as chunks under a manifest record, like a chunked upload
+func setLarge(t *testing.T, store storage.Storage, key string, value []byte, ts hlc.Timestamp) {
+	t.Helper()
+
+	const chunkSize = 4
+	manifest := storage.Manifest{UploadID: key + "-upload", ChunkSize: chunkSize, Size: int64(len(value))}
+	for i := 0; i*chunkSize < len(value); i++ {
+		chunk := value[i*chunkSize : min((i+1)*chunkSize, len(value))]
+		if err := store.SetChunk(key, manifest.UploadID, i, chunk); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(chunk)
+		manifest.Chunks = append(manifest.Chunks, hex.EncodeToString(sum[:]))
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(&storage.Record{Key: key, Value: data, Timestamp: ts, Manifest: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAgentShipsChunkedValues(t *testing.T) {
+	store := setupTestStorage(t)
+	r, addr := startRemote(t)
+	clock := hlc.NewClock("test-node")
+
+	value := []byte("a value split over several chunks")
+	setLarge(t, store, "large", value, clock.Now())
+
+	// the chunks of the old version are gone once it was overwritten
+	old := clock.Now()
+	setLarge(t, store, "replaced", value, old)
+	store.DeleteChunks("replaced", "replaced-upload")
+	store.Set(&storage.Record{Key: "replaced", Value: []byte("small"), Timestamp: clock.Now()})
+	store.Set(&storage.Record{Key: "small", Value: []byte("v"), Timestamp: clock.Now()})
+
+	agent := setupTestAgent(t, store, addr, 100, filepath.Join(t.TempDir(), "replication.json"))
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Stop()
+
+	waitFor(t, "the writes to be shipped", func() bool { return r.count() == 3 })
+	if got := r.largeValue("large"); !bytes.Equal(got, value) {
+		t.Errorf("remote got %q, want %q", got, value)
+	}
+	if r.largeValue("replaced") != nil {
+		t.Error("a replaced chunked value was shipped")
+	}
+
+	live := clock.Now()
+	setLarge(t, store, "live", value, live)
+	waitFor(t, "the live chunked value to be shipped", func() bool { return r.largeValue("live") != nil })
+
+	agent.Stop()
+	state, err := loadState(agent.opts.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hlc.Compare(state.Watermark, live) != 0 {
+		t.Errorf("watermark = %v, want the live write %v", state.Watermark, live)
+	}
+}
+
+func TestInflightWatermark(t *testing.T) {
+	var f inflight
+	ts := func(wall int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wall} }
+	rec := func(wall int64) *storage.Record { return &storage.Record{Timestamp: ts(wall)} }
+
+	f.setReplaying(true)
+	f.push(ts(100))
+	f.ack([]*storage.Record{rec(100)})
+	if _, ok := f.watermark(); ok {
+		t.Fatal("watermark known while the backlog is replayed")
+	}
+	f.setReplaying(false)
+
+	f.push(ts(300))
+	f.push(ts(200))
+	f.push(ts(400))
+	if w, _ := f.watermark(); w.WallTime != 199 {
+		t.Errorf("watermark = %d, want just before the oldest in flight", w.WallTime)
+	}
+
+	f.ack([]*storage.Record{rec(300)})
+	if w, _ := f.watermark(); w.WallTime != 199 {
+		t.Errorf("watermark = %d after acking 300, want 199", w.WallTime)
+	}
+
+	f.ack([]*storage.Record{rec(200)})
+	if w, _ := f.watermark(); w.WallTime != 399 {
+		t.Errorf("watermark = %d after acking 200, want 399", w.WallTime)
+	}
+
+	f.ack([]*storage.Record{rec(400)})
+	if w, _ := f.watermark(); w.WallTime != 400 {
+		t.Errorf("watermark = %d with nothing in flight, want the newest acked", w.WallTime)
+	}
+}
@@ -0,0 +1,133 @@
+package replication
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+)
+
+// progress of the agent: every owned write up to the watermark was
+// acknowledged by the remote cluster
+type State struct {
+	mu        sync.Mutex
+	Watermark hlc.Timestamp `json:"watermark"`
+	Updated   time.Time     `json:"updated"`
+}
+
+// an empty state when nothing was shipped yet
+func loadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// moves the watermark up to ts, never back: writes replayed from before
+// it were shipped already
+func (s *State) advance(ts hlc.Timestamp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hlc.IsAfter(ts, s.Watermark) {
+		s.Watermark = ts
+	}
+}
+
+func (s *State) save(path string) error {
+	s.mu.Lock()
+	s.Updated = time.Now().UTC()
+	data, err := json.Marshal(s)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// the writes handed to the shipper and not acknowledged yet, in queue
+// order. the watermark stays below the oldest of them, so a restart
+// resumes before any write that was still in flight
+type inflight struct {
+	mu         sync.Mutex
+	timestamps []hlc.Timestamp
+	// increasing minimums of timestamps, the first the oldest in flight
+	mins []hlc.Timestamp
+	// a watch is replaying its backlog, which comes in key order: a write
+	// older than any in flight may still be on its way
+	replaying bool
+	// the newest write acknowledged
+	newest hlc.Timestamp
+}
+
+func (f *inflight) push(ts hlc.Timestamp) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.timestamps = append(f.timestamps, ts)
+	for len(f.mins) > 0 && hlc.IsAfter(f.mins[len(f.mins)-1], ts) {
+		f.mins = f.mins[:len(f.mins)-1]
+	}
+	f.mins = append(f.mins, ts)
+}
+
+// the batch was acknowledged; it holds the oldest writes in flight
+func (f *inflight) ack(batch []*storage.Record) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range batch {
+		if len(f.timestamps) > 0 {
+			ts := f.timestamps[0]
+			f.timestamps = f.timestamps[1:]
+			if len(f.mins) > 0 && hlc.Compare(f.mins[0], ts) == 0 {
+				f.mins = f.mins[1:]
+			}
+		}
+		if hlc.IsAfter(r.Timestamp, f.newest) {
+			f.newest = r.Timestamp
+		}
+	}
+}
+
+func (f *inflight) setReplaying(replaying bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replaying = replaying
+}
+
+// the newest timestamp every write up to has been acknowledged, false
+// while that is unknown
+func (f *inflight) watermark() (hlc.Timestamp, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.replaying:
+		return hlc.Timestamp{}, false
+	case len(f.mins) > 0:
+		// just before the oldest write in flight
+		return hlc.Timestamp{WallTime: f.mins[0].WallTime - 1}, true
+	default:
+		return f.newest, true
+	}
+}
@@ -0,0 +1,117 @@
+package ring
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+var ErrUnknownPartitioner = errors.New("unknown partitioner, use md5, xxhash, murmur3 or ordered")
+
+// maps keys and virtual nodes to tokens, their positions on the ring. a
+// key belongs to the first virtual node at or after its token. every node
+// of a cluster must use the same partitioner
+type Partitioner interface {
+	Name() string
+	Token(key string) uint64
+	VNodeToken(nodeURL string, i int) uint64
+	// whether tokens follow key order, so a key range maps to a token
+	// range
+	Ordered() bool
+}
+
+func ParsePartitioner(name string) (Partitioner, error) {
+	switch strings.ToLower(name) {
+	case "", "md5":
+		return MD5Partitioner{}, nil
+	case "xxhash":
+		return XXHashPartitioner{}, nil
+	case "murmur3":
+		return Murmur3Partitioner{}, nil
+	case "ordered":
+		return OrderedPartitioner{}, nil
+	default:
+		return nil, ErrUnknownPartitioner
+	}
+}
+
+func vnodeKey(nodeURL string, i int) string {
+	return fmt.Sprintf("%s:%d", nodeURL, i)
+}
+
+func md5Token(key string) uint64 {
+	h := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint64(h[:8])
+}
+
+// md5 truncated to 64 bits, the original partitioner
+type MD5Partitioner struct{}
+
+func (MD5Partitioner) Name() string { return "md5" }
+
+func (MD5Partitioner) Token(key string) uint64 { return md5Token(key) }
+
+func (MD5Partitioner) VNodeToken(nodeURL string, i int) uint64 {
+	return md5Token(vnodeKey(nodeURL, i))
+}
+
+func (MD5Partitioner) Ordered() bool { return false }
+
+type XXHashPartitioner struct{}
+
+func (XXHashPartitioner) Name() string { return "xxhash" }
+
+func (XXHashPartitioner) Token(key string) uint64 { return xxhash.Sum64String(key) }
+
+func (p XXHashPartitioner) VNodeToken(nodeURL string, i int) uint64 {
+	return p.Token(vnodeKey(nodeURL, i))
+}
+
+func (XXHashPartitioner) Ordered() bool { return false }
+
+// the first half of murmur3 x64 128, as in cassandra's Murmur3Partitioner
+type Murmur3Partitioner struct{}
+
+func (Murmur3Partitioner) Name() string { return "murmur3" }
+
+func (Murmur3Partitioner) Token(key string) uint64 {
+	h1, _ := murmur3([]byte(key), 0)
+	return h1
+}
+
+func (p Murmur3Partitioner) VNodeToken(nodeURL string, i int) uint64 {
+	return p.Token(vnodeKey(nodeURL, i))
+}
+
+func (Murmur3Partitioner) Ordered() bool { return false }
+
+// uses the first 8 bytes of a key as its token, so neighbouring keys land
+// on the same nodes and a prefix scan only visits the nodes owning it.
+// keys sharing their first 8 bytes share a token, and skewed keys give
+// skewed load; virtual nodes are still spread evenly by md5
+type OrderedPartitioner struct{}
+
+func (OrderedPartitioner) Name() string { return "ordered" }
+
+func (OrderedPartitioner) Token(key string) uint64 {
+	var buf [8]byte
+	copy(buf[:], key)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+func (OrderedPartitioner) VNodeToken(nodeURL string, i int) uint64 {
+	return md5Token(vnodeKey(nodeURL, i))
+}
+
+func (OrderedPartitioner) Ordered() bool { return true }
+
+// the largest token of a key starting with prefix
+func (OrderedPartitioner) upperToken(prefix string) uint64 {
+	buf := [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	copy(buf[:], prefix)
+	return binary.BigEndian.Uint64(buf[:])
+}
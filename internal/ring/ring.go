@@ -1,9 +1,7 @@
 package ring
 
 import (
-	"crypto/md5"
-	"encoding/binary"
-	"fmt"
+	"math"
 	"slices"
 	"sort"
 	"sync"
@@ -15,19 +13,59 @@ type ConsistentHashRing struct {
 	sortedHashes []uint64
 	nodes        map[string]bool
 	vnodes       int
+	partitioner  Partitioner
+	// relative capacity per node, 1 when unset; a node gets its weight
+	// times vnodes virtual nodes
+	weights map[string]float64
+
+	topology      map[string]Topology
+	dcReplication map[string]int
+	// derived from nodes and topology by rebuildLayout
+	dcNodes map[string]int
+	dcRacks map[string]int
+	racks   int
 }
 
 func New(vnodes int) *ConsistentHashRing {
 	return &ConsistentHashRing{
-		ring:   make(map[uint64]string),
-		nodes:  make(map[string]bool),
-		vnodes: vnodes,
+		ring:        make(map[uint64]string),
+		nodes:       make(map[string]bool),
+		vnodes:      vnodes,
+		partitioner: MD5Partitioner{},
+		weights:     make(map[string]float64),
+		topology:    make(map[string]Topology),
 	}
 }
 
-func (r *ConsistentHashRing) hash(key string) uint64 {
-	h := md5.Sum([]byte(key))
-	return binary.BigEndian.Uint64(h[:8])
+// switches to another partitioner, placing the virtual nodes of every
+// node again
+func (r *ConsistentHashRing) SetPartitioner(p Partitioner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.partitioner = p
+	r.ring = make(map[uint64]string)
+	r.sortedHashes = nil
+
+	for node := range r.nodes {
+		r.placeVNodes(node)
+	}
+	slices.Sort(r.sortedHashes)
+}
+
+func (r *ConsistentHashRing) Partitioner() Partitioner {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.partitioner
+}
+
+func (r *ConsistentHashRing) placeVNodes(nodeURL string) {
+	for i := 0; i < r.vnodeCount(nodeURL); i++ {
+		hash := r.partitioner.VNodeToken(nodeURL, i)
+		r.ring[hash] = nodeURL
+		r.sortedHashes = append(r.sortedHashes, hash)
+	}
 }
 
 func (r *ConsistentHashRing) AddNode(nodeURL string) {
@@ -39,15 +77,10 @@ func (r *ConsistentHashRing) AddNode(nodeURL string) {
 	}
 
 	r.nodes[nodeURL] = true
-
-	for i := 0; i < r.vnodes; i++ {
-		virtualKey := fmt.Sprintf("%s:%d", nodeURL, i)
-		hash := r.hash(virtualKey)
-		r.ring[hash] = nodeURL
-		r.sortedHashes = append(r.sortedHashes, hash)
-	}
+	r.placeVNodes(nodeURL)
 
 	slices.Sort(r.sortedHashes)
+	r.rebuildLayout()
 }
 
 func (r *ConsistentHashRing) RemoveNode(nodeURL string) {
@@ -59,7 +92,11 @@ func (r *ConsistentHashRing) RemoveNode(nodeURL string) {
 	}
 
 	delete(r.nodes, nodeURL)
+	r.removeVNodes(nodeURL)
+	r.rebuildLayout()
+}
 
+func (r *ConsistentHashRing) removeVNodes(nodeURL string) {
 	newRing := make(map[uint64]string)
 	var newHashes []uint64
 
@@ -76,26 +113,55 @@ func (r *ConsistentHashRing) RemoveNode(nodeURL string) {
 	slices.Sort(r.sortedHashes)
 }
 
-func (r *ConsistentHashRing) GetNode(key string) string {
+// sets the relative capacity of a node, resizing its share of virtual
+// nodes if it is already in the ring. tokens are numbered, so a node
+// that grows keeps its current ones and only adds more
+func (r *ConsistentHashRing) SetWeight(nodeURL string, weight float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if weight <= 0 {
+		weight = 1
+	}
+	if r.weight(nodeURL) == weight {
+		return
+	}
+
+	r.weights[nodeURL] = weight
+	if r.nodes[nodeURL] {
+		r.removeVNodes(nodeURL)
+		r.placeVNodes(nodeURL)
+		slices.Sort(r.sortedHashes)
+	}
+}
+
+func (r *ConsistentHashRing) Weight(nodeURL string) float64 {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	if len(r.ring) == 0 {
-		return ""
+	return r.weight(nodeURL)
+}
+
+func (r *ConsistentHashRing) weight(nodeURL string) float64 {
+	if w, ok := r.weights[nodeURL]; ok {
+		return w
 	}
+	return 1
+}
 
-	hash := r.hash(key)
+func (r *ConsistentHashRing) vnodeCount(nodeURL string) int {
+	return max(1, int(math.Round(float64(r.vnodes)*r.weight(nodeURL))))
+}
 
-	// binary search for fisrt node >= hash
-	idx := sort.Search(len(r.sortedHashes), func(i int) bool {
-		return r.sortedHashes[i] >= hash
-	})
+func (r *ConsistentHashRing) GetNode(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	if idx == len(r.sortedHashes) {
-		idx = 0
+	if len(r.ring) == 0 {
+		return ""
 	}
 
-	return r.ring[r.sortedHashes[idx]]
+	return r.ring[r.sortedHashes[r.search(r.partitioner.Token(key))]]
 }
 
 // return all physical nodes
@@ -112,6 +178,9 @@ func (r *ConsistentHashRing) GetNodes() []string {
 	return nodes
 }
 
+// returns the nodes holding key, primary first. replicas are spread over
+// as many racks as possible; with per-DC replication factors set, n is
+// ignored and every datacenter gets its own factor
 func (r *ConsistentHashRing) GetReplicas(key string, n int) []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -120,38 +189,62 @@ func (r *ConsistentHashRing) GetReplicas(key string, n int) []string {
 		return nil
 	}
 
-	if n > len(r.nodes) {
-		n = len(r.nodes)
-	}
-
-	hash := r.hash(key)
+	return r.placeReplicas(r.search(r.partitioner.Token(key)), n)
+}
 
-	// find start pos
+// index of the first virtual node at or after token, wrapping around
+func (r *ConsistentHashRing) search(token uint64) int {
+	// binary search for fisrt node >= hash
 	idx := sort.Search(len(r.sortedHashes), func(i int) bool {
-		return r.sortedHashes[i] >= hash
+		return r.sortedHashes[i] >= token
 	})
 
 	if idx == len(r.sortedHashes) {
 		idx = 0
 	}
 
-	replicas := make([]string, 0, n)
-	seen := make(map[string]bool)
+	return idx
+}
 
-	for len(replicas) < n {
-		nodeURL := r.ring[r.sortedHashes[idx]]
-		if !seen[nodeURL] {
-			seen[nodeURL] = true
-			replicas = append(replicas, nodeURL)
+// nodes that may hold keys starting with prefix. that is every node
+// unless the partitioner keeps keys in order, in which case only the
+// replicas of the virtual nodes covering the prefix are returned
+func (r *ConsistentHashRing) PrefixReplicas(prefix string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ordered, ok := r.partitioner.(OrderedPartitioner)
+	if !ok || prefix == "" || len(r.nodes) == 0 {
+		nodes := make([]string, 0, len(r.nodes))
+		for node := range r.nodes {
+			nodes = append(nodes, node)
 		}
+		return nodes
+	}
+
+	first := r.search(ordered.Token(prefix))
+	last := r.search(ordered.upperToken(prefix))
 
-		idx++
-		if idx == len(r.sortedHashes) {
-			idx = 0
+	seen := make(map[string]bool)
+	var nodes []string
+	for i := first; ; i = (i + 1) % len(r.sortedHashes) {
+		for _, node := range r.placeReplicas(i, n) {
+			if !seen[node] {
+				seen[node] = true
+				nodes = append(nodes, node)
+			}
+		}
+		if i == last || len(nodes) == len(r.nodes) {
+			break
 		}
 	}
 
-	return replicas
+	return nodes
+}
+
+// virtual nodes of a node of weight 1
+func (r *ConsistentHashRing) VNodes() int {
+	return r.vnodes
 }
 
 func (r *ConsistentHashRing) Stats() map[string]any {
@@ -167,6 +260,85 @@ func (r *ConsistentHashRing) Stats() map[string]any {
 		"total_nodes":     len(r.nodes),
 		"virtual_nodes":   len(r.ring),
 		"vnodes_per_node": r.vnodes,
+		"partitioner":     r.partitioner.Name(),
 		"distribution":    distribution,
 	}
 }
+
+type Ownership struct {
+	Weight float64 `json:"weight"`
+	VNodes int     `json:"vnodes"`
+	// share of the token space the node is the primary replica of
+	PrimaryPercent float64 `json:"primary_percent"`
+	// share of the token space the node holds one of n replicas of;
+	// adds up to n times 100 over the cluster
+	ReplicaPercent float64 `json:"replica_percent"`
+}
+
+// what each node owns, measured by the token ranges ending at its
+// virtual nodes. with a hash partitioner this is the share of keys; with
+// the ordered one it is only the share of possible keys
+func (r *ConsistentHashRing) Ownership(n int) map[string]Ownership {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]Ownership, len(r.nodes))
+	for node := range r.nodes {
+		result[node] = Ownership{Weight: r.weight(node)}
+	}
+
+	total := len(r.sortedHashes)
+	for i, token := range r.sortedHashes {
+		// a virtual node owns the tokens after the previous one, up to
+		// and including its own; unsigned subtraction wraps around
+		share := 100.0
+		if total > 1 {
+			share = float64(token-r.sortedHashes[(i+total-1)%total]) / math.Exp2(64) * 100
+		}
+
+		primary := r.ring[token]
+		o := result[primary]
+		o.VNodes++
+		o.PrimaryPercent += share
+		result[primary] = o
+
+		for _, node := range r.placeReplicas(i, n) {
+			o := result[node]
+			o.ReplicaPercent += share
+			result[node] = o
+		}
+	}
+
+	return result
+}
+
+// a slice of the token space and the nodes holding it. tokens are encoded
+// as strings since they do not fit in a javascript number
+type TokenRange struct {
+	// exclusive, the token of the previous virtual node
+	Start uint64 `json:"start,string"`
+	// inclusive, the token of the owning virtual node
+	End      uint64   `json:"end,string"`
+	Node     string   `json:"node"`
+	Replicas []string `json:"replicas"`
+}
+
+// the token map in ring order, one range per virtual node. the first
+// range wraps around, starting at the last virtual node
+func (r *ConsistentHashRing) Tokens(n int) []TokenRange {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	total := len(r.sortedHashes)
+	ranges := make([]TokenRange, 0, total)
+	for i, token := range r.sortedHashes {
+		ranges = append(ranges, TokenRange{
+			Start:    r.sortedHashes[(i+total-1)%total],
+			End:      token,
+			Node:     r.ring[token],
+			Replicas: r.placeReplicas(i, n),
+		})
+	}
+
+	return ranges
+}
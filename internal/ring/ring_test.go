@@ -1,7 +1,10 @@
 package ring
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
+	"slices"
 	"testing"
 )
 
@@ -112,3 +115,285 @@ func TestRemoveNode(t *testing.T) {
 		t.Errorf("Expected 2 nodes after removal, got %d", len(nodes))
 	}
 }
+
+func TestReplicasSpreadAcrossRacks(t *testing.T) {
+	ring := New(150)
+
+	for i := 1; i <= 6; i++ {
+		node := fmt.Sprintf("node%d:9001", i)
+		ring.AddNode(node)
+		ring.SetTopology(node, Topology{DC: "dc1", Rack: fmt.Sprintf("rack%d", i%3)})
+	}
+
+	for i := 0; i < 1000; i++ {
+		racks := make(map[string]bool)
+		for _, r := range ring.GetReplicas(fmt.Sprintf("key:%d", i), 3) {
+			racks[ring.Topology(r).Rack] = true
+		}
+		if len(racks) != 3 {
+			t.Fatalf("key:%d: replicas in %d racks, expected 3", i, len(racks))
+		}
+	}
+}
+
+func TestDCReplication(t *testing.T) {
+	ring := New(150)
+
+	for i := 1; i <= 4; i++ {
+		for _, dc := range []string{"east", "west"} {
+			node := fmt.Sprintf("%s-node%d:9001", dc, i)
+			ring.AddNode(node)
+			ring.SetTopology(node, Topology{DC: dc, Rack: fmt.Sprintf("rack%d", i%2)})
+		}
+	}
+	ring.SetDCReplication(map[string]int{"east": 3, "west": 2})
+
+	for i := 0; i < 1000; i++ {
+		replicas := ring.GetReplicas(fmt.Sprintf("key:%d", i), 3)
+		perDC := make(map[string]int)
+		for _, r := range replicas {
+			perDC[ring.Topology(r).DC]++
+		}
+		if perDC["east"] != 3 || perDC["west"] != 2 {
+			t.Fatalf("key:%d: unexpected placement %v", i, perDC)
+		}
+	}
+}
+
+func TestUnlabeledPlacementIsRingOrder(t *testing.T) {
+	ring := New(150)
+
+	for i := 1; i <= 5; i++ {
+		ring.AddNode(fmt.Sprintf("node%d:9001", i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		replicas := ring.GetReplicas(key, 3)
+		if replicas[0] != ring.GetNode(key) {
+			t.Fatalf("%s: primary %s, expected %s", key, replicas[0], ring.GetNode(key))
+		}
+		if len(replicas) != 3 {
+			t.Fatalf("%s: expected 3 replicas, got %d", key, len(replicas))
+		}
+	}
+}
+
+func TestMurmur3Verification(t *testing.T) {
+	// smhasher's verification: hash 0, {0}, {0,1}... with seed 256-i,
+	// then hash the concatenated results
+	var key [256]byte
+	hashes := make([]byte, 0, 256*16)
+	for i := 0; i < 256; i++ {
+		key[i] = byte(i)
+		h1, h2 := murmur3(key[:i], uint32(256-i))
+		hashes = binary.LittleEndian.AppendUint64(hashes, h1)
+		hashes = binary.LittleEndian.AppendUint64(hashes, h2)
+	}
+
+	h1, _ := murmur3(hashes, 0)
+	if got := uint32(h1); got != 0x6384BA69 {
+		t.Errorf("murmur3 verification value 0x%08X, expected 0x6384BA69", got)
+	}
+}
+
+func TestPartitionersSpreadKeys(t *testing.T) {
+	for _, name := range []string{"md5", "xxhash", "murmur3"} {
+		p, err := ParsePartitioner(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ring := New(150)
+		ring.SetPartitioner(p)
+		ring.AddNode("http://node1:9000")
+		ring.AddNode("http://node2:9000")
+		ring.AddNode("http://node3:9000")
+
+		counts := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			counts[ring.GetNode(fmt.Sprintf("key-%d", i))]++
+		}
+
+		for node, count := range counts {
+			if count < 2500 || count > 4200 {
+				t.Errorf("%s: %s owns %d of 10000 keys", name, node, count)
+			}
+		}
+	}
+
+	if _, err := ParsePartitioner("sha1"); err != ErrUnknownPartitioner {
+		t.Errorf("expected ErrUnknownPartitioner, got %v", err)
+	}
+}
+
+func TestSetPartitionerReplacesVNodes(t *testing.T) {
+	ring := New(50)
+	ring.AddNode("http://node1:9000")
+	ring.AddNode("http://node2:9000")
+	ring.AddNode("http://node3:9000")
+
+	before := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before[key] = ring.GetNode(key)
+	}
+
+	ring.SetPartitioner(XXHashPartitioner{})
+	ring.SetPartitioner(MD5Partitioner{})
+
+	for key, node := range before {
+		if got := ring.GetNode(key); got != node {
+			t.Errorf("%s moved from %s to %s", key, node, got)
+		}
+	}
+}
+
+func TestOrderedPartitioner(t *testing.T) {
+	p := OrderedPartitioner{}
+	keys := []string{"", "a", "ab", "abc", "b", "user:1", "user:2", "users", "zzzzzzzzz"}
+	for i := 1; i < len(keys); i++ {
+		if p.Token(keys[i-1]) > p.Token(keys[i]) {
+			t.Errorf("token of %q sorts after %q", keys[i-1], keys[i])
+		}
+	}
+
+	ring := New(4)
+	ring.SetPartitioner(p)
+	for i := 1; i <= 6; i++ {
+		ring.AddNode(fmt.Sprintf("http://node%d:9000", i))
+	}
+
+	nodes := ring.PrefixReplicas("user:", 2)
+	if len(nodes) == 0 || len(nodes) == 6 {
+		t.Fatalf("expected a prefix to map to some of the nodes, got %v", nodes)
+	}
+
+	owners := make(map[string]bool)
+	for _, n := range nodes {
+		owners[n] = true
+	}
+	for i := 0; i < 1000; i++ {
+		for _, replica := range ring.GetReplicas(fmt.Sprintf("user:%d", i), 2) {
+			if !owners[replica] {
+				t.Fatalf("user:%d has replica %s outside the prefix nodes %v", i, replica, nodes)
+			}
+		}
+	}
+
+	if all := ring.PrefixReplicas("", 2); len(all) != 6 {
+		t.Errorf("expected every node for an empty prefix, got %d", len(all))
+	}
+}
+
+func TestWeightedOwnership(t *testing.T) {
+	ring := New(150)
+	ring.SetWeight("http://big:9000", 2)
+	ring.AddNode("http://big:9000")
+	ring.AddNode("http://small1:9000")
+	ring.AddNode("http://small2:9000")
+
+	ownership := ring.Ownership(2)
+	if ownership["http://big:9000"].VNodes != 300 || ownership["http://small1:9000"].VNodes != 150 {
+		t.Fatalf("expected vnodes sized by weight, got %+v", ownership)
+	}
+
+	var primary, replica float64
+	for _, o := range ownership {
+		primary += o.PrimaryPercent
+		replica += o.ReplicaPercent
+	}
+	if math.Abs(primary-100) > 0.001 || math.Abs(replica-200) > 0.001 {
+		t.Errorf("expected 100%% primary and 200%% replica ownership, got %.3f and %.3f", primary, replica)
+	}
+
+	if big := ownership["http://big:9000"].PrimaryPercent; big < 42 || big > 58 {
+		t.Errorf("expected the weight 2 node to own about half, got %.1f%%", big)
+	}
+
+	owned := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if ring.GetNode(key) == "http://small1:9000" {
+			owned[key] = true
+		}
+	}
+
+	// growing a node only moves keys to it
+	ring.SetWeight("http://small1:9000", 3)
+	for key := range owned {
+		if node := ring.GetNode(key); node != "http://small1:9000" {
+			t.Errorf("%s moved from the growing node to %s", key, node)
+		}
+	}
+	if v := ring.Ownership(1)["http://small1:9000"].VNodes; v != 450 {
+		t.Errorf("expected 450 vnodes after the weight change, got %d", v)
+	}
+}
+
+func BenchmarkPartitionerToken(b *testing.B) {
+	for _, name := range []string{"md5", "xxhash", "murmur3", "ordered"} {
+		p, _ := ParsePartitioner(name)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p.Token("user:1234567890:profile")
+			}
+		})
+	}
+}
+
+func BenchmarkGetReplicas(b *testing.B) {
+	for _, name := range []string{"md5", "xxhash", "murmur3", "ordered"} {
+		p, _ := ParsePartitioner(name)
+		ring := New(150)
+		ring.SetPartitioner(p)
+		for i := 1; i <= 10; i++ {
+			ring.AddNode(fmt.Sprintf("http://node%d:9000", i))
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ring.GetReplicas("user:1234567890:profile", 3)
+			}
+		})
+	}
+}
+
+func TestTokensCoverRing(t *testing.T) {
+	ring := New(50)
+	ring.AddNode("http://node1:9000")
+	ring.AddNode("http://node2:9000")
+	ring.AddNode("http://node3:9000")
+
+	ranges := ring.Tokens(2)
+	if len(ranges) != 150 {
+		t.Fatalf("expected a range per virtual node, got %d", len(ranges))
+	}
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].Start != ranges[i-1].End {
+			t.Fatalf("range %d does not start where range %d ends", i, i-1)
+		}
+	}
+	if ranges[0].Start != ranges[len(ranges)-1].End {
+		t.Error("expected the first range to wrap around")
+	}
+
+	partitioner := ring.Partitioner()
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		token := partitioner.Token(key)
+
+		// the range holding token is the first one ending at or after it
+		owner := ranges[0]
+		for _, r := range ranges {
+			if token <= r.End {
+				owner = r
+				break
+			}
+		}
+
+		if !slices.Equal(owner.Replicas, ring.GetReplicas(key, 2)) {
+			t.Errorf("%s: token map says %v, ring says %v", key, owner.Replicas, ring.GetReplicas(key, 2))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package ring
+
+import "slices"
+
+// failure domain of a node. nodes without labels share one unnamed rack
+type Topology struct {
+	DC   string `json:"dc,omitempty"`
+	Rack string `json:"rack,omitempty"`
+}
+
+func (r *ConsistentHashRing) SetTopology(nodeURL string, t Topology) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.topology[nodeURL] == t {
+		return
+	}
+
+	r.topology[nodeURL] = t
+	r.rebuildLayout()
+}
+
+func (r *ConsistentHashRing) Topology(nodeURL string) Topology {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.topology[nodeURL]
+}
+
+// labels of every node in the ring
+func (r *ConsistentHashRing) Topologies() map[string]Topology {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]Topology, len(r.nodes))
+	for node := range r.nodes {
+		result[node] = r.topology[node]
+	}
+
+	return result
+}
+
+// switches placement to a replication factor per datacenter, like
+// cassandra's NetworkTopologyStrategy. empty factors go back to placing
+// n replicas across the whole ring
+func (r *ConsistentHashRing) SetDCReplication(factors map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dcReplication = make(map[string]int, len(factors))
+	for dc, n := range factors {
+		if n > 0 {
+			r.dcReplication[dc] = n
+		}
+	}
+}
+
+func (r *ConsistentHashRing) DCReplication() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]int, len(r.dcReplication))
+	for dc, n := range r.dcReplication {
+		result[dc] = n
+	}
+
+	return result
+}
+
+// counts nodes and distinct racks per datacenter; called with the write
+// lock held whenever nodes or labels change
+func (r *ConsistentHashRing) rebuildLayout() {
+	r.dcNodes = make(map[string]int)
+	r.dcRacks = make(map[string]int)
+	racks := make(map[Topology]bool)
+
+	for node := range r.nodes {
+		t := r.topology[node]
+		r.dcNodes[t.DC]++
+		if !racks[t] {
+			racks[t] = true
+			r.dcRacks[t.DC]++
+		}
+	}
+
+	r.racks = len(racks)
+}
+
+// replicas still to be picked in one datacenter, or in the whole ring
+// when there are no per-DC factors
+type placement struct {
+	want      int
+	picked    int
+	rackCount int
+	racks     map[Topology]bool
+	// nodes passed over for sitting in a rack that already has a
+	// replica, used in ring order once every rack is taken
+	skipped []string
+}
+
+func (p *placement) done() bool {
+	return p.picked == p.want ||
+		(len(p.racks) == p.rackCount && p.picked+len(p.skipped) >= p.want)
+}
+
+// walks the ring from idx, preferring nodes in racks without a replica
+// yet. with all nodes in one rack this is the plain ring walk
+func (r *ConsistentHashRing) placeReplicas(idx, n int) []string {
+	placements := make(map[string]*placement)
+	if len(r.dcReplication) > 0 {
+		for dc, factor := range r.dcReplication {
+			placements[dc] = &placement{
+				want:      min(factor, r.dcNodes[dc]),
+				rackCount: r.dcRacks[dc],
+				racks:     make(map[Topology]bool),
+			}
+		}
+	} else {
+		placements[""] = &placement{
+			want:      min(n, len(r.nodes)),
+			rackCount: r.racks,
+			racks:     make(map[Topology]bool),
+		}
+	}
+
+	bucket := func(node string) *placement {
+		if len(r.dcReplication) > 0 {
+			return placements[r.topology[node].DC]
+		}
+		return placements[""]
+	}
+
+	allDone := func() bool {
+		for _, p := range placements {
+			if !p.done() {
+				return false
+			}
+		}
+		return true
+	}
+
+	var replicas []string
+	seen := make(map[string]bool)
+
+	for i := 0; i < len(r.sortedHashes) && !allDone(); i++ {
+		node := r.ring[r.sortedHashes[(idx+i)%len(r.sortedHashes)]]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+
+		p := bucket(node)
+		if p == nil || p.picked == p.want {
+			continue
+		}
+
+		t := r.topology[node]
+		if p.racks[t] {
+			p.skipped = append(p.skipped, node)
+			continue
+		}
+
+		p.racks[t] = true
+		p.picked++
+		replicas = append(replicas, node)
+	}
+
+	dcs := make([]string, 0, len(placements))
+	for dc := range placements {
+		dcs = append(dcs, dc)
+	}
+	slices.Sort(dcs)
+
+	for _, dc := range dcs {
+		p := placements[dc]
+		for _, node := range p.skipped {
+			if p.picked == p.want {
+				break
+			}
+			p.picked++
+			replicas = append(replicas, node)
+		}
+	}
+
+	return replicas
+}
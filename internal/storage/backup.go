@@ -0,0 +1,482 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/v2/z"
+	"google.golang.org/protobuf/proto"
+)
+
+type BackupStats struct {
+	Records    int `json:"records"`
+	Tombstones int `json:"tombstones"`
+	Chunks     int `json:"chunks"`
+	// records left out: those with no version at the backup point still
+	// kept, which the next backup picks up, and those that cannot be
+	// decoded
+	Later        int           `json:"later,omitempty"`
+	Unreadable   int           `json:"unreadable,omitempty"`
+	MaxTimestamp hlc.Timestamp `json:"max_timestamp"`
+}
+
+// counts an entry read back from a backup
+func (s *BackupStats) Add(entry *BackupEntry) {
+	if entry.Chunk {
+		s.Chunks++
+		return
+	}
+
+	s.add(entry.Timestamp, entry.Tombstone)
+}
+
+func (s *BackupStats) add(ts hlc.Timestamp, tombstone bool) {
+	s.Records++
+	if tombstone {
+		s.Tombstones++
+	}
+	if hlc.IsAfter(ts, s.MaxTimestamp) {
+		s.MaxTimestamp = ts
+	}
+}
+
+// writes records and chunks to w in badger's backup format, a sequence
+// of length prefixed KVLists that badger's own Load can read as well.
+// each record is backed up as it was at until, its newest version
+// written at or before it, and only when that version was written after
+// since; a zero since gives a full backup and a zero until takes the
+// latest of everything. badger keeps older versions only until
+// compaction, so a record rewritten after until may have none left; it
+// is counted as Later and comes with the next backup. tombstones are
+// kept so a restore does not resurrect deleted keys, and chunks are kept
+// only for the manifests in the backup, leaving out uploads that are
+// still in flight. a record that cannot be decoded would make the whole
+// backup unreadable, so it is left out and counted as Unreadable
+func (s *BadgerStorage) Backup(w io.Writer, since, until hlc.Timestamp) (BackupStats, error) {
+	var mu sync.Mutex
+	var stats BackupStats
+	var failed error
+	uploads := make(map[string]bool)
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed == nil {
+			failed = err
+		}
+	}
+
+	stream := s.db.NewStream()
+	stream.LogPrefix = "strangedb.Backup"
+	stream.ChooseKey = func(item *badger.Item) bool {
+		k := item.Key()
+		return !item.IsDeletedOrExpired() &&
+			(bytes.HasPrefix(k, []byte(chunkPrefix)) || bytes.HasPrefix(k, []byte(dataPrefix)))
+	}
+	stream.KeyToList = func(k []byte, itr *badger.Iterator) (*pb.KVList, error) {
+		list := &pb.KVList{}
+
+		if bytes.HasPrefix(k, []byte(chunkPrefix)) {
+			mu.Lock()
+			include := s.backedUpChunk(k, since, until, uploads)
+			if include {
+				stats.Chunks++
+			}
+			mu.Unlock()
+
+			if include {
+				kv, err := backupKV(itr.Item())
+				if err != nil {
+					fail(err)
+					return nil, err
+				}
+				list.Kv = append(list.Kv, kv)
+			}
+			return list, nil
+		}
+
+		v, err := versionAt(k, itr, until)
+		if err == nil && v.older && !s.chunksKept(v.item) {
+			// a manifest since replaced, whose chunks went with it
+			err = ErrKeyNotFound
+		}
+		switch {
+		case errors.Is(err, ErrKeyNotFound):
+			mu.Lock()
+			stats.Later++
+			mu.Unlock()
+			return list, nil
+		case err != nil:
+			mu.Lock()
+			stats.Unreadable++
+			mu.Unlock()
+			return list, nil
+		case v.item == nil || !hlc.IsAfter(v.ts, since):
+			return list, nil
+		}
+
+		kv, err := backupKV(v.item)
+		if err != nil {
+			fail(err)
+			return nil, err
+		}
+		list.Kv = append(list.Kv, kv)
+
+		mu.Lock()
+		stats.add(v.ts, v.tombstone)
+		mu.Unlock()
+		return list, nil
+	}
+	stream.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+		return writeKVList(w, list)
+	}
+
+	if err := stream.Orchestrate(context.Background()); err != nil {
+		return stats, err
+	}
+	return stats, failed
+}
+
+// the version of a record a backup picks
+type backupVersion struct {
+	// nil when the key was removed from the store
+	item      *badger.Item
+	ts        hlc.Timestamp
+	tombstone bool
+	// newer versions were passed over
+	older bool
+}
+
+// the newest version of a record written at or before until, starting
+// from the version itr stands on. ErrKeyNotFound when every version
+// still kept is newer
+func versionAt(k []byte, itr *badger.Iterator, until hlc.Timestamp) (backupVersion, error) {
+	cut := until != (hlc.Timestamp{})
+	key := recordKey(k)
+	var v backupVersion
+
+	for ; itr.Valid() && bytes.Equal(itr.Item().Key(), k); itr.Next() {
+		item := itr.Item()
+		if item.IsDeletedOrExpired() {
+			break
+		}
+
+		err := item.Value(func(val []byte) error {
+			var err error
+			v.ts, v.tombstone, err = recordHeader(key, val)
+			return err
+		})
+		if err != nil {
+			return v, err
+		}
+		if cut && hlc.IsAfter(v.ts, until) {
+			v.older = true
+			continue
+		}
+
+		v.item = item
+		return v, nil
+	}
+
+	if v.older {
+		return v, ErrKeyNotFound
+	}
+	return v, nil
+}
+
+// reports whether the chunks of a manifest are still stored. a newer
+// manifest drops those of the one it replaces, so an older version is
+// only worth backing up while they are there
+func (s *BadgerStorage) chunksKept(item *badger.Item) bool {
+	if item == nil {
+		return true
+	}
+
+	var record *Record
+	err := item.Value(func(val []byte) error {
+		var err error
+		record, err = decodeRecord(recordKey(item.Key()), val)
+		return err
+	})
+	if err != nil {
+		return false
+	}
+
+	m, err := ParseManifest(record)
+	if err != nil {
+		return !record.Manifest
+	}
+	if len(m.Chunks) == 0 {
+		return true
+	}
+	_, err = s.GetChunk(record.Key, m.UploadID, 0)
+	return err == nil
+}
+
+// a version as it is stored, in the form badger's Backup writes it
+func backupKV(item *badger.Item) (*pb.KV, error) {
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.KV{
+		Key:       item.KeyCopy(nil),
+		Value:     value,
+		UserMeta:  []byte{item.UserMeta()},
+		Version:   item.Version(),
+		ExpiresAt: item.ExpiresAt(),
+		Meta:      []byte{0},
+	}, nil
+}
+
+// frames a list the way badger's Backup does: its size as a little
+// endian uint64, then the list
+func writeKVList(w io.Writer, list *pb.KVList) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(proto.Size(list))); err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// reports whether a chunk belongs to the manifest its key had at until
+// and that manifest is part of the backup. lookups are cached per
+// upload since a large object has many chunks
+func (s *BadgerStorage) backedUpChunk(k []byte, since, until hlc.Timestamp, uploads map[string]bool) bool {
+	prefix := string(k[:bytes.LastIndexByte(k, 0)+1])
+	if include, ok := uploads[prefix]; ok {
+		return include
+	}
+
+	include := false
+	record, err := s.recordAt(chunkRecordKey(k), until)
+	if err == nil && hlc.IsAfter(record.Timestamp, since) {
+		if m, err := ParseManifest(record); err == nil {
+			include = prefix == string(uploadPrefix(record.Key, m.UploadID))
+		}
+	}
+
+	uploads[prefix] = include
+	return include
+}
+
+// the newest version of key's record written at or before until, as
+// Backup picks it
+func (s *BadgerStorage) recordAt(key string, until hlc.Timestamp) (*Record, error) {
+	var record *Record
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		k := dataKey(key)
+		opts := badger.DefaultIteratorOptions
+		opts.AllVersions = true
+		it := txn.NewKeyIterator(k, opts)
+		defer it.Close()
+
+		it.Rewind()
+		v, err := versionAt(k, it, until)
+		if err != nil {
+			return err
+		}
+		if v.item == nil {
+			return ErrKeyNotFound
+		}
+
+		return v.item.Value(func(val []byte) error {
+			record, err = decodeRecord(key, val)
+			return err
+		})
+	})
+
+	return record, err
+}
+
+// one record or chunk read back from a backup
+type BackupEntry struct {
+	// the record key; chunks carry the key of the record they belong to
+	Key       string
+	Chunk     bool
+	Timestamp hlc.Timestamp // records only
+	Tombstone bool
+
+	badgerKey []byte
+	value     []byte
+}
+
+// size of the entry as stored, for batching
+func (e *BackupEntry) Size() int {
+	return len(e.badgerKey) + len(e.value)
+}
+
+// reads a stream written by Backup, calling fn for the latest version of
+// every record and chunk
+func ReadBackup(r io.Reader, fn func(*BackupEntry) error) error {
+	br := NewBackupReader(r)
+	for {
+		entry, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// pulls entries from a backup stream one at a time, for merging several
+// streams
+type BackupReader struct {
+	r    *bufio.Reader
+	buf  []byte
+	list *pb.KVList
+	next int
+	last []byte
+}
+
+func NewBackupReader(r io.Reader) *BackupReader {
+	return &BackupReader{r: bufio.NewReaderSize(r, 64<<10)}
+}
+
+// returns the latest version of the next record or chunk, or io.EOF at
+// the end of the stream
+func (b *BackupReader) Next() (*BackupEntry, error) {
+	for {
+		for b.list != nil && b.next < len(b.list.Kv) {
+			kv := b.list.Kv[b.next]
+			b.next++
+
+			// older versions follow the latest one
+			if bytes.Equal(kv.Key, b.last) {
+				continue
+			}
+			b.last = kv.Key
+
+			// deletion markers carry no value
+			if len(kv.Value) == 0 {
+				continue
+			}
+
+			entry, err := backupEntry(kv.Key, kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				return entry, nil
+			}
+		}
+
+		if err := b.readList(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (b *BackupReader) readList() error {
+	var size uint64
+	err := binary.Read(b.r, binary.LittleEndian, &size)
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	if uint64(cap(b.buf)) < size {
+		b.buf = make([]byte, size)
+	}
+	if _, err := io.ReadFull(b.r, b.buf[:size]); err != nil {
+		return fmt.Errorf("truncated backup: %w", err)
+	}
+
+	// entries keep pointing into the list, so it is not reused
+	list := &pb.KVList{}
+	if err := proto.Unmarshal(b.buf[:size], list); err != nil {
+		return err
+	}
+
+	b.list, b.next = list, 0
+	return nil
+}
+
+func backupEntry(k, val []byte) (*BackupEntry, error) {
+	switch {
+	case bytes.HasPrefix(k, []byte(chunkPrefix)):
+		return &BackupEntry{
+			Key:       chunkRecordKey(k),
+			Chunk:     true,
+			badgerKey: k,
+			value:     val,
+		}, nil
+	case bytes.HasPrefix(k, []byte(dataPrefix)):
+		key := recordKey(k)
+		ts, tombstone, err := recordHeader(key, val)
+		if err != nil {
+			return nil, err
+		}
+		return &BackupEntry{
+			Key:       key,
+			Timestamp: ts,
+			Tombstone: tombstone,
+			badgerKey: k,
+			value:     val,
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// writes backup entries as they are stored, without re-encoding. when
+// a record already exists the newer version wins, so snapshots of
+// several replicas can be restored into the same node
+func (s *BadgerStorage) Restore(entries []*BackupEntry) error {
+	txn := s.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for _, entry := range entries {
+		if !entry.Chunk {
+			newer, err := storedNewer(txn, entry.Key, entry.Timestamp)
+			if err != nil {
+				return err
+			}
+			if newer {
+				continue
+			}
+		}
+
+		err := txn.Set(entry.badgerKey, entry.value)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+			txn = s.db.NewTransaction(true)
+			err = txn.Set(entry.badgerKey, entry.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
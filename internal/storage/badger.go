@@ -1,11 +1,12 @@
 package storage
 
 import (
-	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/AuraReaper/strangedb/internal/hlc"
 	"github.com/dgraph-io/badger/v4"
+	"github.com/rs/zerolog"
 )
 
 var (
@@ -14,30 +15,70 @@ var (
 )
 
 type BadgerStorage struct {
-	db      *badger.DB
-	dataDir string
+	db            *badger.DB
+	dataDir       string
+	broker        *broker
+	compression   *CompressionPolicy
+	encryptionKey []byte
+	keyRotation   time.Duration
+	usage         *namespaceUsage
+	uploads       *uploadActivity
+	log           zerolog.Logger
+	// stops the usage recount and the orphan sweep
+	stop chan struct{}
 }
 
 func NewBadgerStorage(dataDir string) *BadgerStorage {
 	return &BadgerStorage{
 		dataDir: dataDir,
+		broker:  newBroker(),
+		usage:   newNamespaceUsage(),
+		uploads: newUploadActivity(),
+		log:     zerolog.Nop(),
 	}
 }
 
-func (s *BadgerStorage) Open() error {
-	opts := badger.DefaultOptions(s.dataDir)
-	opts.Logger = nil
+// where the usage recount and the orphan sweep report problems
+func (s *BadgerStorage) SetLogger(log zerolog.Logger) {
+	s.log = log
+}
+
+// sets how values are compressed on write; records already on disk keep
+// their codec and stay readable
+func (s *BadgerStorage) SetCompression(policy *CompressionPolicy) {
+	s.compression = policy
+}
 
-	db, err := badger.Open(opts)
+// encrypts the data directory with key, see LoadEncryptionKey. must be
+// set before Open; an encrypted directory does not open without it
+func (s *BadgerStorage) SetEncryption(key []byte, rotation time.Duration) {
+	s.encryptionKey = key
+	s.keyRotation = rotation
+}
+
+func (s *BadgerStorage) Open() error {
+	db, err := openBadger(s.dataDir, s.encryptionKey, s.keyRotation)
 	if err != nil {
 		return err
 	}
 
 	s.db = db
+	if err := s.countUsage(); err != nil {
+		db.Close()
+		return err
+	}
+
+	s.stop = make(chan struct{})
+	go s.usageLoop(s.stop)
+	go s.orphanLoop(s.stop)
 	return nil
 }
 
 func (s *BadgerStorage) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
@@ -51,8 +92,13 @@ func dataKey(key string) []byte {
 	return []byte(dataPrefix + key)
 }
 
+// strips the data prefix from a badger key
+func recordKey(k []byte) string {
+	return string(k[len(dataPrefix):])
+}
+
 func (s *BadgerStorage) Get(key string) (*Record, error) {
-	var record Record
+	var record *Record
 
 	err := s.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(dataKey(key))
@@ -64,7 +110,12 @@ func (s *BadgerStorage) Get(key string) (*Record, error) {
 		}
 
 		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &record)
+			r, err := decodeRecord(key, val)
+			if err != nil {
+				return err
+			}
+			record = r
+			return nil
 		})
 	})
 	if err != nil {
@@ -75,18 +126,136 @@ func (s *BadgerStorage) Get(key string) (*Record, error) {
 		return nil, ErrKeyDeleted
 	}
 
-	return &record, nil
+	return record, nil
 }
 
 func (s *BadgerStorage) Set(record *Record) error {
-	data, err := json.Marshal(record)
+	data := encodeRecord(record, s.compression.codecFor(record.Key, len(record.Value)))
+
+	return s.write(record, data)
+}
+
+// stores an encoded record, dropping the chunks of a large object it
+// replaces, and notifies watchers
+func (s *BadgerStorage) write(record *Record, data []byte) error {
+	var superseded string
+	var delta int64
+
+	err := s.db.Update(func(txn *badger.Txn) error {
+		k := dataKey(record.Key)
+		superseded = supersededUpload(txn, record)
+		delta = int64(len(k)+len(data)) - storedSize(txn, k)
+		return txn.Set(k, data)
+	})
 	if err != nil {
 		return err
 	}
+	s.usage.add(record.Key, delta)
+
+	if superseded != "" {
+		deleteUpload(s.db, record.Key, superseded)
+	}
+
+	s.broker.publish(record)
+	return nil
+}
+
+// stores many records in as few transactions as badger allows, with the
+// same chunk cleanup and notifications as Set
+func (s *BadgerStorage) SetBatch(records []*Record) error {
+	_, err := s.setBatch(records, false)
+	return err
+}
+
+// like SetBatch, but a record is only written when it is newer than the
+// stored version of its key, so replaying writes never undoes a later
+// one. returns how many records were written
+func (s *BadgerStorage) MergeBatch(records []*Record) (int, error) {
+	return s.setBatch(records, true)
+}
+
+func (s *BadgerStorage) setBatch(records []*Record, merge bool) (int, error) {
+	type superseded struct{ key, uploadID string }
+	var dropped []superseded
+	var written []*Record
+	deltas := make(map[string]int64)
+
+	txn := s.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for _, record := range records {
+		if merge {
+			newer, err := storedNewer(txn, record.Key, record.Timestamp)
+			if err != nil {
+				return 0, err
+			}
+			if newer {
+				continue
+			}
+		}
+
+		data := encodeRecord(record, s.compression.codecFor(record.Key, len(record.Value)))
+		id := supersededUpload(txn, record)
+		k := dataKey(record.Key)
+		delta := int64(len(k)+len(data)) - storedSize(txn, k)
+
+		err := txn.Set(k, data)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			if err := txn.Commit(); err != nil {
+				return 0, err
+			}
+			txn = s.db.NewTransaction(true)
+			err = txn.Set(dataKey(record.Key), data)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if id != "" {
+			dropped = append(dropped, superseded{record.Key, id})
+		}
+		written = append(written, record)
+		deltas[record.Key] += delta
+	}
+
+	if err := txn.Commit(); err != nil {
+		return 0, err
+	}
+
+	for key, delta := range deltas {
+		s.usage.add(key, delta)
+	}
+
+	for _, d := range dropped {
+		deleteUpload(s.db, d.key, d.uploadID)
+	}
+	for _, record := range written {
+		s.broker.publish(record)
+	}
+
+	return len(written), nil
+}
+
+// reports whether the stored version of key is at least as new as ts
+func storedNewer(txn *badger.Txn, key string, ts hlc.Timestamp) (bool, error) {
+	item, err := txn.Get(dataKey(key))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-	return s.db.Update(func(txn *badger.Txn) error {
-		return txn.Set(dataKey(record.Key), data)
+	var existing hlc.Timestamp
+	err = item.Value(func(val []byte) error {
+		existing, _, err = recordHeader(key, val)
+		return err
 	})
+	if err != nil {
+		return false, err
+	}
+
+	return !hlc.IsAfter(ts, existing), nil
 }
 
 func (s *BadgerStorage) Delete(key string, timestamp hlc.Timestamp) error {
@@ -97,14 +266,9 @@ func (s *BadgerStorage) Delete(key string, timestamp hlc.Timestamp) error {
 		Tombstone: true,
 	}
 
-	data, err := json.Marshal(record)
-	if err != nil {
-		return err
-	}
+	data := encodeRecord(record, CodecNone)
 
-	return s.db.Update(func(txn *badger.Txn) error {
-		return txn.Set(dataKey(key), data)
-	})
+	return s.write(record, data)
 }
 
 func (s *BadgerStorage) Exists(key string) (bool, error) {
@@ -120,9 +284,10 @@ func (s *BadgerStorage) Exists(key string) (bool, error) {
 			return err
 		}
 
-		var record Record
+		var record *Record
 		err = item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &record)
+			record, err = decodeRecord(key, val)
+			return err
 		})
 		if err != nil {
 			return err
@@ -136,7 +301,7 @@ func (s *BadgerStorage) Exists(key string) (bool, error) {
 }
 
 func (s *BadgerStorage) GetRaw(key string) (*Record, error) {
-	var record Record
+	var record *Record
 
 	err := s.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(dataKey(key))
@@ -148,7 +313,12 @@ func (s *BadgerStorage) GetRaw(key string) (*Record, error) {
 		}
 
 		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &record)
+			r, err := decodeRecord(key, val)
+			if err != nil {
+				return err
+			}
+			record = r
+			return nil
 		})
 	})
 
@@ -156,7 +326,7 @@ func (s *BadgerStorage) GetRaw(key string) (*Record, error) {
 		return nil, err
 	}
 
-	return &record, err
+	return record, err
 }
 
 func (s *BadgerStorage) DB() *badger.DB {
@@ -176,15 +346,17 @@ func (s *BadgerStorage) List(prefix string, limit int) ([]*Record, error) {
 		seekPrefix := []byte(dataPrefix + prefix)
 		count := 0
 
-		for it.Seek(seekPrefix); it.ValidForPrefix([]byte(dataPrefix)); it.Next() {
+		for it.Seek(seekPrefix); it.ValidForPrefix(seekPrefix); it.Next() {
 			if limit > 0 && count >= limit {
 				break
 			}
 
 			item := it.Item()
-			var record Record
+			var record *Record
 			err := item.Value(func(val []byte) error {
-				return json.Unmarshal(val, &record)
+				var err error
+				record, err = decodeRecord(recordKey(item.Key()), val)
+				return err
 			})
 			if err != nil {
 				continue
@@ -195,7 +367,7 @@ func (s *BadgerStorage) List(prefix string, limit int) ([]*Record, error) {
 				continue
 			}
 
-			records = append(records, &record)
+			records = append(records, record)
 			count++
 		}
 		return nil
@@ -203,3 +375,63 @@ func (s *BadgerStorage) List(prefix string, limit int) ([]*Record, error) {
 
 	return records, err
 }
+
+// returns up to limit records under prefix with keys after the given
+// one and written after since, in key order and tombstones included, for
+// paging through the writes a watch missed
+func (s *BadgerStorage) ListSince(prefix, after string, since hlc.Timestamp, limit int) ([]*Record, error) {
+	return s.scan(prefix, after, limit, func(record *Record) bool {
+		return hlc.IsAfter(record.Timestamp, since)
+	})
+}
+
+// returns up to limit records under prefix with keys after the given
+// one, in key order and tombstones included, for paging through a node
+func (s *BadgerStorage) Scan(prefix, after string, limit int) ([]*Record, error) {
+	return s.scan(prefix, after, limit, nil)
+}
+
+// the records Scan and ListSince page through, those keep rejects left
+// out
+func (s *BadgerStorage) scan(prefix, after string, limit int, keep func(*Record) bool) ([]*Record, error) {
+	var records []*Record
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 100
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		seekPrefix := []byte(dataPrefix + prefix)
+		it.Seek(seekPrefix)
+		// a cursor before the prefix would seek outside it
+		if after > prefix {
+			it.Seek(dataKey(after))
+			if it.ValidForPrefix(seekPrefix) && recordKey(it.Item().Key()) == after {
+				it.Next()
+			}
+		}
+
+		for ; it.ValidForPrefix(seekPrefix); it.Next() {
+			if limit > 0 && len(records) >= limit {
+				break
+			}
+
+			item := it.Item()
+			var record *Record
+			err := item.Value(func(val []byte) error {
+				var err error
+				record, err = decodeRecord(recordKey(item.Key()), val)
+				return err
+			})
+			if err != nil || (keep != nil && !keep(record)) {
+				continue
+			}
+
+			records = append(records, record)
+		}
+		return nil
+	})
+
+	return records, err
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/dgraph-io/badger/v4"
+)
+
+var ErrNotManifest = errors.New("record is not a manifest")
+
+// chunks of large values live under their own prefix so scans over the
+// data prefix never see them
+const chunkPrefix = "c:"
+
+// uploads that no manifest names are dropped once they had no chunk
+// written for orphanChunkIdle: aborted uploads whose chunks could not be
+// deleted, and those of a coordinator that died mid-upload
+const (
+	orphanSweepInterval = 10 * time.Minute
+	orphanChunkIdle     = time.Hour
+)
+
+// the value of a manifest record: a large object split into chunks that
+// are stored under the key and upload id
+type Manifest struct {
+	UploadID  string   `json:"upload_id"`
+	Size      int64    `json:"size"`
+	ChunkSize int      `json:"chunk_size"`
+	Chunks    []string `json:"chunks"` // hex sha256 of each chunk
+}
+
+func ParseManifest(record *Record) (*Manifest, error) {
+	if !record.Manifest {
+		return nil, ErrNotManifest
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(record.Value, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %q: %w", record.Key, err)
+	}
+
+	return &m, nil
+}
+
+func uploadPrefix(key, uploadID string) []byte {
+	return []byte(chunkPrefix + key + "\x00" + uploadID + "\x00")
+}
+
+func chunkKey(key, uploadID string, index int) []byte {
+	return fmt.Appendf(uploadPrefix(key, uploadID), "%08d", index)
+}
+
+// recovers the record key from a chunk's badger key
+func chunkRecordKey(k []byte) string {
+	k = k[len(chunkPrefix):]
+	for range 2 {
+		if i := bytes.LastIndexByte(k, 0); i >= 0 {
+			k = k[:i]
+		}
+	}
+
+	return string(k)
+}
+
+func (s *BadgerStorage) SetChunk(key, uploadID string, index int, data []byte) error {
+	codec, value := compressValue(s.compression.codecFor(key, len(data)), data)
+
+	entry := make([]byte, 0, len(value)+1)
+	entry = append(entry, byte(codec))
+	entry = append(entry, value...)
+
+	s.uploads.touch(key, uploadID)
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(chunkKey(key, uploadID, index), entry)
+	})
+}
+
+func (s *BadgerStorage) GetChunk(key, uploadID string, index int) ([]byte, error) {
+	var data []byte
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(chunkKey(key, uploadID, index))
+		if err == badger.ErrKeyNotFound {
+			return ErrKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			if len(val) == 0 {
+				return ErrUnknownFormat
+			}
+			data, err = decompressValue(Codec(val[0]), val[1:])
+			return err
+		})
+	})
+
+	return data, err
+}
+
+func (s *BadgerStorage) DeleteChunks(key, uploadID string) error {
+	return deleteUpload(s.db, key, uploadID)
+}
+
+func deleteUpload(db *badger.DB, key, uploadID string) error {
+	prefix := uploadPrefix(key, uploadID)
+
+	var keys [][]byte
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, k := range keys {
+		if err := wb.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return wb.Flush()
+}
+
+// returns the upload id of the manifest a newer write is about to
+// replace, if any. chunks of an in-flight upload are never touched
+// because only a committed manifest names its upload, and neither are
+// those of a manifest written again for the same upload, as EXPIRE does
+func supersededUpload(txn *badger.Txn, record *Record) string {
+	item, err := txn.Get(dataKey(record.Key))
+	if err != nil {
+		return ""
+	}
+
+	var uploadID string
+	item.Value(func(val []byte) error {
+		existing, err := decodeRecord(record.Key, val)
+		if err != nil || !existing.Manifest || !hlc.IsAfter(record.Timestamp, existing.Timestamp) {
+			return nil
+		}
+
+		if m, err := ParseManifest(existing); err == nil {
+			uploadID = m.UploadID
+		}
+		return nil
+	})
+
+	if uploadID != "" && record.Manifest {
+		if m, err := ParseManifest(record); err == nil && m.UploadID == uploadID {
+			return ""
+		}
+	}
+
+	return uploadID
+}
+
+// deletes chunks that the current manifest of their key does not point
+// at. only safe while no uploads are in flight, since their chunks have
+// no manifest yet; restores run it once all entries are loaded
+func (s *BadgerStorage) DropOrphanChunks() (int, error) {
+	return s.dropOrphans(0)
+}
+
+// drops orphaned uploads that had no chunk written for idle, as seen by
+// this process; uploads left from before a restart get idle from when
+// the sweep first finds them. 0 drops every orphan
+func (s *BadgerStorage) dropOrphans(idle time.Duration) (int, error) {
+	type upload struct{ key, id string }
+	var orphans []upload
+	seen := make(map[string]bool)
+	now := time.Now()
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(chunkPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		var last []byte
+		for it.Rewind(); it.Valid(); it.Next() {
+			k := it.Item().Key()
+			prefix := k[:bytes.LastIndexByte(k, 0)+1]
+			if bytes.Equal(prefix, last) {
+				continue
+			}
+			last = append(last[:0], prefix...)
+
+			key := chunkRecordKey(k)
+			id := string(prefix[len(chunkPrefix)+len(key)+1 : len(prefix)-1])
+			if currentUpload(txn, key) == id {
+				continue
+			}
+			if idle > 0 {
+				seen[string(prefix)] = true
+				if now.Sub(s.uploads.lastWrite(string(prefix), now)) < idle {
+					continue
+				}
+			}
+			orphans = append(orphans, upload{key, id})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, o := range orphans {
+		if err := deleteUpload(s.db, o.key, o.id); err != nil {
+			return 0, err
+		}
+	}
+	if idle > 0 {
+		s.uploads.prune(seen, now.Add(-idle))
+	}
+
+	return len(orphans), nil
+}
+
+// when each upload last had a chunk written, so the sweep leaves those in
+// flight alone; keyed by upload prefix
+type uploadActivity struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func newUploadActivity() *uploadActivity {
+	return &uploadActivity{times: make(map[string]time.Time)}
+}
+
+func (u *uploadActivity) touch(key, uploadID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.times[string(uploadPrefix(key, uploadID))] = time.Now()
+}
+
+// the last write to an upload, or now when none was seen
+func (u *uploadActivity) lastWrite(prefix string, now time.Time) time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	t, ok := u.times[prefix]
+	if !ok {
+		u.times[prefix] = now
+		return now
+	}
+	return t
+}
+
+// forgets uploads the sweep no longer finds orphaned and that had no
+// write since before
+func (u *uploadActivity) prune(orphans map[string]bool, before time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for prefix, t := range u.times {
+		if !orphans[prefix] && t.Before(before) {
+			delete(u.times, prefix)
+		}
+	}
+}
+
+// the upload id named by the manifest stored under key, if any
+func currentUpload(txn *badger.Txn, key string) string {
+	item, err := txn.Get(dataKey(key))
+	if err != nil {
+		return ""
+	}
+
+	var uploadID string
+	item.Value(func(val []byte) error {
+		record, err := decodeRecord(key, val)
+		if err != nil {
+			return nil
+		}
+		if m, err := ParseManifest(record); err == nil {
+			uploadID = m.UploadID
+		}
+		return nil
+	})
+
+	return uploadID
+}
+
+func (s *BadgerStorage) orphanLoop(stopCh chan struct{}) {
+	ticker := time.NewTicker(orphanSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dropped, err := s.dropOrphans(orphanChunkIdle)
+			if err != nil {
+				s.log.Error().Err(err).Msg("failed to drop orphaned chunks")
+			} else if dropped > 0 {
+				s.log.Info().Int("uploads", dropped).Msg("dropped orphaned chunks")
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
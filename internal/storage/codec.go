@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+)
+
+var ErrUnknownFormat = errors.New("unknown record format")
+
+// on-disk record layout, format version 1:
+//
+//	[0]      format version
+//	[1]      flags: bit 0 tombstone, bits 1-2 value codec, bit 3 manifest,
+//	         bit 4 origin, bit 5 expiry
+//	[2:10]   hlc wall time, big endian
+//	[10:14]  hlc logical counter, big endian
+//	uvarint length + hlc node id
+//	uvarint length + content type
+//	uvarint length + origin cluster, only with the origin flag
+//	[8]      expiry wall time, big endian, only with the expiry flag
+//	value, the rest of the entry, compressed with the flagged codec
+//
+// the key is not repeated, it is recovered from the badger key. records
+// written before the binary format are JSON objects and always start
+// with '{', which never collides with a format version byte.
+const (
+	formatJSON byte = '{'
+	formatV1   byte = 1
+)
+
+const (
+	flagTombstone  byte = 1 << 0
+	flagCodecShift      = 1
+	flagCodecMask  byte = 0b11 << flagCodecShift
+	flagManifest   byte = 1 << 3
+	flagOrigin     byte = 1 << 4
+	flagExpiry     byte = 1 << 5
+)
+
+const recordHeaderSize = 14
+
+func encodeRecord(record *Record, codec Codec) []byte {
+	codec, value := compressValue(codec, record.Value)
+
+	size := recordHeaderSize +
+		binary.MaxVarintLen64 + len(record.Timestamp.NodeID) +
+		binary.MaxVarintLen64 + len(record.ContentType) +
+		binary.MaxVarintLen64 + len(record.Origin) +
+		8 + len(value)
+
+	buf := make([]byte, recordHeaderSize, size)
+	buf[0] = formatV1
+
+	var flags byte
+	if record.Tombstone {
+		flags |= flagTombstone
+	}
+	if record.Manifest {
+		flags |= flagManifest
+	}
+	if record.Origin != "" {
+		flags |= flagOrigin
+	}
+	if record.ExpiresAt != 0 {
+		flags |= flagExpiry
+	}
+	flags |= byte(codec) << flagCodecShift
+	buf[1] = flags
+
+	binary.BigEndian.PutUint64(buf[2:10], uint64(record.Timestamp.WallTime))
+	binary.BigEndian.PutUint32(buf[10:14], record.Timestamp.Logical)
+
+	buf = binary.AppendUvarint(buf, uint64(len(record.Timestamp.NodeID)))
+	buf = append(buf, record.Timestamp.NodeID...)
+	buf = binary.AppendUvarint(buf, uint64(len(record.ContentType)))
+	buf = append(buf, record.ContentType...)
+	if record.Origin != "" {
+		buf = binary.AppendUvarint(buf, uint64(len(record.Origin)))
+		buf = append(buf, record.Origin...)
+	}
+	if record.ExpiresAt != 0 {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(record.ExpiresAt))
+	}
+
+	return append(buf, value...)
+}
+
+// decodes either format; val is copied so it may come straight from a
+// badger item callback. expired records come back as tombstones
+func decodeRecord(key string, val []byte) (*Record, error) {
+	if len(val) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	var record *Record
+	switch val[0] {
+	case formatJSON:
+		record = &Record{}
+		if err := json.Unmarshal(val, record); err != nil {
+			return nil, err
+		}
+	case formatV1:
+		var err error
+		record, err = decodeV1(key, val)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: version %d", ErrUnknownFormat, val[0])
+	}
+
+	record.expire(time.Now().UnixNano())
+	return record, nil
+}
+
+func decodeV1(key string, val []byte) (*Record, error) {
+	if len(val) < recordHeaderSize {
+		return nil, fmt.Errorf("record %q: truncated header", key)
+	}
+
+	flags := val[1]
+	record := &Record{
+		Key: key,
+		Timestamp: hlc.Timestamp{
+			WallTime: int64(binary.BigEndian.Uint64(val[2:10])),
+			Logical:  binary.BigEndian.Uint32(val[10:14]),
+		},
+		Tombstone: flags&flagTombstone != 0,
+		Manifest:  flags&flagManifest != 0,
+	}
+
+	rest := val[recordHeaderSize:]
+
+	nodeID, rest, err := readString(rest)
+	if err != nil {
+		return nil, fmt.Errorf("record %q: node id: %w", key, err)
+	}
+	record.Timestamp.NodeID = nodeID
+
+	contentType, rest, err := readString(rest)
+	if err != nil {
+		return nil, fmt.Errorf("record %q: content type: %w", key, err)
+	}
+	record.ContentType = contentType
+
+	if flags&flagOrigin != 0 {
+		record.Origin, rest, err = readString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("record %q: origin: %w", key, err)
+		}
+	}
+
+	if flags&flagExpiry != 0 {
+		if len(rest) < 8 {
+			return nil, fmt.Errorf("record %q: expiry: truncated field", key)
+		}
+		record.ExpiresAt = int64(binary.BigEndian.Uint64(rest))
+		rest = rest[8:]
+	}
+
+	if !record.Tombstone {
+		codec := Codec((flags & flagCodecMask) >> flagCodecShift)
+		value, err := decompressValue(codec, rest)
+		if err != nil {
+			return nil, fmt.Errorf("record %q: %w", key, err)
+		}
+		record.Value = value
+	}
+
+	return record, nil
+}
+
+// reads the timestamp and tombstone flag without touching the value,
+// for ordering a stored record against another version of it
+func recordHeader(key string, val []byte) (hlc.Timestamp, bool, error) {
+	if len(val) > 0 && val[0] == formatV1 {
+		if len(val) < recordHeaderSize {
+			return hlc.Timestamp{}, false, fmt.Errorf("record %q: truncated header", key)
+		}
+
+		nodeID, _, err := readString(val[recordHeaderSize:])
+		if err != nil {
+			return hlc.Timestamp{}, false, fmt.Errorf("record %q: node id: %w", key, err)
+		}
+
+		return hlc.Timestamp{
+			WallTime: int64(binary.BigEndian.Uint64(val[2:10])),
+			Logical:  binary.BigEndian.Uint32(val[10:14]),
+			NodeID:   nodeID,
+		}, val[1]&flagTombstone != 0, nil
+	}
+
+	record, err := decodeRecord(key, val)
+	if err != nil {
+		return hlc.Timestamp{}, false, err
+	}
+
+	return record.Timestamp, record.Tombstone, nil
+}
+
+func readString(buf []byte) (string, []byte, error) {
+	n, size := binary.Uvarint(buf)
+	if size <= 0 || uint64(len(buf)-size) < n {
+		return "", nil, errors.New("truncated field")
+	}
+
+	buf = buf[size:]
+	return string(buf[:n]), buf[n:], nil
+}
+
+func isLegacyRecord(val []byte) bool {
+	return len(val) > 0 && val[0] == formatJSON
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AuraReaper/strangedb/internal/telemetry"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+type Codec byte
+
+const (
+	CodecNone Codec = iota
+	CodecSnappy
+	CodecZstd
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecSnappy:
+		return "snappy"
+	case CodecZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("codec(%d)", byte(c))
+	}
+}
+
+func ParseCodec(name string) (Codec, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return CodecNone, nil
+	case "snappy":
+		return CodecSnappy, nil
+	case "zstd":
+		return CodecZstd, nil
+	default:
+		return CodecNone, fmt.Errorf("unknown compression codec %q", name)
+	}
+}
+
+// values smaller than this rarely shrink enough to pay for the header
+const DefaultCompressionMinSize = 512
+
+// picks a codec per namespace, falling back to Default
+type CompressionPolicy struct {
+	Default    Codec
+	Namespaces map[string]Codec
+	MinSize    int
+}
+
+// builds a policy from codec names, as given in the node config
+func NewCompressionPolicy(defaultCodec string, namespaces map[string]string) (*CompressionPolicy, error) {
+	codec, err := ParseCodec(defaultCodec)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &CompressionPolicy{
+		Default:    codec,
+		Namespaces: make(map[string]Codec),
+		MinSize:    DefaultCompressionMinSize,
+	}
+
+	for namespace, name := range namespaces {
+		codec, err := ParseCodec(name)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+		policy.Namespaces[namespace] = codec
+	}
+
+	return policy, nil
+}
+
+func (p *CompressionPolicy) codecFor(key string, size int) Codec {
+	if p == nil || size < p.MinSize {
+		return CodecNone
+	}
+
+	if codec, ok := p.Namespaces[Namespace(key)]; ok {
+		return codec
+	}
+
+	return p.Default
+}
+
+// the part of a key before the first ':', or "" when there is none
+func Namespace(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+
+	return ""
+}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compresses value, returning it unchanged with CodecNone when the codec
+// does not make it smaller
+func compressValue(codec Codec, value []byte) (Codec, []byte) {
+	var out []byte
+
+	switch codec {
+	case CodecSnappy:
+		out = s2.EncodeSnappy(nil, value)
+	case CodecZstd:
+		out = zstdEncoder.EncodeAll(value, nil)
+	default:
+		return CodecNone, value
+	}
+
+	telemetry.RecordCompression(codec.String(), len(value), len(out))
+
+	if len(out) >= len(value) {
+		return CodecNone, value
+	}
+
+	return codec, out
+}
+
+func decompressValue(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case CodecNone:
+		return append([]byte{}, data...), nil
+	case CodecSnappy:
+		return s2.Decode(nil, data)
+	case CodecZstd:
+		return zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("%w: codec %d", ErrUnknownFormat, byte(codec))
+	}
+}
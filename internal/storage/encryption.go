@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	ErrEncrypted          = errors.New("data directory is encrypted, an encryption key is required")
+	ErrNotEncrypted       = errors.New("data directory is not encrypted, encrypt it with rotate-key first")
+	ErrWrongEncryptionKey = errors.New("encryption key does not match the data directory")
+)
+
+// reads an AES key from path, or from value when path is empty. keys
+// are hex or base64 encoded, of 16, 24 or 32 bytes for AES-128, 192 or
+// 256. returns nil when neither is set
+func LoadEncryptionKey(path, value string) ([]byte, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseEncryptionKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	if value == "" {
+		return nil, nil
+	}
+	return parseEncryptionKey(value)
+}
+
+func parseEncryptionKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, errors.New("encryption key must be hex or base64 encoded")
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+}
+
+// a badger key of 16, 24 or 32 bytes encrypts the directory. new data
+// keys are generated every rotation, 0 for badger's default of 10 days
+func openBadger(dataDir string, key []byte, rotation time.Duration) (*badger.DB, error) {
+	opts := badger.DefaultOptions(dataDir)
+	opts.Logger = nil
+
+	if len(key) > 0 {
+		opts.EncryptionKey = key
+		if rotation > 0 {
+			opts.EncryptionKeyRotationDuration = rotation
+		}
+		// decrypted table indexes are cached here instead of all being
+		// kept in memory
+		opts.IndexCacheSize = 100 << 20
+	}
+
+	db, err := badger.Open(opts)
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return nil, encryptionError(dataDir, key)
+	}
+	return db, err
+}
+
+// badger only tells that the key does not match; find out whether the
+// directory is encrypted at all to say what is wrong
+func encryptionError(dataDir string, key []byte) error {
+	_, err := badger.OpenKeyRegistry(badger.KeyRegistryOptions{
+		Dir:      dataDir,
+		ReadOnly: true,
+	})
+	switch {
+	case err == nil:
+		return ErrNotEncrypted
+	case !errors.Is(err, badger.ErrEncryptionKeyMismatch):
+		return err
+	case len(key) == 0:
+		return ErrEncrypted
+	default:
+		return ErrWrongEncryptionKey
+	}
+}
+
+// re-encrypts the data keys of a stopped node's directory with newKey.
+// the data itself stays as it is, encrypted with the data keys. an empty
+// oldKey encrypts a plaintext directory: existing tables stay readable
+// and are encrypted as compaction rewrites them
+func RotateEncryptionKey(dataDir string, oldKey, newKey []byte) error {
+	if len(newKey) == 0 {
+		return errors.New("a new encryption key is required")
+	}
+	if _, err := os.Stat(dataDir); err != nil {
+		return err
+	}
+
+	// checks the old key, and fails while a node holds the directory
+	db, err := openBadger(dataDir, oldKey, 0)
+	if err != nil {
+		return err
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	opts := badger.KeyRegistryOptions{
+		Dir:           dataDir,
+		ReadOnly:      true,
+		EncryptionKey: oldKey,
+	}
+	registry, err := badger.OpenKeyRegistry(opts)
+	if err != nil {
+		return err
+	}
+
+	opts.EncryptionKey = newKey
+	return badger.WriteKeyRegistry(registry, opts)
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/v2/z"
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrStoreNotEmpty = errors.New("store is not empty")
+
+// badger version given to every ingested key; the store starts empty, so
+// any version works as long as it is the same for all of them
+const ingestVersion = 1
+
+// encodes a record the way Set would store it, for building stream files
+// outside of a running node
+func NewBackupEntry(record *Record, compression *CompressionPolicy) *BackupEntry {
+	return &BackupEntry{
+		Key:       record.Key,
+		Timestamp: record.Timestamp,
+		Tombstone: record.Tombstone,
+		badgerKey: dataKey(record.Key),
+		value:     encodeRecord(record, compression.codecFor(record.Key, len(record.Value))),
+	}
+}
+
+// hash of the entry as stored, the leaf hash for merkle comparisons
+func (e *BackupEntry) Hash() string {
+	h := sha256.Sum256(e.value)
+	return hex.EncodeToString(h[:])
+}
+
+// appends entries to w as one KVList in the format Backup writes and
+// ReadBackup reads
+func WriteBackup(w io.Writer, entries []*BackupEntry) error {
+	list := &pb.KVList{Kv: make([]*pb.KV, len(entries))}
+	for i, e := range entries {
+		list.Kv[i] = &pb.KV{Key: e.badgerKey, Value: e.value, Version: ingestVersion}
+	}
+
+	data, err := proto.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// loads a stream file straight into the LSM tree with badger's
+// StreamWriter, skipping transactions and the write-ahead value log
+// entirely. the store must be empty and the stream sorted by key with
+// every key once, as the loader writes it
+func (s *BadgerStorage) Ingest(r io.Reader) (int, error) {
+	if empty, err := s.isEmpty(); err != nil {
+		return 0, err
+	} else if !empty {
+		return 0, ErrStoreNotEmpty
+	}
+
+	sw := s.db.NewStreamWriter()
+	if err := sw.Prepare(); err != nil {
+		return 0, err
+	}
+
+	buf := z.NewBuffer(32<<20, "strangedb.Ingest")
+	defer buf.Release()
+
+	var count int
+	var last []byte
+
+	flush := func() error {
+		if buf.LenNoPadding() == 0 {
+			return nil
+		}
+		if err := sw.Write(buf); err != nil {
+			return err
+		}
+		buf.Reset()
+		return nil
+	}
+
+	err := ReadBackup(r, func(e *BackupEntry) error {
+		// StreamWriter silently corrupts the tree on unsorted input
+		if last != nil && string(e.badgerKey) <= string(last) {
+			return fmt.Errorf("stream not sorted at key %q", e.Key)
+		}
+		last = append(last[:0], e.badgerKey...)
+
+		badger.KVToBuffer(&pb.KV{Key: e.badgerKey, Value: e.value, Version: ingestVersion}, buf)
+		count++
+
+		if buf.LenNoPadding() >= 16<<20 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		sw.Cancel()
+		return count, err
+	}
+
+	return count, sw.Flush()
+}
+
+// hashes every record as stored, keyed by record key, for comparing a
+// store with the stream file it was loaded from
+func (s *BadgerStorage) RecordHashes() (map[string]string, error) {
+	hashes := make(map[string]string)
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(dataPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			err := item.Value(func(val []byte) error {
+				h := sha256.Sum256(val)
+				hashes[recordKey(item.Key())] = hex.EncodeToString(h[:])
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return hashes, err
+}
+
+func (s *BadgerStorage) isEmpty() (bool, error) {
+	empty := true
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+
+	return empty, err
+}
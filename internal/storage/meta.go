@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"github.com/dgraph-io/badger/v4"
+)
+
+// node settings that must not change once data is written, kept outside
+// the key space
+const metaPrefix = "m:"
+
+// the partitioner the data directory was written with
+const MetaPartitioner = "partitioner"
+
+// returns "" for a setting that was never stored
+func (s *BadgerStorage) Meta(name string) (string, error) {
+	var value string
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(metaPrefix + name))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		val, err := item.ValueCopy(nil)
+		value = string(val)
+		return err
+	})
+
+	return value, err
+}
+
+func (s *BadgerStorage) SetMeta(name, value string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(metaPrefix+name), []byte(value))
+	})
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"github.com/dgraph-io/badger/v4"
+)
+
+const migrateBatchSize = 1000
+
+type MigrationStats struct {
+	Scanned  int `json:"scanned"`
+	Migrated int `json:"migrated"`
+}
+
+// rewrites legacy JSON records in the binary format. it is safe to run
+// while the node serves traffic: each batch re-checks its keys inside
+// the write transaction, so records overwritten concurrently are left
+// alone and conflicting batches are retried
+func (s *BadgerStorage) MigrateRecords() (MigrationStats, error) {
+	var stats MigrationStats
+	var after []byte
+
+	for {
+		keys, last, scanned, err := s.legacyKeys(after, migrateBatchSize)
+		if err != nil {
+			return stats, err
+		}
+		stats.Scanned += scanned
+
+		if len(keys) > 0 {
+			migrated, err := s.migrateBatch(keys)
+			if err != nil {
+				return stats, err
+			}
+			stats.Migrated += migrated
+		}
+
+		if scanned < migrateBatchSize {
+			return stats, nil
+		}
+		after = last
+	}
+}
+
+// scans up to limit records after the given badger key and returns the
+// ones still stored as JSON along with the last key visited
+func (s *BadgerStorage) legacyKeys(after []byte, limit int) ([][]byte, []byte, int, error) {
+	var keys [][]byte
+	var last []byte
+	scanned := 0
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 100
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(dataPrefix)
+		it.Seek(prefix)
+		if after != nil {
+			it.Seek(after)
+			if it.ValidForPrefix(prefix) && string(it.Item().Key()) == string(after) {
+				it.Next()
+			}
+		}
+
+		for ; it.ValidForPrefix(prefix) && scanned < limit; it.Next() {
+			item := it.Item()
+			scanned++
+			last = item.KeyCopy(nil)
+
+			err := item.Value(func(val []byte) error {
+				if isLegacyRecord(val) {
+					keys = append(keys, item.KeyCopy(nil))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return keys, last, scanned, err
+}
+
+func (s *BadgerStorage) migrateBatch(keys [][]byte) (int, error) {
+	for {
+		migrated := 0
+
+		err := s.db.Update(func(txn *badger.Txn) error {
+			for _, k := range keys {
+				item, err := txn.Get(k)
+				if err == badger.ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if !isLegacyRecord(val) {
+					continue
+				}
+
+				record, err := decodeRecord(recordKey(k), val)
+				if err != nil {
+					// leave unreadable entries for an operator to inspect
+					continue
+				}
+
+				codec := s.compression.codecFor(record.Key, len(record.Value))
+				if err := txn.Set(k, encodeRecord(record, codec)); err != nil {
+					return err
+				}
+				migrated++
+			}
+			return nil
+		})
+
+		if err == badger.ErrConflict {
+			continue
+		}
+
+		return migrated, err
+	}
+}
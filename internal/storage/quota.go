@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+// how often usage is counted again from scratch. writes keep it up to
+// date in between, the recount catches what they do not see: chunks,
+// dropped tombstones and expired uploads
+const usageRecountInterval = 5 * time.Minute
+
+// bytes each namespace takes on disk, keys and encoded values of its
+// records and chunks
+type namespaceUsage struct {
+	mu     sync.Mutex
+	bytes  map[string]int64
+	quotas map[string]int64
+	// deltas of writes made while a recount runs, added to what it
+	// counts; nil between recounts
+	recounting map[string]int64
+}
+
+func newNamespaceUsage() *namespaceUsage {
+	return &namespaceUsage{
+		bytes:  make(map[string]int64),
+		quotas: make(map[string]int64),
+	}
+}
+
+func (u *namespaceUsage) add(key string, delta int64) {
+	if delta == 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	ns := Namespace(key)
+	if _, ok := u.bytes[ns]; !ok {
+		// keys may point into a request buffer that is reused
+		ns = strings.Clone(ns)
+	}
+	u.bytes[ns] += delta
+
+	if u.recounting != nil {
+		if _, ok := u.recounting[ns]; !ok {
+			ns = strings.Clone(ns)
+		}
+		u.recounting[ns] += delta
+	}
+}
+
+// limits the bytes of namespaces on this node; namespaces without an
+// entry have no quota. writes check it with CheckQuota
+func (s *BadgerStorage) SetQuotas(quotas map[string]int64) {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+
+	s.usage.quotas = maps.Clone(quotas)
+}
+
+// bytes per namespace on this node
+func (s *BadgerStorage) Usage() map[string]int64 {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+
+	return maps.Clone(s.usage.bytes)
+}
+
+// fails with ErrQuotaExceeded when size more bytes would take the
+// namespace of key over its quota
+func (s *BadgerStorage) CheckQuota(key string, size int64) error {
+	ns := Namespace(key)
+
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+
+	quota, ok := s.usage.quotas[ns]
+	if !ok {
+		return nil
+	}
+	if used := s.usage.bytes[ns]; used+size > quota {
+		return fmt.Errorf("%w: %q uses %d of %d bytes", ErrQuotaExceeded, ns, used, quota)
+	}
+	return nil
+}
+
+// the bytes an entry takes, 0 when there is none
+func storedSize(txn *badger.Txn, k []byte) int64 {
+	item, err := txn.Get(k)
+	if err != nil {
+		return 0
+	}
+	return int64(len(k)) + item.ValueSize()
+}
+
+// counts every record and chunk; keys only, values are not read. the
+// count comes from a snapshot, so writes made while it runs are added
+// to it. one that commits just before the snapshot and is added just
+// after may be counted twice, until the next recount
+func (s *BadgerStorage) countUsage() error {
+	counted := make(map[string]int64)
+
+	s.usage.mu.Lock()
+	s.usage.recounting = make(map[string]int64)
+	s.usage.mu.Unlock()
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			k := item.Key()
+
+			var key string
+			switch {
+			case bytes.HasPrefix(k, []byte(dataPrefix)):
+				key = recordKey(k)
+			case bytes.HasPrefix(k, []byte(chunkPrefix)):
+				key = chunkRecordKey(k)
+			default:
+				continue
+			}
+			counted[Namespace(key)] += int64(len(k)) + item.ValueSize()
+		}
+		return nil
+	})
+
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+
+	since := s.usage.recounting
+	s.usage.recounting = nil
+	if err != nil {
+		return err
+	}
+
+	for ns, delta := range since {
+		counted[ns] += delta
+	}
+	s.usage.bytes = counted
+	return nil
+}
+
+func (s *BadgerStorage) usageLoop(stopCh chan struct{}) {
+	ticker := time.NewTicker(usageRecountInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.countUsage(); err != nil {
+				s.log.Error().Err(err).Msg("failed to count namespace usage")
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
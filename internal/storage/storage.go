@@ -1,12 +1,35 @@
 package storage
 
-import "github.com/AuraReaper/strangedb/internal/hlc"
+import (
+	"context"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+)
 
 type Record struct {
 	Key       string        `json:"key"`
 	Value     []byte        `json:"value"`
 	Timestamp hlc.Timestamp `json:"timestamp"`
 	Tombstone bool          `json:"tombstone"`
+	// media type supplied by the writer, echoed back on read
+	ContentType string `json:"content_type,omitempty"`
+	// the value is a Manifest pointing at chunks of a large object
+	Manifest bool `json:"manifest,omitempty"`
+	// id of the cluster the write was replicated from, empty for writes
+	// made in this cluster
+	Origin string `json:"origin,omitempty"`
+	// wall time in nanoseconds from which the record reads as deleted, 0
+	// when it never expires
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// an expired record reads as a tombstone written at its own timestamp,
+// so it still wins over older versions held by other replicas
+func (r *Record) expire(now int64) {
+	if r.ExpiresAt != 0 && r.ExpiresAt <= now && !r.Tombstone {
+		r.Tombstone = true
+		r.Value = nil
+	}
 }
 
 type Storage interface {
@@ -14,7 +37,14 @@ type Storage interface {
 	Close() error
 	Get(key string) (*Record, error)
 	Set(record *Record) error
+	SetBatch(records []*Record) error
+	MergeBatch(records []*Record) (int, error)
 	Delete(key string, timestamp hlc.Timestamp) error
 	Exists(key string) (bool, error)
 	List(prefix string, limit int) ([]*Record, error)
+	Scan(prefix, after string, limit int) ([]*Record, error)
+	Watch(ctx context.Context, prefix string, since hlc.Timestamp) (*Watcher, error)
+	SetChunk(key, uploadID string, index int, data []byte) error
+	GetChunk(key, uploadID string, index int) ([]byte, error)
+	DeleteChunks(key, uploadID string) error
 }
@@ -1,10 +1,18 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/dgraph-io/badger/v4"
 )
 
 func setupTestStorage(t *testing.T) *BadgerStorage {
@@ -83,3 +91,892 @@ func TestKeyNotFound(t *testing.T) {
 		t.Errorf("Expected ErrKeyNotFound, got %v", err)
 	}
 }
+
+func TestWatch(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	storage.Set(&Record{Key: "app:a", Value: []byte("1"), Timestamp: clock.Now()})
+	storage.Set(&Record{Key: "other:x", Value: []byte("2"), Timestamp: clock.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher, err := storage.Watch(ctx, "app:", hlc.Timestamp{})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	next := func() *Record {
+		select {
+		case r := <-watcher.Events():
+			return r
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+			return nil
+		}
+	}
+
+	if r := next(); r.Key != "app:a" {
+		t.Errorf("Expected backlog event for 'app:a', got '%s'", r.Key)
+	}
+
+	storage.Set(&Record{Key: "other:y", Value: []byte("3"), Timestamp: clock.Now()})
+	storage.Delete("app:a", clock.Now())
+
+	r := next()
+	if r.Key != "app:a" || !r.Tombstone {
+		t.Errorf("Expected tombstone for 'app:a', got %+v", r)
+	}
+
+	cancel()
+	for range watcher.Events() {
+	}
+	if watcher.Err() != nil {
+		t.Errorf("Expected nil error after cancel, got %v", watcher.Err())
+	}
+}
+
+func TestWatchPagesBacklog(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	total := watchPageSize*2 + 10
+	for i := 0; i < total; i++ {
+		storage.Set(&Record{Key: fmt.Sprintf("app:%05d", i), Value: []byte("v"), Timestamp: clock.Now()})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher, err := storage.Watch(ctx, "app:", hlc.Timestamp{})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	for i := 0; i < total; i++ {
+		select {
+		case r := <-watcher.Events():
+			if want := fmt.Sprintf("app:%05d", i); r.Key != want {
+				t.Fatalf("backlog event %d is %q, want %q", i, r.Key, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d of %d backlog events", i, total)
+		}
+	}
+
+	select {
+	case <-watcher.Replayed():
+	case <-time.After(time.Second):
+		t.Fatal("Replayed not closed after the backlog")
+	}
+}
+
+func TestWatchReadsBackWritesDroppedDuringReplay(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	storage.Set(&Record{Key: "app:backlog", Value: []byte("v"), Timestamp: clock.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher, err := storage.Watch(ctx, "app:", hlc.Timestamp{})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	// nothing is read yet, so the live buffer overflows while the backlog
+	// is still being replayed
+	total := watchBufferSize * 2
+	for i := 0; i < total; i++ {
+		storage.Set(&Record{Key: fmt.Sprintf("app:%05d", i), Value: []byte("v"), Timestamp: clock.Now()})
+	}
+
+	seen := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < total+1 {
+		select {
+		case r, ok := <-watcher.Events():
+			if !ok {
+				t.Fatalf("watcher stopped after %d events: %v", len(seen), watcher.Err())
+			}
+			seen[r.Key] = true
+		case <-timeout:
+			t.Fatalf("timed out after %d of %d keys", len(seen), total+1)
+		}
+	}
+}
+
+func TestRecordCodec(t *testing.T) {
+	clock := hlc.NewClock("test-node")
+
+	records := []*Record{
+		{Key: "k1", Value: []byte{0x00, 0xff, '{'}, Timestamp: clock.Now(), ContentType: "image/png"},
+		{Key: "k2", Value: []byte{}, Timestamp: clock.Now()},
+		{Key: "k3", Timestamp: clock.Now(), Tombstone: true},
+	}
+
+	for _, record := range records {
+		decoded, err := decodeRecord(record.Key, encodeRecord(record, CodecNone))
+		if err != nil {
+			t.Fatalf("decode %s failed: %v", record.Key, err)
+		}
+
+		if decoded.Key != record.Key || !bytes.Equal(decoded.Value, record.Value) ||
+			hlc.Compare(decoded.Timestamp, record.Timestamp) != 0 ||
+			decoded.Tombstone != record.Tombstone || decoded.ContentType != record.ContentType {
+			t.Errorf("roundtrip mismatch: got %+v, want %+v", decoded, record)
+		}
+	}
+
+	if _, err := decodeRecord("k", []byte{0x7f}); err == nil {
+		t.Error("Expected error for unknown format version")
+	}
+}
+
+func writeLegacyRecord(t *testing.T, storage *BadgerStorage, record *Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.DB().Update(func(txn *badger.Txn) error {
+		return txn.Set(dataKey(record.Key), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyRecords(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	for i := 0; i < 2500; i++ {
+		writeLegacyRecord(t, storage, &Record{
+			Key:       fmt.Sprintf("legacy:%04d", i),
+			Value:     []byte("value"),
+			Timestamp: clock.Now(),
+		})
+	}
+	writeLegacyRecord(t, storage, &Record{Key: "legacy:gone", Timestamp: clock.Now(), Tombstone: true})
+	storage.Set(&Record{Key: "binary", Value: []byte("new"), Timestamp: clock.Now()})
+
+	// legacy records read transparently
+	if _, err := storage.Get("legacy:0000"); err != nil {
+		t.Fatalf("Get legacy record failed: %v", err)
+	}
+	if _, err := storage.Get("legacy:gone"); err != ErrKeyDeleted {
+		t.Errorf("Expected ErrKeyDeleted for legacy tombstone, got %v", err)
+	}
+
+	stats, err := storage.MigrateRecords()
+	if err != nil {
+		t.Fatalf("MigrateRecords failed: %v", err)
+	}
+
+	if stats.Scanned != 2502 || stats.Migrated != 2501 {
+		t.Errorf("Expected 2502 scanned and 2501 migrated, got %+v", stats)
+	}
+
+	stats, _ = storage.MigrateRecords()
+	if stats.Migrated != 0 {
+		t.Errorf("Expected second run to migrate nothing, got %d", stats.Migrated)
+	}
+
+	record, err := storage.Get("legacy:0000")
+	if err != nil || string(record.Value) != "value" {
+		t.Errorf("Expected migrated record to keep its value, got %v, %v", record, err)
+	}
+}
+
+func TestCompressionMixedCodecs(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+	doc := bytes.Repeat([]byte(`{"name":"strange","tags":["a","b"]}`), 100)
+
+	// written before compression was turned on
+	storage.Set(&Record{Key: "docs:old", Value: doc, Timestamp: clock.Now()})
+
+	storage.SetCompression(&CompressionPolicy{
+		Default:    CodecSnappy,
+		Namespaces: map[string]Codec{"docs": CodecZstd, "raw": CodecNone},
+		MinSize:    DefaultCompressionMinSize,
+	})
+
+	for _, key := range []string{"docs:new", "cache:1", "raw:1", "docs:tiny"} {
+		value := doc
+		if key == "docs:tiny" {
+			value = []byte("small")
+		}
+		storage.Set(&Record{Key: key, Value: value, Timestamp: clock.Now()})
+	}
+
+	expectedCodecs := map[string]Codec{
+		"docs:old":  CodecNone,
+		"docs:new":  CodecZstd,
+		"cache:1":   CodecSnappy,
+		"raw:1":     CodecNone,
+		"docs:tiny": CodecNone,
+	}
+
+	for key, expected := range expectedCodecs {
+		err := storage.DB().View(func(txn *badger.Txn) error {
+			item, err := txn.Get(dataKey(key))
+			if err != nil {
+				return err
+			}
+			return item.Value(func(val []byte) error {
+				if codec := Codec((val[1] & flagCodecMask) >> flagCodecShift); codec != expected {
+					t.Errorf("%s: expected codec %s, got %s", key, expected, codec)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		record, err := storage.Get(key)
+		if err != nil {
+			t.Fatalf("Get %s failed: %v", key, err)
+		}
+		if key != "docs:tiny" && !bytes.Equal(record.Value, doc) {
+			t.Errorf("%s: value mismatch after decompression", key)
+		}
+	}
+}
+
+func TestChunksReplacedByNewerWrite(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	chunks := [][]byte{bytes.Repeat([]byte("a"), 100), []byte("tail")}
+	for i, data := range chunks {
+		if err := storage.SetChunk("blob", "upload-1", i, data); err != nil {
+			t.Fatalf("SetChunk failed: %v", err)
+		}
+	}
+
+	// an upload that has no manifest yet must survive the overwrite
+	storage.SetChunk("blob", "upload-2", 0, []byte("pending"))
+
+	manifest, _ := json.Marshal(Manifest{UploadID: "upload-1", Size: 104, Chunks: []string{"", ""}})
+	storage.Set(&Record{Key: "blob", Value: manifest, Timestamp: clock.Now(), Manifest: true})
+
+	record, err := storage.Get("blob")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	m, err := ParseManifest(record)
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	for i := range m.Chunks {
+		data, err := storage.GetChunk("blob", m.UploadID, i)
+		if err != nil {
+			t.Fatalf("GetChunk %d failed: %v", i, err)
+		}
+		if !bytes.Equal(data, chunks[i]) {
+			t.Errorf("chunk %d mismatch", i)
+		}
+	}
+
+	storage.Set(&Record{Key: "blob", Value: []byte("small"), Timestamp: clock.Now()})
+
+	if _, err := storage.GetChunk("blob", "upload-1", 0); err != ErrKeyNotFound {
+		t.Errorf("expected superseded chunks to be deleted, got %v", err)
+	}
+	if _, err := storage.GetChunk("blob", "upload-2", 0); err != nil {
+		t.Errorf("expected in-flight upload to be kept, got %v", err)
+	}
+
+	storage.DeleteChunks("blob", "upload-2")
+	if _, err := storage.GetChunk("blob", "upload-2", 0); err != ErrKeyNotFound {
+		t.Errorf("expected DeleteChunks to remove the upload, got %v", err)
+	}
+}
+
+func TestBackupRestoreKeepsNewest(t *testing.T) {
+	source := setupTestStorage(t)
+	stale := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	stale.Set(&Record{Key: "a", Value: []byte("old"), Timestamp: clock.Now()})
+	source.Set(&Record{Key: "a", Value: []byte("new"), Timestamp: clock.Now()})
+	source.Set(&Record{Key: "b", Value: []byte("b"), Timestamp: clock.Now()})
+	source.Delete("b", clock.Now())
+	source.SetChunk("blob", "upload-1", 0, []byte("chunk"))
+	manifest, _ := json.Marshal(Manifest{UploadID: "upload-1", Size: 5, Chunks: []string{""}})
+	source.Set(&Record{Key: "blob", Value: manifest, Timestamp: clock.Now(), Manifest: true})
+	// no manifest points at this upload yet
+	source.SetChunk("blob", "upload-2", 0, []byte("pending"))
+
+	var full, old bytes.Buffer
+	stats, err := source.Backup(&full, hlc.Timestamp{}, hlc.Timestamp{})
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if stats.Records != 3 || stats.Tombstones != 1 || stats.Chunks != 1 {
+		t.Errorf("unexpected backup stats %+v", stats)
+	}
+	stale.Backup(&old, hlc.Timestamp{}, hlc.Timestamp{})
+
+	target := setupTestStorage(t)
+	for _, backup := range []*bytes.Buffer{&full, &old} {
+		var entries []*BackupEntry
+		err := ReadBackup(backup, func(entry *BackupEntry) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ReadBackup failed: %v", err)
+		}
+		if err := target.Restore(entries); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+	}
+
+	record, err := target.Get("a")
+	if err != nil || string(record.Value) != "new" {
+		t.Errorf("expected newest version to win, got %v %v", record, err)
+	}
+	if _, err := target.Get("b"); err != ErrKeyDeleted {
+		t.Errorf("expected tombstone to be restored, got %v", err)
+	}
+	if data, err := target.GetChunk("blob", "upload-1", 0); err != nil || string(data) != "chunk" {
+		t.Errorf("expected chunk to be restored, got %q %v", data, err)
+	}
+}
+
+func TestIncrementalBackup(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	storage.Set(&Record{Key: "a", Value: []byte("a"), Timestamp: clock.Now()})
+	storage.Set(&Record{Key: "b", Value: []byte("b"), Timestamp: clock.Now()})
+	watermark := clock.Now()
+	storage.Set(&Record{Key: "c", Value: []byte("c"), Timestamp: clock.Now()})
+	storage.Delete("a", clock.Now())
+
+	var buf bytes.Buffer
+	if _, err := storage.Backup(&buf, watermark, hlc.Timestamp{}); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	got := make(map[string]bool)
+	err := ReadBackup(&buf, func(entry *BackupEntry) error {
+		got[entry.Key] = entry.Tombstone
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadBackup failed: %v", err)
+	}
+
+	expected := map[string]bool{"a": true, "c": false}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for key, tombstone := range expected {
+		if t2, ok := got[key]; !ok || t2 != tombstone {
+			t.Errorf("%s: expected tombstone=%v, got %v (present %v)", key, tombstone, t2, ok)
+		}
+	}
+}
+
+func backupEntries(t *testing.T, buf *bytes.Buffer) map[string]*BackupEntry {
+	t.Helper()
+
+	entries := make(map[string]*BackupEntry)
+	err := ReadBackup(buf, func(entry *BackupEntry) error {
+		if !entry.Chunk {
+			entries[entry.Key] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadBackup failed: %v", err)
+	}
+	return entries
+}
+
+func TestBackupCutsAtPoint(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	before := clock.Now()
+	storage.Set(&Record{Key: "a", Value: []byte("old"), Timestamp: before})
+	storage.SetChunk("blob", "upload-1", 0, []byte("chunk"))
+	manifest, _ := json.Marshal(Manifest{UploadID: "upload-1", Chunks: []string{""}})
+	storage.Set(&Record{Key: "blob", Value: manifest, Timestamp: clock.Now(), Manifest: true})
+
+	at := clock.Now()
+	storage.Set(&Record{Key: "a", Value: []byte("new"), Timestamp: clock.Now()})
+	storage.Set(&Record{Key: "b", Value: []byte("b"), Timestamp: clock.Now()})
+	// replaces the manifest and drops the chunks of upload-1
+	storage.SetChunk("blob", "upload-2", 0, []byte("chunk"))
+	manifest, _ = json.Marshal(Manifest{UploadID: "upload-2", Chunks: []string{""}})
+	storage.Set(&Record{Key: "blob", Value: manifest, Timestamp: clock.Now(), Manifest: true})
+
+	var buf bytes.Buffer
+	stats, err := storage.Backup(&buf, hlc.Timestamp{}, at)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if stats.Records != 1 || stats.Later != 2 || stats.Chunks != 0 {
+		t.Errorf("unexpected backup stats %+v", stats)
+	}
+
+	entries := backupEntries(t, &buf)
+	if a := entries["a"]; a == nil || hlc.Compare(a.Timestamp, before) != 0 {
+		t.Errorf("backup holds a at %v, want the version written before the backup point", a)
+	}
+	if entries["b"] != nil {
+		t.Error("backup holds b, written after the backup point")
+	}
+	if entries["blob"] != nil {
+		t.Error("backup holds a manifest whose chunks are gone")
+	}
+}
+
+func TestBackupSkipsUnreadableRecords(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	storage.Set(&Record{Key: "good", Value: []byte("v"), Timestamp: clock.Now()})
+	err := storage.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(dataKey("bad"), []byte{formatV1})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	stats, err := storage.Backup(&buf, hlc.Timestamp{}, hlc.Timestamp{})
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if stats.Records != 1 || stats.Unreadable != 1 {
+		t.Errorf("unexpected backup stats %+v", stats)
+	}
+
+	// the backup stays readable
+	if entries := backupEntries(t, &buf); entries["good"] == nil || len(entries) != 1 {
+		t.Errorf("backup holds %v, want only good", entries)
+	}
+}
+
+func TestDropOrphanChunks(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	for _, upload := range []string{"current", "stale"} {
+		storage.SetChunk("blob", upload, 0, []byte(upload))
+		storage.SetChunk("blob", upload, 1, []byte(upload))
+	}
+	storage.SetChunk("gone", "stale", 0, []byte("no record"))
+
+	manifest, _ := json.Marshal(Manifest{UploadID: "current", Chunks: []string{"", ""}})
+	storage.Set(&Record{Key: "blob", Value: manifest, Timestamp: clock.Now(), Manifest: true})
+
+	dropped, err := storage.DropOrphanChunks()
+	if err != nil {
+		t.Fatalf("DropOrphanChunks failed: %v", err)
+	}
+	if dropped != 2 {
+		t.Errorf("expected 2 orphaned uploads, got %d", dropped)
+	}
+
+	if _, err := storage.GetChunk("blob", "current", 1); err != nil {
+		t.Errorf("expected current upload to be kept, got %v", err)
+	}
+	for _, key := range []string{"blob", "gone"} {
+		if _, err := storage.GetChunk(key, "stale", 0); err != ErrKeyNotFound {
+			t.Errorf("%s: expected stale upload to be dropped, got %v", key, err)
+		}
+	}
+}
+
+func TestDropOrphansSparesActiveUploads(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	storage.SetChunk("blob", "active", 0, []byte("data"))
+	storage.SetChunk("blob", "stalled", 0, []byte("data"))
+	storage.SetChunk("blob", "restarted", 0, []byte("data"))
+
+	stalled := string(uploadPrefix("blob", "stalled"))
+	storage.uploads.times[stalled] = time.Now().Add(-2 * time.Hour)
+	// left from before a restart, so this process never saw it written
+	delete(storage.uploads.times, string(uploadPrefix("blob", "restarted")))
+
+	dropped, err := storage.dropOrphans(time.Hour)
+	if err != nil {
+		t.Fatalf("dropOrphans failed: %v", err)
+	}
+	if dropped != 1 {
+		t.Errorf("dropped %d uploads, want only the stalled one", dropped)
+	}
+	if _, err := storage.GetChunk("blob", "stalled", 0); err != ErrKeyNotFound {
+		t.Errorf("expected the stalled upload to be dropped, got %v", err)
+	}
+	for _, upload := range []string{"active", "restarted"} {
+		if _, err := storage.GetChunk("blob", upload, 0); err != nil {
+			t.Errorf("expected the %s upload to be kept, got %v", upload, err)
+		}
+	}
+
+	// an hour after the sweep first found it, the restarted upload goes
+	restarted := string(uploadPrefix("blob", "restarted"))
+	storage.uploads.times[restarted] = storage.uploads.times[restarted].Add(-2 * time.Hour)
+	if dropped, _ := storage.dropOrphans(time.Hour); dropped != 1 {
+		t.Errorf("dropped %d uploads, want the restarted one", dropped)
+	}
+}
+
+func TestScanAndSetBatch(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	var records []*Record
+	for i := 0; i < 5; i++ {
+		records = append(records, &Record{
+			Key:       fmt.Sprintf("user:%d", i),
+			Value:     []byte(fmt.Sprintf("value-%d", i)),
+			Timestamp: clock.Now(),
+		})
+	}
+	records = append(records, &Record{Key: "other", Value: []byte("x"), Timestamp: clock.Now()})
+
+	if err := storage.SetBatch(records); err != nil {
+		t.Fatalf("SetBatch failed: %v", err)
+	}
+	storage.Delete("user:3", clock.Now())
+
+	page, err := storage.Scan("user:", "", 2)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(page) != 2 || page[0].Key != "user:0" || page[1].Key != "user:1" {
+		t.Fatalf("unexpected first page %v", page)
+	}
+
+	rest, err := storage.Scan("user:", page[1].Key, 0)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(rest) != 3 || rest[0].Key != "user:2" || !rest[1].Tombstone {
+		t.Fatalf("expected the rest of the prefix including the tombstone, got %d records", len(rest))
+	}
+
+	all, _ := storage.Scan("", "", 0)
+	if len(all) != 6 {
+		t.Errorf("expected 6 records without a prefix, got %d", len(all))
+	}
+	if cursor, _ := storage.Scan("user:", "a", 0); len(cursor) != 5 {
+		t.Errorf("expected a cursor before the prefix to scan all of it, got %d", len(cursor))
+	}
+}
+
+func TestMergeBatchKeepsNewest(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	older := clock.Now()
+	newer := clock.Now()
+
+	storage.Set(&Record{Key: "a", Value: []byte("local"), Timestamp: newer})
+
+	written, err := storage.MergeBatch([]*Record{
+		{Key: "a", Value: []byte("remote"), Timestamp: older, Origin: "west"},
+		{Key: "b", Value: []byte("remote"), Timestamp: older, Origin: "west"},
+		{Key: "c", Timestamp: older, Tombstone: true, Origin: "west"},
+	})
+	if err != nil {
+		t.Fatalf("MergeBatch failed: %v", err)
+	}
+	if written != 2 {
+		t.Errorf("expected 2 records written, got %d", written)
+	}
+
+	a, _ := storage.Get("a")
+	if string(a.Value) != "local" || a.Origin != "" {
+		t.Errorf("expected the newer local write to survive, got %q from %q", a.Value, a.Origin)
+	}
+
+	b, _ := storage.Get("b")
+	if string(b.Value) != "remote" || b.Origin != "west" {
+		t.Errorf("expected the replicated write with its origin, got %q from %q", b.Value, b.Origin)
+	}
+
+	// replaying the same batch changes nothing
+	if written, _ := storage.MergeBatch([]*Record{{Key: "b", Value: []byte("remote"), Timestamp: older}}); written != 0 {
+		t.Errorf("expected a replayed record to be skipped, %d written", written)
+	}
+}
+
+func TestExpiredRecordsReadAsDeleted(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	past := time.Now().Add(-time.Second).UnixNano()
+	future := time.Now().Add(time.Hour).UnixNano()
+
+	storage.Set(&Record{Key: "gone", Value: []byte("v"), Timestamp: clock.Now(), ExpiresAt: past})
+	storage.Set(&Record{Key: "kept", Value: []byte("v"), Timestamp: clock.Now(), ExpiresAt: future})
+
+	if _, err := storage.Get("gone"); err != ErrKeyDeleted {
+		t.Errorf("expected an expired key to read as deleted, got %v", err)
+	}
+	if exists, _ := storage.Exists("gone"); exists {
+		t.Error("expected an expired key not to exist")
+	}
+
+	kept, err := storage.Get("kept")
+	if err != nil || string(kept.Value) != "v" || kept.ExpiresAt != future {
+		t.Errorf("expected the unexpired key with its expiry, got %+v, %v", kept, err)
+	}
+
+	// scans hand expired keys out as tombstones so they win over older
+	// versions on other replicas
+	records, _ := storage.Scan("", "", 0)
+	if len(records) != 2 || !records[0].Tombstone || records[1].Tombstone {
+		t.Errorf("expected gone as a tombstone and kept as a value, got %+v", records)
+	}
+}
+
+func TestMetaOutsideKeySpace(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	if v, err := storage.Meta(MetaPartitioner); err != nil || v != "" {
+		t.Fatalf("expected no stored partitioner, got %q, %v", v, err)
+	}
+
+	if err := storage.SetMeta(MetaPartitioner, "murmur3"); err != nil {
+		t.Fatalf("SetMeta failed: %v", err)
+	}
+	if v, _ := storage.Meta(MetaPartitioner); v != "murmur3" {
+		t.Errorf("expected murmur3, got %q", v)
+	}
+
+	if all, _ := storage.Scan("", "", 0); len(all) != 0 {
+		t.Errorf("expected meta to stay out of scans, got %d records", len(all))
+	}
+}
+
+func TestIngestStream(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+	policy := &CompressionPolicy{Default: CodecZstd, MinSize: 0}
+
+	var entries []*BackupEntry
+	for i := 0; i < 2500; i++ {
+		record := &Record{
+			Key:       fmt.Sprintf("key-%05d", i),
+			Value:     bytes.Repeat([]byte{byte(i)}, 64),
+			Timestamp: clock.Now(),
+		}
+		entries = append(entries, NewBackupEntry(record, policy))
+	}
+
+	var stream bytes.Buffer
+	for i := 0; i < len(entries); i += 1000 {
+		if err := WriteBackup(&stream, entries[i:min(i+1000, len(entries))]); err != nil {
+			t.Fatalf("WriteBackup failed: %v", err)
+		}
+	}
+
+	n, err := storage.Ingest(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if n != len(entries) {
+		t.Fatalf("expected %d records ingested, got %d", len(entries), n)
+	}
+
+	record, err := storage.Get("key-01234")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(record.Value, bytes.Repeat([]byte{byte(1234 % 256)}, 64)) {
+		t.Errorf("ingested value mismatch")
+	}
+
+	hashes, err := storage.RecordHashes()
+	if err != nil {
+		t.Fatalf("RecordHashes failed: %v", err)
+	}
+	if len(hashes) != len(entries) || hashes["key-00007"] != entries[7].Hash() {
+		t.Errorf("stored hashes do not match the stream")
+	}
+
+	// regular writes continue on top of the ingested data
+	storage.Set(&Record{Key: "key-00000", Value: []byte("new"), Timestamp: clock.Now()})
+	if record, _ := storage.Get("key-00000"); string(record.Value) != "new" {
+		t.Errorf("expected write after ingest to be visible")
+	}
+
+	if _, err := storage.Ingest(bytes.NewReader(stream.Bytes())); err != ErrStoreNotEmpty {
+		t.Errorf("expected ErrStoreNotEmpty, got %v", err)
+	}
+}
+
+func TestEncryptionKeys(t *testing.T) {
+	dir := t.TempDir()
+	clock := hlc.NewClock("test-node")
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 16)
+
+	open := func(key []byte) (*BadgerStorage, error) {
+		store := NewBadgerStorage(dir)
+		store.SetEncryption(key, 0)
+		return store, store.Open()
+	}
+
+	// a plaintext directory, encrypted later
+	store, err := open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(&Record{Key: "user:1", Value: []byte("alice"), Timestamp: clock.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	if _, err := open(key1); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Expected ErrNotEncrypted, got %v", err)
+	}
+	if err := RotateEncryptionKey(dir, nil, key1); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	store, err = open(key1)
+	if err != nil {
+		t.Fatalf("Failed to open with key: %v", err)
+	}
+	if err := store.Set(&Record{Key: "user:2", Value: []byte("bob"), Timestamp: clock.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	if _, err := open(nil); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Expected ErrEncrypted, got %v", err)
+	}
+	if _, err := open(key2); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Errorf("Expected ErrWrongEncryptionKey, got %v", err)
+	}
+	if err := RotateEncryptionKey(dir, key2, key1); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Errorf("Expected rotation with the wrong key to fail, got %v", err)
+	}
+
+	if err := RotateEncryptionKey(dir, key1, key2); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	store, err = open(key2)
+	if err != nil {
+		t.Fatalf("Failed to open with rotated key: %v", err)
+	}
+	defer store.Close()
+
+	for key, want := range map[string]string{"user:1": "alice", "user:2": "bob"} {
+		record, err := store.Get(key)
+		if err != nil || string(record.Value) != want {
+			t.Errorf("Expected %s=%s after rotation, got %v, %v", key, want, record, err)
+		}
+	}
+}
+
+func TestLoadEncryptionKey(t *testing.T) {
+	hexKey := strings.Repeat("ab", 32)
+	key, err := LoadEncryptionKey("", hexKey+"\n")
+	if err != nil || len(key) != 32 {
+		t.Errorf("Expected a 32 byte key, got %d, %v", len(key), err)
+	}
+
+	key, err = LoadEncryptionKey("", "AAAAAAAAAAAAAAAAAAAAAA==")
+	if err != nil || len(key) != 16 {
+		t.Errorf("Expected a 16 byte key, got %d, %v", len(key), err)
+	}
+
+	if _, err := LoadEncryptionKey("", "abcd"); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+	if key, err := LoadEncryptionKey("", ""); key != nil || err != nil {
+		t.Errorf("Expected no key, got %v, %v", key, err)
+	}
+}
+
+func TestNamespaceUsageAndQuota(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	storage.SetQuotas(map[string]int64{"orders": 200})
+
+	value := bytes.Repeat([]byte("x"), 100)
+	if err := storage.Set(&Record{Key: "orders:1", Value: value, Timestamp: clock.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	used := storage.Usage()["orders"]
+	if used <= 100 {
+		t.Fatalf("Expected more than 100 bytes used, got %d", used)
+	}
+
+	if err := storage.CheckQuota("orders:2", 100); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if err := storage.CheckQuota("users:1", 1000); err != nil {
+		t.Errorf("Expected no quota for users, got %v", err)
+	}
+
+	// overwriting counts the difference, not the whole record again
+	if err := storage.SetBatch([]*Record{{Key: "orders:1", Value: []byte("y"), Timestamp: clock.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	if now := storage.Usage()["orders"]; now >= used {
+		t.Errorf("Expected usage to shrink from %d, got %d", used, now)
+	}
+
+	incremental := storage.Usage()
+	if err := storage.countUsage(); err != nil {
+		t.Fatal(err)
+	}
+	if recounted := storage.Usage(); recounted["orders"] != incremental["orders"] {
+		t.Errorf("Expected the recount to match, got %d and %d", recounted["orders"], incremental["orders"])
+	}
+}
+
+func TestRecountKeepsConcurrentWrites(t *testing.T) {
+	storage := setupTestStorage(t)
+	clock := hlc.NewClock("test-node")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 500 {
+			key := fmt.Sprintf("orders:%d", i)
+			if err := storage.Set(&Record{Key: key, Value: []byte("value"), Timestamp: clock.Now()}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for writing := true; writing; {
+		if err := storage.countUsage(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-done:
+			writing = false
+		default:
+		}
+	}
+
+	incremental := storage.Usage()["orders"]
+	if err := storage.countUsage(); err != nil {
+		t.Fatal(err)
+	}
+	if recounted := storage.Usage()["orders"]; recounted != incremental {
+		t.Errorf("Expected usage %d after the recounts, got %d", recounted, incremental)
+	}
+}
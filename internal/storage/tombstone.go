@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"encoding/json"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
@@ -63,12 +62,13 @@ func (tc *TombstoneCollector) collect() {
 			item := it.Item()
 
 			err := item.Value(func(val []byte) error {
-				var record Record
-				if err := json.Unmarshal(val, &record); err != nil {
+				record, err := decodeRecord(recordKey(item.Key()), val)
+				if err != nil {
 					return nil
 				}
 
-				if record.Tombstone && record.Timestamp.WallTime < threshold {
+				// expired records are kept for the ttl after they expire
+				if record.Tombstone && max(record.Timestamp.WallTime, record.ExpiresAt) < threshold {
 					keyToDelete = append(keyToDelete, item.KeyCopy(nil))
 				}
 
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/AuraReaper/strangedb/internal/hlc"
+)
+
+var ErrWatchOverflow = errors.New("watch buffer overflow")
+
+const (
+	watchBufferSize = 1024
+	// records of the backlog read at a time
+	watchPageSize = 1000
+)
+
+// delivers records written under a prefix, tombstones included
+type Watcher struct {
+	prefix   string
+	live     chan *Record
+	events   chan *Record
+	replayed chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+	// while the backlog is replayed, live writes that do not fit the
+	// buffer are dropped and read again from storage afterwards, from the
+	// oldest of them
+	replaying bool
+	missed    bool
+	missedAt  hlc.Timestamp
+}
+
+func newWatcher(prefix string) *Watcher {
+	return &Watcher{
+		prefix:   prefix,
+		live:     make(chan *Record, watchBufferSize),
+		events:   make(chan *Record),
+		replayed: make(chan struct{}),
+		// the backlog comes first
+		replaying: true,
+	}
+}
+
+// closed when the watch context ends or the watcher falls behind
+func (w *Watcher) Events() <-chan *Record {
+	return w.events
+}
+
+// closed once every record of the backlog was received from Events,
+// which comes in key order rather than timestamp order; live writes
+// follow
+func (w *Watcher) Replayed() <-chan struct{} {
+	return w.replayed
+}
+
+func (w *Watcher) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// reports why the watcher stopped, valid once Events is closed
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// never blocks the write path; a slow watcher is dropped instead
+func (w *Watcher) send(record *Record) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.live <- record:
+	default:
+		if w.replaying {
+			if !w.missed || hlc.IsBefore(record.Timestamp, w.missedAt) {
+				w.missed = true
+				w.missedAt = record.Timestamp
+			}
+			return
+		}
+		w.closed = true
+		w.err = ErrWatchOverflow
+		close(w.live)
+	}
+}
+
+// ends the replay unless live writes were dropped during it; then it
+// returns where to replay them from
+func (w *Watcher) endReplay() (hlc.Timestamp, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.missed {
+		w.missed = false
+		return hlc.Timestamp{WallTime: w.missedAt.WallTime - 1}, true
+	}
+	w.replaying = false
+	return hlc.Timestamp{}, false
+}
+
+func (w *Watcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.live)
+	}
+}
+
+// replays the backlog a page at a time, starting with first, then
+// forwards live writes until ctx ends
+func (w *Watcher) pump(ctx context.Context, first []*Record, since hlc.Timestamp,
+	list func(after string, since hlc.Timestamp) ([]*Record, error), onDone func()) {
+	defer close(w.events)
+	defer onDone()
+
+	page := first
+	for {
+		for _, record := range page {
+			select {
+			case w.events <- record:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		var err error
+		if len(page) == watchPageSize {
+			page, err = list(page[len(page)-1].Key, since)
+		} else if missedSince, ok := w.endReplay(); ok {
+			// live writes were dropped meanwhile, read them back
+			since = missedSince
+			page, err = list("", since)
+		} else {
+			break
+		}
+		if err != nil {
+			w.fail(err)
+			return
+		}
+	}
+	close(w.replayed)
+
+	for {
+		select {
+		case record, ok := <-w.live:
+			if !ok {
+				return
+			}
+			select {
+			case w.events <- record:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type broker struct {
+	mu       sync.RWMutex
+	watchers map[*Watcher]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{
+		watchers: make(map[*Watcher]struct{}),
+	}
+}
+
+func (b *broker) subscribe(w *Watcher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.watchers[w] = struct{}{}
+}
+
+func (b *broker) unsubscribe(w *Watcher) {
+	b.mu.Lock()
+	delete(b.watchers, w)
+	b.mu.Unlock()
+
+	w.stop()
+}
+
+func (b *broker) publish(record *Record) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for w := range b.watchers {
+		if strings.HasPrefix(record.Key, w.prefix) {
+			w.send(record)
+		}
+	}
+}
+
+// watches prefix, first replaying records written after since
+func (s *BadgerStorage) Watch(ctx context.Context, prefix string, since hlc.Timestamp) (*Watcher, error) {
+	w := newWatcher(prefix)
+
+	// subscribe before the backlog scan so no write falls in between,
+	// consumers dedupe the overlap by timestamp
+	s.broker.subscribe(w)
+
+	list := func(after string, since hlc.Timestamp) ([]*Record, error) {
+		return s.ListSince(prefix, after, since, watchPageSize)
+	}
+	first, err := list("", since)
+	if err != nil {
+		s.broker.unsubscribe(w)
+		return nil, err
+	}
+
+	go w.pump(ctx, first, since, list, func() {
+		s.broker.unsubscribe(w)
+	})
+
+	return w, nil
+}
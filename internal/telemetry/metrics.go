@@ -58,9 +58,114 @@ var (
 		Name: "strangedb_read_repairs_total",
 		Help: "Total read repairs performed",
 	})
+
+	// cross-cluster replication metrics
+	XDCLagSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "strangedb_xdc_lag_seconds",
+		Help: "Age of the oldest local write not yet acknowledged by the remote cluster",
+	})
+
+	XDCQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "strangedb_xdc_queue_depth",
+		Help: "Local writes waiting to be shipped to the remote cluster",
+	})
+
+	XDCRecordsShipped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "strangedb_xdc_records_shipped_total",
+		Help: "Records acknowledged by the remote cluster",
+	})
+
+	XDCShipErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "strangedb_xdc_ship_errors_total",
+		Help: "Failed attempts to ship a batch to the remote cluster",
+	})
+
+	XDCRecordsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "strangedb_xdc_records_skipped_total",
+		Help: "Local writes not shipped to the remote cluster",
+	},
+		[]string{"reason"},
+	)
+
+	XDCBackpressure = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "strangedb_xdc_backpressure_total",
+		Help: "Times the agent fell behind local writes and resumed from its watermark",
+	})
+
+	// admission metrics
+	AdmissionInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "strangedb_admission_in_flight",
+		Help: "Requests being coordinated by this node",
+	})
+
+	AdmissionQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "strangedb_admission_queue_depth",
+		Help: "Requests waiting for a coordinator slot",
+	})
+
+	AdmissionRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "strangedb_admission_rejections_total",
+		Help: "Requests shed or given up on before they were coordinated",
+	},
+		[]string{"reason"},
+	)
+
+	PeerInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "strangedb_peer_in_flight",
+		Help: "Requests this node has outstanding at each peer",
+	},
+		[]string{"peer"},
+	)
+
+	// peer circuit breaker metrics
+	PeerCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "strangedb_peer_circuit_state",
+		Help: "Circuit breaker of each peer: 0 closed, 1 half-open, 2 open",
+	},
+		[]string{"peer"},
+	)
+
+	PeerCircuitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "strangedb_peer_circuit_rejections_total",
+		Help: "Calls to a peer failed at once because its circuit was open",
+	},
+		[]string{"peer"},
+	)
+
+	PeerRPCRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "strangedb_peer_rpc_retries_total",
+		Help: "Replica RPCs retried after a transient failure",
+	},
+		[]string{"peer"},
+	)
+
+	// compression metrics
+	CompressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "strangedb_compression_ratio",
+		Help:    "Raw to compressed size ratio of values written",
+		Buckets: []float64{1, 1.25, 1.5, 2, 3, 5, 8, 13, 21, 34, 55},
+	},
+		[]string{"codec"},
+	)
+
+	CompressionBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "strangedb_compression_bytes_total",
+		Help: "Value bytes passed through compression, before (raw) and after (compressed)",
+	},
+		[]string{"codec", "stage"},
+	)
 )
 
 func RecordRequest(operation, status string, duration float64) {
 	RequestTotal.WithLabelValues(operation, status).Inc()
 	RequestDuration.WithLabelValues(operation).Observe(duration)
 }
+
+func RecordCompression(codec string, raw, compressed int) {
+	CompressionBytesTotal.WithLabelValues(codec, "raw").Add(float64(raw))
+	CompressionBytesTotal.WithLabelValues(codec, "compressed").Add(float64(compressed))
+
+	if compressed > 0 {
+		CompressionRatio.WithLabelValues(codec).Observe(float64(raw) / float64(compressed))
+	}
+}
@@ -0,0 +1,157 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/filewatch"
+	"github.com/rs/zerolog"
+)
+
+var ErrNoCertificates = errors.New("no certificates found in CA file")
+
+// keeps a certificate and an optional CA bundle loaded from disk and
+// loads them again when the files change, so certificates can be
+// rotated without a restart. configs from it always use the latest
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	watcher  *filewatch.Watcher
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// loads the files once; without a CA file peers are verified against
+// the system roots. failed reloads are logged to log
+func NewReloader(certFile, keyFile, caFile string, interval time.Duration, log zerolog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+
+	// a half written pair fails to load and the old one is kept
+	watcher, err := filewatch.New([]string{certFile, keyFile, caFile}, interval, r.load, log)
+	if err != nil {
+		return nil, err
+	}
+	r.watcher = watcher
+	return r, nil
+}
+
+func (r *Reloader) Start() {
+	r.watcher.Start()
+}
+
+func (r *Reloader) Stop() {
+	r.watcher.Stop()
+}
+
+func (r *Reloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("load CA: %w", err)
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: %w", r.caFile, ErrNoCertificates)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Reloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// verifies a peer's chain against the current CA bundle
+func (r *Reloader) verify(certs []*x509.Certificate, usage x509.ExtKeyUsage, dnsName string) error {
+	if len(certs) == 0 {
+		return errors.New("peer presented no certificate")
+	}
+
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+		DNSName:       dnsName,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// a server config presenting the current certificate. with
+// verifyClients, client certificates are checked against the CA and a
+// connection presenting a bad one is refused; clients without one are
+// let through, so callers must check for a peer certificate where they
+// need one
+func (r *Reloader) ServerConfig(verifyClients bool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+	}
+
+	if verifyClients {
+		// the CA may change after the config is built, so verification
+		// is ours rather than the ClientCAs pool's
+		cfg.ClientAuth = tls.RequestClientCert
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			return r.verify(cs.PeerCertificates, x509.ExtKeyUsageClientAuth, "")
+		}
+	}
+
+	return cfg
+}
+
+// a client config presenting the current certificate and verifying the
+// server against the CA and the dialed host name
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		// verified below against the current CA instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verify(cs.PeerCertificates, x509.ExtKeyUsageServerAuth, cs.ServerName)
+		},
+	}
+}
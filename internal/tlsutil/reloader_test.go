@@ -0,0 +1,199 @@
+package tlsutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// a node certificate for localhost and its key, PEM encoded
+func (ca *testCA) issue(t *testing.T, serial int64) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "node"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writes the files and moves their modification time forward, so the
+// change is seen however coarse the file system's clock is
+func writeFiles(t *testing.T, at time.Time, files map[string][]byte) {
+	t.Helper()
+
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func leaf(r *Reloader) []byte {
+	return r.certificate().Certificate[0]
+}
+
+func TestReloadPicksUpRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newTestCA(t)
+	cert, key := ca.issue(t, 2)
+	writeFiles(t, time.Now(), map[string][]byte{certFile: cert, keyFile: key, caFile: ca.pem})
+
+	r, err := NewReloader(certFile, keyFile, caFile, time.Minute, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	before := leaf(r)
+
+	if reloaded, err := r.watcher.Check(); reloaded || err != nil {
+		t.Fatalf("Check on unchanged files = %v, %v", reloaded, err)
+	}
+
+	// a new CA and a certificate it signed
+	rotated := newTestCA(t)
+	cert, key = rotated.issue(t, 3)
+	writeFiles(t, time.Now().Add(time.Second), map[string][]byte{certFile: cert, keyFile: key, caFile: rotated.pem})
+
+	if reloaded, err := r.watcher.Check(); !reloaded || err != nil {
+		t.Fatalf("Check on rotated files = %v, %v", reloaded, err)
+	}
+	if bytes.Equal(leaf(r), before) {
+		t.Error("the rotated certificate was not loaded")
+	}
+
+	parsed, err := x509.ParseCertificate(leaf(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.verify([]*x509.Certificate{parsed}, x509.ExtKeyUsageServerAuth, "localhost"); err != nil {
+		t.Errorf("a certificate of the rotated CA was refused: %v", err)
+	}
+	old, _ := x509.ParseCertificate(before)
+	if err := r.verify([]*x509.Certificate{old}, x509.ExtKeyUsageServerAuth, "localhost"); err == nil {
+		t.Error("a certificate of the replaced CA was accepted")
+	}
+}
+
+func TestReloadKeepsCertificateOnBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newTestCA(t)
+	cert, key := ca.issue(t, 2)
+	writeFiles(t, time.Now(), map[string][]byte{certFile: cert, keyFile: key, caFile: ca.pem})
+
+	r, err := NewReloader(certFile, keyFile, caFile, time.Minute, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	before := leaf(r)
+
+	otherCert, _ := ca.issue(t, 3)
+	at := time.Now()
+	for _, tc := range []struct {
+		name           string
+		cert, key, pem []byte
+	}{
+		{"garbage certificate", []byte("not a certificate"), key, ca.pem},
+		{"key of another certificate", otherCert, key, ca.pem},
+		{"half written key", cert, key[:len(key)/2], ca.pem},
+		{"CA without certificates", cert, key, []byte("not a certificate")},
+	} {
+		at = at.Add(time.Second)
+		writeFiles(t, at, map[string][]byte{certFile: tc.cert, keyFile: tc.key, caFile: tc.pem})
+
+		if reloaded, err := r.watcher.Check(); reloaded || err == nil {
+			t.Errorf("%s: Check = %v, %v, want an error", tc.name, reloaded, err)
+		}
+		if !bytes.Equal(leaf(r), before) {
+			t.Fatalf("%s: the certificate in use was replaced", tc.name)
+		}
+	}
+
+	// fixed files are loaded on the next check
+	writeFiles(t, at.Add(time.Second), map[string][]byte{certFile: cert, keyFile: key, caFile: ca.pem})
+	if reloaded, err := r.watcher.Check(); !reloaded || err != nil {
+		t.Errorf("fixed files: Check = %v, %v", reloaded, err)
+	}
+}
+
+func TestNewReloaderRejectsBadCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key"), filepath.Join(dir, "ca.crt")
+
+	cert, key := newTestCA(t).issue(t, 2)
+	writeFiles(t, time.Now(), map[string][]byte{certFile: cert, keyFile: key, caFile: []byte("nothing here")})
+
+	if _, err := NewReloader(certFile, keyFile, caFile, time.Minute, zerolog.Nop()); !errors.Is(err, ErrNoCertificates) {
+		t.Errorf("NewReloader error = %v, want %v", err, ErrNoCertificates)
+	}
+}
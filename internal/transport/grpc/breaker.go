@@ -0,0 +1,300 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/telemetry"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrCircuitOpen = errors.New("circuit open")
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitHalfOpen
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+type BreakerOptions struct {
+	// failures in a row that open a peer's circuit
+	Failures int
+	// how long an open circuit fails calls before one is let through to
+	// probe the peer
+	Cooldown time.Duration
+}
+
+type RetryOptions struct {
+	// tries of an idempotent call, the first included
+	Attempts int
+	// wait before the first retry, doubling after each
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// what /cluster/status shows for a peer
+type Circuit struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// a circuit breaker for one peer. failed calls open it, after which
+// calls fail at once instead of waiting out their timeout against a dead
+// node; after the cooldown a single call probes the peer and closes the
+// circuit again when it succeeds
+type breaker struct {
+	mu       sync.Mutex
+	addr     string
+	opts     BreakerOptions
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// gossip declared the peer dead
+	dead bool
+}
+
+func newBreaker(addr string, opts BreakerOptions) *breaker {
+	b := &breaker{addr: addr, opts: opts}
+	telemetry.PeerCircuitState.WithLabelValues(addr).Set(float64(CircuitClosed))
+	return b
+}
+
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.opts.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		// one probe at a time
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// records how a call the breaker let through went
+func (b *breaker) done(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ctx.Err() != nil {
+		// the caller gave up, which says nothing about the peer
+		return
+	}
+	if !peerFailure(err) {
+		b.failures = 0
+		b.setState(CircuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.opts.Failures {
+		b.open()
+	}
+}
+
+// gossip declared the peer dead, or alive again
+func (b *breaker) setAlive(alive bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case !alive && !b.dead:
+		b.dead = true
+		b.open()
+	case alive && b.dead:
+		b.dead = false
+		if b.state == CircuitOpen {
+			// probe with the next call rather than waiting out the
+			// cooldown
+			b.openedAt = time.Time{}
+		}
+	}
+}
+
+func (b *breaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+func (b *breaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	telemetry.PeerCircuitState.WithLabelValues(b.addr).Set(float64(state))
+}
+
+func (b *breaker) status() Circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := Circuit{State: b.state.String(), Failures: b.failures}
+	if b.state != CircuitClosed && !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		c.OpenedAt = &openedAt
+	}
+	return c
+}
+
+func (c *Client) breaker(addr string) *breaker {
+	c.mu.RLock()
+	b, ok := c.breakers[addr]
+	c.mu.RUnlock()
+
+	if ok {
+		return b
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if b, ok := c.breakers[addr]; ok {
+		return b
+	}
+	b = newBreaker(addr, c.opts.Breaker)
+	c.breakers[addr] = b
+	return b
+}
+
+// fails with ErrCircuitOpen while the peer's circuit is open
+func (c *Client) allow(addr string) error {
+	err := c.breaker(addr).allow()
+	if err != nil {
+		telemetry.PeerCircuitRejections.WithLabelValues(addr).Inc()
+	}
+	return err
+}
+
+// feeds gossip's view of a peer into its circuit breaker
+func (c *Client) SetPeerAlive(addr string, alive bool) {
+	c.breaker(addr).setAlive(alive)
+}
+
+// the circuit of every peer this node has called
+func (c *Client) Circuits() map[string]Circuit {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	circuits := make(map[string]Circuit, len(c.breakers))
+	for addr, b := range c.breakers {
+		circuits[addr] = b.status()
+	}
+	return circuits
+}
+
+// a failure of the peer rather than of the request: it could not be
+// reached or did not answer in time. errors the peer sent back mean it
+// is up
+func peerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// failures a retry may get past: the connection dropped or the peer was
+// restarting. a timeout is not retried, the peer is slow and another
+// attempt only adds to its load
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// calls fn on addr through the peer's circuit breaker, each attempt
+// bounded by timeout. idempotent calls are retried; replica Set, Delete
+// and BatchSet overwrite whatever the key holds, so a retry landing
+// after a newer write to the key would roll it back, and they are not
+func invoke[T any](ctx context.Context, c *Client, addr string, timeout time.Duration, idempotent bool,
+	fn func(context.Context, pb.NodeServiceClient) (T, error)) (T, error) {
+	var zero T
+
+	conn, err := c.getConn(addr)
+	if err != nil {
+		return zero, err
+	}
+
+	b := c.breaker(addr)
+	for attempt := 0; ; attempt++ {
+		if err := c.allow(addr); err != nil {
+			return zero, err
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		resp, err := fn(attemptCtx, pb.NewNodeServiceClient(conn))
+		cancel()
+
+		b.done(ctx, err)
+		if err == nil || !idempotent || !retryable(err) || attempt+1 >= c.opts.Retry.Attempts {
+			return resp, err
+		}
+
+		if err := c.backoff(ctx, attempt); err != nil {
+			return zero, err
+		}
+		telemetry.PeerRPCRetries.WithLabelValues(addr).Inc()
+	}
+}
+
+func (c *Client) backoff(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(backoffDelay(c.opts.Retry, attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// the wait before retry attempt+1: Backoff doubled per attempt up to
+// MaxBackoff, plus up to a quarter of jitter so nodes do not retry in
+// step
+func backoffDelay(opts RetryOptions, attempt int) time.Duration {
+	wait := opts.MaxBackoff
+	if attempt < 32 && opts.Backoff<<attempt > 0 {
+		wait = min(opts.Backoff<<attempt, opts.MaxBackoff)
+	}
+	return wait + time.Duration(rand.Int64N(int64(wait)/4+1))
+}
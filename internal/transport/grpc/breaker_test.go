@@ -0,0 +1,209 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errUnreachable = status.Error(codes.Unavailable, "connection refused")
+	errNotFound    = status.Error(codes.NotFound, "key not found")
+)
+
+func TestBreakerOpensAfterFailures(t *testing.T) {
+	b := newBreaker("peer-open", BreakerOptions{Failures: 3, Cooldown: time.Hour})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("call %d refused: %v", i, err)
+		}
+		b.done(ctx, errUnreachable)
+	}
+	if b.state != CircuitClosed {
+		t.Fatalf("state = %v after 2 failures, want closed", b.state)
+	}
+
+	// an answer from the peer, even an error, resets the count
+	b.done(ctx, errNotFound)
+	for i := 0; i < 3; i++ {
+		b.allow()
+		b.done(ctx, errUnreachable)
+	}
+	if b.state != CircuitOpen {
+		t.Fatalf("state = %v after 3 failures, want open", b.state)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow() = %v on an open circuit, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestBreakerIgnoresCallerCancellation(t *testing.T) {
+	b := newBreaker("peer-cancel", BreakerOptions{Failures: 1, Cooldown: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b.allow()
+	b.done(ctx, status.Error(codes.DeadlineExceeded, "deadline exceeded"))
+	if b.state != CircuitClosed {
+		t.Fatalf("state = %v after the caller gave up, want closed", b.state)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b := newBreaker("peer-probe", BreakerOptions{Failures: 1, Cooldown: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	b.allow()
+	b.done(ctx, errUnreachable)
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow() = %v during the cooldown, want %v", err, ErrCircuitOpen)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused after the cooldown: %v", err)
+	}
+	if b.state != CircuitHalfOpen {
+		t.Fatalf("state = %v while probing, want half-open", b.state)
+	}
+	// one probe at a time
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second probe allowed: %v", err)
+	}
+
+	// a failed probe opens the circuit again
+	b.done(ctx, errUnreachable)
+	if b.state != CircuitOpen {
+		t.Fatalf("state = %v after a failed probe, want open", b.state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	b.allow()
+	b.done(ctx, nil)
+	if b.state != CircuitClosed || b.failures != 0 {
+		t.Fatalf("state = %v, failures = %d after a good probe, want closed", b.state, b.failures)
+	}
+}
+
+func TestBreakerFollowsGossip(t *testing.T) {
+	b := newBreaker("peer-gossip", BreakerOptions{Failures: 5, Cooldown: time.Hour})
+
+	b.setAlive(false)
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow() = %v for a dead peer, want %v", err, ErrCircuitOpen)
+	}
+
+	// back alive: the next call probes without waiting out the cooldown
+	b.setAlive(true)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused once the peer is alive: %v", err)
+	}
+	b.done(context.Background(), nil)
+	if b.state != CircuitClosed {
+		t.Fatalf("state = %v, want closed", b.state)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	opts := RetryOptions{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{2, 40 * time.Millisecond},
+		{3, 50 * time.Millisecond},
+		{40, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			wait := backoffDelay(opts, tt.attempt)
+			if wait < tt.base || wait > tt.base+tt.base/4 {
+				t.Fatalf("backoffDelay(%d) = %v, want between %v and %v", tt.attempt, wait, tt.base, tt.base+tt.base/4)
+			}
+		}
+	}
+}
+
+// a peer whose first calls fail as if it could not be reached
+type flakyPeer struct {
+	pb.UnimplementedNodeServiceServer
+	failures atomic.Int32
+	calls    atomic.Int32
+}
+
+func (p *flakyPeer) fail() error {
+	p.calls.Add(1)
+	if p.failures.Add(-1) >= 0 {
+		return errUnreachable
+	}
+	return nil
+}
+
+func (p *flakyPeer) Get(context.Context, *pb.GetRequest) (*pb.GetResponse, error) {
+	if err := p.fail(); err != nil {
+		return nil, err
+	}
+	return &pb.GetResponse{Found: true}, nil
+}
+
+func (p *flakyPeer) Set(context.Context, *pb.SetRequest) (*pb.SetResponse, error) {
+	if err := p.fail(); err != nil {
+		return nil, err
+	}
+	return &pb.SetResponse{Success: true}, nil
+}
+
+func startPeer(t *testing.T, peer *flakyPeer) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	pb.RegisterNodeServiceServer(server, peer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func TestInvokeRetriesOnlyIdempotentCalls(t *testing.T) {
+	peer := &flakyPeer{}
+	addr := startPeer(t, peer)
+
+	client := NewClient(ClientOptions{Retry: RetryOptions{Attempts: 3, Backoff: time.Millisecond}})
+	defer client.Close()
+	ctx := context.Background()
+
+	peer.failures.Store(2)
+	if _, err := client.Get(ctx, addr, "k"); err != nil {
+		t.Fatalf("Get failed after retries: %v", err)
+	}
+	if n := peer.calls.Load(); n != 3 {
+		t.Errorf("Get made %d calls, want 3", n)
+	}
+
+	peer.calls.Store(0)
+	peer.failures.Store(1)
+	if _, err := client.Set(ctx, addr, &pb.Record{Key: "k"}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Set error = %v, want the first failure", err)
+	}
+	if n := peer.calls.Load(); n != 1 {
+		t.Errorf("Set made %d calls, want 1", n)
+	}
+}
@@ -2,22 +2,111 @@ package grpc
 
 import (
 	"context"
+	"crypto/tls"
+	"io"
 	"sync"
 	"time"
 
+	"github.com/AuraReaper/strangedb/internal/gossip"
 	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
+type ClientOptions struct {
+	// compressor for outgoing calls (gzip, snappy, zstd), empty for none
+	Compressor string
+	// sent with every call, for nodes restricting their node service
+	PeerSecret string
+	// dials over TLS when set, plaintext otherwise
+	TLS *tls.Config
+	// zero fields take the defaults
+	Timeouts  Timeouts
+	Breaker   BreakerOptions
+	Retry     RetryOptions
+	Keepalive KeepaliveOptions
+}
+
+// pings idle connections so a peer that vanished without closing them
+// is noticed before the next request waits on it
+type KeepaliveOptions struct {
+	Time    time.Duration // idle time before a ping, at least 10s
+	Timeout time.Duration // wait for the ping's answer
+}
+
+// how long each kind of replica RPC may take; a shorter deadline on the
+// caller's context wins
+type Timeouts struct {
+	Read      time.Duration // Get, GetChunk
+	Write     time.Duration // Set, Delete, DeleteChunks
+	Bulk      time.Duration // Scan, BatchSet, MergeBatch
+	Replicate time.Duration // batches shipped to a remote cluster
+}
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Read:      5 * time.Second,
+		Write:     5 * time.Second,
+		Bulk:      10 * time.Second,
+		Replicate: 30 * time.Second,
+	}
+}
+
+// size of the value slices a ReplicateLarge stream carries
+const replicateChunk = 1 << 20
+
 type Client struct {
-	mu    sync.RWMutex
-	conns map[string]*grpc.ClientConn
+	mu       sync.RWMutex
+	conns    map[string]*grpc.ClientConn
+	breakers map[string]*breaker
+	opts     ClientOptions
+
+	compression *compressorNegotiation
 }
 
-func NewClient() *Client {
+func NewClient(opts ClientOptions) *Client {
+	defaults := DefaultTimeouts()
+	if opts.Timeouts.Read <= 0 {
+		opts.Timeouts.Read = defaults.Read
+	}
+	if opts.Timeouts.Write <= 0 {
+		opts.Timeouts.Write = defaults.Write
+	}
+	if opts.Timeouts.Bulk <= 0 {
+		opts.Timeouts.Bulk = defaults.Bulk
+	}
+	if opts.Timeouts.Replicate <= 0 {
+		opts.Timeouts.Replicate = defaults.Replicate
+	}
+	if opts.Breaker.Failures <= 0 {
+		opts.Breaker.Failures = 5
+	}
+	if opts.Breaker.Cooldown <= 0 {
+		opts.Breaker.Cooldown = 5 * time.Second
+	}
+	if opts.Retry.Attempts <= 0 {
+		opts.Retry.Attempts = 3
+	}
+	if opts.Retry.Backoff <= 0 {
+		opts.Retry.Backoff = 50 * time.Millisecond
+	}
+	if opts.Retry.MaxBackoff <= 0 {
+		opts.Retry.MaxBackoff = time.Second
+	}
+	if opts.Keepalive.Time <= 0 {
+		opts.Keepalive.Time = 30 * time.Second
+	}
+	if opts.Keepalive.Timeout <= 0 {
+		opts.Keepalive.Timeout = 10 * time.Second
+	}
+
 	return &Client{
-		conns: make(map[string]*grpc.ClientConn),
+		compression: newCompressorNegotiation(opts.Compressor),
+		conns:       make(map[string]*grpc.ClientConn),
+		breakers:    make(map[string]*breaker),
+		opts:        opts,
 	}
 }
 
@@ -37,10 +126,36 @@ func (c *Client) getConn(address string) (*grpc.ClientConn, error) {
 		return conn, nil
 	}
 
-	conn, err := grpc.NewClient(address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(16*1024*1024)),
-	)
+	callOpts := []grpc.CallOption{grpc.MaxCallRecvMsgSize(16 * 1024 * 1024)}
+
+	creds := insecure.NewCredentials()
+	if c.opts.TLS != nil {
+		creds = credentials.NewTLS(c.opts.TLS)
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(callOpts...),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.opts.Keepalive.Time,
+			Timeout:             c.opts.Keepalive.Timeout,
+			PermitWithoutStream: true,
+		}),
+	}
+	if c.compression.preferred != "" {
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(c.compression.unary(address)),
+			grpc.WithChainStreamInterceptor(c.compression.stream(address)),
+		)
+	}
+	if c.opts.PeerSecret != "" {
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(peerSecretUnary(c.opts.PeerSecret)),
+			grpc.WithChainStreamInterceptor(peerSecretStream(c.opts.PeerSecret)),
+		)
+	}
+
+	conn, err := grpc.NewClient(address, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -50,38 +165,176 @@ func (c *Client) getConn(address string) (*grpc.ClientConn, error) {
 }
 
 func (c *Client) Get(ctx context.Context, address string, key string) (*pb.GetResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Read, true,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.GetResponse, error) {
+			return client.Get(ctx, &pb.GetRequest{
+				Key: key,
+			})
+		})
+}
+
+func (c *Client) Set(ctx context.Context, address string, record *pb.Record) (*pb.SetResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Write, false,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.SetResponse, error) {
+			return client.Set(ctx, &pb.SetRequest{
+				Record: record,
+			})
+		})
+}
+
+func (c *Client) Delete(ctx context.Context, address string, key string, timestamp *pb.Timestamp) (*pb.DeleteResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Write, false,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.DeleteResponse, error) {
+			return client.Delete(ctx, &pb.DeleteRequest{
+				Key:       key,
+				Timestamp: timestamp,
+			})
+		})
+}
+
+// opens a server stream of writes; the stream lives as long as ctx
+func (c *Client) Watch(ctx context.Context, address string, req *pb.WatchRequest) (pb.NodeService_WatchClient, error) {
 	conn, err := c.getConn(address)
 	if err != nil {
 		return nil, err
 	}
+	if err := c.allow(address); err != nil {
+		return nil, err
+	}
 
 	client := pb.NewNodeServiceClient(conn)
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	return client.Get(ctx, &pb.GetRequest{
-		Key: key,
-	})
+	stream, err := client.Watch(ctx, req)
+	c.breaker(address).done(ctx, err)
+	return stream, err
 }
 
-func (c *Client) Set(ctx context.Context, address string, record *pb.Record) (*pb.SetResponse, error) {
+// opens a client stream for the chunks of one upload
+func (c *Client) PutChunks(ctx context.Context, address string) (pb.NodeService_PutChunksClient, error) {
 	conn, err := c.getConn(address)
 	if err != nil {
 		return nil, err
 	}
+	if err := c.allow(address); err != nil {
+		return nil, err
+	}
 
 	client := pb.NewNodeServiceClient(conn)
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	stream, err := client.PutChunks(ctx)
+	c.breaker(address).done(ctx, err)
+	return stream, err
+}
+
+func (c *Client) GetChunk(ctx context.Context, address string, req *pb.GetChunkRequest) (*pb.GetChunkResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Read, true,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.GetChunkResponse, error) {
+			return client.GetChunk(ctx, req)
+		})
+}
+
+func (c *Client) DeleteChunks(ctx context.Context, address string, key string, uploadID string) (*pb.DeleteResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Write, false,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.DeleteResponse, error) {
+			return client.DeleteChunks(ctx, &pb.DeleteChunksRequest{
+				Key:      key,
+				UploadId: uploadID,
+			})
+		})
+}
+
+func (c *Client) Scan(ctx context.Context, address string, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Bulk, true,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.ScanResponse, error) {
+			return client.Scan(ctx, req)
+		})
+}
+
+func (c *Client) BatchSet(ctx context.Context, address string, records []*pb.Record) (*pb.BatchSetResponse, error) {
+	return c.batchSet(ctx, address, &pb.BatchSetRequest{Records: records})
+}
+
+// writes only the records newer than the replica's stored versions
+func (c *Client) MergeBatch(ctx context.Context, address string, records []*pb.Record) (*pb.BatchSetResponse, error) {
+	return c.batchSet(ctx, address, &pb.BatchSetRequest{Records: records, Merge: true})
+}
+
+// only a merge is retried: it keeps whichever version is newer, so a
+// retry cannot put back a record the first attempt already replaced
+func (c *Client) batchSet(ctx context.Context, address string, req *pb.BatchSetRequest) (*pb.BatchSetResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Bulk, req.Merge,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.BatchSetResponse, error) {
+			return client.BatchSet(ctx, req)
+		})
+}
+
+// ships writes to a node of another cluster, tagged with the id of the
+// cluster they come from
+func (c *Client) Replicate(ctx context.Context, address, clusterID string, records []*pb.Record) (*pb.ReplicateResponse, error) {
+	return invoke(ctx, c, address, c.opts.Timeouts.Replicate, true,
+		func(ctx context.Context, client pb.NodeServiceClient) (*pb.ReplicateResponse, error) {
+			return client.Replicate(ctx, &pb.ReplicateRequest{
+				ClusterId: clusterID,
+				Records:   records,
+			})
+		})
+}
+
+// ships a chunked value to a remote cluster: the manifest record, then
+// the value read from r. like PutChunks it has no timeout of its own,
+// the size of the value is unbounded
+func (c *Client) ReplicateLarge(ctx context.Context, address, clusterID string, record *pb.Record, r io.Reader) (*pb.ReplicateResponse, error) {
+	conn, err := c.getConn(address)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.allow(address); err != nil {
+		return nil, err
+	}
+
+	resp, err := replicateLarge(ctx, pb.NewNodeServiceClient(conn), clusterID, record, r)
+	c.breaker(address).done(ctx, err)
+	return resp, err
+}
+
+func replicateLarge(ctx context.Context, client pb.NodeServiceClient, clusterID string, record *pb.Record, r io.Reader) (*pb.ReplicateResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	return client.Set(ctx, &pb.SetRequest{
-		Record: record,
-	})
+	stream, err := client.ReplicateLarge(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &pb.ReplicateLargeRequest{ClusterId: clusterID, Record: record}
+	buf := make([]byte, replicateChunk)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			msg.Data = buf[:n]
+		}
+		done := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !done {
+			// cancelling the stream makes the remote drop the upload
+			return nil, err
+		}
+
+		if msg.Record != nil || len(msg.Data) > 0 {
+			if err := stream.Send(msg); err != nil {
+				return nil, err
+			}
+		}
+		if done {
+			return stream.CloseAndRecv()
+		}
+		msg = &pb.ReplicateLargeRequest{}
+	}
 }
 
-func (c *Client) Delete(ctx context.Context, address string, key string, timestamp *pb.Timestamp) (*pb.DeleteResponse, error) {
+// exchanges membership digests with a peer; it has the gossip.Transport
+// signature. it bypasses the circuit breakers, gossip is how a dead
+// peer is noticed coming back
+func (c *Client) Gossip(ctx context.Context, address string, members []gossip.MemberState) ([]gossip.MemberState, error) {
 	conn, err := c.getConn(address)
 	if err != nil {
 		return nil, err
@@ -89,13 +342,12 @@ func (c *Client) Delete(ctx context.Context, address string, key string, timesta
 
 	client := pb.NewNodeServiceClient(conn)
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+	resp, err := client.Gossip(ctx, MembersToProto(members))
+	if err != nil {
+		return nil, err
+	}
 
-	return client.Delete(ctx, &pb.DeleteRequest{
-		Key:       key,
-		Timestamp: timestamp,
-	})
+	return MembersFromProto(resp), nil
 }
 
 func (c *Client) Close() {
@@ -0,0 +1,225 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+)
+
+// names the compressors a node accepts in the header of its answers.
+// grpc's own grpc-accept-encoding only goes from client to server
+const acceptEncodingHeader = "strangedb-accept-encoding"
+
+// every compressor this build can read
+var supportedCompressors = []string{"gzip", "snappy", "zstd"}
+
+// registering a compressor lets the server accept it; the server answers
+// with whatever compressor the request used, so nodes configured
+// differently still talk to each other
+func init() {
+	encoding.RegisterCompressor(&zstdCompressor{})
+	encoding.RegisterCompressor(&snappyCompressor{})
+}
+
+func ValidateCompressor(name string) error {
+	if name == "" || name == "none" {
+		return nil
+	}
+
+	if encoding.GetCompressor(name) == nil {
+		return fmt.Errorf("unknown grpc compressor %q", name)
+	}
+
+	return nil
+}
+
+// tells callers which compressors this node reads
+func advertiseUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	grpc.SetHeader(ctx, metadata.Pairs(acceptEncodingHeader, strings.Join(supportedCompressors, ",")))
+	return handler(ctx, req)
+}
+
+func advertiseStream(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	stream.SetHeader(metadata.Pairs(acceptEncodingHeader, strings.Join(supportedCompressors, ",")))
+	return handler(srv, stream)
+}
+
+// picks the compressor of each call to a peer. a peer is sent the
+// configured compressor only once one of its answers listed it, so
+// nodes running a build without it, or one that predates the header,
+// are sent uncompressed calls and a compressor can be changed or added
+// one node at a time
+type compressorNegotiation struct {
+	preferred string
+
+	mu       sync.RWMutex
+	accepted map[string][]string // by peer address
+}
+
+func newCompressorNegotiation(preferred string) *compressorNegotiation {
+	if preferred == "none" {
+		preferred = ""
+	}
+	return &compressorNegotiation{
+		preferred: preferred,
+		accepted:  make(map[string][]string),
+	}
+}
+
+// the compressor for calls to addr, empty for none
+func (n *compressorNegotiation) choose(addr string) string {
+	if n.preferred == "" {
+		return ""
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, name := range n.accepted[addr] {
+		if name == n.preferred {
+			return name
+		}
+	}
+	return ""
+}
+
+// keeps what an answer of addr said it accepts; answers without the
+// header, like failed calls, change nothing
+func (n *compressorNegotiation) learn(addr string, header metadata.MD) {
+	values := header.Get(acceptEncodingHeader)
+	if len(values) == 0 {
+		return
+	}
+
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	n.mu.Lock()
+	n.accepted[addr] = names
+	n.mu.Unlock()
+}
+
+func (n *compressorNegotiation) unary(addr string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var header metadata.MD
+		opts = append(opts, grpc.Header(&header))
+		if name := n.choose(addr); name != "" {
+			opts = append(opts, grpc.UseCompressor(name))
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		n.learn(addr, header)
+		return err
+	}
+}
+
+// streams use what unary calls learned
+func (n *compressorNegotiation) stream(addr string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if name := n.choose(addr); name != "" {
+			opts = append(opts, grpc.UseCompressor(name))
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func (c *zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if enc, ok := c.encoders.Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+	}
+
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	if dec, ok := c.decoders.Get().(*zstd.Decoder); ok {
+		if err := dec.Reset(r); err != nil {
+			return nil, err
+		}
+		return &zstdReader{Decoder: dec, pool: &c.decoders}, nil
+	}
+
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &zstdReader{Decoder: dec, pool: &c.decoders}, nil
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+	pool     *sync.Pool
+	returned bool
+}
+
+// hands the decoder back to the pool once the message is fully read
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.returned {
+		return 0, io.EOF
+	}
+
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		r.returned = true
+		r.pool.Put(r.Decoder)
+	}
+	return n, err
+}
+
+type snappyCompressor struct{}
+
+func (c *snappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return s2.NewWriter(w, s2.WriterSnappyCompat()), nil
+}
+
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return s2.NewReader(r), nil
+}
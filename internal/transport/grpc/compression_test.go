@@ -0,0 +1,125 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+)
+
+func TestNegotiationChoosesAcceptedCompressor(t *testing.T) {
+	n := newCompressorNegotiation("zstd")
+
+	if got := n.choose("a"); got != "" {
+		t.Fatalf("choose() = %q for an unknown peer, want none", got)
+	}
+
+	n.learn("a", metadata.Pairs(acceptEncodingHeader, "gzip, zstd"))
+	n.learn("b", metadata.Pairs(acceptEncodingHeader, "gzip"))
+	if got := n.choose("a"); got != "zstd" {
+		t.Fatalf("choose() = %q for a peer accepting zstd, want zstd", got)
+	}
+	if got := n.choose("b"); got != "" {
+		t.Fatalf("choose() = %q for a peer without zstd, want none", got)
+	}
+
+	// an answer without the header keeps what was learned
+	n.learn("a", metadata.MD{})
+	if got := n.choose("a"); got != "zstd" {
+		t.Fatalf("choose() = %q after an answer without the header, want zstd", got)
+	}
+
+	if got := newCompressorNegotiation("none").choose("a"); got != "" {
+		t.Fatalf("choose() = %q with compression off, want none", got)
+	}
+}
+
+// records the compressor of each request a server reads
+type compressionRecorder struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (r *compressionRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if header, ok := s.(*stats.InHeader); ok {
+		r.mu.Lock()
+		r.seen = append(r.seen, header.Compression)
+		r.mu.Unlock()
+	}
+}
+
+func (r *compressionRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func (r *compressionRecorder) compressors() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.seen...)
+}
+
+func startRecordingPeer(t *testing.T, advertise bool) (string, *compressionRecorder) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &compressionRecorder{}
+	opts := []grpc.ServerOption{grpc.StatsHandler(recorder)}
+	if advertise {
+		opts = append(opts, grpc.ChainUnaryInterceptor(advertiseUnary))
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterNodeServiceServer(server, &flakyPeer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String(), recorder
+}
+
+func TestClientCompressesOnceThePeerAccepts(t *testing.T) {
+	tests := []struct {
+		name      string
+		advertise bool
+		want      []string
+	}{
+		{"peer advertises", true, []string{"", "zstd", "zstd"}},
+		{"peer predates the header", false, []string{"", "", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, recorder := startRecordingPeer(t, tt.advertise)
+
+			client := NewClient(ClientOptions{Compressor: "zstd"})
+			defer client.Close()
+
+			for i := range tt.want {
+				if _, err := client.Get(context.Background(), addr, "k"); err != nil {
+					t.Fatalf("call %d failed: %v", i, err)
+				}
+			}
+
+			got := recorder.compressors()
+			if len(got) != len(tt.want) {
+				t.Fatalf("server read %d requests, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("request %d compressed with %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"github.com/AuraReaper/strangedb/internal/gossip"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+)
+
+func TimestampToProto(ts hlc.Timestamp) *pb.Timestamp {
+	return &pb.Timestamp{
+		WallTime: ts.WallTime,
+		Logical:  ts.Logical,
+		NodeId:   ts.NodeID,
+	}
+}
+
+func TimestampFromProto(ts *pb.Timestamp) hlc.Timestamp {
+	if ts == nil {
+		return hlc.Timestamp{}
+	}
+
+	return hlc.Timestamp{
+		WallTime: ts.WallTime,
+		Logical:  ts.Logical,
+		NodeID:   ts.NodeId,
+	}
+}
+
+func RecordToProto(record *storage.Record) *pb.Record {
+	return &pb.Record{
+		Key:         record.Key,
+		Value:       record.Value,
+		Timestamp:   TimestampToProto(record.Timestamp),
+		Tombstone:   record.Tombstone,
+		ContentType: record.ContentType,
+		Manifest:    record.Manifest,
+		Origin:      record.Origin,
+		ExpiresAt:   record.ExpiresAt,
+	}
+}
+
+func RecordFromProto(record *pb.Record) *storage.Record {
+	return &storage.Record{
+		Key:         record.Key,
+		Value:       record.Value,
+		Timestamp:   TimestampFromProto(record.Timestamp),
+		Tombstone:   record.Tombstone,
+		ContentType: record.ContentType,
+		Manifest:    record.Manifest,
+		Origin:      record.Origin,
+		ExpiresAt:   record.ExpiresAt,
+	}
+}
+
+func MembersToProto(members []gossip.MemberState) *pb.GossipMessage {
+	msg := &pb.GossipMessage{Members: make([]*pb.MemberState, len(members))}
+	for i, m := range members {
+		msg.Members[i] = &pb.MemberState{
+			NodeUrl:     m.NodeURL,
+			Heartbeat:   m.Heartbeat,
+			Dc:          m.DC,
+			Rack:        m.Rack,
+			Partitioner: m.Partitioner,
+			Weight:      m.Weight,
+		}
+	}
+
+	return msg
+}
+
+func MembersFromProto(msg *pb.GossipMessage) []gossip.MemberState {
+	members := make([]gossip.MemberState, len(msg.Members))
+	for i, m := range msg.Members {
+		members[i] = gossip.MemberState{
+			NodeURL:     m.NodeUrl,
+			Heartbeat:   m.Heartbeat,
+			DC:          m.Dc,
+			Rack:        m.Rack,
+			Partitioner: m.Partitioner,
+			Weight:      m.Weight,
+		}
+	}
+
+	return members
+}
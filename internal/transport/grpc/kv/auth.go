@@ -0,0 +1,91 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AuraReaper/strangedb/internal/audit"
+	"github.com/AuraReaper/strangedb/internal/auth"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	ReasonUnauthenticated  = "UNAUTHENTICATED"
+	ReasonPermissionDenied = "PERMISSION_DENIED"
+)
+
+// authenticates callers by the bearer token in their authorization
+// metadata, like the http api, logging denied calls to log; nil lets
+// every call through
+func (s *Service) SetAuth(a *auth.Authenticator, log zerolog.Logger) {
+	s.auth = a
+	s.authLog = log
+}
+
+// records denied calls next to the writes
+func (s *Service) SetAuditLog(l *audit.Log) {
+	s.auditLog = l
+}
+
+// checks the caller's access to every key, or to every key under a
+// prefix, and names the caller for the audit log. AccessNone only
+// requires a valid token
+func (s *Service) authorize(ctx context.Context, method string, access auth.Access, keys ...string) (context.Context, error) {
+	if s.auth == nil {
+		return ctx, nil
+	}
+
+	principal, err := s.auth.Authenticate(bearerToken(ctx))
+	if err != nil {
+		s.logDenied(ctx, method, nil, auth.AccessNone, "", err.Error())
+		return nil, newStatus(codes.Unauthenticated, ReasonUnauthenticated, err.Error(), nil)
+	}
+
+	if access != auth.AccessNone {
+		for _, key := range keys {
+			if principal.Can(access, key) {
+				continue
+			}
+
+			msg := fmt.Sprintf("%s access to %q denied", access, key)
+			s.logDenied(ctx, method, principal, access, key, "insufficient role")
+			if s.auditLog != nil {
+				s.auditLog.RecordAs(principal.Name, method, key, errors.New(msg))
+			}
+			return nil, newStatus(codes.PermissionDenied, ReasonPermissionDenied, msg, map[string]string{"key": key})
+		}
+	}
+
+	return audit.WithPrincipal(ctx, principal.Name), nil
+}
+
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range md.Get("authorization") {
+		if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+			return strings.TrimSpace(header[7:])
+		}
+	}
+	return ""
+}
+
+// logs a denied call the way the http api logs a denied request
+func (s *Service) logDenied(ctx context.Context, method string, principal *auth.Principal, access auth.Access, key, reason string) {
+	event := s.authLog.Warn().
+		Str("method", method).
+		Str("ip", clientID(ctx)).
+		Str("reason", reason)
+
+	if principal != nil {
+		event = event.Str("principal", principal.Name).Strs("roles", principal.Roles)
+	}
+	if access != auth.AccessNone {
+		event = event.Str("access", access.String()).Str("key", key)
+	}
+
+	event.Msg("request denied")
+}
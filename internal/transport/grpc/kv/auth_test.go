@@ -0,0 +1,69 @@
+package kv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/auth"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func testAuthenticator(t *testing.T) *auth.Authenticator {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	cfg := `{
+		"roles": {"orders": [{"namespace": "orders", "access": "write"}]},
+		"tokens": [{"name": "ci", "sha256": "` + auth.HashToken("ci-token") + `", "roles": ["orders"]}]
+	}`
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatalf("Failed to write auth file: %v", err)
+	}
+
+	a, err := auth.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load auth file: %v", err)
+	}
+	return a
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestCallsNeedCredentials(t *testing.T) {
+	s := NewService(nil, nil, nil)
+	s.SetAuth(testAuthenticator(t), zerolog.Nop())
+
+	for name, ctx := range map[string]context.Context{
+		"no token":  context.Background(),
+		"bad token": withToken("wrong"),
+	} {
+		if _, err := s.Get(ctx, &pb.KVGetRequest{Key: "orders:1"}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Get with %s: expected Unauthenticated, got %v", name, err)
+		}
+		if _, err := s.Topology(ctx, &pb.TopologyRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Topology with %s: expected Unauthenticated, got %v", name, err)
+		}
+	}
+
+	ctx := withToken("ci-token")
+	if _, err := s.Set(ctx, &pb.KVSetRequest{Key: "users:1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Set outside the role: expected PermissionDenied, got %v", err)
+	}
+	if _, err := s.Scan(ctx, &pb.KVScanRequest{Limit: 10}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Scan of every key: expected PermissionDenied, got %v", err)
+	}
+	batch := &pb.KVBatchRequest{Records: []*pb.Record{{Key: "orders:1"}, {Key: "users:1"}}}
+	if _, err := s.Batch(ctx, batch); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Batch touching another namespace: expected PermissionDenied, got %v", err)
+	}
+
+	if _, err := s.authorize(ctx, "Set", auth.AccessWrite, "orders:1"); err != nil {
+		t.Errorf("Set within the role was denied: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const errorDomain = "strangedb"
+
+// reasons carried in the ErrorInfo of every error, so clients can tell
+// causes apart without parsing messages
+const (
+	ReasonKeyNotFound        = "KEY_NOT_FOUND"
+	ReasonQuorumNotReached   = "QUORUM_NOT_REACHED"
+	ReasonNoNodesAvailable   = "NO_NODES_AVAILABLE"
+	ReasonInvalidConsistency = "INVALID_CONSISTENCY"
+	ReasonInvalidArgument    = "INVALID_ARGUMENT"
+	ReasonRateLimited        = "RATE_LIMITED"
+	ReasonQuotaExceeded      = "QUOTA_EXCEEDED"
+	ReasonOverloaded         = "OVERLOADED"
+	ReasonTimeout            = "TIMEOUT"
+	ReasonValueTooLarge      = "VALUE_TOO_LARGE"
+	ReasonInternal           = "INTERNAL"
+)
+
+func newStatus(code codes.Code, reason, msg string, metadata map[string]string) error {
+	st, err := status.New(code, msg).WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   errorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+func invalidArgument(field, msg string) error {
+	st, err := status.New(codes.InvalidArgument, msg).WithDetails(
+		&errdetails.ErrorInfo{Reason: ReasonInvalidArgument, Domain: errorDomain},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: msg},
+		}},
+	)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	return st.Err()
+}
+
+func notFound(key string) error {
+	return newStatus(codes.NotFound, ReasonKeyNotFound, "key not found", map[string]string{"key": key})
+}
+
+// maps coordinator and storage errors to grpc codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrKeyNotFound), errors.Is(err, storage.ErrKeyDeleted):
+		return newStatus(codes.NotFound, ReasonKeyNotFound, err.Error(), nil)
+	case errors.Is(err, coordinator.ErrQuorumNotReached):
+		return newStatus(codes.Unavailable, ReasonQuorumNotReached, err.Error(), nil)
+	case errors.Is(err, coordinator.ErrNoNodesAvailable):
+		return newStatus(codes.Unavailable, ReasonNoNodesAvailable, err.Error(), nil)
+	case errors.Is(err, coordinator.ErrOverloaded):
+		return newStatus(codes.Unavailable, ReasonOverloaded, err.Error(), nil)
+	case errors.Is(err, coordinator.ErrTimeout):
+		return newStatus(codes.DeadlineExceeded, ReasonTimeout, err.Error(), nil)
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return newStatus(codes.ResourceExhausted, ReasonQuotaExceeded, err.Error(), nil)
+	case errors.Is(err, coordinator.ErrInvalidConsistency):
+		return newStatus(codes.InvalidArgument, ReasonInvalidConsistency, err.Error(), nil)
+	case errors.Is(err, coordinator.ErrClockSkew):
+		return newStatus(codes.InvalidArgument, ReasonInvalidArgument, err.Error(), nil)
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return newStatus(codes.Internal, ReasonInternal, err.Error(), nil)
+	}
+}
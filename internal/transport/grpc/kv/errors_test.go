@@ -0,0 +1,121 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/ratelimit"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func errorInfo(err error) *errdetails.ErrorInfo {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		{storage.ErrKeyNotFound, codes.NotFound, ReasonKeyNotFound},
+		{storage.ErrKeyDeleted, codes.NotFound, ReasonKeyNotFound},
+		{coordinator.ErrQuorumNotReached, codes.Unavailable, ReasonQuorumNotReached},
+		{coordinator.ErrNoNodesAvailable, codes.Unavailable, ReasonNoNodesAvailable},
+		{coordinator.ErrOverloaded, codes.Unavailable, ReasonOverloaded},
+		{coordinator.ErrTimeout, codes.DeadlineExceeded, ReasonTimeout},
+		{storage.ErrQuotaExceeded, codes.ResourceExhausted, ReasonQuotaExceeded},
+		{coordinator.ErrInvalidConsistency, codes.InvalidArgument, ReasonInvalidConsistency},
+		{coordinator.ErrClockSkew, codes.InvalidArgument, ReasonInvalidArgument},
+		{context.DeadlineExceeded, codes.DeadlineExceeded, ""},
+		{context.Canceled, codes.Canceled, ""},
+		{errors.New("disk on fire"), codes.Internal, ReasonInternal},
+	}
+
+	for _, tt := range tests {
+		// coordinator errors usually arrive wrapped
+		for _, err := range []error{tt.err, fmt.Errorf("key k: %w", tt.err)} {
+			t.Run(err.Error(), func(t *testing.T) {
+				got := toStatus(err)
+
+				if code := status.Code(got); code != tt.code {
+					t.Errorf("code = %s, want %s", code, tt.code)
+				}
+				info := errorInfo(got)
+				if tt.reason == "" {
+					if info != nil {
+						t.Errorf("reason = %s, want none", info.Reason)
+					}
+					return
+				}
+				if info == nil || info.Reason != tt.reason || info.Domain != errorDomain {
+					t.Errorf("error info = %v, want %s in %s", info, tt.reason, errorDomain)
+				}
+				if msg := status.Convert(got).Message(); msg != err.Error() {
+					t.Errorf("message = %q, want %q", msg, err.Error())
+				}
+			})
+		}
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	err := notFound("users:1")
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("notFound code = %s, want NotFound", status.Code(err))
+	}
+	if info := errorInfo(err); info == nil || info.Reason != ReasonKeyNotFound || info.Metadata["key"] != "users:1" {
+		t.Errorf("notFound error info = %v, want %s for users:1", info, ReasonKeyNotFound)
+	}
+
+	err = invalidArgument("limit", "limit must be between 1 and 10000")
+	if status.Code(err) != codes.InvalidArgument || errorInfo(err).GetReason() != ReasonInvalidArgument {
+		t.Errorf("invalidArgument = %v, want InvalidArgument %s", err, ReasonInvalidArgument)
+	}
+	var field string
+	for _, detail := range status.Convert(err).Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok && len(br.FieldViolations) == 1 {
+			field = br.FieldViolations[0].Field
+		}
+	}
+	if field != "limit" {
+		t.Errorf("field violation on %q, want limit", field)
+	}
+}
+
+func TestRateLimitedStatus(t *testing.T) {
+	s := testService(t)
+	s.SetLimiter(ratelimit.NewLimiter(&ratelimit.Config{
+		Default: &ratelimit.Rate{PerSecond: 1, Burst: 1},
+	}))
+	ctx := context.Background()
+
+	if err := s.allow(ctx, 1, "k"); err != nil {
+		t.Fatalf("first call limited: %v", err)
+	}
+	err := s.allow(ctx, 1, "k")
+	if status.Code(err) != codes.ResourceExhausted || errorInfo(err).GetReason() != ReasonRateLimited {
+		t.Fatalf("allow = %v, want ResourceExhausted %s", err, ReasonRateLimited)
+	}
+
+	var retry *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if r, ok := detail.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() <= 0 {
+		t.Errorf("retry info = %v, want a delay", retry)
+	}
+}
@@ -0,0 +1,65 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/AuraReaper/strangedb/internal/ratelimit"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// throttles callers per client address and namespace; nil limits nothing
+func (s *Service) SetLimiter(l *ratelimit.Limiter) {
+	s.limiter = l
+}
+
+// takes cost tokens from the caller and the namespaces of keys, or
+// fails with ResourceExhausted carrying how long to wait in RetryInfo
+func (s *Service) allow(ctx context.Context, cost int, keys ...string) error {
+	if s.limiter == nil {
+		return nil
+	}
+
+	var namespaces []string
+	for _, key := range keys {
+		if ns := storage.Namespace(key); !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	retryAfter, ok := s.limiter.Allow(clientID(ctx), namespaces, cost)
+	if ok {
+		return nil
+	}
+
+	msg := fmt.Sprintf("rate limit exceeded, retry in %s", retryAfter)
+	st, err := status.New(codes.ResourceExhausted, msg).WithDetails(
+		&errdetails.ErrorInfo{Reason: ReasonRateLimited, Domain: errorDomain},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+	return st.Err()
+}
+
+// the host of the caller; the service has no credentials to go by
+func clientID(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
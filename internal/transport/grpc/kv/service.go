@@ -0,0 +1,334 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/AuraReaper/strangedb/internal/audit"
+	"github.com/AuraReaper/strangedb/internal/auth"
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/gossip"
+	"github.com/AuraReaper/strangedb/internal/ratelimit"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+)
+
+const maxScanLimit = 10000
+
+// the largest value Get returns by default; one response carries it
+// whole
+const DefaultMaxValueSize = 16 * 1024 * 1024
+
+// the client facing grpc api, served next to the node service. every
+// request is coordinated by this node, like the http api
+type Service struct {
+	pb.UnimplementedKVServiceServer
+	coordinator *coordinator.Coordinator
+	ring        *ring.ConsistentHashRing
+	gossiper    *gossip.Gossiper
+	limiter     *ratelimit.Limiter
+	auth        *auth.Authenticator
+	auditLog    *audit.Log
+	// where denied calls are logged
+	authLog zerolog.Logger
+	// largest value Get assembles from chunks
+	maxValueSize int64
+}
+
+func NewService(coord *coordinator.Coordinator, ring *ring.ConsistentHashRing, gossiper *gossip.Gossiper) *Service {
+	return &Service{
+		coordinator:  coord,
+		ring:         ring,
+		gossiper:     gossiper,
+		authLog:      zerolog.Nop(),
+		maxValueSize: DefaultMaxValueSize,
+	}
+}
+
+// sets the largest value Get returns; larger ones fail with
+// VALUE_TOO_LARGE and are read over HTTP
+func (s *Service) SetMaxValueSize(n int64) {
+	s.maxValueSize = n
+}
+
+func consistencyContext(ctx context.Context, consistency string) (context.Context, error) {
+	level, err := coordinator.ParseConsistency(consistency)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return coordinator.WithConsistency(ctx, level), nil
+}
+
+func (s *Service) Get(ctx context.Context, req *pb.KVGetRequest) (*pb.KVGetResponse, error) {
+	if req.Key == "" {
+		return nil, invalidArgument("key", "key is required")
+	}
+	ctx, err := s.authorize(ctx, "Get", auth.AccessRead, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.allow(ctx, 1, req.Key); err != nil {
+		return nil, err
+	}
+
+	ctx, err = consistencyContext(ctx, req.Consistency)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.coordinator.Get(ctx, req.Key)
+	if err == storage.ErrKeyNotFound || err == storage.ErrKeyDeleted {
+		return nil, notFound(req.Key)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	// large values are assembled here, the client sees a plain record
+	if record.Manifest {
+		r, manifest, err := s.coordinator.OpenLarge(ctx, record)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		if manifest.Size > s.maxValueSize {
+			return nil, newStatus(codes.FailedPrecondition, ReasonValueTooLarge,
+				fmt.Sprintf("value of %d bytes is over the %d byte limit of Get, read it over HTTP", manifest.Size, s.maxValueSize),
+				map[string]string{"key": req.Key, "size": strconv.FormatInt(manifest.Size, 10)})
+		}
+		value, err := io.ReadAll(r)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+
+		record = &storage.Record{
+			Key:         record.Key,
+			Value:       value,
+			Timestamp:   record.Timestamp,
+			ContentType: record.ContentType,
+		}
+	}
+
+	return &pb.KVGetResponse{
+		Record: grpcTransport.RecordToProto(record),
+	}, nil
+}
+
+func (s *Service) Set(ctx context.Context, req *pb.KVSetRequest) (*pb.KVSetResponse, error) {
+	if req.Key == "" {
+		return nil, invalidArgument("key", "key is required")
+	}
+	ctx, err := s.authorize(ctx, "Set", auth.AccessWrite, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.allow(ctx, 1, req.Key); err != nil {
+		return nil, err
+	}
+
+	ctx, err = consistencyContext(ctx, req.Consistency)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.coordinator.Set(ctx, req.Key, req.Value, req.ContentType)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.KVSetResponse{
+		Timestamp: grpcTransport.TimestampToProto(record.Timestamp),
+	}, nil
+}
+
+func (s *Service) Delete(ctx context.Context, req *pb.KVDeleteRequest) (*pb.KVDeleteResponse, error) {
+	if req.Key == "" {
+		return nil, invalidArgument("key", "key is required")
+	}
+	ctx, err := s.authorize(ctx, "Delete", auth.AccessWrite, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.allow(ctx, 1, req.Key); err != nil {
+		return nil, err
+	}
+
+	ctx, err = consistencyContext(ctx, req.Consistency)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.coordinator.Delete(ctx, req.Key); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.KVDeleteResponse{}, nil
+}
+
+func (s *Service) Scan(ctx context.Context, req *pb.KVScanRequest) (*pb.KVScanResponse, error) {
+	if req.Limit == 0 || req.Limit > maxScanLimit {
+		return nil, invalidArgument("limit", "limit must be between 1 and 10000")
+	}
+	ctx, err := s.authorize(ctx, "Scan", auth.AccessRead, req.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.allow(ctx, 1, req.Prefix); err != nil {
+		return nil, err
+	}
+
+	page, err := s.coordinator.Scan(ctx, req.Prefix, req.After, int(req.Limit))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.KVScanResponse{
+		Records: make([]*pb.Record, len(page.Records)),
+		Next:    page.Next,
+	}
+	for i, record := range page.Records {
+		resp.Records[i] = grpcTransport.RecordToProto(record)
+	}
+
+	return resp, nil
+}
+
+func (s *Service) Batch(ctx context.Context, req *pb.KVBatchRequest) (*pb.KVBatchResponse, error) {
+	records := make([]*storage.Record, len(req.Records))
+	keys := make([]string, len(req.Records))
+	for i, r := range req.Records {
+		if r.Key == "" {
+			return nil, invalidArgument("key", "key is required")
+		}
+		// the coordinator stamps the write; manifests, origins, tombstones
+		// and expiry are not the client's to set
+		records[i] = &storage.Record{
+			Key:         r.Key,
+			Value:       r.Value,
+			ContentType: r.ContentType,
+		}
+		keys[i] = r.Key
+	}
+	ctx, err := s.authorize(ctx, "Batch", auth.AccessWrite, keys...)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.allow(ctx, len(records), keys...); err != nil {
+		return nil, err
+	}
+
+	ctx, err = consistencyContext(ctx, req.Consistency)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.coordinator.Batch(ctx, records)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.KVBatchResponse{
+		Written: uint32(result.Written),
+		Failed:  result.Failed,
+	}, nil
+}
+
+// streams writes to a key or prefix until the client goes away. large
+// values arrive as their manifest; read them with Get
+func (s *Service) Watch(req *pb.WatchRequest, stream pb.KVService_WatchServer) error {
+	if req.Key == "" && req.Prefix == "" {
+		return invalidArgument("key", "key or prefix is required")
+	}
+	if req.Key != "" && req.Prefix != "" {
+		return invalidArgument("prefix", "key and prefix are mutually exclusive")
+	}
+	ctx, err := s.authorize(stream.Context(), "Watch", auth.AccessRead, req.Key+req.Prefix)
+	if err != nil {
+		return err
+	}
+	if err := s.allow(ctx, 1, req.Key+req.Prefix); err != nil {
+		return err
+	}
+
+	watch, err := s.coordinator.Watch(ctx, coordinator.WatchOptions{
+		Key:    req.Key,
+		Prefix: req.Prefix,
+		Since:  grpcTransport.TimestampFromProto(req.Since),
+	})
+	if err != nil {
+		return toStatus(err)
+	}
+
+	events, replayed := watch.Events(), watch.Replayed()
+	if !req.MarkReplayed {
+		replayed = nil
+	}
+	for events != nil {
+		select {
+		case <-replayed:
+			replayed = nil
+			if err := stream.Send(&pb.WatchEvent{Replayed: true}); err != nil {
+				return err
+			}
+		case record, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if err := stream.Send(&pb.WatchEvent{Record: grpcTransport.RecordToProto(record)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// what a client needs to build its own copy of the ring
+func (s *Service) Topology(ctx context.Context, req *pb.TopologyRequest) (*pb.TopologyResponse, error) {
+	if _, err := s.authorize(ctx, "Topology", auth.AccessNone); err != nil {
+		return nil, err
+	}
+
+	var members map[string]gossip.Member
+	if s.gossiper != nil {
+		members = s.gossiper.GetAllMembers()
+	}
+
+	resp := &pb.TopologyResponse{
+		Partitioner: s.ring.Partitioner().Name(),
+		Vnodes:      uint32(s.ring.VNodes()),
+		Replication: uint32(s.coordinator.ReplicationN()),
+	}
+
+	if dcReplication := s.ring.DCReplication(); len(dcReplication) > 0 {
+		resp.DcReplication = make(map[string]uint32, len(dcReplication))
+		for dc, n := range dcReplication {
+			resp.DcReplication[dc] = uint32(n)
+		}
+	}
+
+	for _, addr := range s.ring.GetNodes() {
+		state := "unknown"
+		if member, ok := members[addr]; ok {
+			state = member.State.String()
+		}
+
+		topology := s.ring.Topology(addr)
+		resp.Nodes = append(resp.Nodes, &pb.NodeInfo{
+			Addr:   addr,
+			Dc:     topology.DC,
+			Rack:   topology.Rack,
+			Weight: s.ring.Weight(addr),
+			State:  state,
+		})
+	}
+
+	return resp, nil
+}
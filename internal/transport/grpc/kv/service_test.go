@@ -0,0 +1,64 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the service of a one node cluster
+func testService(t *testing.T) *Service {
+	store := storage.NewBadgerStorage(t.TempDir())
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	const node = "localhost:0"
+	hashring := ring.New(10)
+	hashring.AddNode(node)
+	client := grpcTransport.NewClient(grpcTransport.ClientOptions{})
+	t.Cleanup(client.Close)
+
+	coord := coordinator.New(node, hashring, store, hlc.NewClock(node), client, 1, 1, 1, zerolog.Nop())
+	return NewService(coord, hashring, nil)
+}
+
+// the ErrorInfo reason of a status error
+func reason(err error) string {
+	return errorInfo(err).GetReason()
+}
+
+func TestGetLimitsChunkedValues(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	large := bytes.Repeat([]byte("0123456789"), coordinator.ChunkSize/4)
+	if _, err := s.coordinator.SetLarge(ctx, "blob", bytes.NewReader(large), ""); err != nil {
+		t.Fatalf("SetLarge failed: %v", err)
+	}
+
+	resp, err := s.Get(ctx, &pb.KVGetRequest{Key: "blob"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(resp.Record.Value, large) {
+		t.Errorf("Get returned %d bytes, want %d", len(resp.Record.Value), len(large))
+	}
+
+	s.SetMaxValueSize(coordinator.ChunkSize)
+	_, err = s.Get(ctx, &pb.KVGetRequest{Key: "blob"})
+	if status.Code(err) != codes.FailedPrecondition || reason(err) != ReasonValueTooLarge {
+		t.Errorf("Get over the limit error = %v, want FailedPrecondition %s", err, ReasonValueTooLarge)
+	}
+}
@@ -0,0 +1,93 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// metadata nodes send the cluster secret in
+const peerSecretHeader = "x-strangedb-peer-secret"
+
+var nodeServicePrefix = "/" + pb.NodeService_ServiceDesc.ServiceName + "/"
+
+var errNotPeer = status.Error(codes.PermissionDenied, "node service is restricted to cluster peers")
+
+// whether a call may use method; only node service methods need the
+// secret and a peer certificate, client facing services are open
+func (s *Server) authorizePeer(ctx context.Context, method string) error {
+	if !strings.HasPrefix(method, nodeServicePrefix) {
+		return nil
+	}
+
+	if s.peerCerts && !hasPeerCertificate(ctx) {
+		return errNotPeer
+	}
+
+	if s.peerSecret == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, secret := range md.Get(peerSecretHeader) {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(s.peerSecret)) == 1 {
+			return nil
+		}
+	}
+
+	return errNotPeer
+}
+
+// the handshake already refused certificates the CA did not sign, so
+// any certificate here is a cluster peer's
+func hasPeerCertificate(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	return ok && len(info.State.PeerCertificates) > 0
+}
+
+func (s *Server) peerUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (any, error) {
+	if err := s.authorizePeer(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) peerStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if err := s.authorizePeer(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func withPeerSecret(ctx context.Context, secret string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, peerSecretHeader, secret)
+}
+
+func peerSecretUnary(secret string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withPeerSecret(ctx, secret), method, req, reply, cc, opts...)
+	}
+}
+
+func peerSecretStream(secret string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withPeerSecret(ctx, secret), desc, cc, method, opts...)
+	}
+}
@@ -82,11 +82,16 @@ func (x *Timestamp) GetNodeId() string {
 }
 
 type Record struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
-	Timestamp     *Timestamp             `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	Tombstone     bool                   `protobuf:"varint,4,opt,name=tombstone,proto3" json:"tombstone,omitempty"`
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Key         string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value       []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp   *Timestamp             `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Tombstone   bool                   `protobuf:"varint,4,opt,name=tombstone,proto3" json:"tombstone,omitempty"`
+	ContentType string                 `protobuf:"bytes,5,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Manifest    bool                   `protobuf:"varint,6,opt,name=manifest,proto3" json:"manifest,omitempty"`
+	Origin      string                 `protobuf:"bytes,7,opt,name=origin,proto3" json:"origin,omitempty"`
+	// wall time in nanoseconds the record expires at, 0 for never
+	ExpiresAt     int64 `protobuf:"varint,8,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -149,6 +154,34 @@ func (x *Record) GetTombstone() bool {
 	return false
 }
 
+func (x *Record) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Record) GetManifest() bool {
+	if x != nil {
+		return x.Manifest
+	}
+	return false
+}
+
+func (x *Record) GetOrigin() string {
+	if x != nil {
+		return x.Origin
+	}
+	return ""
+}
+
+func (x *Record) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
 type GetRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
@@ -437,41 +470,1771 @@ func (x *DeleteResponse) GetSuccess() bool {
 	return false
 }
 
-var File_internal_transport_grpc_proto_node_proto protoreflect.FileDescriptor
+type WatchRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Key    string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Prefix string                 `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Since  *Timestamp             `protobuf:"bytes,3,opt,name=since,proto3" json:"since,omitempty"`
+	// asks for an event with replayed set once the writes after since
+	// were all sent. they come in key order, not timestamp order, so a
+	// watch can only resume from the newest timestamp after that
+	MarkReplayed  bool `protobuf:"varint,4,opt,name=mark_replayed,json=markReplayed,proto3" json:"mark_replayed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_internal_transport_grpc_proto_node_proto_rawDesc = "" +
-	"\n" +
-	"(internal/transport/grpc/proto/node.proto\x12\tstrangedb\"[\n" +
-	"\tTimestamp\x12\x1b\n" +
-	"\twall_time\x18\x01 \x01(\x03R\bwallTime\x12\x18\n" +
-	"\alogical\x18\x02 \x01(\rR\alogical\x12\x17\n" +
-	"\anode_id\x18\x03 \x01(\tR\x06nodeId\"\x82\x01\n" +
-	"\x06Record\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\fR\x05value\x122\n" +
-	"\ttimestamp\x18\x03 \x01(\v2\x14.strangedb.TimestampR\ttimestamp\x12\x1c\n" +
-	"\ttombstone\x18\x04 \x01(\bR\ttombstone\"\x1e\n" +
-	"\n" +
-	"GetRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\"N\n" +
-	"\vGetResponse\x12\x14\n" +
-	"\x05found\x18\x01 \x01(\bR\x05found\x12)\n" +
-	"\x06record\x18\x02 \x01(\v2\x11.strangedb.RecordR\x06record\"7\n" +
-	"\n" +
-	"SetRequest\x12)\n" +
-	"\x06record\x18\x01 \x01(\v2\x11.strangedb.RecordR\x06record\"[\n" +
-	"\vSetResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\x122\n" +
-	"\ttimestamp\x18\x02 \x01(\v2\x14.strangedb.TimestampR\ttimestamp\"U\n" +
-	"\rDeleteRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x122\n" +
-	"\ttimestamp\x18\x02 \x01(\v2\x14.strangedb.TimestampR\ttimestamp\"*\n" +
-	"\x0eDeleteResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess2\xb8\x01\n" +
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *WatchRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *WatchRequest) GetSince() *Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *WatchRequest) GetMarkReplayed() bool {
+	if x != nil {
+		return x.MarkReplayed
+	}
+	return false
+}
+
+type WatchEvent struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Record *Record                `protobuf:"bytes,1,opt,name=record,proto3" json:"record,omitempty"`
+	// no record; the writes before this event were the backlog
+	Replayed      bool `protobuf:"varint,2,opt,name=replayed,proto3" json:"replayed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEvent) Reset() {
+	*x = WatchEvent{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEvent) ProtoMessage() {}
+
+func (x *WatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEvent.ProtoReflect.Descriptor instead.
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *WatchEvent) GetRecord() *Record {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+func (x *WatchEvent) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+type Chunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	UploadId      string                 `protobuf:"bytes,2,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	Index         uint32                 `protobuf:"varint,3,opt,name=index,proto3" json:"index,omitempty"`
+	Data          []byte                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Chunk) Reset() {
+	*x = Chunk{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chunk) ProtoMessage() {}
+
+func (x *Chunk) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chunk.ProtoReflect.Descriptor instead.
+func (*Chunk) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Chunk) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Chunk) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+func (x *Chunk) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Chunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type PutChunksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChunksWritten uint32                 `protobuf:"varint,1,opt,name=chunks_written,json=chunksWritten,proto3" json:"chunks_written,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutChunksResponse) Reset() {
+	*x = PutChunksResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutChunksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutChunksResponse) ProtoMessage() {}
+
+func (x *PutChunksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutChunksResponse.ProtoReflect.Descriptor instead.
+func (*PutChunksResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PutChunksResponse) GetChunksWritten() uint32 {
+	if x != nil {
+		return x.ChunksWritten
+	}
+	return 0
+}
+
+type GetChunkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	UploadId      string                 `protobuf:"bytes,2,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	Index         uint32                 `protobuf:"varint,3,opt,name=index,proto3" json:"index,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetChunkRequest) Reset() {
+	*x = GetChunkRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetChunkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetChunkRequest) ProtoMessage() {}
+
+func (x *GetChunkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetChunkRequest.ProtoReflect.Descriptor instead.
+func (*GetChunkRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetChunkRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *GetChunkRequest) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+func (x *GetChunkRequest) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+type GetChunkResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Found         bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetChunkResponse) Reset() {
+	*x = GetChunkResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetChunkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetChunkResponse) ProtoMessage() {}
+
+func (x *GetChunkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetChunkResponse.ProtoReflect.Descriptor instead.
+func (*GetChunkResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *GetChunkResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *GetChunkResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type DeleteChunksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	UploadId      string                 `protobuf:"bytes,2,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteChunksRequest) Reset() {
+	*x = DeleteChunksRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteChunksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteChunksRequest) ProtoMessage() {}
+
+func (x *DeleteChunksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteChunksRequest.ProtoReflect.Descriptor instead.
+func (*DeleteChunksRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *DeleteChunksRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *DeleteChunksRequest) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+type ScanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	After         string                 `protobuf:"bytes,2,opt,name=after,proto3" json:"after,omitempty"`
+	Limit         uint32                 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanRequest) Reset() {
+	*x = ScanRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanRequest) ProtoMessage() {}
+
+func (x *ScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanRequest.ProtoReflect.Descriptor instead.
+func (*ScanRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ScanRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ScanRequest) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+func (x *ScanRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ScanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       []*Record              `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanResponse) Reset() {
+	*x = ScanResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanResponse) ProtoMessage() {}
+
+func (x *ScanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanResponse.ProtoReflect.Descriptor instead.
+func (*ScanResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ScanResponse) GetRecords() []*Record {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+type BatchSetRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Records []*Record              `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	// skip records older than the stored version of their key
+	Merge         bool `protobuf:"varint,2,opt,name=merge,proto3" json:"merge,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSetRequest) Reset() {
+	*x = BatchSetRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSetRequest) ProtoMessage() {}
+
+func (x *BatchSetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSetRequest.ProtoReflect.Descriptor instead.
+func (*BatchSetRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *BatchSetRequest) GetRecords() []*Record {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+func (x *BatchSetRequest) GetMerge() bool {
+	if x != nil {
+		return x.Merge
+	}
+	return false
+}
+
+type BatchSetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Written       uint32                 `protobuf:"varint,1,opt,name=written,proto3" json:"written,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSetResponse) Reset() {
+	*x = BatchSetResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSetResponse) ProtoMessage() {}
+
+func (x *BatchSetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSetResponse.ProtoReflect.Descriptor instead.
+func (*BatchSetResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *BatchSetResponse) GetWritten() uint32 {
+	if x != nil {
+		return x.Written
+	}
+	return 0
+}
+
+type ReplicateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ClusterId     string                 `protobuf:"bytes,1,opt,name=cluster_id,json=clusterId,proto3" json:"cluster_id,omitempty"`
+	Records       []*Record              `protobuf:"bytes,2,rep,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicateRequest) Reset() {
+	*x = ReplicateRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicateRequest) ProtoMessage() {}
+
+func (x *ReplicateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicateRequest.ProtoReflect.Descriptor instead.
+func (*ReplicateRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ReplicateRequest) GetClusterId() string {
+	if x != nil {
+		return x.ClusterId
+	}
+	return ""
+}
+
+func (x *ReplicateRequest) GetRecords() []*Record {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+type ReplicateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Written       uint32                 `protobuf:"varint,1,opt,name=written,proto3" json:"written,omitempty"`
+	Failed        []string               `protobuf:"bytes,2,rep,name=failed,proto3" json:"failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicateResponse) Reset() {
+	*x = ReplicateResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicateResponse) ProtoMessage() {}
+
+func (x *ReplicateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicateResponse.ProtoReflect.Descriptor instead.
+func (*ReplicateResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ReplicateResponse) GetWritten() uint32 {
+	if x != nil {
+		return x.Written
+	}
+	return 0
+}
+
+func (x *ReplicateResponse) GetFailed() []string {
+	if x != nil {
+		return x.Failed
+	}
+	return nil
+}
+
+// one message of a chunked value shipped to another cluster. the first
+// carries the cluster id and the manifest record, the rest the value's
+// bytes in order
+type ReplicateLargeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ClusterId     string                 `protobuf:"bytes,1,opt,name=cluster_id,json=clusterId,proto3" json:"cluster_id,omitempty"`
+	Record        *Record                `protobuf:"bytes,2,opt,name=record,proto3" json:"record,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicateLargeRequest) Reset() {
+	*x = ReplicateLargeRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicateLargeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicateLargeRequest) ProtoMessage() {}
+
+func (x *ReplicateLargeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicateLargeRequest.ProtoReflect.Descriptor instead.
+func (*ReplicateLargeRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ReplicateLargeRequest) GetClusterId() string {
+	if x != nil {
+		return x.ClusterId
+	}
+	return ""
+}
+
+func (x *ReplicateLargeRequest) GetRecord() *Record {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+func (x *ReplicateLargeRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type MemberState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeUrl       string                 `protobuf:"bytes,1,opt,name=node_url,json=nodeUrl,proto3" json:"node_url,omitempty"`
+	Heartbeat     int64                  `protobuf:"varint,2,opt,name=heartbeat,proto3" json:"heartbeat,omitempty"`
+	Dc            string                 `protobuf:"bytes,3,opt,name=dc,proto3" json:"dc,omitempty"`
+	Rack          string                 `protobuf:"bytes,4,opt,name=rack,proto3" json:"rack,omitempty"`
+	Partitioner   string                 `protobuf:"bytes,5,opt,name=partitioner,proto3" json:"partitioner,omitempty"`
+	Weight        float64                `protobuf:"fixed64,6,opt,name=weight,proto3" json:"weight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MemberState) Reset() {
+	*x = MemberState{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MemberState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MemberState) ProtoMessage() {}
+
+func (x *MemberState) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MemberState.ProtoReflect.Descriptor instead.
+func (*MemberState) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *MemberState) GetNodeUrl() string {
+	if x != nil {
+		return x.NodeUrl
+	}
+	return ""
+}
+
+func (x *MemberState) GetHeartbeat() int64 {
+	if x != nil {
+		return x.Heartbeat
+	}
+	return 0
+}
+
+func (x *MemberState) GetDc() string {
+	if x != nil {
+		return x.Dc
+	}
+	return ""
+}
+
+func (x *MemberState) GetRack() string {
+	if x != nil {
+		return x.Rack
+	}
+	return ""
+}
+
+func (x *MemberState) GetPartitioner() string {
+	if x != nil {
+		return x.Partitioner
+	}
+	return ""
+}
+
+func (x *MemberState) GetWeight() float64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+type GossipMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Members       []*MemberState         `protobuf:"bytes,1,rep,name=members,proto3" json:"members,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GossipMessage) Reset() {
+	*x = GossipMessage{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GossipMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GossipMessage) ProtoMessage() {}
+
+func (x *GossipMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GossipMessage.ProtoReflect.Descriptor instead.
+func (*GossipMessage) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *GossipMessage) GetMembers() []*MemberState {
+	if x != nil {
+		return x.Members
+	}
+	return nil
+}
+
+// the client facing api. any node coordinates a request, but smart
+// clients send it to a replica of the key to save a hop. errors carry a
+// google.rpc.ErrorInfo in domain strangedb whose reason names the cause:
+// KEY_NOT_FOUND, QUORUM_NOT_REACHED, NO_NODES_AVAILABLE,
+// INVALID_CONSISTENCY, INVALID_ARGUMENT or VALUE_TOO_LARGE
+type KVGetRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// one, quorum, local_quorum, each_quorum or all; empty for the default
+	Consistency   string `protobuf:"bytes,2,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVGetRequest) Reset() {
+	*x = KVGetRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVGetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVGetRequest) ProtoMessage() {}
+
+func (x *KVGetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVGetRequest.ProtoReflect.Descriptor instead.
+func (*KVGetRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *KVGetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KVGetRequest) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+// a missing key is a NOT_FOUND error
+type KVGetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Record        *Record                `protobuf:"bytes,1,opt,name=record,proto3" json:"record,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVGetResponse) Reset() {
+	*x = KVGetResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVGetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVGetResponse) ProtoMessage() {}
+
+func (x *KVGetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVGetResponse.ProtoReflect.Descriptor instead.
+func (*KVGetResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *KVGetResponse) GetRecord() *Record {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+type KVSetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	ContentType   string                 `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Consistency   string                 `protobuf:"bytes,4,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVSetRequest) Reset() {
+	*x = KVSetRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVSetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVSetRequest) ProtoMessage() {}
+
+func (x *KVSetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVSetRequest.ProtoReflect.Descriptor instead.
+func (*KVSetRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *KVSetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KVSetRequest) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *KVSetRequest) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *KVSetRequest) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+type KVSetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *Timestamp             `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVSetResponse) Reset() {
+	*x = KVSetResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVSetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVSetResponse) ProtoMessage() {}
+
+func (x *KVSetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVSetResponse.ProtoReflect.Descriptor instead.
+func (*KVSetResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *KVSetResponse) GetTimestamp() *Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+type KVDeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Consistency   string                 `protobuf:"bytes,2,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVDeleteRequest) Reset() {
+	*x = KVDeleteRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVDeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVDeleteRequest) ProtoMessage() {}
+
+func (x *KVDeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVDeleteRequest.ProtoReflect.Descriptor instead.
+func (*KVDeleteRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *KVDeleteRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KVDeleteRequest) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+type KVDeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVDeleteResponse) Reset() {
+	*x = KVDeleteResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVDeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVDeleteResponse) ProtoMessage() {}
+
+func (x *KVDeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVDeleteResponse.ProtoReflect.Descriptor instead.
+func (*KVDeleteResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{29}
+}
+
+type KVScanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	After         string                 `protobuf:"bytes,2,opt,name=after,proto3" json:"after,omitempty"`
+	Limit         uint32                 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVScanRequest) Reset() {
+	*x = KVScanRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVScanRequest) ProtoMessage() {}
+
+func (x *KVScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVScanRequest.ProtoReflect.Descriptor instead.
+func (*KVScanRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *KVScanRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *KVScanRequest) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+func (x *KVScanRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type KVScanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       []*Record              `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	Next          string                 `protobuf:"bytes,2,opt,name=next,proto3" json:"next,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVScanResponse) Reset() {
+	*x = KVScanResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVScanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVScanResponse) ProtoMessage() {}
+
+func (x *KVScanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVScanResponse.ProtoReflect.Descriptor instead.
+func (*KVScanResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *KVScanResponse) GetRecords() []*Record {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+func (x *KVScanResponse) GetNext() string {
+	if x != nil {
+		return x.Next
+	}
+	return ""
+}
+
+type KVBatchRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Records []*Record              `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	// one, quorum, local_quorum, each_quorum or all; each group of keys
+	// sharing replicas must meet it. empty for the configured default
+	Consistency   string `protobuf:"bytes,2,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVBatchRequest) Reset() {
+	*x = KVBatchRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVBatchRequest) ProtoMessage() {}
+
+func (x *KVBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVBatchRequest.ProtoReflect.Descriptor instead.
+func (*KVBatchRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *KVBatchRequest) GetRecords() []*Record {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+func (x *KVBatchRequest) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+type KVBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Written       uint32                 `protobuf:"varint,1,opt,name=written,proto3" json:"written,omitempty"`
+	Failed        []string               `protobuf:"bytes,2,rep,name=failed,proto3" json:"failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KVBatchResponse) Reset() {
+	*x = KVBatchResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KVBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KVBatchResponse) ProtoMessage() {}
+
+func (x *KVBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KVBatchResponse.ProtoReflect.Descriptor instead.
+func (*KVBatchResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *KVBatchResponse) GetWritten() uint32 {
+	if x != nil {
+		return x.Written
+	}
+	return 0
+}
+
+func (x *KVBatchResponse) GetFailed() []string {
+	if x != nil {
+		return x.Failed
+	}
+	return nil
+}
+
+type TopologyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopologyRequest) Reset() {
+	*x = TopologyRequest{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopologyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopologyRequest) ProtoMessage() {}
+
+func (x *TopologyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopologyRequest.ProtoReflect.Descriptor instead.
+func (*TopologyRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{34}
+}
+
+type NodeInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addr          string                 `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Dc            string                 `protobuf:"bytes,2,opt,name=dc,proto3" json:"dc,omitempty"`
+	Rack          string                 `protobuf:"bytes,3,opt,name=rack,proto3" json:"rack,omitempty"`
+	Weight        float64                `protobuf:"fixed64,4,opt,name=weight,proto3" json:"weight,omitempty"`
+	State         string                 `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeInfo) Reset() {
+	*x = NodeInfo{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeInfo) ProtoMessage() {}
+
+func (x *NodeInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeInfo.ProtoReflect.Descriptor instead.
+func (*NodeInfo) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *NodeInfo) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *NodeInfo) GetDc() string {
+	if x != nil {
+		return x.Dc
+	}
+	return ""
+}
+
+func (x *NodeInfo) GetRack() string {
+	if x != nil {
+		return x.Rack
+	}
+	return ""
+}
+
+func (x *NodeInfo) GetWeight() float64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *NodeInfo) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+type TopologyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Partitioner   string                 `protobuf:"bytes,1,opt,name=partitioner,proto3" json:"partitioner,omitempty"`
+	Vnodes        uint32                 `protobuf:"varint,2,opt,name=vnodes,proto3" json:"vnodes,omitempty"`
+	Replication   uint32                 `protobuf:"varint,3,opt,name=replication,proto3" json:"replication,omitempty"`
+	DcReplication map[string]uint32      `protobuf:"bytes,4,rep,name=dc_replication,json=dcReplication,proto3" json:"dc_replication,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Nodes         []*NodeInfo            `protobuf:"bytes,5,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopologyResponse) Reset() {
+	*x = TopologyResponse{}
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopologyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopologyResponse) ProtoMessage() {}
+
+func (x *TopologyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_node_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopologyResponse.ProtoReflect.Descriptor instead.
+func (*TopologyResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_node_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *TopologyResponse) GetPartitioner() string {
+	if x != nil {
+		return x.Partitioner
+	}
+	return ""
+}
+
+func (x *TopologyResponse) GetVnodes() uint32 {
+	if x != nil {
+		return x.Vnodes
+	}
+	return 0
+}
+
+func (x *TopologyResponse) GetReplication() uint32 {
+	if x != nil {
+		return x.Replication
+	}
+	return 0
+}
+
+func (x *TopologyResponse) GetDcReplication() map[string]uint32 {
+	if x != nil {
+		return x.DcReplication
+	}
+	return nil
+}
+
+func (x *TopologyResponse) GetNodes() []*NodeInfo {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+var File_internal_transport_grpc_proto_node_proto protoreflect.FileDescriptor
+
+const file_internal_transport_grpc_proto_node_proto_rawDesc = "" +
+	"\n" +
+	"(internal/transport/grpc/proto/node.proto\x12\tstrangedb\"[\n" +
+	"\tTimestamp\x12\x1b\n" +
+	"\twall_time\x18\x01 \x01(\x03R\bwallTime\x12\x18\n" +
+	"\alogical\x18\x02 \x01(\rR\alogical\x12\x17\n" +
+	"\anode_id\x18\x03 \x01(\tR\x06nodeId\"\xf8\x01\n" +
+	"\x06Record\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x122\n" +
+	"\ttimestamp\x18\x03 \x01(\v2\x14.strangedb.TimestampR\ttimestamp\x12\x1c\n" +
+	"\ttombstone\x18\x04 \x01(\bR\ttombstone\x12!\n" +
+	"\fcontent_type\x18\x05 \x01(\tR\vcontentType\x12\x1a\n" +
+	"\bmanifest\x18\x06 \x01(\bR\bmanifest\x12\x16\n" +
+	"\x06origin\x18\a \x01(\tR\x06origin\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\b \x01(\x03R\texpiresAt\"\x1e\n" +
+	"\n" +
+	"GetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"N\n" +
+	"\vGetResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12)\n" +
+	"\x06record\x18\x02 \x01(\v2\x11.strangedb.RecordR\x06record\"7\n" +
+	"\n" +
+	"SetRequest\x12)\n" +
+	"\x06record\x18\x01 \x01(\v2\x11.strangedb.RecordR\x06record\"[\n" +
+	"\vSetResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x122\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x14.strangedb.TimestampR\ttimestamp\"U\n" +
+	"\rDeleteRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x122\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x14.strangedb.TimestampR\ttimestamp\"*\n" +
+	"\x0eDeleteResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\"\x89\x01\n" +
+	"\fWatchRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x16\n" +
+	"\x06prefix\x18\x02 \x01(\tR\x06prefix\x12*\n" +
+	"\x05since\x18\x03 \x01(\v2\x14.strangedb.TimestampR\x05since\x12#\n" +
+	"\rmark_replayed\x18\x04 \x01(\bR\fmarkReplayed\"S\n" +
+	"\n" +
+	"WatchEvent\x12)\n" +
+	"\x06record\x18\x01 \x01(\v2\x11.strangedb.RecordR\x06record\x12\x1a\n" +
+	"\breplayed\x18\x02 \x01(\bR\breplayed\"`\n" +
+	"\x05Chunk\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1b\n" +
+	"\tupload_id\x18\x02 \x01(\tR\buploadId\x12\x14\n" +
+	"\x05index\x18\x03 \x01(\rR\x05index\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\":\n" +
+	"\x11PutChunksResponse\x12%\n" +
+	"\x0echunks_written\x18\x01 \x01(\rR\rchunksWritten\"V\n" +
+	"\x0fGetChunkRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1b\n" +
+	"\tupload_id\x18\x02 \x01(\tR\buploadId\x12\x14\n" +
+	"\x05index\x18\x03 \x01(\rR\x05index\"<\n" +
+	"\x10GetChunkResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"D\n" +
+	"\x13DeleteChunksRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1b\n" +
+	"\tupload_id\x18\x02 \x01(\tR\buploadId\"Q\n" +
+	"\vScanRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x14\n" +
+	"\x05after\x18\x02 \x01(\tR\x05after\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\rR\x05limit\";\n" +
+	"\fScanResponse\x12+\n" +
+	"\arecords\x18\x01 \x03(\v2\x11.strangedb.RecordR\arecords\"T\n" +
+	"\x0fBatchSetRequest\x12+\n" +
+	"\arecords\x18\x01 \x03(\v2\x11.strangedb.RecordR\arecords\x12\x14\n" +
+	"\x05merge\x18\x02 \x01(\bR\x05merge\",\n" +
+	"\x10BatchSetResponse\x12\x18\n" +
+	"\awritten\x18\x01 \x01(\rR\awritten\"^\n" +
+	"\x10ReplicateRequest\x12\x1d\n" +
+	"\n" +
+	"cluster_id\x18\x01 \x01(\tR\tclusterId\x12+\n" +
+	"\arecords\x18\x02 \x03(\v2\x11.strangedb.RecordR\arecords\"E\n" +
+	"\x11ReplicateResponse\x12\x18\n" +
+	"\awritten\x18\x01 \x01(\rR\awritten\x12\x16\n" +
+	"\x06failed\x18\x02 \x03(\tR\x06failed\"u\n" +
+	"\x15ReplicateLargeRequest\x12\x1d\n" +
+	"\n" +
+	"cluster_id\x18\x01 \x01(\tR\tclusterId\x12)\n" +
+	"\x06record\x18\x02 \x01(\v2\x11.strangedb.RecordR\x06record\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\"\xa4\x01\n" +
+	"\vMemberState\x12\x19\n" +
+	"\bnode_url\x18\x01 \x01(\tR\anodeUrl\x12\x1c\n" +
+	"\theartbeat\x18\x02 \x01(\x03R\theartbeat\x12\x0e\n" +
+	"\x02dc\x18\x03 \x01(\tR\x02dc\x12\x12\n" +
+	"\x04rack\x18\x04 \x01(\tR\x04rack\x12 \n" +
+	"\vpartitioner\x18\x05 \x01(\tR\vpartitioner\x12\x16\n" +
+	"\x06weight\x18\x06 \x01(\x01R\x06weight\"A\n" +
+	"\rGossipMessage\x120\n" +
+	"\amembers\x18\x01 \x03(\v2\x16.strangedb.MemberStateR\amembers\"B\n" +
+	"\fKVGetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12 \n" +
+	"\vconsistency\x18\x02 \x01(\tR\vconsistency\":\n" +
+	"\rKVGetResponse\x12)\n" +
+	"\x06record\x18\x01 \x01(\v2\x11.strangedb.RecordR\x06record\"{\n" +
+	"\fKVSetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12 \n" +
+	"\vconsistency\x18\x04 \x01(\tR\vconsistency\"C\n" +
+	"\rKVSetResponse\x122\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x14.strangedb.TimestampR\ttimestamp\"E\n" +
+	"\x0fKVDeleteRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12 \n" +
+	"\vconsistency\x18\x02 \x01(\tR\vconsistency\"\x12\n" +
+	"\x10KVDeleteResponse\"S\n" +
+	"\rKVScanRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x14\n" +
+	"\x05after\x18\x02 \x01(\tR\x05after\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\rR\x05limit\"Q\n" +
+	"\x0eKVScanResponse\x12+\n" +
+	"\arecords\x18\x01 \x03(\v2\x11.strangedb.RecordR\arecords\x12\x12\n" +
+	"\x04next\x18\x02 \x01(\tR\x04next\"_\n" +
+	"\x0eKVBatchRequest\x12+\n" +
+	"\arecords\x18\x01 \x03(\v2\x11.strangedb.RecordR\arecords\x12 \n" +
+	"\vconsistency\x18\x02 \x01(\tR\vconsistency\"C\n" +
+	"\x0fKVBatchResponse\x12\x18\n" +
+	"\awritten\x18\x01 \x01(\rR\awritten\x12\x16\n" +
+	"\x06failed\x18\x02 \x03(\tR\x06failed\"\x11\n" +
+	"\x0fTopologyRequest\"p\n" +
+	"\bNodeInfo\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\tR\x04addr\x12\x0e\n" +
+	"\x02dc\x18\x02 \x01(\tR\x02dc\x12\x12\n" +
+	"\x04rack\x18\x03 \x01(\tR\x04rack\x12\x16\n" +
+	"\x06weight\x18\x04 \x01(\x01R\x06weight\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\"\xb2\x02\n" +
+	"\x10TopologyResponse\x12 \n" +
+	"\vpartitioner\x18\x01 \x01(\tR\vpartitioner\x12\x16\n" +
+	"\x06vnodes\x18\x02 \x01(\rR\x06vnodes\x12 \n" +
+	"\vreplication\x18\x03 \x01(\rR\vreplication\x12U\n" +
+	"\x0edc_replication\x18\x04 \x03(\v2..strangedb.TopologyResponse.DcReplicationEntryR\rdcReplication\x12)\n" +
+	"\x05nodes\x18\x05 \x03(\v2\x13.strangedb.NodeInfoR\x05nodes\x1a@\n" +
+	"\x12DcReplicationEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\rR\x05value:\x028\x012\x9a\x06\n" +
 	"\vNodeService\x124\n" +
 	"\x03Get\x12\x15.strangedb.GetRequest\x1a\x16.strangedb.GetResponse\x124\n" +
 	"\x03Set\x12\x15.strangedb.SetRequest\x1a\x16.strangedb.SetResponse\x12=\n" +
-	"\x06Delete\x12\x18.strangedb.DeleteRequest\x1a\x19.strangedb.DeleteResponseB?Z=github.com/AuraReaper/strangedb/internal/transport/grpc/protob\x06proto3"
+	"\x06Delete\x12\x18.strangedb.DeleteRequest\x1a\x19.strangedb.DeleteResponse\x129\n" +
+	"\x05Watch\x12\x17.strangedb.WatchRequest\x1a\x15.strangedb.WatchEvent0\x01\x12=\n" +
+	"\tPutChunks\x12\x10.strangedb.Chunk\x1a\x1c.strangedb.PutChunksResponse(\x01\x12C\n" +
+	"\bGetChunk\x12\x1a.strangedb.GetChunkRequest\x1a\x1b.strangedb.GetChunkResponse\x12I\n" +
+	"\fDeleteChunks\x12\x1e.strangedb.DeleteChunksRequest\x1a\x19.strangedb.DeleteResponse\x127\n" +
+	"\x04Scan\x12\x16.strangedb.ScanRequest\x1a\x17.strangedb.ScanResponse\x12C\n" +
+	"\bBatchSet\x12\x1a.strangedb.BatchSetRequest\x1a\x1b.strangedb.BatchSetResponse\x12<\n" +
+	"\x06Gossip\x12\x18.strangedb.GossipMessage\x1a\x18.strangedb.GossipMessage\x12F\n" +
+	"\tReplicate\x12\x1b.strangedb.ReplicateRequest\x1a\x1c.strangedb.ReplicateResponse\x12R\n" +
+	"\x0eReplicateLarge\x12 .strangedb.ReplicateLargeRequest\x1a\x1c.strangedb.ReplicateResponse(\x012\xbf\x03\n" +
+	"\tKVService\x128\n" +
+	"\x03Get\x12\x17.strangedb.KVGetRequest\x1a\x18.strangedb.KVGetResponse\x128\n" +
+	"\x03Set\x12\x17.strangedb.KVSetRequest\x1a\x18.strangedb.KVSetResponse\x12A\n" +
+	"\x06Delete\x12\x1a.strangedb.KVDeleteRequest\x1a\x1b.strangedb.KVDeleteResponse\x12;\n" +
+	"\x04Scan\x12\x18.strangedb.KVScanRequest\x1a\x19.strangedb.KVScanResponse\x12>\n" +
+	"\x05Batch\x12\x19.strangedb.KVBatchRequest\x1a\x1a.strangedb.KVBatchResponse\x129\n" +
+	"\x05Watch\x12\x17.strangedb.WatchRequest\x1a\x15.strangedb.WatchEvent0\x01\x12C\n" +
+	"\bTopology\x12\x1a.strangedb.TopologyRequest\x1a\x1b.strangedb.TopologyResponseB?Z=github.com/AuraReaper/strangedb/internal/transport/grpc/protob\x06proto3"
 
 var (
 	file_internal_transport_grpc_proto_node_proto_rawDescOnce sync.Once
@@ -485,34 +2248,109 @@ func file_internal_transport_grpc_proto_node_proto_rawDescGZIP() []byte {
 	return file_internal_transport_grpc_proto_node_proto_rawDescData
 }
 
-var file_internal_transport_grpc_proto_node_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_internal_transport_grpc_proto_node_proto_msgTypes = make([]protoimpl.MessageInfo, 38)
 var file_internal_transport_grpc_proto_node_proto_goTypes = []any{
-	(*Timestamp)(nil),      // 0: strangedb.Timestamp
-	(*Record)(nil),         // 1: strangedb.Record
-	(*GetRequest)(nil),     // 2: strangedb.GetRequest
-	(*GetResponse)(nil),    // 3: strangedb.GetResponse
-	(*SetRequest)(nil),     // 4: strangedb.SetRequest
-	(*SetResponse)(nil),    // 5: strangedb.SetResponse
-	(*DeleteRequest)(nil),  // 6: strangedb.DeleteRequest
-	(*DeleteResponse)(nil), // 7: strangedb.DeleteResponse
+	(*Timestamp)(nil),             // 0: strangedb.Timestamp
+	(*Record)(nil),                // 1: strangedb.Record
+	(*GetRequest)(nil),            // 2: strangedb.GetRequest
+	(*GetResponse)(nil),           // 3: strangedb.GetResponse
+	(*SetRequest)(nil),            // 4: strangedb.SetRequest
+	(*SetResponse)(nil),           // 5: strangedb.SetResponse
+	(*DeleteRequest)(nil),         // 6: strangedb.DeleteRequest
+	(*DeleteResponse)(nil),        // 7: strangedb.DeleteResponse
+	(*WatchRequest)(nil),          // 8: strangedb.WatchRequest
+	(*WatchEvent)(nil),            // 9: strangedb.WatchEvent
+	(*Chunk)(nil),                 // 10: strangedb.Chunk
+	(*PutChunksResponse)(nil),     // 11: strangedb.PutChunksResponse
+	(*GetChunkRequest)(nil),       // 12: strangedb.GetChunkRequest
+	(*GetChunkResponse)(nil),      // 13: strangedb.GetChunkResponse
+	(*DeleteChunksRequest)(nil),   // 14: strangedb.DeleteChunksRequest
+	(*ScanRequest)(nil),           // 15: strangedb.ScanRequest
+	(*ScanResponse)(nil),          // 16: strangedb.ScanResponse
+	(*BatchSetRequest)(nil),       // 17: strangedb.BatchSetRequest
+	(*BatchSetResponse)(nil),      // 18: strangedb.BatchSetResponse
+	(*ReplicateRequest)(nil),      // 19: strangedb.ReplicateRequest
+	(*ReplicateResponse)(nil),     // 20: strangedb.ReplicateResponse
+	(*ReplicateLargeRequest)(nil), // 21: strangedb.ReplicateLargeRequest
+	(*MemberState)(nil),           // 22: strangedb.MemberState
+	(*GossipMessage)(nil),         // 23: strangedb.GossipMessage
+	(*KVGetRequest)(nil),          // 24: strangedb.KVGetRequest
+	(*KVGetResponse)(nil),         // 25: strangedb.KVGetResponse
+	(*KVSetRequest)(nil),          // 26: strangedb.KVSetRequest
+	(*KVSetResponse)(nil),         // 27: strangedb.KVSetResponse
+	(*KVDeleteRequest)(nil),       // 28: strangedb.KVDeleteRequest
+	(*KVDeleteResponse)(nil),      // 29: strangedb.KVDeleteResponse
+	(*KVScanRequest)(nil),         // 30: strangedb.KVScanRequest
+	(*KVScanResponse)(nil),        // 31: strangedb.KVScanResponse
+	(*KVBatchRequest)(nil),        // 32: strangedb.KVBatchRequest
+	(*KVBatchResponse)(nil),       // 33: strangedb.KVBatchResponse
+	(*TopologyRequest)(nil),       // 34: strangedb.TopologyRequest
+	(*NodeInfo)(nil),              // 35: strangedb.NodeInfo
+	(*TopologyResponse)(nil),      // 36: strangedb.TopologyResponse
+	nil,                           // 37: strangedb.TopologyResponse.DcReplicationEntry
 }
 var file_internal_transport_grpc_proto_node_proto_depIdxs = []int32{
-	0, // 0: strangedb.Record.timestamp:type_name -> strangedb.Timestamp
-	1, // 1: strangedb.GetResponse.record:type_name -> strangedb.Record
-	1, // 2: strangedb.SetRequest.record:type_name -> strangedb.Record
-	0, // 3: strangedb.SetResponse.timestamp:type_name -> strangedb.Timestamp
-	0, // 4: strangedb.DeleteRequest.timestamp:type_name -> strangedb.Timestamp
-	2, // 5: strangedb.NodeService.Get:input_type -> strangedb.GetRequest
-	4, // 6: strangedb.NodeService.Set:input_type -> strangedb.SetRequest
-	6, // 7: strangedb.NodeService.Delete:input_type -> strangedb.DeleteRequest
-	3, // 8: strangedb.NodeService.Get:output_type -> strangedb.GetResponse
-	5, // 9: strangedb.NodeService.Set:output_type -> strangedb.SetResponse
-	7, // 10: strangedb.NodeService.Delete:output_type -> strangedb.DeleteResponse
-	8, // [8:11] is the sub-list for method output_type
-	5, // [5:8] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	0,  // 0: strangedb.Record.timestamp:type_name -> strangedb.Timestamp
+	1,  // 1: strangedb.GetResponse.record:type_name -> strangedb.Record
+	1,  // 2: strangedb.SetRequest.record:type_name -> strangedb.Record
+	0,  // 3: strangedb.SetResponse.timestamp:type_name -> strangedb.Timestamp
+	0,  // 4: strangedb.DeleteRequest.timestamp:type_name -> strangedb.Timestamp
+	0,  // 5: strangedb.WatchRequest.since:type_name -> strangedb.Timestamp
+	1,  // 6: strangedb.WatchEvent.record:type_name -> strangedb.Record
+	1,  // 7: strangedb.ScanResponse.records:type_name -> strangedb.Record
+	1,  // 8: strangedb.BatchSetRequest.records:type_name -> strangedb.Record
+	1,  // 9: strangedb.ReplicateRequest.records:type_name -> strangedb.Record
+	1,  // 10: strangedb.ReplicateLargeRequest.record:type_name -> strangedb.Record
+	22, // 11: strangedb.GossipMessage.members:type_name -> strangedb.MemberState
+	1,  // 12: strangedb.KVGetResponse.record:type_name -> strangedb.Record
+	0,  // 13: strangedb.KVSetResponse.timestamp:type_name -> strangedb.Timestamp
+	1,  // 14: strangedb.KVScanResponse.records:type_name -> strangedb.Record
+	1,  // 15: strangedb.KVBatchRequest.records:type_name -> strangedb.Record
+	37, // 16: strangedb.TopologyResponse.dc_replication:type_name -> strangedb.TopologyResponse.DcReplicationEntry
+	35, // 17: strangedb.TopologyResponse.nodes:type_name -> strangedb.NodeInfo
+	2,  // 18: strangedb.NodeService.Get:input_type -> strangedb.GetRequest
+	4,  // 19: strangedb.NodeService.Set:input_type -> strangedb.SetRequest
+	6,  // 20: strangedb.NodeService.Delete:input_type -> strangedb.DeleteRequest
+	8,  // 21: strangedb.NodeService.Watch:input_type -> strangedb.WatchRequest
+	10, // 22: strangedb.NodeService.PutChunks:input_type -> strangedb.Chunk
+	12, // 23: strangedb.NodeService.GetChunk:input_type -> strangedb.GetChunkRequest
+	14, // 24: strangedb.NodeService.DeleteChunks:input_type -> strangedb.DeleteChunksRequest
+	15, // 25: strangedb.NodeService.Scan:input_type -> strangedb.ScanRequest
+	17, // 26: strangedb.NodeService.BatchSet:input_type -> strangedb.BatchSetRequest
+	23, // 27: strangedb.NodeService.Gossip:input_type -> strangedb.GossipMessage
+	19, // 28: strangedb.NodeService.Replicate:input_type -> strangedb.ReplicateRequest
+	21, // 29: strangedb.NodeService.ReplicateLarge:input_type -> strangedb.ReplicateLargeRequest
+	24, // 30: strangedb.KVService.Get:input_type -> strangedb.KVGetRequest
+	26, // 31: strangedb.KVService.Set:input_type -> strangedb.KVSetRequest
+	28, // 32: strangedb.KVService.Delete:input_type -> strangedb.KVDeleteRequest
+	30, // 33: strangedb.KVService.Scan:input_type -> strangedb.KVScanRequest
+	32, // 34: strangedb.KVService.Batch:input_type -> strangedb.KVBatchRequest
+	8,  // 35: strangedb.KVService.Watch:input_type -> strangedb.WatchRequest
+	34, // 36: strangedb.KVService.Topology:input_type -> strangedb.TopologyRequest
+	3,  // 37: strangedb.NodeService.Get:output_type -> strangedb.GetResponse
+	5,  // 38: strangedb.NodeService.Set:output_type -> strangedb.SetResponse
+	7,  // 39: strangedb.NodeService.Delete:output_type -> strangedb.DeleteResponse
+	9,  // 40: strangedb.NodeService.Watch:output_type -> strangedb.WatchEvent
+	11, // 41: strangedb.NodeService.PutChunks:output_type -> strangedb.PutChunksResponse
+	13, // 42: strangedb.NodeService.GetChunk:output_type -> strangedb.GetChunkResponse
+	7,  // 43: strangedb.NodeService.DeleteChunks:output_type -> strangedb.DeleteResponse
+	16, // 44: strangedb.NodeService.Scan:output_type -> strangedb.ScanResponse
+	18, // 45: strangedb.NodeService.BatchSet:output_type -> strangedb.BatchSetResponse
+	23, // 46: strangedb.NodeService.Gossip:output_type -> strangedb.GossipMessage
+	20, // 47: strangedb.NodeService.Replicate:output_type -> strangedb.ReplicateResponse
+	20, // 48: strangedb.NodeService.ReplicateLarge:output_type -> strangedb.ReplicateResponse
+	25, // 49: strangedb.KVService.Get:output_type -> strangedb.KVGetResponse
+	27, // 50: strangedb.KVService.Set:output_type -> strangedb.KVSetResponse
+	29, // 51: strangedb.KVService.Delete:output_type -> strangedb.KVDeleteResponse
+	31, // 52: strangedb.KVService.Scan:output_type -> strangedb.KVScanResponse
+	33, // 53: strangedb.KVService.Batch:output_type -> strangedb.KVBatchResponse
+	9,  // 54: strangedb.KVService.Watch:output_type -> strangedb.WatchEvent
+	36, // 55: strangedb.KVService.Topology:output_type -> strangedb.TopologyResponse
+	37, // [37:56] is the sub-list for method output_type
+	18, // [18:37] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
 }
 
 func init() { file_internal_transport_grpc_proto_node_proto_init() }
@@ -526,9 +2364,9 @@ func file_internal_transport_grpc_proto_node_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_transport_grpc_proto_node_proto_rawDesc), len(file_internal_transport_grpc_proto_node_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   8,
+			NumMessages:   38,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_internal_transport_grpc_proto_node_proto_goTypes,
 		DependencyIndexes: file_internal_transport_grpc_proto_node_proto_depIdxs,
@@ -2,21 +2,43 @@ package grpc
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
+	"time"
 
+	"github.com/AuraReaper/strangedb/internal/gossip"
 	"github.com/AuraReaper/strangedb/internal/hlc"
 	"github.com/AuraReaper/strangedb/internal/storage"
 	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
+// applies writes shipped from another cluster; implemented by the
+// coordinator
+type Replicator interface {
+	Replicate(ctx context.Context, origin string, records []*storage.Record) (written int, failed []string, err error)
+	// the value of a manifest record is read from r
+	ReplicateLarge(ctx context.Context, origin string, record *storage.Record, r io.Reader) error
+}
+
 type Server struct {
 	pb.UnimplementedNodeServiceServer
-	storage storage.Storage
-	clock   *hlc.Clock
-	server  *grpc.Server
-	port    int
+	storage    storage.Storage
+	clock      *hlc.Clock
+	gossiper   *gossip.Gossiper
+	replicator Replicator
+	services   []service
+	peerSecret string
+	tls        *tls.Config
+	peerCerts  bool
+	server     *grpc.Server
+	port       int
 }
 
 func NewServer(port int, storage storage.Storage, clock *hlc.Clock) *Server {
@@ -27,14 +49,62 @@ func NewServer(port int, storage storage.Storage, clock *hlc.Clock) *Server {
 	}
 }
 
+func (s *Server) SetGossiper(g *gossip.Gossiper) {
+	s.gossiper = g
+}
+
+func (s *Server) SetReplicator(r Replicator) {
+	s.replicator = r
+}
+
+// restricts the node service to callers presenting secret; the other
+// services stay open
+func (s *Server) SetPeerSecret(secret string) {
+	s.peerSecret = secret
+}
+
+// serves over TLS; with peerCerts the node service also requires a
+// client certificate, which cfg must verify
+func (s *Server) SetTLS(cfg *tls.Config, peerCerts bool) {
+	s.tls = cfg
+	s.peerCerts = peerCerts
+}
+
+type service struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+// serves another service next to the node service; call before Start
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	s.services = append(s.services, service{desc: desc, impl: impl})
+}
+
 func (s *Server) Start() error {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
 	if err != nil {
 		return err
 	}
 
-	s.server = grpc.NewServer()
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.peerUnaryInterceptor, advertiseUnary),
+		grpc.ChainStreamInterceptor(s.peerStreamInterceptor, advertiseStream),
+		// peers ping idle connections; grpc refuses pings more often than
+		// every 5 minutes by default and would drop them
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	if s.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tls)))
+	}
+
+	s.server = grpc.NewServer(opts...)
 	pb.RegisterNodeServiceServer(s.server, s)
+	for _, svc := range s.services {
+		s.server.RegisterService(svc.desc, svc.impl)
+	}
 
 	return s.server.Serve(listener)
 }
@@ -57,31 +127,13 @@ func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse,
 	}
 
 	return &pb.GetResponse{
-		Found: true,
-		Record: &pb.Record{
-			Key:   record.Key,
-			Value: record.Value,
-			Timestamp: &pb.Timestamp{
-				WallTime: record.Timestamp.WallTime,
-				Logical:  record.Timestamp.Logical,
-				NodeId:   record.Timestamp.NodeID,
-			},
-			Tombstone: record.Tombstone,
-		},
+		Found:  true,
+		Record: RecordToProto(record),
 	}, nil
 }
 
 func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
-	record := &storage.Record{
-		Key:   req.Record.Key,
-		Value: req.Record.Value,
-		Timestamp: hlc.Timestamp{
-			WallTime: req.Record.Timestamp.WallTime,
-			Logical:  req.Record.Timestamp.Logical,
-			NodeID:   req.Record.Timestamp.NodeId,
-		},
-		Tombstone: req.Record.Tombstone,
-	}
+	record := RecordFromProto(req.Record)
 
 	if err := s.storage.Set(record); err != nil {
 		return nil, err
@@ -94,11 +146,7 @@ func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse,
 }
 
 func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
-	ts := hlc.Timestamp{
-		WallTime: req.Timestamp.WallTime,
-		Logical:  req.Timestamp.Logical,
-		NodeID:   req.Timestamp.NodeId,
-	}
+	ts := TimestampFromProto(req.Timestamp)
 
 	if err := s.storage.Delete(req.Key, ts); err != nil {
 		return nil, err
@@ -108,3 +156,220 @@ func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteR
 		Success: true,
 	}, nil
 }
+
+func (s *Server) Watch(req *pb.WatchRequest, stream pb.NodeService_WatchServer) error {
+	prefix := req.Prefix
+	if req.Key != "" {
+		prefix = req.Key
+	}
+
+	watcher, err := s.storage.Watch(stream.Context(), prefix, TimestampFromProto(req.Since))
+	if err != nil {
+		return err
+	}
+
+	events, replayed := watcher.Events(), watcher.Replayed()
+	if !req.MarkReplayed {
+		replayed = nil
+	}
+	for events != nil {
+		select {
+		case <-replayed:
+			replayed = nil
+			if err := stream.Send(&pb.WatchEvent{Replayed: true}); err != nil {
+				return err
+			}
+		case record, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if req.Key != "" && record.Key != req.Key {
+				continue
+			}
+
+			if err := stream.Send(&pb.WatchEvent{Record: RecordToProto(record)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := watcher.Err(); err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	return nil
+}
+
+// stores the chunks of one upload; if the sender aborts, everything
+// written so far is removed again
+func (s *Server) PutChunks(stream pb.NodeService_PutChunksServer) error {
+	var key, uploadID string
+	var written uint32
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.PutChunksResponse{
+				ChunksWritten: written,
+			})
+		}
+		if err != nil {
+			if uploadID != "" {
+				s.storage.DeleteChunks(key, uploadID)
+			}
+			return err
+		}
+
+		key, uploadID = chunk.Key, chunk.UploadId
+
+		if err := s.storage.SetChunk(chunk.Key, chunk.UploadId, int(chunk.Index), chunk.Data); err != nil {
+			s.storage.DeleteChunks(key, uploadID)
+			return err
+		}
+		written++
+	}
+}
+
+func (s *Server) GetChunk(ctx context.Context, req *pb.GetChunkRequest) (*pb.GetChunkResponse, error) {
+	data, err := s.storage.GetChunk(req.Key, req.UploadId, int(req.Index))
+	if err == storage.ErrKeyNotFound {
+		return &pb.GetChunkResponse{
+			Found: false,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetChunkResponse{
+		Found: true,
+		Data:  data,
+	}, nil
+}
+
+func (s *Server) DeleteChunks(ctx context.Context, req *pb.DeleteChunksRequest) (*pb.DeleteResponse, error) {
+	if err := s.storage.DeleteChunks(req.Key, req.UploadId); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteResponse{
+		Success: true,
+	}, nil
+}
+
+func (s *Server) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	records, err := s.storage.Scan(req.Prefix, req.After, int(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ScanResponse{
+		Records: make([]*pb.Record, len(records)),
+	}
+	for i, record := range records {
+		resp.Records[i] = RecordToProto(record)
+	}
+
+	return resp, nil
+}
+
+func (s *Server) BatchSet(ctx context.Context, req *pb.BatchSetRequest) (*pb.BatchSetResponse, error) {
+	records := make([]*storage.Record, len(req.Records))
+	for i, r := range req.Records {
+		records[i] = RecordFromProto(r)
+	}
+
+	if req.Merge {
+		written, err := s.storage.MergeBatch(records)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.BatchSetResponse{Written: uint32(written)}, nil
+	}
+
+	if err := s.storage.SetBatch(records); err != nil {
+		return nil, err
+	}
+
+	return &pb.BatchSetResponse{
+		Written: uint32(len(records)),
+	}, nil
+}
+
+func (s *Server) Gossip(ctx context.Context, req *pb.GossipMessage) (*pb.GossipMessage, error) {
+	if s.gossiper == nil {
+		return nil, status.Error(codes.Unavailable, "gossip not running")
+	}
+
+	return MembersToProto(s.gossiper.HandleGossip(MembersFromProto(req))), nil
+}
+
+func (s *Server) Replicate(ctx context.Context, req *pb.ReplicateRequest) (*pb.ReplicateResponse, error) {
+	if s.replicator == nil {
+		return nil, status.Error(codes.Unavailable, "replication not accepted")
+	}
+	if req.ClusterId == "" {
+		return nil, status.Error(codes.InvalidArgument, "cluster id required")
+	}
+
+	records := make([]*storage.Record, len(req.Records))
+	for i, r := range req.Records {
+		records[i] = RecordFromProto(r)
+	}
+
+	written, failed, err := s.replicator.Replicate(ctx, req.ClusterId, records)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ReplicateResponse{
+		Written: uint32(written),
+		Failed:  failed,
+	}, nil
+}
+
+func (s *Server) ReplicateLarge(stream pb.NodeService_ReplicateLargeServer) error {
+	if s.replicator == nil {
+		return status.Error(codes.Unavailable, "replication not accepted")
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.ClusterId == "" {
+		return status.Error(codes.InvalidArgument, "cluster id required")
+	}
+	if first.Record == nil || !first.Record.Manifest {
+		return status.Error(codes.InvalidArgument, "manifest record required")
+	}
+
+	record := RecordFromProto(first.Record)
+	r := &replicateReader{stream: stream, buf: first.Data}
+	if err := s.replicator.ReplicateLarge(stream.Context(), first.ClusterId, record, r); err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&pb.ReplicateResponse{Written: 1})
+}
+
+// the value bytes of a ReplicateLarge stream
+type replicateReader struct {
+	stream pb.NodeService_ReplicateLargeServer
+	buf    []byte
+}
+
+func (r *replicateReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = msg.Data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
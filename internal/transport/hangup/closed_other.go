@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package hangup
+
+import "net"
+
+// hang-ups are not detected on this platform; requests run until their
+// deadline
+func closed(net.Conn) bool {
+	return false
+}
@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package hangup
+
+import (
+	"net"
+	"syscall"
+)
+
+// peeks at the socket without blocking or consuming anything: an end of
+// stream or a reset means the peer is gone, while pending bytes, such
+// as a pipelined request, or none at all mean it is still there
+func closed(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	gone := false
+	var buf [1]byte
+	raw.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		gone = (n == 0 && err == nil) || err == syscall.ECONNRESET
+		return true
+	})
+	return gone
+}
@@ -0,0 +1,65 @@
+// Package hangup notices clients that close their connection while a
+// request is in progress. fasthttp and the redis server only read a
+// connection between requests, so without it a client that gave up
+// keeps replicas busy until its deadline
+package hangup
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// how often a connection is checked while a request runs
+const checkInterval = 200 * time.Millisecond
+
+// calls cancel once the peer closes conn, checking until stop is called.
+// connections that are not sockets, such as in tests, are not watched
+func Watch(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	if conn == nil {
+		return func() {}
+	}
+	if c, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		// tls
+		conn = c.NetConn()
+	}
+
+	// a timer rather than a goroutine, since most requests are done
+	// before the first check
+	w := &watch{conn: conn, cancel: cancel}
+	w.mu.Lock()
+	w.timer = time.AfterFunc(checkInterval, w.check)
+	w.mu.Unlock()
+	return w.stop
+}
+
+type watch struct {
+	conn   net.Conn
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+func (w *watch) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case w.stopped:
+	case closed(w.conn):
+		w.cancel()
+	default:
+		w.timer.Reset(checkInterval)
+	}
+}
+
+func (w *watch) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	w.timer.Stop()
+}
@@ -0,0 +1,72 @@
+package hangup
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// a connected pair of sockets: the client end and the server's
+func dial(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestWatchCancelsWhenClientHangsUp(t *testing.T) {
+	client, server := dial(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := Watch(server, cancel)
+	defer stop()
+
+	client.Close()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("context not cancelled after the client hung up")
+	}
+}
+
+func TestWatchKeepsLiveClient(t *testing.T) {
+	client, server := dial(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := Watch(server, cancel)
+
+	// a pipelined request waiting to be read is no hang-up, and is left
+	// for the server to read
+	client.Write([]byte("PING\r\n"))
+	time.Sleep(3 * checkInterval)
+	if ctx.Err() != nil {
+		t.Fatal("context cancelled for a client that is still connected")
+	}
+
+	stop()
+	client.Close()
+	time.Sleep(3 * checkInterval)
+	if ctx.Err() != nil {
+		t.Fatal("context cancelled after the request was done")
+	}
+
+	buf := make([]byte, 6)
+	if n, _ := server.Read(buf); string(buf[:n]) != "PING\r\n" {
+		t.Errorf("server read %q, want the pipelined request", buf[:n])
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/AuraReaper/strangedb/internal/audit"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// identifies the node that answered an admin request
+const HeaderNodeID = "X-Node-ID"
+
+type recordMigrator interface {
+	MigrateRecords() (storage.MigrationStats, error)
+}
+
+// rewrites legacy JSON records on this node in the binary format
+func (h *Handler) MigrateStorage(c *fiber.Ctx) error {
+	migrator, ok := h.coordinator.Storage().(recordMigrator)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotImplemented, "storage does not support migration")
+	}
+
+	stats, err := migrator.MigrateRecords()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(stats)
+}
+
+type snapshotter interface {
+	Backup(w io.Writer, since, until hlc.Timestamp) (storage.BackupStats, error)
+}
+
+// streams a snapshot of this node's data in badger's backup format.
+// ?at= is the cluster-wide backup point: the snapshot holds every record
+// as it was then, and the clock is moved past it first so every write
+// this node accepts afterwards sorts after it. ?since= limits the
+// snapshot to records written after an earlier backup point, for
+// incremental backups
+func (h *Handler) Snapshot(c *fiber.Ctx) error {
+	store, ok := h.coordinator.Storage().(snapshotter)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotImplemented, "storage does not support snapshots")
+	}
+
+	var at hlc.Timestamp
+	if q := c.Query("at"); q != "" {
+		ts, err := hlc.Parse(q)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		h.clock.Update(ts)
+		at = ts
+	}
+
+	var since hlc.Timestamp
+	if q := c.Query("since"); q != "" {
+		ts, err := hlc.Parse(q)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		since = ts
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		stats, err := store.Backup(pw, since, at)
+		if err != nil {
+			h.log.Error().Err(err).Msg("snapshot failed")
+		} else {
+			h.log.Info().
+				Int("records", stats.Records).
+				Int("chunks", stats.Chunks).
+				Int("later", stats.Later).
+				Int("unreadable", stats.Unreadable).
+				Msg("snapshot streamed")
+		}
+		// an error aborts the response so the client never sees a
+		// truncated snapshot as complete
+		pw.CloseWithError(err)
+	}()
+
+	c.Set(fiber.HeaderContentType, defaultContentType)
+	c.Set(HeaderNodeID, h.nodeID)
+	c.Context().SetBodyStream(pr, -1)
+
+	return nil
+}
+
+// records every admin request in the audit log once it has been handled
+func (h *Handler) auditAdmin(c *fiber.Ctx) error {
+	err := c.Next()
+	if h.auditLog != nil {
+		h.auditLog.RecordAs(principalName(c), c.Method()+" "+c.Path(), "", err)
+	}
+	return err
+}
+
+// pages through this node's audit log. ?after= and the next field of
+// the response continue from an earlier page
+func (h *Handler) AuditLog(c *fiber.Ctx) error {
+	if h.auditLog == nil {
+		return fiber.NewError(fiber.StatusNotImplemented, "audit log is not enabled")
+	}
+
+	q := audit.Query{
+		Limit:     c.QueryInt("limit", 100),
+		Principal: c.Query("principal"),
+		Operation: c.Query("operation"),
+		Prefix:    c.Query("prefix"),
+	}
+	if after := c.Query("after"); after != "" {
+		seq, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid after")
+		}
+		q.After = seq
+	}
+	if q.Limit <= 0 || q.Limit > 1000 {
+		return fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and 1000")
+	}
+
+	entries, next, err := h.auditLog.List(q)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+
+	c.Set(HeaderNodeID, h.nodeID)
+	return c.JSON(fiber.Map{
+		"entries": entries,
+		"next":    next,
+	})
+}
+
+// checks the hash chain of this node's audit log
+func (h *Handler) VerifyAuditLog(c *fiber.Ctx) error {
+	if h.auditLog == nil {
+		return fiber.NewError(fiber.StatusNotImplemented, "audit log is not enabled")
+	}
+
+	result, err := h.auditLog.Verify()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	c.Set(HeaderNodeID, h.nodeID)
+	if !result.OK {
+		c.Status(fiber.StatusConflict)
+	}
+	return c.JSON(result)
+}
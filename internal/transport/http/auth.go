@@ -0,0 +1,114 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AuraReaper/strangedb/internal/auth"
+	"github.com/gofiber/fiber/v2"
+)
+
+const localsPrincipal = "principal"
+
+// authenticates requests by their bearer token and keeps the caller for
+// the access checks after it. a nil authenticator lets every request
+// through
+func (h *Handler) authenticate(a *auth.Authenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if a == nil {
+			return c.Next()
+		}
+
+		principal, err := a.Authenticate(bearerToken(c))
+		if err != nil {
+			h.logDenied(c, nil, auth.AccessNone, "", err.Error())
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="strangedb"`)
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+
+		c.Locals(localsPrincipal, principal)
+		return c.Next()
+	}
+}
+
+func bearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// requires access to the key or prefix scope returns
+func (h *Handler) require(access auth.Access, scope func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := h.authorize(c, access, scope(c)); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+func param(name string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		return c.Params(name)
+	}
+}
+
+func query(name string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		return c.Query(name)
+	}
+}
+
+// the whole keyspace
+func everything(*fiber.Ctx) string {
+	return ""
+}
+
+// checks the caller's access to a key, or to every key under a prefix.
+// handlers that find their keys in the body call it themselves
+func (h *Handler) authorize(c *fiber.Ctx, access auth.Access, key string) error {
+	principal, ok := c.Locals(localsPrincipal).(*auth.Principal)
+	if !ok {
+		// auth is disabled
+		return nil
+	}
+
+	if principal.Can(access, key) {
+		return nil
+	}
+
+	err := fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s access to %q denied", access, key))
+	h.logDenied(c, principal, access, key, "insufficient role")
+	if h.auditLog != nil {
+		h.auditLog.RecordAs(principal.Name, c.Method()+" "+c.Path(), key, err)
+	}
+	return err
+}
+
+// the name of the authenticated caller, "" when auth is disabled
+func principalName(c *fiber.Ctx) string {
+	if principal, ok := c.Locals(localsPrincipal).(*auth.Principal); ok {
+		return principal.Name
+	}
+	return ""
+}
+
+// logs a denied request
+func (h *Handler) logDenied(c *fiber.Ctx, principal *auth.Principal, access auth.Access, key, reason string) {
+	event := h.authLog.Warn().
+		Str("method", c.Method()).
+		Str("path", c.Path()).
+		Str("ip", c.IP()).
+		Str("reason", reason)
+
+	if principal != nil {
+		event = event.Str("principal", principal.Name).Strs("roles", principal.Roles)
+	}
+	if access != auth.AccessNone {
+		event = event.Str("access", access.String()).Str("key", key)
+	}
+
+	event.Msg("request denied")
+}
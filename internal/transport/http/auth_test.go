@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/auth"
+)
+
+func testAuthenticator(t *testing.T) *auth.Authenticator {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	cfg := `{
+		"roles": {"orders": [{"namespace": "orders", "access": "read"}]},
+		"tokens": [{"name": "ci", "sha256": "` + auth.HashToken("ci-token") + `", "roles": ["orders"]}]
+	}`
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatalf("Failed to write auth file: %v", err)
+	}
+
+	a, err := auth.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load auth file: %v", err)
+	}
+	return a
+}
+
+func TestListKeysStaysInGrantedPrefix(t *testing.T) {
+	plain, _ := setupTestServer(t)
+	server := NewServer(plain.handler, 0, ServerOptions{Auth: testAuthenticator(t)})
+
+	for _, key := range []string{"orders:1", "orders:2", "users:1"} {
+		resp, err := plain.app.Test(httptest.NewRequest(http.MethodPut, "/api/v1/kv/"+key, strings.NewReader("v")), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("PUT %s = %d", key, resp.StatusCode)
+		}
+	}
+
+	list := func(prefix string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/keys?prefix="+prefix, nil)
+		req.Header.Set("Authorization", "Bearer ci-token")
+		resp, err := server.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := list("orders:")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /keys?prefix=orders: = %d, want 200", resp.StatusCode)
+	}
+	var body ListKeysResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Keys) != 2 {
+		t.Fatalf("GET /keys?prefix=orders: returned %d keys, want 2", len(body.Keys))
+	}
+	for _, key := range body.Keys {
+		if !strings.HasPrefix(key.Key, "orders:") {
+			t.Errorf("GET /keys?prefix=orders: returned %q", key.Key)
+		}
+	}
+
+	if resp := list("users:"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /keys?prefix=users: = %d, want 403", resp.StatusCode)
+	}
+}
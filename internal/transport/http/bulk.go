@@ -0,0 +1,145 @@
+package http
+
+import (
+	"errors"
+
+	"github.com/AuraReaper/strangedb/internal/auth"
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultScanLimit = 1000
+	maxScanLimit     = 10000
+)
+
+type ScanResponse struct {
+	Keys []KeyInfo `json:"keys"`
+	// pass back as ?after= for the next page; empty once the scan is done
+	Next string `json:"next,omitempty"`
+}
+
+// pages through every key in the cluster in key order
+func (h *Handler) Scan(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultScanLimit)
+	if limit <= 0 || limit > maxScanLimit {
+		return fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and 10000")
+	}
+
+	page, err := h.coordinator.Scan(requestContext(c), c.Query("prefix"), c.Query("after"), limit)
+	if err != nil {
+		if errors.Is(err, coordinator.ErrOverloaded) {
+			return overloaded(c)
+		}
+		if errors.Is(err, coordinator.ErrTimeout) {
+			return fiber.NewError(fiber.StatusGatewayTimeout, err.Error())
+		}
+		if err == coordinator.ErrQuorumNotReached || err == coordinator.ErrNoNodesAvailable {
+			return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	resp := ScanResponse{
+		Keys: make([]KeyInfo, len(page.Records)),
+		Next: page.Next,
+	}
+	for i, r := range page.Records {
+		resp.Keys[i] = toKeyInfo(r)
+	}
+
+	return c.JSON(resp)
+}
+
+type BatchRecord struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Encoding    string `json:"encoding,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	// kept as given when set, otherwise the coordinator assigns one
+	Timestamp *hlc.Timestamp `json:"timestamp,omitempty"`
+}
+
+type BatchRequest struct {
+	Records []BatchRecord `json:"records"`
+}
+
+type BatchResponse struct {
+	Success bool     `json:"success"`
+	Written int      `json:"written"`
+	Failed  []string `json:"failed,omitempty"`
+}
+
+// writes many keys at once, one request per replica set
+func (h *Handler) Batch(c *fiber.Ctx) error {
+	var req BatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+
+	records := make([]*storage.Record, len(req.Records))
+	for i, r := range req.Records {
+		if r.Key == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "key is required")
+		}
+		if err := h.authorize(c, auth.AccessWrite, r.Key); err != nil {
+			return err
+		}
+
+		value, err := decodeValue(r.Value, r.Encoding)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, r.Key+": "+err.Error())
+		}
+
+		records[i] = &storage.Record{
+			Key:         r.Key,
+			Value:       value,
+			ContentType: r.ContentType,
+		}
+		if r.Timestamp != nil {
+			records[i].Timestamp = *r.Timestamp
+		}
+	}
+
+	keys := make([]string, len(records))
+	for i, record := range records {
+		keys[i] = record.Key
+	}
+	// every key counts, so a batch job is limited like its single writes
+	if err := h.allow(c, len(records), keys...); err != nil {
+		return err
+	}
+
+	ctx, err := consistencyContext(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.coordinator.Batch(ctx, records)
+	if err == coordinator.ErrQuorumNotReached {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "quorum not reached")
+	}
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return fiber.NewError(fiber.StatusInsufficientStorage, err.Error())
+	}
+	if errors.Is(err, coordinator.ErrClockSkew) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, coordinator.ErrOverloaded) {
+		return overloaded(c)
+	}
+	if errors.Is(err, coordinator.ErrTimeout) {
+		return fiber.NewError(fiber.StatusGatewayTimeout, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(BatchResponse{
+		Success: len(result.Failed) == 0,
+		Written: result.Written,
+		Failed:  result.Failed,
+	})
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	EncodingUTF8   = "utf8"
+	EncodingBase64 = "base64"
+
+	defaultContentType = "application/octet-stream"
+
+	// cap on JSON request bodies, which are parsed in memory
+	maxJSONBodySize = 4 * 1024 * 1024
+)
+
+// decodes a JSON value field; utf8 is the default for compatibility
+func decodeValue(value, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", EncodingUTF8:
+		return []byte(value), nil
+	case EncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 value: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// encodes a value for JSON output, falling back to base64 when utf8 was
+// requested (or nothing was) but the bytes are not valid utf8
+func encodeValue(value []byte, encoding string) (string, string, error) {
+	switch encoding {
+	case "", EncodingUTF8:
+		if utf8.Valid(value) {
+			return string(value), EncodingUTF8, nil
+		}
+		if encoding == EncodingUTF8 {
+			return "", "", fmt.Errorf("value is not valid utf8, use encoding=base64")
+		}
+		return base64.StdEncoding.EncodeToString(value), EncodingBase64, nil
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(value), EncodingBase64, nil
+	default:
+		return "", "", fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
@@ -0,0 +1,208 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+)
+
+func do(t *testing.T, server *Server, req *http.Request) (*http.Response, []byte) {
+	t.Helper()
+
+	resp, err := server.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func getJSON(t *testing.T, server *Server, path string) (int, GetKeyResponse) {
+	t.Helper()
+
+	resp, body := do(t, server, httptest.NewRequest(http.MethodGet, path, nil))
+	var got GetKeyResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("GET %s: %v in %s", path, err, body)
+		}
+	}
+	return resp.StatusCode, got
+}
+
+func TestValueRoundTrips(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe}
+
+	tests := []struct {
+		name string
+		// stores the value under key k
+		put         func() *http.Request
+		value       []byte
+		contentType string
+		// encoding of the default JSON read
+		encoding string
+	}{
+		{
+			name: "raw bytes with content type",
+			put: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPut, "/api/v1/kv/k", bytes.NewReader(binary))
+				req.Header.Set("Content-Type", "image/png")
+				return req
+			},
+			value:       binary,
+			contentType: "image/png",
+			encoding:    EncodingBase64,
+		},
+		{
+			name: "raw bytes without content type",
+			put: func() *http.Request {
+				return httptest.NewRequest(http.MethodPut, "/api/v1/kv/k", bytes.NewReader(binary))
+			},
+			value:       binary,
+			contentType: defaultContentType,
+			encoding:    EncodingBase64,
+		},
+		{
+			name: "raw text",
+			put: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPut, "/api/v1/kv/k", strings.NewReader("héllo"))
+				req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+				return req
+			},
+			value:       []byte("héllo"),
+			contentType: "text/plain; charset=utf-8",
+			encoding:    EncodingUTF8,
+		},
+		{
+			name: "json base64",
+			put: func() *http.Request {
+				body, _ := json.Marshal(SetKeyRequest{
+					Key:         "k",
+					Value:       base64.StdEncoding.EncodeToString(binary),
+					Encoding:    EncodingBase64,
+					ContentType: "image/png",
+				})
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/kv", bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				return req
+			},
+			value:       binary,
+			contentType: "image/png",
+			encoding:    EncodingBase64,
+		},
+		{
+			name: "json utf8",
+			put: func() *http.Request {
+				body, _ := json.Marshal(SetKeyRequest{Key: "k", Value: "héllo"})
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/kv", bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				return req
+			},
+			value:       []byte("héllo"),
+			contentType: defaultContentType,
+			encoding:    EncodingUTF8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := setupTestServer(t)
+
+			if resp, body := do(t, server, tt.put()); resp.StatusCode != http.StatusOK {
+				t.Fatalf("write = %d: %s", resp.StatusCode, body)
+			}
+
+			// raw, asked for either way
+			raw := httptest.NewRequest(http.MethodGet, "/api/v1/kv/k?raw=true", nil)
+			accept := httptest.NewRequest(http.MethodGet, "/api/v1/kv/k", nil)
+			accept.Header.Set("Accept", "application/octet-stream")
+			for _, req := range []*http.Request{raw, accept} {
+				resp, body := do(t, server, req)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("GET %s = %d: %s", req.URL, resp.StatusCode, body)
+				}
+				if !bytes.Equal(body, tt.value) {
+					t.Errorf("GET %s = %q, want %q", req.URL, body, tt.value)
+				}
+				if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+					t.Errorf("GET %s content type %q, want %q", req.URL, got, tt.contentType)
+				}
+			}
+
+			code, got := getJSON(t, server, "/api/v1/kv/k")
+			if code != http.StatusOK {
+				t.Fatalf("GET = %d", code)
+			}
+			value, err := decodeValue(got.Value, got.Encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Encoding != tt.encoding || !bytes.Equal(value, tt.value) {
+				t.Errorf("GET = %q as %s, want %q as %s", got.Value, got.Encoding, tt.value, tt.encoding)
+			}
+
+			// base64 can always be forced
+			code, got = getJSON(t, server, "/api/v1/kv/k?encoding=base64")
+			if code != http.StatusOK || got.Encoding != EncodingBase64 || got.Value != base64.StdEncoding.EncodeToString(tt.value) {
+				t.Errorf("GET ?encoding=base64 = %d, %q as %s", code, got.Value, got.Encoding)
+			}
+		})
+	}
+}
+
+func TestInvalidEncodings(t *testing.T) {
+	server, coord := setupTestServer(t)
+
+	for _, req := range []SetKeyRequest{
+		{Key: "k", Value: "not base64!", Encoding: EncodingBase64},
+		{Key: "k", Value: "v", Encoding: "hex"},
+	} {
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/kv", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if resp, _ := do(t, server, r); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %+v = %d, want 400", req, resp.StatusCode)
+		}
+	}
+
+	// bytes that are not utf8 cannot be returned as utf8
+	if _, err := coord.Set(t.Context(), "binary", []byte{0xff}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := getJSON(t, server, "/api/v1/kv/binary?encoding=utf8"); code != http.StatusBadRequest {
+		t.Errorf("GET ?encoding=utf8 of binary = %d, want 400", code)
+	}
+}
+
+func TestChunkedValueIsRawOnly(t *testing.T) {
+	server, _ := setupTestServer(t)
+	value := bytes.Repeat([]byte{0xab}, coordinator.ChunkSize+1)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/kv/blob", bytes.NewReader(value))
+	req.Header.Set("Content-Type", "video/mp4")
+	if resp, body := do(t, server, req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT = %d: %s", resp.StatusCode, body)
+	}
+
+	if code, _ := getJSON(t, server, "/api/v1/kv/blob"); code != http.StatusNotAcceptable {
+		t.Errorf("JSON GET of a chunked value = %d, want 406", code)
+	}
+
+	resp, body := do(t, server, httptest.NewRequest(http.MethodGet, "/api/v1/kv/blob?raw=true", nil))
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, value) {
+		t.Fatalf("raw GET = %d with %d bytes, want 200 with %d", resp.StatusCode, len(body), len(value))
+	}
+	if got := resp.Header.Get("Content-Type"); got != "video/mp4" {
+		t.Errorf("content type %q, want video/mp4", got)
+	}
+}
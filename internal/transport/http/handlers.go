@@ -1,17 +1,26 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/AuraReaper/strangedb/internal/audit"
+	"github.com/AuraReaper/strangedb/internal/auth"
 	"github.com/AuraReaper/strangedb/internal/coordinator"
 	"github.com/AuraReaper/strangedb/internal/gossip"
 	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ratelimit"
 	"github.com/AuraReaper/strangedb/internal/ring"
 	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	"github.com/AuraReaper/strangedb/internal/transport/hangup"
 	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
 )
 
 type Handler struct {
@@ -21,10 +30,15 @@ type Handler struct {
 	startTime   time.Time
 	gossiper    *gossip.Gossiper
 	ring        *ring.ConsistentHashRing
+	auditLog    *audit.Log
+	limiter     *ratelimit.Limiter
+	peers       *grpcTransport.Client
+	log         zerolog.Logger
+	authLog     zerolog.Logger
 }
 
 func NewHandler(coord *coordinator.Coordinator, clock *hlc.Clock, nodeID string,
-	gossiper *gossip.Gossiper, ring *ring.ConsistentHashRing) *Handler {
+	gossiper *gossip.Gossiper, ring *ring.ConsistentHashRing, log zerolog.Logger) *Handler {
 	return &Handler{
 		coordinator: coord,
 		clock:       clock,
@@ -32,12 +46,25 @@ func NewHandler(coord *coordinator.Coordinator, clock *hlc.Clock, nodeID string,
 		startTime:   time.Now(),
 		gossiper:    gossiper,
 		ring:        ring,
+		log:         log,
 	}
 }
 
+// records admin actions and denied requests, and serves /admin/audit
+func (h *Handler) SetAuditLog(l *audit.Log) {
+	h.auditLog = l
+}
+
+// the client replica RPCs go through, for its circuit breakers
+func (h *Handler) SetPeerClient(c *grpcTransport.Client) {
+	h.peers = c
+}
+
 type SetKeyRequest struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Encoding    string `json:"encoding,omitempty"` // utf8 (default) or base64
+	ContentType string `json:"content_type,omitempty"`
 }
 
 type SetKeyResponse struct {
@@ -55,10 +82,217 @@ func (h *Handler) SetKey(c *fiber.Ctx) error {
 	if req.Key == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "key is required")
 	}
+	if err := h.authorize(c, auth.AccessWrite, req.Key); err != nil {
+		return err
+	}
+	if err := h.allow(c, 1, req.Key); err != nil {
+		return err
+	}
+
+	value, err := decodeValue(req.Value, req.Encoding)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return h.setKey(c, req.Key, value, req.ContentType, hlc.Timestamp{})
+}
+
+// stores the request body verbatim, tagged with its Content-Type.
+// bodies larger than one chunk are streamed to the replicas in chunks
+// and never held in memory as a whole
+func (h *Handler) PutKey(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if key == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "key is required")
+	}
+
+	contentType := c.Get(fiber.HeaderContentType)
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	ts, err := preservedTimestamp(c)
+	if err != nil {
+		return err
+	}
+
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		// the body buffer is reused by fasthttp once the handler returns
+		value := append([]byte(nil), c.Body()...)
+		return h.setKey(c, key, value, contentType, ts)
+	}
 
-	ctx := context.Background()
-	record, err := h.coordinator.Set(ctx, req.Key, []byte(req.Value))
+	head, err := io.ReadAll(io.LimitReader(body, coordinator.ChunkSize+1))
 	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if len(head) <= coordinator.ChunkSize {
+		return h.setKey(c, key, head, contentType, ts)
+	}
+
+	ctx, err := consistencyContext(c)
+	if err != nil {
+		return err
+	}
+
+	record, err := h.coordinator.ImportLarge(ctx, key,
+		io.MultiReader(bytes.NewReader(head), body), contentType, ts)
+	if err != nil {
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			return fiber.NewError(fiber.StatusInsufficientStorage, err.Error())
+		}
+		if errors.Is(err, coordinator.ErrClockSkew) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, coordinator.ErrOverloaded) {
+			return overloaded(c)
+		}
+		if errors.Is(err, coordinator.ErrTimeout) {
+			return fiber.NewError(fiber.StatusGatewayTimeout, err.Error())
+		}
+		if err == coordinator.ErrQuorumNotReached {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "quorum not reached")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(SetKeyResponse{
+		Success:   true,
+		Key:       key,
+		Timestamp: record.Timestamp,
+	})
+}
+
+// header carrying the timestamp a write keeps instead of a new one, as
+// formatted by hlc.Timestamp.String; also accepted as ?timestamp=. like
+// a batch record with a timestamp, it never replaces a newer value
+const HeaderTimestamp = "X-Timestamp"
+
+// the zero timestamp when the client sent none
+func preservedTimestamp(c *fiber.Ctx) (hlc.Timestamp, error) {
+	v := c.Query("timestamp", c.Get(HeaderTimestamp))
+	if v == "" {
+		return hlc.Timestamp{}, nil
+	}
+
+	ts, err := hlc.Parse(v)
+	if err != nil || ts.WallTime <= 0 {
+		return hlc.Timestamp{}, fiber.NewError(fiber.StatusBadRequest, "invalid timestamp")
+	}
+	return ts, nil
+}
+
+// header naming the consistency level of a key operation, also accepted
+// as ?consistency=
+const HeaderConsistency = "X-Consistency"
+
+// context for a key operation at the consistency level the client asked
+// for, or the configured quorums when it asked for none
+func consistencyContext(c *fiber.Ctx) (context.Context, error) {
+	level, err := coordinator.ParseConsistency(c.Query("consistency", c.Get(HeaderConsistency)))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return coordinator.WithConsistency(requestContext(c), level), nil
+}
+
+// header bounding how long a request may take, a duration such as
+// 250ms; also accepted as ?timeout=
+const HeaderTimeout = "X-Timeout"
+
+// gives the request context the deadline the client asked for, and
+// cancels it when the client hangs up, so replica work stops for a
+// caller that has gone
+func deadline(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.UserContext())
+	defer cancel()
+
+	if v := c.Query("timeout", c.Get(HeaderTimeout)); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid timeout")
+		}
+
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	stop := hangup.Watch(c.Context().Conn(), cancel)
+	defer stop()
+
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// carries the caller into the audit log, and the deadline and
+// cancellation of the request into the coordinator
+func requestContext(c *fiber.Ctx) context.Context {
+	return audit.WithPrincipal(c.UserContext(), principalName(c))
+}
+
+// answers 503 when the node shed the request, with a hint to come back
+// once the queue has drained
+func overloaded(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderRetryAfter, "1")
+	return fiber.NewError(fiber.StatusServiceUnavailable, coordinator.ErrOverloaded.Error())
+}
+
+// request bodies are streamed so large uploads never sit in memory.
+// only PUT /api/v1/kv/:key reads its body as a stream; every other
+// request has its body read here, up to maxJSONBodySize
+func limitBody(c *fiber.Ctx) error {
+	if c.Method() == fiber.MethodPut && strings.HasPrefix(c.Path(), "/api/v1/kv/") {
+		return c.Next()
+	}
+
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		return c.Next()
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxJSONBodySize+1))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if len(data) > maxJSONBodySize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge,
+			"request body too large, upload large values with PUT /api/v1/kv/:key")
+	}
+
+	c.Request().SetBody(data)
+	return c.Next()
+}
+
+// a non-zero ts is kept, going through the batch path that merges
+// preserved timestamps
+func (h *Handler) setKey(c *fiber.Ctx, key string, value []byte, contentType string, ts hlc.Timestamp) error {
+	ctx, err := consistencyContext(c)
+	if err != nil {
+		return err
+	}
+
+	record := &storage.Record{Key: key, Value: value, ContentType: contentType, Timestamp: ts}
+	if ts.WallTime == 0 {
+		record, err = h.coordinator.Set(ctx, key, value, contentType)
+	} else {
+		_, err = h.coordinator.Batch(ctx, []*storage.Record{record})
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			return fiber.NewError(fiber.StatusInsufficientStorage, err.Error())
+		}
+		if errors.Is(err, coordinator.ErrClockSkew) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, coordinator.ErrOverloaded) {
+			return overloaded(c)
+		}
+		if errors.Is(err, coordinator.ErrTimeout) {
+			return fiber.NewError(fiber.StatusGatewayTimeout, err.Error())
+		}
 		if err == coordinator.ErrQuorumNotReached {
 			return fiber.NewError(fiber.StatusServiceUnavailable, "quorum not reached")
 		}
@@ -67,16 +301,28 @@ func (h *Handler) SetKey(c *fiber.Ctx) error {
 
 	return c.JSON(SetKeyResponse{
 		Success:   true,
-		Key:       req.Key,
+		Key:       key,
 		Timestamp: record.Timestamp,
 	})
 }
 
 type GetKeyResponse struct {
-	Key       string        `json:"key"`
-	Value     string        `json:"value"`
-	Timestamp hlc.Timestamp `json:"timestamp"`
-	Node      string        `json:"node"`
+	Key         string        `json:"key"`
+	Value       string        `json:"value"`
+	Encoding    string        `json:"encoding"`
+	ContentType string        `json:"content_type,omitempty"`
+	Timestamp   hlc.Timestamp `json:"timestamp"`
+	Node        string        `json:"node"`
+}
+
+// raw bytes are returned for ?raw=true or when the client prefers
+// application/octet-stream over JSON
+func wantsRaw(c *fiber.Ctx) bool {
+	if c.QueryBool("raw") {
+		return true
+	}
+
+	return c.Accepts(fiber.MIMEApplicationJSON, defaultContentType) == defaultContentType
 }
 
 func (h *Handler) GetKey(c *fiber.Ctx) error {
@@ -85,7 +331,11 @@ func (h *Handler) GetKey(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "key is required")
 	}
 
-	ctx := context.Background()
+	ctx, err := consistencyContext(c)
+	if err != nil {
+		return err
+	}
+
 	record, err := h.coordinator.Get(ctx, key)
 	if err == storage.ErrKeyNotFound || err == storage.ErrKeyDeleted {
 		return fiber.NewError(fiber.StatusNotFound, "key not found")
@@ -93,18 +343,69 @@ func (h *Handler) GetKey(c *fiber.Ctx) error {
 	if err == coordinator.ErrQuorumNotReached {
 		return fiber.NewError(fiber.StatusServiceUnavailable, "quorum not reached")
 	}
+	if errors.Is(err, coordinator.ErrOverloaded) {
+		return overloaded(c)
+	}
+	if errors.Is(err, coordinator.ErrTimeout) {
+		return fiber.NewError(fiber.StatusGatewayTimeout, err.Error())
+	}
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
 
+	if record.Manifest {
+		return h.sendLarge(c, record)
+	}
+
+	if wantsRaw(c) {
+		contentType := record.ContentType
+		if contentType == "" {
+			contentType = defaultContentType
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		return c.Send(record.Value)
+	}
+
+	value, encoding, err := encodeValue(record.Value, c.Query("encoding"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
 	return c.JSON(GetKeyResponse{
-		Key:       record.Key,
-		Value:     string(record.Value),
-		Timestamp: record.Timestamp,
-		Node:      h.nodeID,
+		Key:         record.Key,
+		Value:       value,
+		Encoding:    encoding,
+		ContentType: record.ContentType,
+		Timestamp:   record.Timestamp,
+		Node:        h.nodeID,
 	})
 }
 
+// streams a chunked value; it is only available as raw bytes since
+// inlining it in JSON would mean buffering the whole object
+func (h *Handler) sendLarge(c *fiber.Ctx, record *storage.Record) error {
+	if !wantsRaw(c) {
+		return fiber.NewError(fiber.StatusNotAcceptable,
+			"value is stored in chunks, request it with ?raw=true")
+	}
+
+	// fasthttp reads the body after the handler returns, so the reader
+	// must not depend on a request scoped context
+	reader, manifest, err := h.coordinator.OpenLarge(context.Background(), record)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	contentType := record.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Context().SetBodyStream(reader, int(manifest.Size))
+
+	return nil
+}
+
 type DeleteKeyResponse struct {
 	Success   bool   `json:"success"`
 	Key       string `json:"key"`
@@ -117,8 +418,18 @@ func (h *Handler) DeleteKey(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "key is required")
 	}
 
-	ctx := context.Background()
+	ctx, err := consistencyContext(c)
+	if err != nil {
+		return err
+	}
+
 	if err := h.coordinator.Delete(ctx, key); err != nil {
+		if errors.Is(err, coordinator.ErrOverloaded) {
+			return overloaded(c)
+		}
+		if errors.Is(err, coordinator.ErrTimeout) {
+			return fiber.NewError(fiber.StatusGatewayTimeout, err.Error())
+		}
 		if err == coordinator.ErrQuorumNotReached {
 			return fiber.NewError(fiber.StatusServiceUnavailable, "quorum not reached")
 		}
@@ -164,51 +475,174 @@ type ClusterStatusResponse struct {
 	NodeID  string       `json:"node_id"`
 	Members []MemberInfo `json:"members"`
 	Total   int          `json:"total"`
+	// circuit breaker of every peer this node has called, by address
+	Circuits map[string]grpcTransport.Circuit `json:"circuits,omitempty"`
 }
 
 type MemberInfo struct {
-	NodeID string `json:"node_id"`
-	Addr   string `json:"addr"`
-	Status string `json:"status"`
+	NodeID string  `json:"node_id"`
+	Addr   string  `json:"addr"`
+	Status string  `json:"status"`
+	DC     string  `json:"dc,omitempty"`
+	Rack   string  `json:"rack,omitempty"`
+	Weight float64 `json:"weight,omitempty"`
 }
 
 func (h *Handler) ClusterStatus(c *fiber.Ctx) error {
 	var members []MemberInfo
 
 	if h.gossiper != nil {
+		all := h.gossiper.GetAllMembers()
 		for _, addr := range h.gossiper.GetMembers() {
 			members = append(members, MemberInfo{
 				NodeID: addr,
 				Addr:   addr,
 				Status: "alive",
+				DC:     all[addr].DC,
+				Rack:   all[addr].Rack,
+				Weight: all[addr].Weight,
 			})
 		}
 	}
 
-	return c.JSON(ClusterStatusResponse{
+	resp := ClusterStatusResponse{
 		NodeID:  h.nodeID,
 		Members: members,
 		Total:   len(members),
-	})
+	}
+	if h.peers != nil {
+		resp.Circuits = h.peers.Circuits()
+	}
+
+	return c.JSON(resp)
 }
 
 func (h *Handler) RingStatus(c *fiber.Ctx) error {
 	nodes := h.ring.GetNodes()
+	resp := fiber.Map{
+		"nodes":           nodes,
+		"total_nodes":     len(nodes),
+		"vnodes_per_node": h.ring.VNodes(),
+		"partitioner":     h.ring.Partitioner().Name(),
+		"topology":        h.ring.Topologies(),
+	}
+	if dcReplication := h.ring.DCReplication(); len(dcReplication) > 0 {
+		resp["dc_replication"] = dcReplication
+	}
+
+	weights := make(map[string]float64)
+	for _, node := range nodes {
+		if w := h.ring.Weight(node); w != 1 {
+			weights[node] = w
+		}
+	}
+	if len(weights) > 0 {
+		resp["weights"] = weights
+	}
+
+	return c.JSON(resp)
+}
+
+// share of the token space each node owns, as primary and as any of
+// the n replicas; n defaults to the cluster's replication factor
+func (h *Handler) Ownership(c *fiber.Ctx) error {
+	n := c.QueryInt("n", h.coordinator.ReplicationN())
+	if n <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "n must be positive")
+	}
+
+	return c.JSON(fiber.Map{
+		"partitioner": h.ring.Partitioner().Name(),
+		"replication": n,
+		"nodes":       h.ring.Ownership(n),
+	})
+}
+
+// the token map, one range per virtual node with its replica set, for
+// debugging and client side routing
+func (h *Handler) Tokens(c *fiber.Ctx) error {
+	n := c.QueryInt("n", h.coordinator.ReplicationN())
+	if n <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "n must be positive")
+	}
+
 	return c.JSON(fiber.Map{
-		"nodes":       nodes,
-		"total_nodes": len(nodes),
+		"partitioner": h.ring.Partitioner().Name(),
+		"replication": n,
+		"ranges":      h.ring.Tokens(n),
 	})
 }
 
+type ReplicaInfo struct {
+	Addr  string `json:"addr"`
+	State string `json:"state"`
+	DC    string `json:"dc,omitempty"`
+	Rack  string `json:"rack,omitempty"`
+}
+
+type LocateResponse struct {
+	Key         string        `json:"key"`
+	Token       uint64        `json:"token,string"`
+	Partitioner string        `json:"partitioner"`
+	Primary     string        `json:"primary"`
+	Replicas    []ReplicaInfo `json:"replicas"`
+}
+
+// where a key lives: its token, its replicas primary first, and what
+// gossip currently says about each of them
+func (h *Handler) Locate(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if key == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "key is required")
+	}
+
+	var members map[string]gossip.Member
+	if h.gossiper != nil {
+		members = h.gossiper.GetAllMembers()
+	}
+
+	partitioner := h.ring.Partitioner()
+	resp := LocateResponse{
+		Key:         key,
+		Token:       partitioner.Token(key),
+		Partitioner: partitioner.Name(),
+		Replicas:    []ReplicaInfo{},
+	}
+
+	for _, addr := range h.ring.GetReplicas(key, h.coordinator.ReplicationN()) {
+		state := "unknown"
+		if member, ok := members[addr]; ok {
+			state = member.State.String()
+		}
+
+		topology := h.ring.Topology(addr)
+		resp.Replicas = append(resp.Replicas, ReplicaInfo{
+			Addr:  addr,
+			State: state,
+			DC:    topology.DC,
+			Rack:  topology.Rack,
+		})
+	}
+	if len(resp.Replicas) > 0 {
+		resp.Primary = resp.Replicas[0].Addr
+	}
+
+	return c.JSON(resp)
+}
+
 type ListKeysResponse struct {
 	Keys  []KeyInfo `json:"keys"`
 	Total int       `json:"total"`
 }
 
 type KeyInfo struct {
-	Key       string        `json:"key"`
-	Value     string        `json:"value"`
-	Timestamp hlc.Timestamp `json:"timestamp"`
+	Key         string        `json:"key"`
+	Value       string        `json:"value"`
+	Encoding    string        `json:"encoding,omitempty"`
+	ContentType string        `json:"content_type,omitempty"`
+	Chunked     bool          `json:"chunked,omitempty"`
+	Size        int64         `json:"size,omitempty"`
+	Timestamp   hlc.Timestamp `json:"timestamp"`
 }
 
 // returns all keys, optionally filtered by prefix and sorted
@@ -253,11 +687,7 @@ func (h *Handler) ListKeys(c *fiber.Ctx) error {
 	// Convert to response
 	keys := make([]KeyInfo, len(records))
 	for i, r := range records {
-		keys[i] = KeyInfo{
-			Key:       r.Key,
-			Value:     string(r.Value),
-			Timestamp: r.Timestamp,
-		}
+		keys[i] = toKeyInfo(r)
 	}
 
 	return c.JSON(ListKeysResponse{
@@ -265,3 +695,21 @@ func (h *Handler) ListKeys(c *fiber.Ctx) error {
 		Total: len(keys),
 	})
 }
+
+func toKeyInfo(r *storage.Record) KeyInfo {
+	info := KeyInfo{
+		Key:         r.Key,
+		ContentType: r.ContentType,
+		Timestamp:   r.Timestamp,
+	}
+
+	// chunked values are too large to inline
+	if manifest, err := storage.ParseManifest(r); err == nil {
+		info.Chunked = true
+		info.Size = manifest.Size
+		return info
+	}
+
+	info.Value, info.Encoding, _ = encodeValue(r.Value, "")
+	return info
+}
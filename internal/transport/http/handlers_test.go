@@ -0,0 +1,381 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+)
+
+const testNode = "localhost:0"
+
+// the HTTP API of a node whose keys are on it and every peer, with
+// quorums of one
+func setupTestServer(t *testing.T, peers ...string) (*Server, *coordinator.Coordinator) {
+	store := storage.NewBadgerStorage(t.TempDir())
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	hashring := ring.New(10)
+	hashring.AddNode(testNode)
+	for _, peer := range peers {
+		hashring.AddNode(peer)
+	}
+	clock := hlc.NewClock(testNode)
+
+	client := grpcTransport.NewClient(grpcTransport.ClientOptions{})
+	t.Cleanup(client.Close)
+
+	n := 1 + len(peers)
+	coord := coordinator.New(testNode, hashring, store, clock, client, n, 1, 1, zerolog.Nop())
+	handler := NewHandler(coord, clock, "node1", nil, hashring, zerolog.Nop())
+	return NewServer(handler, 0, ServerOptions{}), coord
+}
+
+func TestShedRequestGets503(t *testing.T) {
+	server, coord := setupTestServer(t)
+	coord.SetAdmission(coordinator.AdmissionOptions{MaxInFlight: 1})
+
+	// a chunked upload holds the only slot while it reads its body
+	body, upload := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := coord.SetLarge(context.Background(), "blob", body, "")
+		done <- err
+	}()
+	if _, err := upload.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/api/v1/kv/k", strings.NewReader("v")),
+		httptest.NewRequest(http.MethodGet, "/api/v1/kv/k", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/v1/kv/k", nil),
+	}
+	for _, req := range requests {
+		resp, err := server.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s %s = %d, want 503", req.Method, req.URL.Path, resp.StatusCode)
+		}
+		if resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("%s %s has Retry-After %q, want 1", req.Method, req.URL.Path, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	upload.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("SetLarge failed: %v", err)
+	}
+
+	resp, err := server.app.Test(httptest.NewRequest(http.MethodPut, "/api/v1/kv/k", strings.NewReader("v")), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("PUT = %d once the slot was free, want 200", resp.StatusCode)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	server, coord := setupTestServer(t)
+	big := strings.Repeat("x", maxJSONBodySize+1)
+
+	for _, path := range []string{"/api/v1/kv", "/api/v1/batch", "/admin/storage/migrate"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(big))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("POST %s with %d bytes = %d, want 413", path, len(big), resp.StatusCode)
+		}
+	}
+
+	// PUT streams its body, of any size
+	resp, err := server.app.Test(httptest.NewRequest(http.MethodPut, "/api/v1/kv/blob", strings.NewReader(big)), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT with %d bytes = %d, want 200", len(big), resp.StatusCode)
+	}
+	if record, err := coord.Get(context.Background(), "blob"); err != nil || !record.Manifest {
+		t.Errorf("Get = %v, %v, want the value stored in chunks", record, err)
+	}
+}
+
+func TestPutKeepsTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		chunked bool
+	}{
+		{"small", 10, false},
+		{"chunked", coordinator.ChunkSize + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, coord := setupTestServer(t)
+			ctx := context.Background()
+			old := hlc.Timestamp{WallTime: time.Now().Add(-time.Hour).UnixNano(), NodeID: "src"}
+
+			put := func(key string, ts hlc.Timestamp) int {
+				req := httptest.NewRequest(http.MethodPut, "/api/v1/kv/"+key, strings.NewReader(strings.Repeat("x", tt.size)))
+				req.Header.Set(HeaderTimestamp, ts.String())
+				resp, err := server.app.Test(req, -1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return resp.StatusCode
+			}
+
+			if code := put("k", old); code != http.StatusOK {
+				t.Fatalf("PUT = %d, want 200", code)
+			}
+			record, err := coord.Get(ctx, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hlc.Compare(record.Timestamp, old) != 0 || record.Manifest != tt.chunked {
+				t.Errorf("stored at %v (chunked %v), want %v (chunked %v)", record.Timestamp, record.Manifest, old, tt.chunked)
+			}
+
+			// an older preserved write never replaces a live one
+			live, err := coord.Set(ctx, "live", []byte("v"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code := put("live", old); code != http.StatusOK {
+				t.Fatalf("PUT = %d, want 200", code)
+			}
+			if record, err := coord.Get(ctx, "live"); err != nil || hlc.Compare(record.Timestamp, live.Timestamp) != 0 {
+				t.Errorf("live value = %v, %v, want the write at %v kept", record, err, live.Timestamp)
+			}
+
+			if code := put("ahead", hlc.Timestamp{WallTime: time.Now().Add(time.Hour).UnixNano()}); code != http.StatusBadRequest {
+				t.Errorf("PUT an hour ahead = %d, want 400", code)
+			}
+		})
+	}
+}
+
+// a replica whose writes take until the caller gives up, reporting how
+// long each waited
+type slowReplica struct {
+	pb.UnimplementedNodeServiceServer
+	waited chan time.Duration
+}
+
+func (r *slowReplica) Set(ctx context.Context, _ *pb.SetRequest) (*pb.SetResponse, error) {
+	start := time.Now()
+	<-ctx.Done()
+	r.waited <- time.Since(start)
+	return nil, ctx.Err()
+}
+
+func startSlowReplica(t *testing.T) (*slowReplica, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &slowReplica{waited: make(chan time.Duration, 1)}
+	server := grpc.NewServer()
+	pb.RegisterNodeServiceServer(server, r)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return r, listener.Addr().String()
+}
+
+func TestTimeoutGets504(t *testing.T) {
+	replica, addr := startSlowReplica(t)
+	server, _ := setupTestServer(t, addr)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/kv/k", strings.NewReader("v"))
+	req.Header.Set(HeaderTimeout, "100ms")
+	req.Header.Set(HeaderConsistency, "all")
+	resp, err := server.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("PUT = %d past its timeout, want 504", resp.StatusCode)
+	}
+
+	// the replica RPC got the client's deadline, not its own 5s
+	if waited := <-replica.waited; waited > time.Second {
+		t.Errorf("replica worked on the write for %v, want it stopped at the client's timeout", waited)
+	}
+}
+
+func TestHangupCancelsReplicaWork(t *testing.T) {
+	replica, addr := startSlowReplica(t)
+	server, _ := setupTestServer(t, addr)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.app.Listener(listener)
+	t.Cleanup(func() { server.Shutdown() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "PUT /api/v1/kv/k HTTP/1.1\r\nHost: test\r\nX-Consistency: all\r\nContent-Length: 1\r\n\r\nv")
+	// give the write time to reach the replica, then hang up
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case waited := <-replica.waited:
+		if waited > 2*time.Second {
+			t.Errorf("replica worked on the write for %v after the client hung up", waited)
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("replica still working on the write of a client that hung up")
+	}
+}
+
+// a replica that applies writes after a delay, unless the caller gives
+// up first
+type lateReplica struct {
+	pb.UnimplementedNodeServiceServer
+	applied chan error
+}
+
+func (r *lateReplica) Set(ctx context.Context, _ *pb.SetRequest) (*pb.SetResponse, error) {
+	select {
+	case <-time.After(200 * time.Millisecond):
+		r.applied <- nil
+		return &pb.SetResponse{Success: true}, nil
+	case <-ctx.Done():
+		r.applied <- ctx.Err()
+		return nil, ctx.Err()
+	}
+}
+
+func TestWriteReachesReplicasAfterLevelMet(t *testing.T) {
+	for _, level := range []string{"one", "local_quorum"} {
+		t.Run(level, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			replica := &lateReplica{applied: make(chan error, 1)}
+			grpcServer := grpc.NewServer()
+			pb.RegisterNodeServiceServer(grpcServer, replica)
+			go grpcServer.Serve(listener)
+			t.Cleanup(grpcServer.Stop)
+			addr := listener.Addr().String()
+
+			server, _ := setupTestServer(t, addr)
+			// the replica is in another datacenter, so the local write
+			// alone meets local_quorum
+			server.handler.ring.SetTopology(testNode, ring.Topology{DC: "dc1"})
+			server.handler.ring.SetTopology(addr, ring.Topology{DC: "dc2"})
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/kv/k", strings.NewReader("v"))
+			req.Header.Set(HeaderConsistency, level)
+			resp, err := server.app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("PUT = %d, want 200", resp.StatusCode)
+			}
+
+			// the request has ended by now, the replica still gets the write
+			select {
+			case err := <-replica.applied:
+				if err != nil {
+					t.Errorf("replica write cut off once the request ended: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("replica never got the write")
+			}
+		})
+	}
+}
+
+// a replica whose backlog, one old write, takes longer to arrive than
+// the batch window
+type slowBacklogReplica struct {
+	pb.UnimplementedNodeServiceServer
+}
+
+func (slowBacklogReplica) Watch(req *pb.WatchRequest, stream pb.NodeService_WatchServer) error {
+	time.Sleep(4 * watchBatchWindow)
+	record := &pb.Record{Key: "k:old", Value: []byte("v"), Timestamp: &pb.Timestamp{WallTime: 100}}
+	if err := stream.Send(&pb.WatchEvent{Record: record}); err != nil {
+		return err
+	}
+	if req.MarkReplayed {
+		if err := stream.Send(&pb.WatchEvent{Replayed: true}); err != nil {
+			return err
+		}
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func TestWatchCursorWaitsForBacklog(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterNodeServiceServer(grpcServer, slowBacklogReplica{})
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	server, coord := setupTestServer(t, listener.Addr().String())
+	if _, err := coord.Set(context.Background(), "k:new", []byte("v"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := server.app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/watch?prefix=k:&timeout=5s", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /watch = %d, want 200", resp.StatusCode)
+	}
+
+	var body WatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, event := range body.Events {
+		keys = append(keys, event.Key)
+	}
+	// the cursor passes k:old, so it must come in this response
+	if len(keys) != 2 || keys[0] != "k:old" || keys[1] != "k:new" {
+		t.Errorf("GET /watch returned %v, want [k:old k:new]", keys)
+	}
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/AuraReaper/strangedb/internal/ratelimit"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// throttles callers per client and namespace; nil limits nothing
+func (h *Handler) SetLimiter(l *ratelimit.Limiter) {
+	h.limiter = l
+}
+
+// limits the caller before the handler, counting the namespace of the
+// key or prefix scope returns
+func (h *Handler) limit(scope func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := h.allow(c, 1, scope(c)); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// takes cost tokens from the caller and the namespaces of keys, or
+// answers 429 with the seconds to wait in Retry-After. handlers that
+// find their keys in the body call it themselves
+func (h *Handler) allow(c *fiber.Ctx, cost int, keys ...string) error {
+	if h.limiter == nil {
+		return nil
+	}
+
+	var namespaces []string
+	for _, key := range keys {
+		if ns := storage.Namespace(key); !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	retryAfter, ok := h.limiter.Allow(clientID(c), namespaces, cost)
+	if ok {
+		return nil
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return fiber.NewError(fiber.StatusTooManyRequests, "rate limit exceeded")
+}
+
+// callers are told apart by principal, or by address without auth
+func clientID(c *fiber.Ctx) string {
+	if name := principalName(c); name != "" {
+		return name
+	}
+	return c.IP()
+}
+
+type usageReporter interface {
+	Usage() map[string]int64
+}
+
+type LimitsResponse struct {
+	Limits *ratelimit.Config `json:"limits"`
+	// bytes per namespace on this node
+	Usage map[string]int64 `json:"usage,omitempty"`
+}
+
+// the limits in force on this node and what each namespace stores
+func (h *Handler) Limits(c *fiber.Ctx) error {
+	var resp LimitsResponse
+	if h.limiter != nil {
+		resp.Limits = h.limiter.Config()
+	}
+	if reporter, ok := h.coordinator.Storage().(usageReporter); ok {
+		resp.Usage = reporter.Usage()
+	}
+
+	c.Set(HeaderNodeID, h.nodeID)
+	return c.JSON(resp)
+}
@@ -1,9 +1,13 @@
 package http
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
+	"github.com/AuraReaper/strangedb/internal/auth"
 	"github.com/AuraReaper/strangedb/internal/telemetry"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/adaptor"
@@ -11,52 +15,99 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
 )
 
+type ServerOptions struct {
+	// comma separated origins browsers may call the API from, * for any
+	CORSOrigins string
+	// serves HTTPS when set
+	TLS *tls.Config
+	// checks every request but /health and /metrics when set
+	Auth *auth.Authenticator
+	// where denied requests are logged
+	AuthLog zerolog.Logger
+}
+
 type Server struct {
 	app     *fiber.App
 	handler *Handler
 	port    int
+	tls     *tls.Config
 }
 
-func NewServer(handler *Handler, port int) *Server {
+func NewServer(handler *Handler, port int, opts ServerOptions) *Server {
+	if opts.CORSOrigins == "" {
+		opts.CORSOrigins = "*"
+	}
+
 	app := fiber.New(fiber.Config{
-		AppName:      "StrangeDB",
-		ErrorHandler: customErrorHandler,
+		AppName:           "StrangeDB",
+		ErrorHandler:      customErrorHandler,
+		StreamRequestBody: true,
 	})
 
 	app.Use(recover.New())
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
+		AllowOrigins: opts.CORSOrigins,
 		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
 		AllowHeaders: "Content-Type,Authorization",
 	}))
 	app.Use(metricsMiddleware())
+	app.Use(limitBody)
 
 	app.Get("/health", handler.Health)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
+	// everything else needs credentials when auth is on
+	handler.authLog = opts.AuthLog
+	authenticated := handler.authenticate(opts.Auth)
 
-	api := app.Group("/api/v1")
+	api := app.Group("/api/v1", authenticated, deadline)
 	api.Post("/kv", handler.SetKey)
-	api.Get("/kv/:key", handler.GetKey)
-	api.Delete("/kv/:key", handler.DeleteKey)
+	api.Put("/kv/:key", handler.require(auth.AccessWrite, param("key")), handler.limit(param("key")), handler.PutKey)
+	api.Get("/kv/:key", handler.require(auth.AccessRead, param("key")), handler.limit(param("key")), handler.GetKey)
+	api.Get("/locate/:key", handler.require(auth.AccessRead, param("key")), handler.Locate)
+	api.Delete("/kv/:key", handler.require(auth.AccessWrite, param("key")), handler.limit(param("key")), handler.DeleteKey)
+	api.Get("/watch", handler.require(auth.AccessRead, watchScope), handler.limit(watchScope), handler.Watch)
 	api.Get("/status", handler.Status)
-	api.Get("/cluster/status", handler.ClusterStatus)
-	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
-	app.Get("/cluster/status", handler.ClusterStatus)
-	app.Get("/cluster/ring", handler.RingStatus)
 
-	api.Get("/keys", handler.ListKeys)
+	cluster := app.Group("/cluster", authenticated)
+	cluster.Get("/status", handler.ClusterStatus)
+	cluster.Get("/ring", handler.RingStatus)
+	cluster.Get("/ownership", handler.Ownership)
+	cluster.Get("/tokens", handler.Tokens)
+
+	api.Get("/keys", handler.require(auth.AccessRead, query("prefix")), handler.limit(query("prefix")), handler.ListKeys)
+	api.Get("/scan", handler.require(auth.AccessRead, query("prefix")), handler.limit(query("prefix")), handler.Scan)
+	api.Post("/batch", handler.Batch)
+
+	admin := app.Group("/admin", authenticated, handler.require(auth.AccessAdmin, everything), handler.auditAdmin)
+	admin.Post("/storage/migrate", handler.MigrateStorage)
+	admin.Get("/snapshot", handler.Snapshot)
+	admin.Get("/audit", handler.AuditLog)
+	admin.Get("/audit/verify", handler.VerifyAuditLog)
+	admin.Get("/limits", handler.Limits)
 
 	return &Server{
 		app:     app,
 		handler: handler,
 		port:    port,
+		tls:     opts.TLS,
 	}
 }
 
 func (s *Server) Start() error {
-	return s.app.Listen(fmt.Sprintf(":%d", s.port))
+	if s.tls == nil {
+		return s.app.Listen(fmt.Sprintf(":%d", s.port))
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return err
+	}
+	return s.app.Listener(tls.NewListener(listener, s.tls))
 }
 
 func (s *Server) Shutdown() error {
@@ -86,7 +137,9 @@ func metricsMiddleware() fiber.Handler {
 			status = "error"
 		}
 
-		telemetry.RecordRequest(c.Method(), status, duration)
+		// the method points into a request buffer that is reused, and
+		// prometheus keeps the first label values it sees
+		telemetry.RecordRequest(strings.Clone(c.Method()), status, duration)
 
 		return err
 	}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+
+	// once the first event arrives, keep collecting for this long so
+	// bursts come back in one response
+	watchBatchWindow = 50 * time.Millisecond
+	maxWatchEvents   = 1000
+	// events collected before all but the oldest maxWatchEvents are
+	// dropped again
+	maxWatchCollect = 10 * maxWatchEvents
+)
+
+type WatchEvent struct {
+	Type        string        `json:"type"` // set or delete
+	Key         string        `json:"key"`
+	Value       string        `json:"value,omitempty"`
+	Encoding    string        `json:"encoding,omitempty"`
+	ContentType string        `json:"content_type,omitempty"`
+	Chunked     bool          `json:"chunked,omitempty"`
+	Size        int64         `json:"size,omitempty"`
+	Timestamp   hlc.Timestamp `json:"timestamp"`
+}
+
+type WatchResponse struct {
+	Events []WatchEvent `json:"events"`
+	// pass back as since to resume after the last event
+	Cursor string `json:"cursor"`
+}
+
+// the key or prefix a watch covers
+func watchScope(c *fiber.Ctx) string {
+	if key := c.Query("key"); key != "" {
+		return key
+	}
+	return c.Query("prefix")
+}
+
+// long-polls for changes to ?key= or ?prefix=, returning as soon as at
+// least one event is available or the timeout expires
+func (h *Handler) Watch(c *fiber.Ctx) error {
+	opts := coordinator.WatchOptions{
+		Key:    c.Query("key"),
+		Prefix: c.Query("prefix"),
+	}
+
+	if opts.Key == "" && opts.Prefix == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "key or prefix is required")
+	}
+	if opts.Key != "" && opts.Prefix != "" {
+		return fiber.NewError(fiber.StatusBadRequest, "key and prefix are mutually exclusive")
+	}
+
+	if since := c.Query("since"); since != "" {
+		ts, err := hlc.Parse(since)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		opts.Since = ts
+	}
+
+	timeout := defaultWatchTimeout
+	if t := c.Query("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid timeout")
+		}
+		timeout = min(d, maxWatchTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(requestContext(c), timeout)
+	defer cancel()
+
+	watch, err := h.coordinator.Watch(ctx, opts)
+	if err != nil {
+		if err == coordinator.ErrNoNodesAvailable {
+			return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	// the backlog comes in key order, so until all of it arrived a write
+	// not yet received can be older than the cursor would be. it is read
+	// to the end, keeping only the oldest records
+	events, replayed := watch.Events(), watch.Replayed()
+	var records []*storage.Record
+	var window <-chan time.Time
+collect:
+	for {
+		select {
+		case record, ok := <-events:
+			if !ok {
+				break collect
+			}
+
+			records = append(records, record)
+			if len(records) >= maxWatchCollect {
+				records, _ = oldestEvents(records, opts.Since, maxWatchEvents)
+			}
+
+			if window == nil && replayed == nil {
+				window = time.After(watchBatchWindow)
+			}
+		case <-replayed:
+			replayed = nil
+			if len(records) > 0 {
+				window = time.After(watchBatchWindow)
+			}
+		case <-window:
+			break collect
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	if replayed != nil {
+		return fiber.NewError(fiber.StatusGatewayTimeout, "writes since the cursor were not all read before the timeout, retry with a longer one")
+	}
+
+	records, cursor := oldestEvents(records, opts.Since, maxWatchEvents)
+
+	resp := WatchResponse{
+		Events: make([]WatchEvent, len(records)),
+		Cursor: cursor.String(),
+	}
+	for i, record := range records {
+		resp.Events[i] = toWatchEvent(record)
+	}
+	return c.JSON(resp)
+}
+
+// the oldest limit records and the cursor to resume after them. events
+// arrive in no particular order, so records left out can be older than
+// ones returned; sorting first keeps the cursor from passing them.
+// records sharing the cursor's timestamp are kept together, since
+// resuming skips that timestamp
+func oldestEvents(records []*storage.Record, since hlc.Timestamp, limit int) ([]*storage.Record, hlc.Timestamp) {
+	slices.SortStableFunc(records, func(a, b *storage.Record) int {
+		return hlc.Compare(a.Timestamp, b.Timestamp)
+	})
+
+	if len(records) > limit {
+		n := limit
+		for n < len(records) && hlc.Compare(records[n].Timestamp, records[limit-1].Timestamp) == 0 {
+			n++
+		}
+		records = records[:n]
+	}
+
+	if len(records) == 0 {
+		return records, since
+	}
+	return records, records[len(records)-1].Timestamp
+}
+
+func toWatchEvent(record *storage.Record) WatchEvent {
+	if record.Tombstone {
+		return WatchEvent{
+			Type:      "delete",
+			Key:       record.Key,
+			Timestamp: record.Timestamp,
+		}
+	}
+
+	if manifest, err := storage.ParseManifest(record); err == nil {
+		return WatchEvent{
+			Type:        "set",
+			Key:         record.Key,
+			ContentType: record.ContentType,
+			Chunked:     true,
+			Size:        manifest.Size,
+			Timestamp:   record.Timestamp,
+		}
+	}
+
+	value, encoding, _ := encodeValue(record.Value, "")
+	return WatchEvent{
+		Type:        "set",
+		Key:         record.Key,
+		Value:       value,
+		Encoding:    encoding,
+		ContentType: record.ContentType,
+		Timestamp:   record.Timestamp,
+	}
+}
@@ -0,0 +1,80 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AuraReaper/strangedb/internal/auth"
+)
+
+var (
+	errNoAuth    = errors.New("NOAUTH Authentication required.")
+	errWrongPass = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+// the keys of commands naming one, all their arguments, or every other
+// argument as MSET does
+func firstKey(args [][]byte) [][]byte { return args[1:2] }
+func allKeys(args [][]byte) [][]byte  { return args[1:] }
+
+func pairKeys(args [][]byte) [][]byte {
+	keys := make([][]byte, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// AUTH [username] token. the token is one the http api takes as a bearer
+// token; a username, which redis 6 clients always send, is ignored
+func (s *session) authenticate(_ context.Context, args [][]byte) error {
+	if len(args) > 3 {
+		return errSyntax
+	}
+	if s.auth == nil {
+		return errors.New("ERR AUTH called without any password configured")
+	}
+
+	principal, err := s.auth.Authenticate(string(args[len(args)-1]))
+	if err != nil {
+		s.logDenied("auth", nil, auth.AccessNone, "", err.Error())
+		return errWrongPass
+	}
+
+	s.principal = principal
+	s.w.simple("OK")
+	return nil
+}
+
+// checks the connection's access to a key, or to every key under a scan
+// prefix
+func (s *session) authorize(command string, access auth.Access, key string) error {
+	if s.principal == nil || s.principal.Can(access, key) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s access to %q denied", access, key)
+	s.logDenied(command, s.principal, access, key, "insufficient role")
+	if s.auditLog != nil {
+		s.auditLog.RecordAs(s.principal.Name, command, key, errors.New(msg))
+	}
+	return errors.New("NOPERM " + msg)
+}
+
+// logs a denied command the way the http api logs a denied request
+func (s *session) logDenied(command string, principal *auth.Principal, access auth.Access, key, reason string) {
+	event := s.authLog.Warn().
+		Str("command", command).
+		Str("ip", s.remote).
+		Str("reason", reason)
+
+	if principal != nil {
+		event = event.Str("principal", principal.Name).Strs("roles", principal.Roles)
+	}
+	if access != auth.AccessNone {
+		event = event.Str("access", access.String()).Str("key", key)
+	}
+
+	event.Msg("request denied")
+}
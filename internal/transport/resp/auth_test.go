@@ -0,0 +1,80 @@
+package resp
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/auth"
+	"github.com/rs/zerolog"
+)
+
+func testAuthenticator(t *testing.T) *auth.Authenticator {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	cfg := `{
+		"roles": {"orders": [{"namespace": "orders", "access": "read"}]},
+		"tokens": [{"name": "ci", "sha256": "` + auth.HashToken("ci-token") + `", "roles": ["orders"]}]
+	}`
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatalf("Failed to write auth file: %v", err)
+	}
+
+	a, err := auth.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load auth file: %v", err)
+	}
+	return a
+}
+
+func TestAuthRequired(t *testing.T) {
+	var out bytes.Buffer
+	sess := &session{
+		w:       newWriter(&out),
+		cursors: make(map[uint64]string),
+		auth:    testAuthenticator(t),
+		authLog: zerolog.Nop(),
+	}
+
+	run := func(args ...string) string {
+		out.Reset()
+		cmd := make([][]byte, len(args))
+		for i, arg := range args {
+			cmd[i] = []byte(arg)
+		}
+		sess.dispatch(context.Background(), cmd)
+		sess.w.flush()
+		return out.String()
+	}
+
+	if reply := run("PING"); !strings.HasPrefix(reply, "-NOAUTH") {
+		t.Errorf("PING before AUTH = %q", reply)
+	}
+	if reply := run("GET", "orders:1"); !strings.HasPrefix(reply, "-NOAUTH") {
+		t.Errorf("GET before AUTH = %q", reply)
+	}
+	if reply := run("AUTH", "wrong"); !strings.HasPrefix(reply, "-WRONGPASS") {
+		t.Errorf("AUTH with a bad token = %q", reply)
+	}
+	if reply := run("AUTH", "default", "ci-token"); reply != "+OK\r\n" {
+		t.Fatalf("AUTH = %q", reply)
+	}
+	if reply := run("PING"); reply != "+PONG\r\n" {
+		t.Errorf("PING after AUTH = %q", reply)
+	}
+
+	denied := [][]string{
+		{"GET", "users:1"},
+		{"SET", "orders:1", "v"},
+		{"MGET", "orders:1", "users:1"},
+		{"SCAN", "0", "MATCH", "users:*"},
+		{"SCAN", "0"},
+	}
+	for _, cmd := range denied {
+		if reply := run(cmd...); !strings.HasPrefix(reply, "-NOPERM") {
+			t.Errorf("%v = %q, expected NOPERM", cmd, reply)
+		}
+	}
+}
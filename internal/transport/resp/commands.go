@@ -0,0 +1,707 @@
+package resp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/audit"
+	"github.com/AuraReaper/strangedb/internal/auth"
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultScanCount = 10
+	maxScanCount     = 10000
+	// scan cursors a connection keeps before forgetting the oldest
+	maxCursors = 1024
+)
+
+var (
+	errSyntax     = errors.New("ERR syntax error")
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+	errOverflow   = errors.New("ERR increment or decrement would overflow")
+	errBadExpire  = errors.New("ERR invalid expire time")
+	errBadSetTTL  = errors.New("ERR invalid expire time in 'set' command")
+	errTooLarge   = errors.New("ERR value too large for this command, read it with GET")
+)
+
+// per connection state
+type session struct {
+	id    int64
+	coord *coordinator.Coordinator
+	r     *reader
+	w     *writer
+
+	// nil when auth is off
+	auth      *auth.Authenticator
+	auditLog  *audit.Log
+	authLog   zerolog.Logger
+	remote    string
+	principal *auth.Principal
+
+	name        string
+	consistency coordinator.Consistency
+
+	// redis cursors are numbers, ours are keys
+	cursors    map[uint64]string
+	nextCursor uint64
+}
+
+type command struct {
+	// argument count including the name; negative for at least -arity
+	arity int
+	// what the caller needs on the keys picks out, when auth is on
+	access  auth.Access
+	keys    func(args [][]byte) [][]byte
+	handler func(s *session, ctx context.Context, args [][]byte) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"auth":    {-2, auth.AccessNone, nil, (*session).authenticate},
+		"ping":    {-1, auth.AccessNone, nil, (*session).ping},
+		"echo":    {2, auth.AccessNone, nil, (*session).echo},
+		"select":  {2, auth.AccessNone, nil, (*session).selectDB},
+		"command": {-1, auth.AccessNone, nil, (*session).commandInfo},
+		"client":  {-2, auth.AccessNone, nil, (*session).client},
+		"get":     {2, auth.AccessRead, firstKey, (*session).get},
+		"set":     {-3, auth.AccessWrite, firstKey, (*session).set},
+		"del":     {-2, auth.AccessWrite, allKeys, (*session).del},
+		"unlink":  {-2, auth.AccessWrite, allKeys, (*session).del},
+		"exists":  {-2, auth.AccessRead, allKeys, (*session).exists},
+		"mget":    {-2, auth.AccessRead, allKeys, (*session).mget},
+		"mset":    {-3, auth.AccessWrite, pairKeys, (*session).mset},
+		// checks the prefix its pattern scans itself
+		"scan":    {-2, auth.AccessNone, nil, (*session).scan},
+		"expire":  {3, auth.AccessWrite, firstKey, (*session).expire},
+		"pexpire": {3, auth.AccessWrite, firstKey, (*session).expire},
+		"persist": {2, auth.AccessWrite, firstKey, (*session).persist},
+		"ttl":     {2, auth.AccessRead, firstKey, (*session).ttl},
+		"pttl":    {2, auth.AccessRead, firstKey, (*session).ttl},
+		"incr":    {2, auth.AccessWrite, firstKey, (*session).incr},
+		"decr":    {2, auth.AccessWrite, firstKey, (*session).incr},
+		"incrby":  {3, auth.AccessWrite, firstKey, (*session).incr},
+		"decrby":  {3, auth.AccessWrite, firstKey, (*session).incr},
+	}
+}
+
+// runs one command and reports whether the client asked to quit
+func (s *session) dispatch(ctx context.Context, args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	if name == "quit" {
+		s.w.simple("OK")
+		return true
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		s.w.error("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		s.w.error("ERR wrong number of arguments for '" + name + "' command")
+		return false
+	}
+
+	if s.auth != nil {
+		if s.principal == nil && name != "auth" {
+			s.w.error(errNoAuth.Error())
+			return false
+		}
+		if cmd.keys != nil {
+			for _, key := range cmd.keys(args) {
+				if err := s.authorize(name, cmd.access, string(key)); err != nil {
+					s.w.error(err.Error())
+					return false
+				}
+			}
+		}
+		if s.principal != nil {
+			ctx = audit.WithPrincipal(ctx, s.principal.Name)
+		}
+	}
+
+	ctx = coordinator.WithConsistency(ctx, s.consistency)
+	if err := cmd.handler(s, ctx, args); err != nil {
+		if errors.Is(err, errReplyCut) {
+			return true
+		}
+		s.w.error(errorReply(err))
+	}
+	return false
+}
+
+func errorReply(err error) string {
+	switch {
+	case errors.Is(err, coordinator.ErrQuorumNotReached), errors.Is(err, coordinator.ErrNoNodesAvailable),
+		errors.Is(err, coordinator.ErrOverloaded):
+		return "TRYAGAIN " + err.Error()
+	case errors.Is(err, coordinator.ErrTimeout):
+		return "TIMEOUT " + err.Error()
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return "OOM " + err.Error()
+	case strings.HasPrefix(err.Error(), "ERR "), strings.HasPrefix(err.Error(), "WRONGTYPE "),
+		strings.HasPrefix(err.Error(), "NOPERM "), strings.HasPrefix(err.Error(), "WRONGPASS "):
+		return err.Error()
+	default:
+		return "ERR " + err.Error()
+	}
+}
+
+func (s *session) ping(_ context.Context, args [][]byte) error {
+	switch len(args) {
+	case 1:
+		s.w.simple("PONG")
+	case 2:
+		s.w.bulk(args[1])
+	default:
+		return errors.New("ERR wrong number of arguments for 'ping' command")
+	}
+	return nil
+}
+
+func (s *session) echo(_ context.Context, args [][]byte) error {
+	s.w.bulk(args[1])
+	return nil
+}
+
+// there is a single keyspace
+func (s *session) selectDB(_ context.Context, args [][]byte) error {
+	if string(args[1]) != "0" {
+		return errors.New("ERR DB index is out of range")
+	}
+	s.w.simple("OK")
+	return nil
+}
+
+// redis-cli asks for command docs on start; it copes with none
+func (s *session) commandInfo(_ context.Context, _ [][]byte) error {
+	s.w.array(0)
+	return nil
+}
+
+// CLIENT CONSISTENCY [level] reads or sets the consistency level of the
+// connection's commands: one, quorum, local_quorum, each_quorum, all or
+// default
+func (s *session) client(_ context.Context, args [][]byte) error {
+	switch strings.ToLower(string(args[1])) {
+	case "consistency":
+		if len(args) == 2 {
+			s.w.bulk([]byte(s.consistency.String()))
+			return nil
+		}
+		if len(args) != 3 {
+			return errSyntax
+		}
+
+		level := string(args[2])
+		if strings.EqualFold(level, "default") {
+			level = ""
+		}
+		consistency, err := coordinator.ParseConsistency(level)
+		if err != nil {
+			return err
+		}
+		s.consistency = consistency
+		s.w.simple("OK")
+	case "setname":
+		if len(args) != 3 {
+			return errSyntax
+		}
+		s.name = string(args[2])
+		s.w.simple("OK")
+	case "getname":
+		if s.name == "" {
+			s.w.null()
+		} else {
+			s.w.bulk([]byte(s.name))
+		}
+	case "id":
+		s.w.integer(s.id)
+	case "setinfo":
+		s.w.simple("OK")
+	default:
+		return errors.New("ERR unknown CLIENT subcommand '" + string(args[1]) + "'")
+	}
+	return nil
+}
+
+// the current record of key, nil when there is none
+func (s *session) lookup(ctx context.Context, key string) (*storage.Record, error) {
+	record, err := s.coord.Get(ctx, key)
+	if err == storage.ErrKeyNotFound || err == storage.ErrKeyDeleted {
+		return nil, nil
+	}
+	return record, err
+}
+
+// the value of a record, reading the chunks of a large one. replies
+// that hold it in memory take no more than a client may write
+func (s *session) value(ctx context.Context, record *storage.Record) ([]byte, error) {
+	if !record.Manifest {
+		return record.Value, nil
+	}
+
+	r, manifest, err := s.coord.OpenLarge(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Size > maxBulkSize {
+		return nil, errTooLarge
+	}
+	return io.ReadAll(r)
+}
+
+// replies with the value of a record, streaming the chunks of a large
+// one. the first chunk is read before the reply starts, so a value
+// that cannot be read at all is still an error reply
+func (s *session) replyStream(ctx context.Context, record *storage.Record) error {
+	if !record.Manifest {
+		s.w.bulk(record.Value)
+		return nil
+	}
+
+	r, manifest, err := s.coord.OpenLarge(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	first := make([]byte, 32*1024)
+	n, err := io.ReadFull(r, first[:min(int64(len(first)), manifest.Size)])
+	if err != nil {
+		return err
+	}
+	return s.w.bulkFrom(io.MultiReader(bytes.NewReader(first[:n]), r), manifest.Size)
+}
+
+func (s *session) get(ctx context.Context, args [][]byte) error {
+	record, err := s.lookup(ctx, string(args[1]))
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		s.w.null()
+		return nil
+	}
+
+	return s.replyStream(ctx, record)
+}
+
+// SET key value [NX|XX] [GET] [EX s|PX ms|EXAT ts|PXAT ts|KEEPTTL]. NX,
+// XX, GET and KEEPTTL read the key first and are not atomic
+func (s *session) set(ctx context.Context, args [][]byte) error {
+	key, value := string(args[1]), args[2]
+
+	var nx, xx, get, keepTTL bool
+	var expiresAt time.Time
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		switch opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(args) || !expiresAt.IsZero() {
+				return errSyntax
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return errNotInteger
+			}
+			var ok bool
+			if expiresAt, ok = expiryTime(opt, n); !ok || n <= 0 {
+				return errBadSetTTL
+			}
+		default:
+			return errSyntax
+		}
+	}
+	if (nx && xx) || (keepTTL && !expiresAt.IsZero()) {
+		return errSyntax
+	}
+
+	var current *storage.Record
+	if nx || xx || get || keepTTL {
+		var err error
+		current, err = s.lookup(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	var old []byte
+	if get && current != nil {
+		var err error
+		if old, err = s.value(ctx, current); err != nil {
+			return err
+		}
+	}
+
+	if (nx && current != nil) || (xx && current == nil) {
+		if get {
+			s.replyValue(current, old)
+		} else {
+			s.w.null()
+		}
+		return nil
+	}
+
+	if keepTTL && current != nil && current.ExpiresAt != 0 {
+		expiresAt = time.Unix(0, current.ExpiresAt)
+	}
+
+	if _, err := s.coord.SetExpiring(ctx, key, value, "", expiresAt); err != nil {
+		return err
+	}
+
+	if get {
+		s.replyValue(current, old)
+	} else {
+		s.w.simple("OK")
+	}
+	return nil
+}
+
+func (s *session) replyValue(record *storage.Record, value []byte) {
+	if record == nil {
+		s.w.null()
+	} else {
+		s.w.bulk(value)
+	}
+}
+
+// the time n seconds or milliseconds from now, or at n for EXAT and
+// PXAT; false when it does not fit in nanoseconds since the epoch, which
+// is how records keep it
+func expiryTime(unit string, n int64) (time.Time, bool) {
+	scale := int64(time.Second)
+	if unit == "PX" || unit == "PXAT" {
+		scale = int64(time.Millisecond)
+	}
+	if n > math.MaxInt64/scale || n < math.MinInt64/scale {
+		return time.Time{}, false
+	}
+
+	nanos := n * scale
+	if unit == "EX" || unit == "PX" {
+		now := time.Now().UnixNano()
+		if nanos > math.MaxInt64-now {
+			return time.Time{}, false
+		}
+		nanos += now
+	}
+	return time.Unix(0, nanos), true
+}
+
+func (s *session) del(ctx context.Context, args [][]byte) error {
+	var deleted int64
+	for _, key := range args[1:] {
+		record, err := s.lookup(ctx, string(key))
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			continue
+		}
+
+		if err := s.coord.Delete(ctx, string(key)); err != nil {
+			return err
+		}
+		deleted++
+	}
+
+	s.w.integer(deleted)
+	return nil
+}
+
+func (s *session) exists(ctx context.Context, args [][]byte) error {
+	var found int64
+	for _, key := range args[1:] {
+		record, err := s.lookup(ctx, string(key))
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			found++
+		}
+	}
+
+	s.w.integer(found)
+	return nil
+}
+
+func (s *session) mget(ctx context.Context, args [][]byte) error {
+	records := make([]*storage.Record, len(args)-1)
+	for i, key := range args[1:] {
+		record, err := s.lookup(ctx, string(key))
+		if err != nil {
+			return err
+		}
+		records[i] = record
+	}
+
+	s.w.array(len(records))
+	for _, record := range records {
+		if record == nil {
+			s.w.null()
+		} else if err := s.replyStream(ctx, record); err != nil {
+			// part of the array went out already
+			return fmt.Errorf("%w: %v", errReplyCut, err)
+		}
+	}
+	return nil
+}
+
+// MSET key value [key value ...], written as one batch
+func (s *session) mset(ctx context.Context, args [][]byte) error {
+	if len(args)%2 != 1 {
+		return errors.New("ERR wrong number of arguments for 'mset' command")
+	}
+
+	records := make([]*storage.Record, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		records = append(records, &storage.Record{Key: string(args[i]), Value: args[i+1]})
+	}
+
+	result, err := s.coord.Batch(ctx, records)
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		return coordinator.ErrQuorumNotReached
+	}
+
+	s.w.simple("OK")
+	return nil
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE string]. the literal
+// prefix of the pattern limits the scan, the rest filters the page, so
+// like redis a page may come back short or empty before the end
+func (s *session) scan(ctx context.Context, args [][]byte) error {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return errors.New("ERR invalid cursor")
+	}
+
+	pattern := "*"
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || n < 1 {
+				return errSyntax
+			}
+			count = min(n, maxScanCount)
+		case "TYPE":
+			// every value is a string
+			if !strings.EqualFold(string(args[i+1]), "string") {
+				s.w.array(2)
+				s.w.bulk([]byte("0"))
+				s.w.array(0)
+				return nil
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	var after string
+	if cursor != 0 {
+		var ok bool
+		if after, ok = s.cursors[cursor]; !ok {
+			return errors.New("ERR invalid cursor")
+		}
+	}
+
+	if err := s.authorize("scan", auth.AccessRead, literalPrefix(pattern)); err != nil {
+		return err
+	}
+
+	page, err := s.coord.Scan(ctx, literalPrefix(pattern), after, count)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, record := range page.Records {
+		if matchGlob(pattern, record.Key) {
+			keys = append(keys, record.Key)
+		}
+	}
+
+	var next uint64
+	if page.Next != "" {
+		next = s.saveCursor(page.Next)
+	}
+
+	s.w.array(2)
+	s.w.bulk([]byte(strconv.FormatUint(next, 10)))
+	s.w.array(len(keys))
+	for _, key := range keys {
+		s.w.bulk([]byte(key))
+	}
+	return nil
+}
+
+func (s *session) saveCursor(after string) uint64 {
+	if len(s.cursors) >= maxCursors {
+		delete(s.cursors, s.nextCursor-maxCursors+1)
+	}
+
+	s.nextCursor++
+	s.cursors[s.nextCursor] = after
+	return s.nextCursor
+}
+
+// EXPIRE key seconds and PEXPIRE key milliseconds; a time in the past
+// deletes the key
+func (s *session) expire(ctx context.Context, args [][]byte) error {
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+
+	unit := "EX"
+	if strings.EqualFold(string(args[0]), "pexpire") {
+		unit = "PX"
+	}
+	expiresAt, valid := expiryTime(unit, n)
+	if !valid {
+		return errBadExpire
+	}
+	if n <= 0 {
+		// the earliest representable expiry, already passed
+		expiresAt = time.Unix(0, 1)
+	}
+
+	ok, err := s.coord.Expire(ctx, string(args[1]), expiresAt)
+	if err != nil {
+		return err
+	}
+	s.w.integer(boolInt(ok))
+	return nil
+}
+
+func (s *session) persist(ctx context.Context, args [][]byte) error {
+	record, err := s.lookup(ctx, string(args[1]))
+	if err != nil {
+		return err
+	}
+	if record == nil || record.ExpiresAt == 0 {
+		s.w.integer(0)
+		return nil
+	}
+
+	ok, err := s.coord.Expire(ctx, string(args[1]), time.Time{})
+	if err != nil {
+		return err
+	}
+	s.w.integer(boolInt(ok))
+	return nil
+}
+
+// TTL and PTTL: -2 for a missing key, -1 for one without expiry
+func (s *session) ttl(ctx context.Context, args [][]byte) error {
+	record, err := s.lookup(ctx, string(args[1]))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case record == nil:
+		s.w.integer(-2)
+	case record.ExpiresAt == 0:
+		s.w.integer(-1)
+	default:
+		remaining := max(time.Until(time.Unix(0, record.ExpiresAt)), 0)
+		if strings.EqualFold(string(args[0]), "pttl") {
+			s.w.integer(remaining.Milliseconds())
+		} else {
+			s.w.integer(int64(remaining.Round(time.Second) / time.Second))
+		}
+	}
+	return nil
+}
+
+// INCR, DECR, INCRBY and DECRBY. a read followed by a write, so two
+// clients incrementing the same key at once can lose an increment
+func (s *session) incr(ctx context.Context, args [][]byte) error {
+	delta := int64(1)
+	if len(args) == 3 {
+		n, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil {
+			return errNotInteger
+		}
+		delta = n
+	}
+	if strings.HasPrefix(strings.ToLower(string(args[0])), "decr") {
+		if delta == math.MinInt64 {
+			return errOverflow
+		}
+		delta = -delta
+	}
+
+	key := string(args[1])
+	record, err := s.lookup(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	var current int64
+	var expiresAt time.Time
+	if record != nil {
+		value, err := s.value(ctx, record)
+		if err != nil {
+			return err
+		}
+		if current, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return errNotInteger
+		}
+		if record.ExpiresAt != 0 {
+			expiresAt = time.Unix(0, record.ExpiresAt)
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return errOverflow
+	}
+	current += delta
+
+	if _, err := s.coord.SetExpiring(ctx, key, []byte(strconv.FormatInt(current, 10)), "", expiresAt); err != nil {
+		return err
+	}
+
+	s.w.integer(current)
+	return nil
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
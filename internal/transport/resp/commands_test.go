@@ -0,0 +1,27 @@
+package resp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiryTime(t *testing.T) {
+	if _, ok := expiryTime("EX", 1<<62); ok {
+		t.Error("EX past the nanosecond range was accepted")
+	}
+	if _, ok := expiryTime("PX", 1<<62); ok {
+		t.Error("PX past the nanosecond range was accepted")
+	}
+	if _, ok := expiryTime("EX", 9223372036-60); ok {
+		t.Error("EX wrapping past the nanosecond range was accepted")
+	}
+	if at, ok := expiryTime("EXAT", 1700000000); !ok || at.Unix() != 1700000000 {
+		t.Errorf("EXAT = %v, %v", at, ok)
+	}
+	if at, ok := expiryTime("PXAT", 1700000000123); !ok || at.UnixMilli() != 1700000000123 {
+		t.Errorf("PXAT = %v, %v", at, ok)
+	}
+	if at, ok := expiryTime("EX", 60); !ok || time.Until(at) <= 59*time.Second {
+		t.Errorf("EX 60 = %v, %v", at, ok)
+	}
+}
@@ -0,0 +1,60 @@
+package resp
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users:1", false},
+		{"*:name", "user:1:name", true},
+		{"a**b", "ab", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"h[\\]]llo", "h]llo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hallo", false},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+		{"", "", true},
+		{"", "a", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"user:*", "user:"},
+		{"user:?", "user:"},
+		{"user:[ab]", "user:"},
+		{"a\\*b*", "a*b"},
+		{"plain", "plain"},
+		{"*", ""},
+	}
+
+	for _, tt := range tests {
+		if got := literalPrefix(tt.pattern); got != tt.want {
+			t.Errorf("literalPrefix(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package resp
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/hlc"
+	"github.com/AuraReaper/strangedb/internal/ring"
+	"github.com/AuraReaper/strangedb/internal/storage"
+	grpcTransport "github.com/AuraReaper/strangedb/internal/transport/grpc"
+	"github.com/rs/zerolog"
+)
+
+// a session on a one node cluster
+func testSession(t *testing.T) (*session, *bytes.Buffer) {
+	store := storage.NewBadgerStorage(t.TempDir())
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	const node = "localhost:0"
+	hashring := ring.New(10)
+	hashring.AddNode(node)
+	client := grpcTransport.NewClient(grpcTransport.ClientOptions{})
+	t.Cleanup(client.Close)
+	coord := coordinator.New(node, hashring, store, hlc.NewClock(node), client, 1, 1, 1, zerolog.Nop())
+
+	var out bytes.Buffer
+	return &session{
+		coord:   coord,
+		w:       newWriter(&out),
+		cursors: make(map[uint64]string),
+		authLog: zerolog.Nop(),
+	}, &out
+}
+
+func TestGetStreamsChunkedValue(t *testing.T) {
+	sess, out := testSession(t)
+	ctx := context.Background()
+
+	large := bytes.Repeat([]byte("0123456789"), coordinator.ChunkSize/4)
+	if _, err := sess.coord.SetLarge(ctx, "blob", bytes.NewReader(large), ""); err != nil {
+		t.Fatalf("SetLarge failed: %v", err)
+	}
+
+	bulk := "$" + strconv.Itoa(len(large)) + "\r\n" + string(large) + "\r\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"GET", "blob"}, bulk},
+		{[]string{"MGET", "missing", "blob"}, "*2\r\n$-1\r\n" + bulk},
+	}
+
+	for _, tt := range tests {
+		out.Reset()
+		args := make([][]byte, len(tt.args))
+		for i, arg := range tt.args {
+			args[i] = []byte(arg)
+		}
+		if quit := sess.dispatch(ctx, args); quit {
+			t.Fatalf("%s closed the connection", tt.args[0])
+		}
+		sess.w.flush()
+
+		if out.String() != tt.want {
+			t.Errorf("%s replied %d bytes, want %d", tt.args[0], out.Len(), len(tt.want))
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxArgs     = 1024 * 1024
+	maxBulkSize = 64 * 1024 * 1024
+	// all the arguments of one command together, so a client cannot make
+	// the server buffer maxArgs arguments of maxBulkSize each
+	maxCommandSize = 256 * 1024 * 1024
+	// also the longest line, so the longest inline command
+	maxInline = 64 * 1024
+)
+
+var (
+	errProtocol = errors.New("protocol error")
+	// a streamed reply failed after its header went out; the client
+	// cannot tell, so the connection is closed
+	errReplyCut = errors.New("reply cut short")
+)
+
+// reads commands, either RESP arrays of bulk strings as sent by clients
+// or inline commands typed into telnet
+type reader struct {
+	r              *bufio.Reader
+	maxCommandSize int
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{r: bufio.NewReaderSize(r, maxInline), maxCommandSize: maxCommandSize}
+}
+
+func (r *reader) readLine() (string, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("%w: line too long", errProtocol)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		var args [][]byte
+		for _, field := range strings.Fields(line) {
+			args = append(args, []byte(field))
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	// the length is only a claim; grow with what actually arrives
+	args := make([][]byte, 0, min(max(n, 0), 1024))
+	total := 0
+	for i := 0; i < n; i++ {
+		header, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header, "$") {
+			return nil, fmt.Errorf("%w: expected '$', got %q", errProtocol, header)
+		}
+
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+		// a few bytes for each argument too, so a million empty ones
+		// count against the limit
+		if total += size + 16; total > r.maxCommandSize {
+			return nil, fmt.Errorf("%w: command too large", errProtocol)
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, buf[:size])
+	}
+
+	return args, nil
+}
+
+// buffers replies; flushed once all pipelined commands read so far
+// have been answered
+type writer struct {
+	w *bufio.Writer
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{w: bufio.NewWriter(w)}
+}
+
+func (w *writer) simple(s string) {
+	w.w.WriteString("+" + s + "\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.w.WriteString("-" + strings.ReplaceAll(s, "\r\n", " ") + "\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(b []byte) {
+	w.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// a bulk string of size bytes read from r, as it is read
+func (w *writer) bulkFrom(r io.Reader, size int64) error {
+	w.w.WriteString("$" + strconv.FormatInt(size, 10) + "\r\n")
+	if _, err := io.CopyN(w.w, r, size); err != nil {
+		return fmt.Errorf("%w: %v", errReplyCut, err)
+	}
+	w.w.WriteString("\r\n")
+	return nil
+}
+
+func (w *writer) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (w *writer) flush() error {
+	return w.w.Flush()
+}
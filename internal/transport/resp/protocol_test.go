@@ -0,0 +1,144 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, input string) [][]string {
+	t.Helper()
+
+	r := newReader(strings.NewReader(input))
+	var commands [][]string
+	for {
+		args, err := r.readCommand()
+		if errors.Is(err, io.EOF) {
+			return commands
+		}
+		if err != nil {
+			t.Fatalf("readCommand(%q) failed: %v", input, err)
+		}
+		command := make([]string, len(args))
+		for i, arg := range args {
+			command[i] = string(arg)
+		}
+		commands = append(commands, command)
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]string
+	}{
+		{"multibulk", "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", [][]string{{"SET", "key", "value"}}},
+		{"binary value", "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n", [][]string{{"ECHO", "a\r\nb"}}},
+		{"empty bulk", "*2\r\n$4\r\nECHO\r\n$0\r\n\r\n", [][]string{{"ECHO", ""}}},
+		{"inline", "GET  key\r\n", [][]string{{"GET", "key"}}},
+		{"inline without carriage return", "PING\n", [][]string{{"PING"}}},
+		{"empty line", "\r\n", [][]string{nil}},
+		{"pipeline", "*1\r\n$4\r\nPING\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\n",
+			[][]string{{"PING"}, {"PING"}, {"GET", "k"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAll(t, tt.input)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d commands %q, want %q", len(got), got, tt.want)
+			}
+			for i := range got {
+				if strings.Join(got[i], " ") != strings.Join(tt.want[i], " ") || len(got[i]) != len(tt.want[i]) {
+					t.Errorf("command %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadCommandRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"bad multibulk length", "*x\r\n"},
+		{"too many arguments", "*2000000\r\n"},
+		{"missing bulk header", "*1\r\nPING\r\n"},
+		{"negative bulk length", "*1\r\n$-1\r\n"},
+		{"bulk too large", "*1\r\n$67108865\r\n"},
+		{"line too long", strings.Repeat("a", maxInline+1) + "\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newReader(strings.NewReader(tt.input)).readCommand()
+			if !errors.Is(err, errProtocol) {
+				t.Errorf("readCommand() error = %v, want a protocol error", err)
+			}
+		})
+	}
+}
+
+func TestReadCommandLimitsTotalSize(t *testing.T) {
+	r := newReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$100\r\n" + strings.Repeat("v", 100) + "\r\n"))
+	r.maxCommandSize = 64
+
+	if _, err := r.readCommand(); !errors.Is(err, errProtocol) {
+		t.Fatalf("readCommand() error = %v, want a protocol error", err)
+	}
+
+	// a claimed length is not allocated up front
+	r = newReader(strings.NewReader("*1048576\r\n$1\r\na\r\n"))
+	if _, err := r.readCommand(); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("readCommand() error = %v, want EOF", err)
+	}
+}
+
+func TestReadCommandTruncated(t *testing.T) {
+	_, err := newReader(strings.NewReader("*1\r\n$5\r\nab")).readCommand()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("readCommand() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+
+	w.simple("OK")
+	w.error("ERR bad\r\nthing")
+	w.integer(-3)
+	w.bulk([]byte("hi"))
+	w.null()
+	w.array(2)
+	if err := w.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "+OK\r\n-ERR bad thing\r\n:-3\r\n$2\r\nhi\r\n$-1\r\n*2\r\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriterBulkFrom(t *testing.T) {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+
+	if err := w.bulkFrom(strings.NewReader("hello"), 5); err != nil {
+		t.Fatal(err)
+	}
+	w.flush()
+	if buf.String() != "$5\r\nhello\r\n" {
+		t.Errorf("wrote %q", buf.String())
+	}
+
+	// a reader ending early cuts the reply
+	if err := w.bulkFrom(strings.NewReader("hel"), 5); !errors.Is(err, errReplyCut) {
+		t.Errorf("bulkFrom() of a short reader error = %v, want %v", err, errReplyCut)
+	}
+}
@@ -0,0 +1,203 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/audit"
+	"github.com/AuraReaper/strangedb/internal/auth"
+	"github.com/AuraReaper/strangedb/internal/coordinator"
+	"github.com/AuraReaper/strangedb/internal/transport/hangup"
+	"github.com/rs/zerolog"
+)
+
+// speaks the redis protocol, so redis clients and redis-cli can use the
+// cluster. every command goes through the coordinator
+type Server struct {
+	coordinator *coordinator.Coordinator
+	port        int
+	log         zerolog.Logger
+	// bounds each command, 0 for no limit
+	timeout time.Duration
+	// nil when connections need no AUTH
+	auth     *auth.Authenticator
+	auditLog *audit.Log
+	authLog  zerolog.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	// cancels the commands of each connection
+	conns  map[net.Conn]context.CancelFunc
+	closed bool
+	wg     sync.WaitGroup
+	nextID atomic.Int64
+}
+
+func NewServer(coord *coordinator.Coordinator, port int, log zerolog.Logger) *Server {
+	return &Server{
+		coordinator: coord,
+		port:        port,
+		log:         log,
+		authLog:     zerolog.Nop(),
+		conns:       make(map[net.Conn]context.CancelFunc),
+	}
+}
+
+// how long a command may take before it fails with TIMEOUT; redis
+// clients send no deadline of their own
+func (s *Server) SetCommandTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// makes connections AUTH with a token the http api would take before
+// any other command, and checks their keys against its roles. denied
+// commands are logged to log; nil lets every connection in
+func (s *Server) SetAuth(a *auth.Authenticator, log zerolog.Logger) {
+	s.auth = a
+	s.authLog = log
+}
+
+// records denied commands next to the writes
+func (s *Server) SetAuditLog(l *audit.Log) {
+	s.auditLog = l
+}
+
+// serves connections until Stop
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		s.mu.Lock()
+		s.conns[conn] = cancel
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(ctx, conn)
+	}
+}
+
+// closes the listener and every connection, cancelling their commands
+// and waiting for them to finish
+func (s *Server) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn, cancel := range s.conns {
+		cancel()
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serve(ctx context.Context, conn net.Conn) {
+	defer func() {
+		conn.Close()
+
+		s.mu.Lock()
+		s.conns[conn]()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	sess := &session{
+		id:      s.nextID.Add(1),
+		coord:   s.coordinator,
+		r:       newReader(conn),
+		w:       newWriter(conn),
+		cursors: make(map[uint64]string),
+
+		auth:     s.auth,
+		auditLog: s.auditLog,
+		authLog:  s.authLog,
+		remote:   remoteHost(conn),
+	}
+
+	for {
+		args, err := sess.r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				sess.w.error("ERR " + err.Error())
+				sess.w.flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.log.Debug().Err(err).Str("remote", conn.RemoteAddr().String()).Msg("resp connection closed")
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if quit := s.dispatch(ctx, conn, sess, args); quit {
+			sess.w.flush()
+			return
+		}
+
+		// answer a pipeline in one write
+		if sess.r.r.Buffered() == 0 {
+			if err := sess.w.flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// runs one command, bounded by the command timeout and cancelled if the
+// client hangs up meanwhile
+func (s *Server) dispatch(ctx context.Context, conn net.Conn, sess *session, args [][]byte) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if s.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, s.timeout)
+		defer cancelTimeout()
+	}
+
+	stop := hangup.Watch(conn, cancel)
+	defer stop()
+
+	return sess.dispatch(ctx, args)
+}
+
+func remoteHost(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,544 @@
+// Package client is a Go client for StrangeDB. It keeps its own copy of
+// the cluster's ring and sends every request straight to a replica of the
+// key over grpc, so the coordinating node already holds the data, and
+// falls back to the other replicas when a node fails.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrNotFound = errors.New("key not found")
+	ErrNoNodes  = errors.New("no nodes available")
+	ErrNoSeeds  = errors.New("at least one seed is required")
+)
+
+type Options struct {
+	// grpc addresses of some nodes of the cluster
+	Seeds []string
+	// how often the ring is fetched again, 30s by default
+	RefreshInterval time.Duration
+	// attempts per request, each on the next replica; 3 by default
+	Attempts int
+	// wait before the second attempt, doubled for every further one;
+	// 50ms by default
+	Backoff time.Duration
+	// per attempt, 5s by default
+	Timeout time.Duration
+	// for clusters serving TLS on their gRPC port; nil dials plaintext
+	TLS *tls.Config
+	// bearer token for clusters with auth, sent with every request
+	Token string
+}
+
+type Timestamp struct {
+	// nanoseconds since the epoch
+	WallTime int64
+	Logical  uint32
+	NodeID   string
+}
+
+// whether t orders after o: by wall time, then the logical counter,
+// then the node
+func (t Timestamp) after(o Timestamp) bool {
+	if t.WallTime != o.WallTime {
+		return t.WallTime > o.WallTime
+	}
+	if t.Logical != o.Logical {
+		return t.Logical > o.Logical
+	}
+	return t.NodeID > o.NodeID
+}
+
+type Record struct {
+	Key         string
+	Value       []byte
+	ContentType string
+	// set by the cluster; ignored when writing
+	Timestamp Timestamp
+}
+
+type ScanPage struct {
+	Records []Record
+	// pass back as after for the next page; empty once the scan is done
+	Next string
+}
+
+type BatchResult struct {
+	Written int
+	// keys none of whose replicas took the write
+	Failed []string
+}
+
+type Client struct {
+	opts Options
+
+	mu    sync.RWMutex
+	topo  *topology
+	conns map[string]*grpc.ClientConn
+
+	stopCh chan struct{}
+	once   sync.Once
+}
+
+// connects to the cluster and fetches its ring; fails when no seed answers
+func New(ctx context.Context, opts Options) (*Client, error) {
+	if len(opts.Seeds) == 0 {
+		return nil, ErrNoSeeds
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = 30 * time.Second
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 50 * time.Millisecond
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	c := &Client{
+		opts:   opts,
+		conns:  make(map[string]*grpc.ClientConn),
+		stopCh: make(chan struct{}),
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	go c.refreshLoop()
+
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	c.once.Do(func() { close(c.stopCh) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for addr, conn := range c.conns {
+		err = errors.Join(err, conn.Close())
+		delete(c.conns, addr)
+	}
+	return err
+}
+
+// nodes of the cluster as last seen
+func (c *Client) Nodes() []string {
+	if t := c.topology(); t != nil {
+		return t.nodes()
+	}
+	return nil
+}
+
+// the replicas a key is sent to, primary first
+func (c *Client) Replicas(key string) []string {
+	if t := c.topology(); t != nil {
+		return t.ring.GetReplicas(key, t.replication)
+	}
+	return nil
+}
+
+type consistencyKey struct{}
+
+// runs the requests made with ctx at the given consistency level: one,
+// quorum, local_quorum, each_quorum or all
+func WithConsistency(ctx context.Context, level string) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, level)
+}
+
+func consistencyFrom(ctx context.Context) string {
+	level, _ := ctx.Value(consistencyKey{}).(string)
+	return level
+}
+
+func (c *Client) Get(ctx context.Context, key string) (*Record, error) {
+	var resp *pb.KVGetResponse
+	err := c.do(ctx, c.keyTargets(key), true, func(ctx context.Context, kv pb.KVServiceClient, opts ...grpc.CallOption) error {
+		var err error
+		resp, err = kv.Get(ctx, &pb.KVGetRequest{
+			Key:         key,
+			Consistency: consistencyFrom(ctx),
+		}, opts...)
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := recordFromProto(resp.Record)
+	return &record, nil
+}
+
+func (c *Client) Set(ctx context.Context, key string, value []byte, contentType string) (Timestamp, error) {
+	var resp *pb.KVSetResponse
+	err := c.do(ctx, c.keyTargets(key), false, func(ctx context.Context, kv pb.KVServiceClient, opts ...grpc.CallOption) error {
+		var err error
+		resp, err = kv.Set(ctx, &pb.KVSetRequest{
+			Key:         key,
+			Value:       value,
+			ContentType: contentType,
+			Consistency: consistencyFrom(ctx),
+		}, opts...)
+		return err
+	})
+	if err != nil {
+		return Timestamp{}, err
+	}
+
+	return timestampFromProto(resp.Timestamp), nil
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, c.keyTargets(key), false, func(ctx context.Context, kv pb.KVServiceClient, opts ...grpc.CallOption) error {
+		_, err := kv.Delete(ctx, &pb.KVDeleteRequest{
+			Key:         key,
+			Consistency: consistencyFrom(ctx),
+		}, opts...)
+		return err
+	})
+}
+
+// one page of the keys starting with prefix, in key order, after the
+// key after; limit is at most 10000
+func (c *Client) Scan(ctx context.Context, prefix, after string, limit int) (*ScanPage, error) {
+	var resp *pb.KVScanResponse
+	err := c.do(ctx, c.anyTargets(), true, func(ctx context.Context, kv pb.KVServiceClient, opts ...grpc.CallOption) error {
+		var err error
+		resp, err = kv.Scan(ctx, &pb.KVScanRequest{
+			Prefix: prefix,
+			After:  after,
+			Limit:  uint32(limit),
+		}, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ScanPage{
+		Records: make([]Record, len(resp.Records)),
+		Next:    resp.Next,
+	}
+	for i, r := range resp.Records {
+		page.Records[i] = recordFromProto(r)
+	}
+
+	return page, nil
+}
+
+// writes many records. they are grouped by primary replica and each
+// group is sent to that node; a group that fails on every node it was
+// tried on ends up in Failed
+func (c *Client) Batch(ctx context.Context, records []Record) (*BatchResult, error) {
+	t := c.topology()
+	if t == nil {
+		return nil, ErrNoNodes
+	}
+
+	groups := make(map[string][]*pb.Record)
+	targets := make(map[string][]string)
+	for _, r := range records {
+		candidates := t.candidates(r.Key)
+		if len(candidates) == 0 {
+			return nil, ErrNoNodes
+		}
+		groups[candidates[0]] = append(groups[candidates[0]], recordToProto(r))
+		targets[candidates[0]] = candidates
+	}
+
+	result := &BatchResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for primary, group := range groups {
+		wg.Add(1)
+		go func(candidates []string, group []*pb.Record) {
+			defer wg.Done()
+
+			var resp *pb.KVBatchResponse
+			err := c.do(ctx, candidates, false, func(ctx context.Context, kv pb.KVServiceClient, opts ...grpc.CallOption) error {
+				var err error
+				resp, err = kv.Batch(ctx, &pb.KVBatchRequest{
+					Records:     group,
+					Consistency: consistencyFrom(ctx),
+				}, opts...)
+				return err
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				for _, r := range group {
+					result.Failed = append(result.Failed, r.Key)
+				}
+				return
+			}
+			result.Written += int(resp.Written)
+			result.Failed = append(result.Failed, resp.Failed...)
+		}(targets[primary], group)
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (c *Client) topology() *topology {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.topo
+}
+
+func (c *Client) keyTargets(key string) []string {
+	if t := c.topology(); t != nil {
+		return t.candidates(key)
+	}
+	return nil
+}
+
+// any node will do, so the load is spread over the cluster
+func (c *Client) anyTargets() []string {
+	t := c.topology()
+	if t == nil {
+		return nil
+	}
+
+	nodes := t.nodes()
+	alive := len(nodes) - len(t.down)
+	if alive < 2 {
+		return nodes
+	}
+
+	shift := rand.IntN(alive)
+	rotated := append(slices.Clone(nodes[shift:alive]), nodes[:shift]...)
+	return append(rotated, nodes[alive:]...)
+}
+
+// calls fn on the targets in turn until one succeeds, waiting a growing
+// backoff between attempts. only failures another node may not have are
+// retried: the node being unreachable, overloaded or out of time. writes
+// stamp a new timestamp each time, so one that may have been applied is
+// not sent again: a retry landing after another client's write would
+// undo it
+func (c *Client) do(ctx context.Context, targets []string, idempotent bool,
+	fn func(context.Context, pb.KVServiceClient, ...grpc.CallOption) error) error {
+	if len(targets) == 0 {
+		return ErrNoNodes
+	}
+
+	var err error
+	for attempt := 0; attempt < c.opts.Attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(ctx, attempt); err != nil {
+				return err
+			}
+		}
+
+		var kv pb.KVServiceClient
+		kv, err = c.service(targets[attempt%len(targets)])
+		if err != nil {
+			continue
+		}
+
+		// set once the call went out on a connection
+		var sent peer.Peer
+		attemptCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		err = fn(attemptCtx, kv, grpc.Peer(&sent))
+		cancel()
+
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if !idempotent && sent.Addr != nil && !refused(err) {
+			return err
+		}
+	}
+
+	// the ring may be out of date when every replica failed
+	go func() {
+		select {
+		case <-c.stopCh:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+		defer cancel()
+		c.Refresh(ctx)
+	}()
+
+	return err
+}
+
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	backoff := c.opts.Backoff * time.Duration(math.Pow(2, float64(attempt-1)))
+	// up to a quarter of jitter, so clients do not retry in step
+	backoff += time.Duration(rand.Int64N(int64(backoff)/4 + 1))
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// whether the node turned the call away before writing anything, by
+// the reason in the ErrorInfo of the KVService's errors
+func refused(err error) bool {
+	st, _ := status.FromError(err)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			switch info.Reason {
+			case "RATE_LIMITED", "OVERLOADED", "NO_NODES_AVAILABLE":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Client) service(addr string) (pb.KVServiceClient, error) {
+	c.mu.RLock()
+	conn, ok := c.conns[addr]
+	c.mu.RUnlock()
+
+	if ok {
+		return pb.NewKVServiceClient(conn), nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if conn, ok := c.conns[addr]; ok {
+		return pb.NewKVServiceClient(conn), nil
+	}
+
+	creds := insecure.NewCredentials()
+	if c.opts.TLS != nil {
+		creds = credentials.NewTLS(c.opts.TLS)
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		// large values come back whole
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)),
+	}
+	if c.opts.Token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(bearerToken(c.opts.Token)))
+	}
+
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.conns[addr] = conn
+	return pb.NewKVServiceClient(conn), nil
+}
+
+// closes connections to nodes that left the cluster, keeping the seeds
+func (c *Client) closeStale(t *topology) {
+	keep := make(map[string]bool)
+	for _, node := range t.ring.GetNodes() {
+		keep[node] = true
+	}
+	for _, seed := range c.opts.Seeds {
+		keep[seed] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for addr, conn := range c.conns {
+		if !keep[addr] {
+			conn.Close()
+			delete(c.conns, addr)
+		}
+	}
+}
+
+func timestampFromProto(ts *pb.Timestamp) Timestamp {
+	if ts == nil {
+		return Timestamp{}
+	}
+	return Timestamp{WallTime: ts.WallTime, Logical: ts.Logical, NodeID: ts.NodeId}
+}
+
+func recordFromProto(r *pb.Record) Record {
+	return Record{
+		Key:         r.Key,
+		Value:       r.Value,
+		ContentType: r.ContentType,
+		Timestamp:   timestampFromProto(r.Timestamp),
+	}
+}
+
+func recordToProto(r Record) *pb.Record {
+	return &pb.Record{
+		Key:         r.Key,
+		Value:       r.Value,
+		ContentType: r.ContentType,
+	}
+}
+
+func timestampToProto(ts Timestamp) *pb.Timestamp {
+	return &pb.Timestamp{WallTime: ts.WallTime, Logical: ts.Logical, NodeId: ts.NodeID}
+}
+
+// sends the token as the authorization metadata of every call
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// nodes without TLS on their grpc port are reached in plaintext too
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
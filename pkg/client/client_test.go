@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// a node of a fake cluster answering every read and write with err
+type fakeNode struct {
+	pb.UnimplementedKVServiceServer
+	topology *pb.TopologyResponse
+	err      error
+	calls    atomic.Int32
+}
+
+func (n *fakeNode) Topology(context.Context, *pb.TopologyRequest) (*pb.TopologyResponse, error) {
+	return n.topology, nil
+}
+
+func (n *fakeNode) Get(context.Context, *pb.KVGetRequest) (*pb.KVGetResponse, error) {
+	n.calls.Add(1)
+	return nil, n.err
+}
+
+func (n *fakeNode) Set(context.Context, *pb.KVSetRequest) (*pb.KVSetResponse, error) {
+	n.calls.Add(1)
+	if n.err != nil {
+		return nil, n.err
+	}
+	return &pb.KVSetResponse{}, nil
+}
+
+func reasonError(code codes.Code, reason string) error {
+	st, err := status.New(code, reason).WithDetails(&errdetails.ErrorInfo{Reason: reason})
+	if err != nil {
+		panic(err)
+	}
+	return st.Err()
+}
+
+// serves the nodes and connects a client to them. a nil node is listed
+// in the ring but not running
+func startFakeCluster(t *testing.T, nodes ...*fakeNode) *Client {
+	topology := &pb.TopologyResponse{Partitioner: "md5", Vnodes: 10, Replication: uint32(len(nodes))}
+	var seed string
+	for _, node := range nodes {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		topology.Nodes = append(topology.Nodes, &pb.NodeInfo{Addr: listener.Addr().String(), State: "alive"})
+
+		if node == nil {
+			listener.Close()
+			continue
+		}
+		node.topology = topology
+		seed = listener.Addr().String()
+
+		server := grpc.NewServer()
+		pb.RegisterKVServiceServer(server, node)
+		go server.Serve(listener)
+		t.Cleanup(server.Stop)
+	}
+
+	c, err := New(context.Background(), Options{Seeds: []string{seed}, Backoff: time.Millisecond, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func totalCalls(nodes ...*fakeNode) int32 {
+	var total int32
+	for _, node := range nodes {
+		total += node.calls.Load()
+	}
+	return total
+}
+
+func TestWritesThatMayHaveAppliedAreNotRetried(t *testing.T) {
+	partial := reasonError(codes.Unavailable, "QUORUM_NOT_REACHED")
+	a, b := &fakeNode{err: partial}, &fakeNode{err: partial}
+	c := startFakeCluster(t, a, b)
+	ctx := context.Background()
+
+	if _, err := c.Set(ctx, "k", []byte("v"), ""); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Set error = %v, want Unavailable", err)
+	}
+	if calls := totalCalls(a, b); calls != 1 {
+		t.Errorf("Set was sent %d times, want once", calls)
+	}
+
+	// reads are retried on the other replica
+	c.Get(ctx, "k")
+	if calls := totalCalls(a, b); calls != 4 {
+		t.Errorf("Get was sent %d times, want 3", calls-1)
+	}
+}
+
+func TestRefusedWritesAreRetried(t *testing.T) {
+	overloaded := reasonError(codes.Unavailable, "OVERLOADED")
+	a, b := &fakeNode{err: overloaded}, &fakeNode{err: overloaded}
+	c := startFakeCluster(t, a, b)
+
+	if _, err := c.Set(context.Background(), "k", []byte("v"), ""); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Set error = %v, want Unavailable", err)
+	}
+	if calls := totalCalls(a, b); calls != 3 {
+		t.Errorf("Set was sent %d times, want 3", calls)
+	}
+}
+
+func TestWritesToUnreachableNodesAreRetried(t *testing.T) {
+	live := &fakeNode{}
+	c := startFakeCluster(t, nil, live)
+	down := live.topology.Nodes[0].Addr
+
+	// a key whose primary is the node that is not running
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("k%d", i); c.keyTargets(k)[0] == down {
+			key = k
+		}
+	}
+
+	if _, err := c.Set(context.Background(), key, []byte("v"), ""); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if calls := live.calls.Load(); calls != 1 {
+		t.Errorf("the live node got %d calls, want 1", calls)
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/AuraReaper/strangedb/internal/ring"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+)
+
+// the client's copy of the cluster layout
+type topology struct {
+	ring        *ring.ConsistentHashRing
+	replication int
+	// nodes gossip does not consider alive, tried last
+	down map[string]bool
+}
+
+// places the nodes exactly like the cluster does, so keys map to the
+// same replicas
+func buildTopology(resp *pb.TopologyResponse) (*topology, error) {
+	partitioner, err := ring.ParsePartitioner(resp.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+
+	hashring := ring.New(int(resp.Vnodes))
+	hashring.SetPartitioner(partitioner)
+
+	t := &topology{
+		ring:        hashring,
+		replication: int(resp.Replication),
+		down:        make(map[string]bool),
+	}
+
+	for _, node := range resp.Nodes {
+		hashring.SetWeight(node.Addr, node.Weight)
+		hashring.SetTopology(node.Addr, ring.Topology{DC: node.Dc, Rack: node.Rack})
+		hashring.AddNode(node.Addr)
+
+		if node.State != "alive" {
+			t.down[node.Addr] = true
+		}
+	}
+
+	if len(resp.DcReplication) > 0 {
+		factors := make(map[string]int, len(resp.DcReplication))
+		for dc, n := range resp.DcReplication {
+			factors[dc] = int(n)
+		}
+		hashring.SetDCReplication(factors)
+	}
+
+	return t, nil
+}
+
+// the replicas of key, primary first and nodes believed down last
+func (t *topology) candidates(key string) []string {
+	replicas := t.ring.GetReplicas(key, t.replication)
+	slices.SortStableFunc(replicas, func(a, b string) int {
+		return boolCmp(t.down[a], t.down[b])
+	})
+	return replicas
+}
+
+// every node, nodes believed down last
+func (t *topology) nodes() []string {
+	nodes := t.ring.GetNodes()
+	slices.Sort(nodes)
+	slices.SortStableFunc(nodes, func(a, b string) int {
+		return boolCmp(t.down[a], t.down[b])
+	})
+	return nodes
+}
+
+func boolCmp(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// asks the known nodes, then the seeds, for the layout until one answers
+func (c *Client) Refresh(ctx context.Context) error {
+	addrs := slices.Clone(c.opts.Seeds)
+	if t := c.topology(); t != nil {
+		addrs = append(t.nodes(), addrs...)
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		kv, err := c.service(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		resp, err := kv.Topology(attemptCtx, &pb.TopologyRequest{})
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(resp.Nodes) == 0 {
+			lastErr = ErrNoNodes
+			continue
+		}
+
+		t, err := buildTopology(resp)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.topo = t
+		c.mu.Unlock()
+
+		c.closeStale(t)
+		return nil
+	}
+
+	return fmt.Errorf("refresh topology: %w", lastErr)
+}
+
+func (c *Client) refreshLoop() {
+	ticker := time.NewTicker(c.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+			c.Refresh(ctx)
+			cancel()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
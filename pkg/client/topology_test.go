@@ -0,0 +1,70 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/AuraReaper/strangedb/internal/ring"
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+)
+
+func TestTopologyMatchesClusterRing(t *testing.T) {
+	cluster := ring.New(50)
+	cluster.SetPartitioner(ring.Murmur3Partitioner{})
+
+	resp := &pb.TopologyResponse{Partitioner: "murmur3", Vnodes: 50, Replication: 2}
+	for i := 1; i <= 4; i++ {
+		addr := fmt.Sprintf("node%d:9001", i)
+		weight := float64(i%2 + 1)
+
+		cluster.SetWeight(addr, weight)
+		cluster.SetTopology(addr, ring.Topology{DC: "dc1", Rack: fmt.Sprintf("rack%d", i%2)})
+		cluster.AddNode(addr)
+
+		resp.Nodes = append(resp.Nodes, &pb.NodeInfo{
+			Addr:   addr,
+			Dc:     "dc1",
+			Rack:   fmt.Sprintf("rack%d", i%2),
+			Weight: weight,
+			State:  "alive",
+		})
+	}
+
+	topo, err := buildTopology(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if got, want := topo.candidates(key), cluster.GetReplicas(key, 2); !slices.Equal(got, want) {
+			t.Fatalf("%s: client routes to %v, cluster places it on %v", key, got, want)
+		}
+	}
+}
+
+func TestTopologyTriesDownNodesLast(t *testing.T) {
+	resp := &pb.TopologyResponse{Partitioner: "md5", Vnodes: 50, Replication: 3}
+	for i := 1; i <= 3; i++ {
+		state := "alive"
+		if i == 1 {
+			state = "suspect"
+		}
+		resp.Nodes = append(resp.Nodes, &pb.NodeInfo{Addr: fmt.Sprintf("node%d:9001", i), Weight: 1, State: state})
+	}
+
+	topo, err := buildTopology(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if candidates := topo.candidates(fmt.Sprintf("key-%d", i)); candidates[2] != "node1:9001" {
+			t.Fatalf("expected the suspect node last, got %v", candidates)
+		}
+	}
+	if nodes := topo.nodes(); nodes[2] != "node1:9001" {
+		t.Errorf("expected the suspect node last, got %v", nodes)
+	}
+}
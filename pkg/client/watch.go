@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+)
+
+var ErrWatchTarget = errors.New("watch needs either a key or a prefix")
+
+// a Key watch follows a single key, a Prefix watch every key under it
+type WatchOptions struct {
+	Key    string
+	Prefix string
+	// only writes after this one are delivered
+	Since Timestamp
+}
+
+type Event struct {
+	Record
+	Deleted bool
+	// the value is stored in chunks and left out; read it with Get
+	Large bool
+}
+
+type Watcher struct {
+	events chan Event
+
+	mu  sync.Mutex
+	err error
+}
+
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// why the events channel was closed; nil when the context ended
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// streams writes until ctx ends. a broken stream is opened again on the
+// next node, resuming where it broke off; errors retrying
+// cannot fix close the watcher
+func (c *Client) Watch(ctx context.Context, opts WatchOptions) (*Watcher, error) {
+	if (opts.Key == "") == (opts.Prefix == "") {
+		return nil, ErrWatchTarget
+	}
+
+	w := &Watcher{events: make(chan Event)}
+	go c.follow(ctx, opts, w)
+
+	return w, nil
+}
+
+func (c *Client) follow(ctx context.Context, opts WatchOptions, w *Watcher) {
+	defer close(w.events)
+
+	since := opts.Since
+	backoff := c.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		progressed, err := c.streamOnce(ctx, opts, &since, attempt, w.events)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != io.EOF && err != ErrNoNodes && !retryable(err) {
+			w.mu.Lock()
+			w.err = err
+			w.mu.Unlock()
+			return
+		}
+
+		if progressed {
+			backoff = c.opts.Backoff
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
+
+// follows one node until its stream breaks, moving since along
+func (c *Client) streamOnce(ctx context.Context, opts WatchOptions, since *Timestamp, attempt int, out chan<- Event) (bool, error) {
+	targets := c.keyTargets(opts.Key)
+	if opts.Key == "" {
+		targets = c.anyTargets()
+	}
+	if len(targets) == 0 {
+		return false, ErrNoNodes
+	}
+
+	kv, err := c.service(targets[attempt%len(targets)])
+	if err != nil {
+		return false, err
+	}
+
+	stream, err := kv.Watch(ctx, &pb.WatchRequest{
+		Key:          opts.Key,
+		Prefix:       opts.Prefix,
+		Since:        timestampToProto(*since),
+		MarkReplayed: true,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// writes before since come in key order, so the newest one delivered
+	// is only a safe place to resume once they all came
+	newest := *since
+	replayed := false
+	progressed := false
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return progressed, err
+		}
+
+		if msg.Replayed {
+			replayed = true
+			*since = newest
+			continue
+		}
+
+		event := Event{
+			Record:  recordFromProto(msg.Record),
+			Deleted: msg.Record.Tombstone,
+			Large:   msg.Record.Manifest,
+		}
+		if event.Large {
+			event.Value = nil
+		}
+
+		select {
+		case out <- event:
+		case <-ctx.Done():
+			return progressed, ctx.Err()
+		}
+
+		if event.Timestamp.after(newest) {
+			newest = event.Timestamp
+		}
+		if replayed {
+			*since = newest
+		}
+		progressed = true
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/AuraReaper/strangedb/internal/transport/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sends a backlog that is newest first in key order, breaking the first
+// stream after one record
+func (n *fakeNode) Watch(req *pb.WatchRequest, stream pb.KVService_WatchServer) error {
+	first := n.calls.Add(1) == 1
+	since := req.Since.GetWallTime()
+
+	backlog := []*pb.Record{
+		{Key: "k:a", Timestamp: &pb.Timestamp{WallTime: 300}},
+		{Key: "k:b", Timestamp: &pb.Timestamp{WallTime: 100}},
+	}
+	for i, record := range backlog {
+		if first && i == 1 {
+			return status.Error(codes.Unavailable, "connection reset")
+		}
+		if record.Timestamp.WallTime > since {
+			if err := stream.Send(&pb.WatchEvent{Record: record}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if req.MarkReplayed {
+		if err := stream.Send(&pb.WatchEvent{Replayed: true}); err != nil {
+			return err
+		}
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func TestWatchResumesMidBacklog(t *testing.T) {
+	node := &fakeNode{}
+	c := startFakeCluster(t, node)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w, err := c.Watch(ctx, WatchOptions{Prefix: "k:"})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for !seen["k:b"] {
+		select {
+		case event, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("watch ended with %v: %v", seen, w.Err())
+			}
+			seen[event.Key] = true
+		case <-ctx.Done():
+			t.Fatalf("watch delivered %v, the write older than the break was lost", seen)
+		}
+	}
+}
@@ -53,7 +53,7 @@ echo "  Node 2: HTTP=localhost:9010, gRPC=localhost:9011"
 echo "  Node 3: HTTP=localhost:9020, gRPC=localhost:9021"
 echo ""
 echo "Test with:"
-echo "  curl -X POST http://localhost:9000/api/v1/kv -d '{\"key\":\"test\",\"value\":\"aGVsbG8=\"}'"
+echo "  curl -X POST http://localhost:9000/api/v1/kv -d '{\"key\":\"test\",\"value\":\"aGVsbG8=\",\"encoding\":\"base64\"}'"
 echo "  curl http://localhost:9010/api/v1/kv/test  # Should work from any node!"
 echo ""
 echo "Logs: tail -f logs/node1.log"